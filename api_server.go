@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"loris-tunnel/internal/biz"
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/journal"
+	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/restapi"
+)
+
+// GetAPISettings returns the local REST API settings, including the bearer
+// token scripts must send.
+func (a *App) GetAPISettings() (model.APISettings, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.APISettings{}, err
+	}
+	cfg, err := a.storage.Load()
+	if err != nil {
+		return model.APISettings{}, err
+	}
+	dir := a.apiTokenDir()
+	token, err := restapi.LoadToken(dir)
+	if err != nil {
+		return model.APISettings{}, err
+	}
+
+	a.apiMu.Lock()
+	defer a.apiMu.Unlock()
+	settings := model.APISettings{
+		Enabled:   cfg.APIEnabled,
+		Port:      apiPort(cfg),
+		Token:     token,
+		TokenPath: filepath.Join(dir, restapi.TokenFileName),
+		Error:     a.apiErr,
+	}
+	if a.api != nil {
+		settings.Address = a.api.Addr()
+	}
+	return settings, nil
+}
+
+// SetAPISettings turns the REST API on or off and moves it to port
+// (0 keeps the default).
+func (a *App) SetAPISettings(enabled bool, port int) (model.APISettings, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.APISettings{}, err
+	}
+	if port < 0 || port > 65535 {
+		return model.APISettings{}, fmt.Errorf("port must be between 1 and 65535")
+	}
+	_, err := a.storage.Update(func(cfg *conf.Config) error {
+		cfg.APIEnabled = enabled
+		cfg.APIPort = port
+		return nil
+	})
+	if err != nil {
+		return model.APISettings{}, err
+	}
+	a.syncAPIServer()
+	return a.GetAPISettings()
+}
+
+// RegenerateAPIToken replaces the API token; clients using the old one are
+// rejected from then on.
+func (a *App) RegenerateAPIToken() (model.APISettings, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.APISettings{}, err
+	}
+	token, err := restapi.RegenerateToken(a.apiTokenDir())
+	if err != nil {
+		return model.APISettings{}, err
+	}
+	a.apiMu.Lock()
+	if a.api != nil {
+		a.api.SetToken(token)
+	}
+	a.apiMu.Unlock()
+	slog.Info("api token regenerated")
+	return a.GetAPISettings()
+}
+
+// syncAPIServer starts, restarts or stops the REST API to match the config.
+func (a *App) syncAPIServer() {
+	cfg, err := a.storage.Load()
+	if err != nil {
+		return
+	}
+	a.apiMu.Lock()
+	defer a.apiMu.Unlock()
+	if a.api != nil {
+		_ = a.api.Close()
+		a.api = nil
+	}
+	a.apiErr = ""
+	if !cfg.APIEnabled {
+		return
+	}
+
+	token, err := restapi.LoadToken(a.apiTokenDir())
+	if err != nil {
+		a.apiErr = err.Error()
+		slog.Error("api server token failed", "err", err)
+		return
+	}
+	server := restapi.New(restapi.Backend{
+		Tunnels:    func() *biz.TunnelBiz { return a.tunnel },
+		Jumpers:    func() *biz.JumperBiz { return a.jumper },
+		Groups:     func() *biz.GroupBiz { return a.group },
+		Journal:    func() *journal.Journal { return a.journal },
+		StartLimit: a.tunnelStartLimit,
+	}, token)
+	if err := server.Start(apiPort(cfg)); err != nil {
+		a.apiErr = err.Error()
+		slog.Error("api server start failed", "err", err)
+		return
+	}
+	a.api = server
+}
+
+func (a *App) stopAPIServer() {
+	a.apiMu.Lock()
+	defer a.apiMu.Unlock()
+	if a.api != nil {
+		_ = a.api.Close()
+		a.api = nil
+	}
+}
+
+func (a *App) apiTokenDir() string {
+	return filepath.Dir(a.storage.Path())
+}
+
+func apiPort(cfg *conf.Config) int {
+	if cfg.APIPort > 0 {
+		return cfg.APIPort
+	}
+	return restapi.DefaultPort
+}
@@ -21,10 +21,16 @@ import (
 	"loris-tunnel/internal/biz"
 	"loris-tunnel/internal/conf"
 	"loris-tunnel/internal/device"
+	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/journal"
 	"loris-tunnel/internal/license"
+	"loris-tunnel/internal/metrics"
 	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/netproxy"
+	"loris-tunnel/internal/netwatch"
+	"loris-tunnel/internal/notify"
+	"loris-tunnel/internal/restapi"
 	"loris-tunnel/internal/sshconfig"
-	"loris-tunnel/internal/traytext"
 	"loris-tunnel/internal/uilocale"
 	"loris-tunnel/internal/updater"
 
@@ -50,30 +56,65 @@ type OpenReportEmailResult struct {
 
 // App struct
 type App struct {
-	ctx       context.Context
-	storage   *conf.Storage
-	jumper    *biz.JumperBiz
-	group     *biz.GroupBiz
-	tunnel    *biz.TunnelBiz
-	updater   *updater.Service
-	license   *license.Client
-	aiDebug   *aidebug.Service
-	machineID string
-	initErr   error
-
-	trayMu   sync.Mutex
-	trayShow *systray.MenuItem
-	trayQuit *systray.MenuItem
+	ctx          context.Context
+	storage      *conf.Storage
+	jumper       *biz.JumperBiz
+	group        *biz.GroupBiz
+	profile      *biz.ProfileBiz
+	tunnel       *biz.TunnelBiz
+	notification *biz.NotificationBiz
+	updater      *updater.Service
+	license      *license.Client
+	aiDebug      *aidebug.Service
+	machineID    string
+	initErr      error
+
+	trayMu      sync.Mutex
+	trayLocale  string
+	trayIcons   trayIcons
+	trayFailed  bool
+	trayShape   string
+	trayOnShow  func()
+	trayOnQuit  func()
+	trayShow    *systray.MenuItem
+	trayQuit    *systray.MenuItem
+	trayEmpty   *systray.MenuItem
+	trayGroups  []*systray.MenuItem
+	trayTunnels map[int]*systray.MenuItem
+	trayCancel  func()
 
 	allowClose atomic.Bool
 
 	usageReporterStop chan struct{}
 	usageReporterWG   sync.WaitGroup
 
-	trafficMu         sync.Mutex
-	lastTrafficUp     uint64
-	lastTrafficDown   uint64
-	lastTrafficAt     time.Time
+	netWatch *netwatch.Watcher
+
+	journal *journal.Journal
+
+	bus       *biz.Bus
+	busCancel func()
+
+	apiMu  sync.Mutex
+	api    *restapi.Server
+	apiErr string
+
+	metricsMu  sync.Mutex
+	metrics    *metrics.Server
+	metricsErr string
+
+	notifyMu     sync.Mutex
+	notifier     *notify.Notifier
+	notifyCancel func()
+
+	authPromptMu        sync.Mutex
+	authPrompts         map[string]chan authPromptReply
+	authPromptListening bool
+
+	trafficMu       sync.Mutex
+	lastTrafficUp   uint64
+	lastTrafficDown uint64
+	lastTrafficAt   time.Time
 }
 
 // NewApp creates a new App application struct
@@ -88,18 +129,30 @@ func NewApp() *App {
 	}
 	slog.Info("app initialized", "config", storage.Path())
 
+	events, err := journal.Open(filepath.Dir(storage.Path()))
+	if err != nil {
+		slog.Error("event journal unavailable", "err", err)
+	}
+
 	licenseClient := license.NewDefaultClient()
 	machineID := device.MachineID()
-	return &App{
-		storage:   storage,
-		jumper:    biz.NewJumperBiz(storage),
-		group:     biz.NewGroupBiz(storage),
-		tunnel:    biz.NewTunnelBiz(storage),
-		updater:   newUpdaterService(),
-		license:   licenseClient,
-		aiDebug:   aidebug.NewService(licenseClient.BaseURL(), machineID),
-		machineID: machineID,
-	}
+	app := &App{
+		storage:      storage,
+		jumper:       biz.NewJumperBiz(storage),
+		group:        biz.NewGroupBiz(storage),
+		profile:      biz.NewProfileBiz(storage),
+		tunnel:       biz.NewTunnelBiz(storage),
+		notification: biz.NewNotificationBiz(storage),
+		journal:      events,
+		bus:          biz.NewBus(),
+		updater:      newUpdaterService(),
+		license:      licenseClient,
+		aiDebug:      aidebug.NewService(licenseClient.BaseURL(), machineID),
+		machineID:    machineID,
+	}
+	app.attachJournal()
+	app.attachBus()
+	return app
 }
 
 func newUpdaterService() *updater.Service {
@@ -168,28 +221,9 @@ func configureLogger(configPath string, level slog.Level) error {
 
 // startup is called when the app starts. The context is saved
 // so we can call the runtime methods
-// SetTrayMenuItems wires systray menu entries created in main so locale changes can relabel them.
-func (a *App) SetTrayMenuItems(show, quit *systray.MenuItem) {
-	a.trayMu.Lock()
-	defer a.trayMu.Unlock()
-	a.trayShow = show
-	a.trayQuit = quit
-}
-
 func (a *App) applyTrayLocaleUnlocked(tag string) {
-	s := traytext.ForLocale(tag)
-	if a.trayShow != nil {
-		a.trayShow.SetTitle(s.ShowMainTitle)
-		a.trayShow.SetTooltip(s.ShowMainTooltip)
-	}
-	if a.trayQuit != nil {
-		a.trayQuit.SetTitle(s.QuitTitle)
-		a.trayQuit.SetTooltip(s.QuitTooltip)
-	}
-	if runtime.GOOS != "darwin" {
-		systray.SetTitle(s.AppTitle)
-	}
-	systray.SetTooltip(s.IconTooltip)
+	a.trayLocale = tag
+	a.refreshTrayUnlocked()
 }
 
 // ApplyTrayLocale updates tray icon tooltip and menu item titles to match a vue-i18n locale tag.
@@ -229,6 +263,7 @@ func (a *App) startup(ctx context.Context) {
 	a.aiDebug = aidebug.NewService(a.license.BaseURL(), a.machineID)
 	slog.Info("license client initialized", "build_type", buildType, "api_base_url", a.license.BaseURL())
 	slog.Info("app startup")
+	forward.SetChallengePrompter(a.promptKeyboardInteractive)
 	if err := a.ensureReady(); err == nil {
 		a.syncAutoRunWithConfig()
 		go func() {
@@ -236,8 +271,16 @@ func (a *App) startup(ctx context.Context) {
 			if err := a.tunnel.StartAutoStart(limit); err != nil {
 				slog.Error("auto start tunnel failed", "err", err)
 			}
+			a.tunnel.StartScheduler(a.tunnelStartLimit)
 		}()
+		a.startEventBridge()
+		a.startTrayUpdates()
+		a.tunnel.StartTrafficTicks()
 		a.startUsageReporter()
+		a.startNetWatch()
+		a.syncAPIServer()
+		a.syncMetricsServer()
+		a.startNotifier()
 	}
 }
 
@@ -262,9 +305,34 @@ func (a *App) shutdown(ctx context.Context) {
 	_ = ctx
 	slog.Info("app shutdown")
 	a.stopUsageReporter()
+	if a.netWatch != nil {
+		a.netWatch.Stop()
+	}
+	a.stopAPIServer()
+	a.stopMetricsServer()
+	a.stopNotifier()
+	if a.busCancel != nil {
+		a.busCancel()
+	}
+	if a.trayCancel != nil {
+		a.trayCancel()
+	}
 	if a.tunnel != nil {
 		a.tunnel.Shutdown()
 	}
+	_ = a.journal.Close()
+}
+
+// startNetWatch probes running tunnels as soon as the network changes or the
+// machine wakes up, so dead connections reconnect without waiting for the
+// keepalive to time out.
+func (a *App) startNetWatch() {
+	a.netWatch = netwatch.New(netwatch.DefaultInterval, func(change netwatch.Change) {
+		if tunnel := a.tunnel; tunnel != nil {
+			tunnel.ProbeAll(change.Reason, change.Detail)
+		}
+	})
+	a.netWatch.Start()
 }
 
 func (a *App) startUsageReporter() {
@@ -327,7 +395,7 @@ func (a *App) ensureReady() error {
 	if a.initErr != nil {
 		return a.initErr
 	}
-	if a.storage == nil || a.jumper == nil || a.group == nil || a.tunnel == nil {
+	if a.storage == nil || a.jumper == nil || a.group == nil || a.profile == nil || a.tunnel == nil || a.notification == nil {
 		return fmt.Errorf("app is not initialized")
 	}
 	return nil
@@ -354,10 +422,20 @@ func (a *App) GetState() (model.State, error) {
 	if err != nil {
 		return model.State{}, err
 	}
+	profiles, err := a.profile.List()
+	if err != nil {
+		return model.State{}, err
+	}
+	activeProfileID, err := a.profile.ActiveID()
+	if err != nil {
+		return model.State{}, err
+	}
 	return model.State{
-		Jumpers: append([]model.Jumper{}, jumpers...),
-		Groups:  append([]model.TunnelGroup{}, groups...),
-		Tunnels: append([]model.Tunnel{}, tunnels...),
+		Jumpers:         append([]model.Jumper{}, jumpers...),
+		Groups:          append([]model.TunnelGroup{}, groups...),
+		Tunnels:         append([]model.Tunnel{}, tunnels...),
+		Profiles:        append([]model.TunnelProfile{}, profiles...),
+		ActiveProfileID: activeProfileID,
 	}, nil
 }
 
@@ -439,6 +517,73 @@ func (a *App) TestJumperConnection(payload model.JumperPayload) error {
 	return a.jumper.TestConnection(payload)
 }
 
+func (a *App) CheckJumperHostKey(payload model.JumperPayload) (model.HostKeyCheckResult, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	return a.jumper.CheckHostKey(payload)
+}
+
+func (a *App) TrustJumperHostKey(payload model.JumperPayload, fingerprint string) (model.HostKeyCheckResult, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	return a.jumper.TrustHostKey(payload, fingerprint)
+}
+
+func (a *App) ListKnownHosts() ([]model.KnownHostEntry, error) {
+	if err := a.ensureReady(); err != nil {
+		return nil, err
+	}
+	return a.jumper.ListKnownHosts()
+}
+
+func (a *App) RemoveKnownHost(path string, line int, fingerprint string) error {
+	if err := a.ensureReady(); err != nil {
+		return err
+	}
+	return a.jumper.RemoveKnownHost(path, line, fingerprint)
+}
+
+func (a *App) ReplaceKnownHost(jumperID int, line int, fingerprint, newFingerprint string) (model.HostKeyCheckResult, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	return a.jumper.ReplaceKnownHost(jumperID, line, fingerprint, newFingerprint)
+}
+
+func (a *App) FetchJumperHostKey(id int) (model.HostKeyCheckResult, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	return a.jumper.FetchHostKey(id)
+}
+
+func (a *App) ListSSHKeys() ([]model.SSHKey, error) {
+	if err := a.ensureReady(); err != nil {
+		return nil, err
+	}
+	return a.jumper.ListKeys()
+}
+
+func (a *App) GenerateSSHKey(payload model.SSHKeyGeneratePayload) (model.SSHKey, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.SSHKey{}, err
+	}
+	return a.jumper.GenerateKey(payload)
+}
+
+func (a *App) InstallSSHKey(jumperID int, keyName string, passphrase string) (model.SSHKeyInstallResult, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.SSHKeyInstallResult{}, err
+	}
+	return a.jumper.InstallKey(jumperID, keyName, passphrase)
+}
+
+func (a *App) ListAgentForwardEvents() []model.AgentForwardEvent {
+	return forward.AgentForwardEvents()
+}
+
 func (a *App) DeleteJumper(id int) error {
 	if err := a.ensureReady(); err != nil {
 		return err
@@ -488,6 +633,41 @@ func (a *App) ReorderGroups(ids []int) error {
 	return a.group.Reorder(ids)
 }
 
+func (a *App) ListProfiles() ([]model.TunnelProfile, error) {
+	if err := a.ensureReady(); err != nil {
+		return nil, err
+	}
+	return a.profile.List()
+}
+
+func (a *App) CreateProfile(payload model.TunnelProfilePayload) (model.TunnelProfile, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.TunnelProfile{}, err
+	}
+	return a.profile.Create(payload)
+}
+
+func (a *App) UpdateProfile(id int, payload model.TunnelProfilePayload) (model.TunnelProfile, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.TunnelProfile{}, err
+	}
+	return a.profile.Update(id, payload)
+}
+
+func (a *App) DeleteProfile(id int) error {
+	if err := a.ensureReady(); err != nil {
+		return err
+	}
+	return a.profile.Delete(id)
+}
+
+func (a *App) ActivateProfile(id int) (model.ProfileActivation, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.ProfileActivation{}, err
+	}
+	return a.tunnel.ActivateProfile(id, a.tunnelStartLimit())
+}
+
 func (a *App) CreateTunnel(payload model.TunnelPayload) (model.Tunnel, error) {
 	if err := a.ensureReady(); err != nil {
 		return model.Tunnel{}, err
@@ -513,12 +693,13 @@ func (a *App) TestTunnelConnection(payload model.TunnelPayload, inlineJumper *mo
 	if err := a.ensureReady(); err != nil {
 		return model.TunnelConnectionTestResult{}, err
 	}
-	latency, err := a.tunnel.TestConnection(payload, inlineJumper)
+	latency, algorithms, err := a.tunnel.TestConnection(payload, inlineJumper)
 	if err != nil {
 		return model.TunnelConnectionTestResult{}, err
 	}
 	return model.TunnelConnectionTestResult{
-		LatencyMs: latency.Milliseconds(),
+		LatencyMs:  latency.Milliseconds(),
+		Algorithms: algorithms,
 	}, nil
 }
 
@@ -529,6 +710,10 @@ func (a *App) DebugJumperFailure(payload model.JumperPayload, rawError string, u
 	if a.aiDebug == nil {
 		return model.AIDebugResult{}, fmt.Errorf("ai debug service is not initialized")
 	}
+	cfg, err := a.storage.Load()
+	if err != nil {
+		return model.AIDebugResult{}, err
+	}
 
 	jumper := model.Jumper{
 		Name:                   strings.TrimSpace(payload.Name),
@@ -536,12 +721,26 @@ func (a *App) DebugJumperFailure(payload model.JumperPayload, rawError string, u
 		Port:                   payload.Port,
 		User:                   strings.TrimSpace(payload.User),
 		AuthType:               strings.TrimSpace(payload.AuthType),
+		AuthMethods:            append([]string(nil), payload.AuthMethods...),
 		KeyPath:                strings.TrimSpace(payload.KeyPath),
+		CertificatePath:        strings.TrimSpace(payload.CertificatePath),
 		AgentSocketPath:        strings.TrimSpace(payload.AgentSocketPath),
+		ForwardAgent:           payload.ForwardAgent,
+		IdentitiesOnly:         payload.IdentitiesOnly,
+		IdentityFingerprint:    strings.TrimSpace(payload.IdentityFingerprint),
 		BypassHostVerification: payload.BypassHostVerification,
+		HostKeyPolicy:          strings.TrimSpace(payload.HostKeyPolicy),
+		HostKeyFingerprint:     strings.TrimSpace(payload.HostKeyFingerprint),
+		KnownHostsPath:         strings.TrimSpace(payload.KnownHostsPath),
+		HashKnownHosts:         payload.HashKnownHosts,
 		KeepAliveIntervalMs:    payload.KeepAliveIntervalMs,
 		TimeoutMs:              payload.TimeoutMs,
 		HostKeyAlgorithms:      strings.TrimSpace(payload.HostKeyAlgorithms),
+		Ciphers:                strings.TrimSpace(payload.Ciphers),
+		KeyExchanges:           strings.TrimSpace(payload.KeyExchanges),
+		MACs:                   strings.TrimSpace(payload.MACs),
+		ProxyCommand:           strings.TrimSpace(payload.ProxyCommand),
+		UpstreamProxy:          strings.TrimSpace(payload.UpstreamProxy),
 		Notes:                  strings.TrimSpace(payload.Notes),
 	}
 
@@ -549,7 +748,7 @@ func (a *App) DebugJumperFailure(payload model.JumperPayload, rawError string, u
 		TargetType:  "jumper_test",
 		RawError:    rawError,
 		UILocale:    uiLocale,
-		JumperChain: []model.Jumper{jumper},
+		JumperChain: cfg.ApplyUpstreamProxy([]model.Jumper{jumper}),
 	})
 }
 
@@ -561,12 +760,12 @@ func (a *App) DebugTunnelFailure(payload model.TunnelPayload, inlineJumper *mode
 		return model.AIDebugResult{}, fmt.Errorf("ai debug service is not initialized")
 	}
 
+	cfg, err := a.storage.Load()
+	if err != nil {
+		return model.AIDebugResult{}, err
+	}
 	chain := make([]model.Jumper, 0, len(payload.JumperIDs)+1)
 	if len(payload.JumperIDs) > 0 {
-		cfg, err := a.storage.Load()
-		if err != nil {
-			return model.AIDebugResult{}, err
-		}
 		jumpers, err := collectJumpersForApp(cfg.Jumpers, payload.JumperIDs)
 		if err != nil {
 			return model.AIDebugResult{}, err
@@ -580,12 +779,26 @@ func (a *App) DebugTunnelFailure(payload model.TunnelPayload, inlineJumper *mode
 			Port:                   inlineJumper.Port,
 			User:                   strings.TrimSpace(inlineJumper.User),
 			AuthType:               strings.TrimSpace(inlineJumper.AuthType),
+			AuthMethods:            append([]string(nil), inlineJumper.AuthMethods...),
 			KeyPath:                strings.TrimSpace(inlineJumper.KeyPath),
+			CertificatePath:        strings.TrimSpace(inlineJumper.CertificatePath),
 			AgentSocketPath:        strings.TrimSpace(inlineJumper.AgentSocketPath),
+			ForwardAgent:           inlineJumper.ForwardAgent,
+			IdentitiesOnly:         inlineJumper.IdentitiesOnly,
+			IdentityFingerprint:    strings.TrimSpace(inlineJumper.IdentityFingerprint),
 			BypassHostVerification: inlineJumper.BypassHostVerification,
+			HostKeyPolicy:          strings.TrimSpace(inlineJumper.HostKeyPolicy),
+			HostKeyFingerprint:     strings.TrimSpace(inlineJumper.HostKeyFingerprint),
+			KnownHostsPath:         strings.TrimSpace(inlineJumper.KnownHostsPath),
+			HashKnownHosts:         inlineJumper.HashKnownHosts,
 			KeepAliveIntervalMs:    inlineJumper.KeepAliveIntervalMs,
 			TimeoutMs:              inlineJumper.TimeoutMs,
 			HostKeyAlgorithms:      strings.TrimSpace(inlineJumper.HostKeyAlgorithms),
+			Ciphers:                strings.TrimSpace(inlineJumper.Ciphers),
+			KeyExchanges:           strings.TrimSpace(inlineJumper.KeyExchanges),
+			MACs:                   strings.TrimSpace(inlineJumper.MACs),
+			ProxyCommand:           strings.TrimSpace(inlineJumper.ProxyCommand),
+			UpstreamProxy:          strings.TrimSpace(inlineJumper.UpstreamProxy),
 			Notes:                  strings.TrimSpace(inlineJumper.Notes),
 		})
 	}
@@ -608,7 +821,7 @@ func (a *App) DebugTunnelFailure(payload model.TunnelPayload, inlineJumper *mode
 		RawError:    rawError,
 		UILocale:    uiLocale,
 		Tunnel:      &tunnel,
-		JumperChain: chain,
+		JumperChain: cfg.ApplyUpstreamProxy(chain),
 	})
 }
 
@@ -655,10 +868,38 @@ func (a *App) DebugSavedTunnelFailure(id int, rawError string, uiLocale string)
 		RawError:    rawError,
 		UILocale:    uiLocale,
 		Tunnel:      &tunnel,
-		JumperChain: jumpers,
+		JumperChain: cfg.ApplyUpstreamProxy(jumpers),
 	})
 }
 
+func (a *App) GetTunnelLog(id int) ([]model.TunnelLogEntry, error) {
+	if err := a.ensureReady(); err != nil {
+		return nil, err
+	}
+	return a.tunnel.Log(id), nil
+}
+
+func (a *App) ExtendTunnelTTL(id int, extendMs int) (model.Tunnel, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.Tunnel{}, err
+	}
+	return a.tunnel.ExtendTTL(id, time.Duration(extendMs)*time.Millisecond)
+}
+
+func (a *App) GetTunnelLatency(id int, windowSeconds int) (model.LatencyHistory, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.LatencyHistory{}, err
+	}
+	return a.tunnel.TunnelLatency(id, time.Duration(windowSeconds)*time.Second), nil
+}
+
+func (a *App) GetJumperLatency(id int, windowSeconds int) (model.LatencyHistory, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.LatencyHistory{}, err
+	}
+	return a.tunnel.JumperLatency(id, time.Duration(windowSeconds)*time.Second), nil
+}
+
 func (a *App) DeleteTunnel(id int) error {
 	if err := a.ensureReady(); err != nil {
 		return err
@@ -876,6 +1117,35 @@ func (a *App) SetTrafficMonitorEnabled(enabled bool) error {
 	return err
 }
 
+// GetUpstreamProxy returns the global upstream proxy used by jumpers that do
+// not set their own ("" means direct).
+func (a *App) GetUpstreamProxy() (string, error) {
+	if err := a.ensureReady(); err != nil {
+		return "", err
+	}
+	cfg, err := a.storage.Load()
+	if err != nil {
+		return "", err
+	}
+	return cfg.UpstreamProxy, nil
+}
+
+// SetUpstreamProxy validates and persists the global upstream proxy.
+func (a *App) SetUpstreamProxy(spec string) error {
+	if err := a.ensureReady(); err != nil {
+		return err
+	}
+	spec = strings.TrimSpace(spec)
+	if err := netproxy.Validate(spec); err != nil {
+		return err
+	}
+	_, err := a.storage.Update(func(cfg *conf.Config) error {
+		cfg.UpstreamProxy = spec
+		return nil
+	})
+	return err
+}
+
 // GetConfigPath returns the absolute path of the current config file.
 func (a *App) GetConfigPath() (string, error) {
 	if err := a.ensureReady(); err != nil {
@@ -980,6 +1250,7 @@ func (a *App) ImportConfig(srcPath string) error {
 	}
 
 	// Stop all running tunnels.
+	a.stopNotifier()
 	if a.tunnel != nil {
 		a.tunnel.Shutdown()
 	}
@@ -996,10 +1267,21 @@ func (a *App) ImportConfig(srcPath string) error {
 	// Reinitialise biz layer so the new config takes effect.
 	a.jumper = biz.NewJumperBiz(a.storage)
 	a.group = biz.NewGroupBiz(a.storage)
+	a.profile = biz.NewProfileBiz(a.storage)
 	a.tunnel = biz.NewTunnelBiz(a.storage)
+	a.notification = biz.NewNotificationBiz(a.storage)
+	a.attachJournal()
+	a.attachBus()
+	a.journal.Record(model.JournalEntry{Type: journal.TypeImport, Message: "config imported from " + srcPath})
+	a.bus.Publish(biz.BusEvent{Kind: biz.BusConfig, Config: model.ConfigChange{Kind: "import", Action: "imported"}})
+	a.startNotifier()
 
 	// Restart auto-start tunnels.
 	_ = a.tunnel.StartAutoStart(a.tunnelStartLimit())
+	a.tunnel.StartScheduler(a.tunnelStartLimit)
+	a.tunnel.StartTrafficTicks()
+	a.syncAPIServer()
+	a.syncMetricsServer()
 
 	slog.Info("config imported", "src", srcPath)
 	return nil
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"loris-tunnel/internal/forward"
+
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	// authPromptEvent asks the frontend to show an AuthPrompt; it answers with
+	// AnswerAuthPrompt or CancelAuthPrompt.
+	authPromptEvent = "auth:prompt"
+	// authPromptClosedEvent tells the frontend to dismiss a prompt that timed
+	// out or was answered elsewhere.
+	authPromptClosedEvent = "auth:prompt-closed"
+
+	authPromptTimeout = 2 * time.Minute
+)
+
+var (
+	ErrAuthPromptNotFound  = errors.New("auth prompt not found or already answered")
+	ErrAuthPromptTimeout   = errors.New("auth prompt timed out")
+	ErrAuthPromptCancelled = errors.New("auth prompt cancelled")
+)
+
+// AuthPrompt is a keyboard-interactive challenge that needs user input.
+type AuthPrompt struct {
+	ID          string   `json:"id"`
+	JumperName  string   `json:"jumperName"`
+	Host        string   `json:"host"`
+	User        string   `json:"user"`
+	Name        string   `json:"name"`
+	Instruction string   `json:"instruction"`
+	Questions   []string `json:"questions"`
+	Echos       []bool   `json:"echos"`
+	TimeoutMs   int64    `json:"timeoutMs"`
+}
+
+type authPromptReply struct {
+	answers []string
+	err     error
+}
+
+// ListenAuthPrompts is called by the frontend once it handles authPromptEvent.
+// Until then prompts fail at once instead of waiting for an answer that
+// cannot come.
+func (a *App) ListenAuthPrompts() {
+	a.authPromptMu.Lock()
+	defer a.authPromptMu.Unlock()
+	a.authPromptListening = true
+}
+
+// promptKeyboardInteractive is installed as the forward challenge prompter. It
+// brings the window forward and blocks until the frontend answers, cancels,
+// or the prompt times out.
+func (a *App) promptKeyboardInteractive(req forward.ChallengeRequest) ([]string, error) {
+	a.authPromptMu.Lock()
+	listening := a.authPromptListening
+	a.authPromptMu.Unlock()
+	if a.ctx == nil || !listening {
+		return nil, fmt.Errorf("%w: %q", forward.ErrNoChallengePrompter, req.Questions[0])
+	}
+
+	id, err := newAuthPromptID()
+	if err != nil {
+		return nil, err
+	}
+	reply := make(chan authPromptReply, 1)
+	a.authPromptMu.Lock()
+	if a.authPrompts == nil {
+		a.authPrompts = make(map[string]chan authPromptReply)
+	}
+	a.authPrompts[id] = reply
+	a.authPromptMu.Unlock()
+	defer func() {
+		a.authPromptMu.Lock()
+		delete(a.authPrompts, id)
+		a.authPromptMu.Unlock()
+	}()
+
+	wailsruntime.WindowShow(a.ctx)
+	wailsruntime.EventsEmit(a.ctx, authPromptEvent, AuthPrompt{
+		ID:          id,
+		JumperName:  req.JumperName,
+		Host:        req.Host,
+		User:        req.User,
+		Name:        req.Name,
+		Instruction: req.Instruction,
+		Questions:   req.Questions,
+		Echos:       req.Echos,
+		TimeoutMs:   authPromptTimeout.Milliseconds(),
+	})
+
+	select {
+	case r := <-reply:
+		return r.answers, r.err
+	case <-time.After(authPromptTimeout):
+		slog.Warn("keyboard-interactive prompt timed out", "jumper", req.JumperName, "host", req.Host)
+		wailsruntime.EventsEmit(a.ctx, authPromptClosedEvent, id)
+		return nil, fmt.Errorf("%w after %s", ErrAuthPromptTimeout, authPromptTimeout)
+	}
+}
+
+// AnswerAuthPrompt delivers the user's answers to a pending prompt.
+func (a *App) AnswerAuthPrompt(id string, answers []string) error {
+	return a.resolveAuthPrompt(id, authPromptReply{answers: answers})
+}
+
+// CancelAuthPrompt aborts a pending prompt; the connection attempt fails.
+func (a *App) CancelAuthPrompt(id string) error {
+	return a.resolveAuthPrompt(id, authPromptReply{err: ErrAuthPromptCancelled})
+}
+
+func (a *App) resolveAuthPrompt(id string, r authPromptReply) error {
+	id = strings.TrimSpace(id)
+	a.authPromptMu.Lock()
+	reply, ok := a.authPrompts[id]
+	delete(a.authPrompts, id)
+	a.authPromptMu.Unlock()
+	if !ok {
+		return ErrAuthPromptNotFound
+	}
+	reply <- r
+	return nil
+}
+
+func newAuthPromptID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generate prompt id failed: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
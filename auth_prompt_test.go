@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/forward"
+)
+
+func TestAuthPromptFailsAtOnceWithoutListener(t *testing.T) {
+	a := &App{ctx: context.Background()}
+	start := time.Now()
+	_, err := a.promptKeyboardInteractive(forward.ChallengeRequest{Questions: []string{"Code: "}, Echos: []bool{false}})
+	if !errors.Is(err, forward.ErrNoChallengePrompter) {
+		t.Fatalf("err = %v, want ErrNoChallengePrompter", err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Fatalf("prompt without a listener waited %s", waited)
+	}
+}
+
+func TestResolveAuthPromptDeliversOnce(t *testing.T) {
+	a := &App{}
+	reply := make(chan authPromptReply, 1)
+	a.authPrompts = map[string]chan authPromptReply{"p1": reply}
+
+	if err := a.AnswerAuthPrompt(" p1 ", []string{"123456"}); err != nil {
+		t.Fatalf("answer: %v", err)
+	}
+	if r := <-reply; r.err != nil || len(r.answers) != 1 || r.answers[0] != "123456" {
+		t.Fatalf("reply = %+v", r)
+	}
+	if err := a.CancelAuthPrompt("p1"); !errors.Is(err, ErrAuthPromptNotFound) {
+		t.Fatalf("second resolve err = %v, want ErrAuthPromptNotFound", err)
+	}
+}
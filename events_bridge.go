@@ -0,0 +1,165 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"loris-tunnel/internal/biz"
+	"loris-tunnel/internal/model"
+
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Events pushed to the frontend. Status and latency payloads are keyed by
+// tunnel; config:changed tells the UI to reload the state.
+const (
+	tunnelStatusEvent  = "tunnel:status"
+	tunnelLatencyEvent = "tunnel:latency"
+	trafficStatsEvent  = "traffic:stats"
+	configChangedEvent = "config:changed"
+
+	// bridgeFlushInterval batches bursts, such as a profile switch that
+	// restarts many tunnels, into one emit per tunnel.
+	bridgeFlushInterval = 100 * time.Millisecond
+	// trafficEmitInterval rate-limits the traffic ticks, which the bus
+	// publishes several times a second.
+	trafficEmitInterval = time.Second
+)
+
+// eventBridge coalesces bus events into frontend events: only the latest
+// status and latency of each tunnel is kept between flushes, config changes
+// collapse into one reload, and traffic is sent at most once per
+// trafficEmitInterval as a rate.
+type eventBridge struct {
+	emit func(name string, data any)
+
+	status  map[int]model.Tunnel
+	latency map[int]model.TunnelLatencyUpdate
+	config  []model.ConfigChange
+
+	trafficSeen          bool
+	trafficUp, trafficDn uint64
+	trafficAt            time.Time
+	sentUp, sentDn       uint64
+	sentAt               time.Time
+}
+
+func newEventBridge(emit func(name string, data any)) *eventBridge {
+	return &eventBridge{
+		emit:    emit,
+		status:  make(map[int]model.Tunnel),
+		latency: make(map[int]model.TunnelLatencyUpdate),
+	}
+}
+
+func (e *eventBridge) handle(evt biz.BusEvent) {
+	switch evt.Kind {
+	case biz.BusTunnelStatus:
+		e.status[evt.Tunnel.ID] = evt.Tunnel
+		// A status change carries the latency too; drop an older probe.
+		delete(e.latency, evt.Tunnel.ID)
+	case biz.BusTunnelLatency:
+		e.latency[evt.Latency.TunnelID] = evt.Latency
+	case biz.BusConfig:
+		e.config = append(e.config, evt.Config)
+	case biz.BusTraffic:
+		e.trafficSeen = true
+		e.trafficUp, e.trafficDn, e.trafficAt = evt.Up, evt.Down, evt.Time
+	}
+}
+
+// flush emits what accumulated since the last call. Tunnels go out in ID
+// order so the UI applies them deterministically.
+func (e *eventBridge) flush() {
+	if len(e.config) > 0 {
+		e.emit(configChangedEvent, e.config)
+		e.config = nil
+	}
+	for _, id := range sortedKeys(e.status) {
+		e.emit(tunnelStatusEvent, e.status[id])
+	}
+	clear(e.status)
+	for _, id := range sortedKeys(e.latency) {
+		e.emit(tunnelLatencyEvent, e.latency[id])
+	}
+	clear(e.latency)
+	e.flushTraffic()
+}
+
+func (e *eventBridge) flushTraffic() {
+	if !e.trafficSeen {
+		return
+	}
+	if e.sentAt.IsZero() {
+		// The first tick only sets the baseline for the rate.
+		e.sentUp, e.sentDn, e.sentAt = e.trafficUp, e.trafficDn, e.trafficAt
+		return
+	}
+	elapsed := e.trafficAt.Sub(e.sentAt)
+	if elapsed < trafficEmitInterval {
+		return
+	}
+	e.emit(trafficStatsEvent, model.TrafficStats{
+		UpBps:   rate(e.sentUp, e.trafficUp, elapsed),
+		DownBps: rate(e.sentDn, e.trafficDn, elapsed),
+	})
+	e.sentUp, e.sentDn, e.sentAt = e.trafficUp, e.trafficDn, e.trafficAt
+	e.trafficSeen = false
+}
+
+// rate is bytes per second between two totals. Totals shrink when a tunnel
+// stops, which reads as no traffic rather than a negative rate.
+func rate(from, to uint64, elapsed time.Duration) int64 {
+	if to <= from || elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(to-from) / elapsed.Seconds())
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// run feeds events into the bridge and flushes on every tick until events
+// is closed.
+func (e *eventBridge) run(events <-chan biz.BusEvent) {
+	ticker := time.NewTicker(bridgeFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case evt, ok := <-events:
+			if !ok {
+				e.flush()
+				return
+			}
+			e.handle(evt)
+		case <-ticker.C:
+			e.flush()
+		}
+	}
+}
+
+// attachBus hands the event bus to the current biz objects; call it
+// whenever they are recreated.
+func (a *App) attachBus() {
+	a.jumper.SetBus(a.bus)
+	a.group.SetBus(a.bus)
+	a.profile.SetBus(a.bus)
+	a.notification.SetBus(a.bus)
+	a.tunnel.SetBus(a.bus)
+}
+
+// startEventBridge forwards bus events to the frontend until shutdown.
+func (a *App) startEventBridge() {
+	events, cancel := a.bus.Subscribe(256)
+	a.busCancel = cancel
+	bridge := newEventBridge(func(name string, data any) {
+		wailsruntime.EventsEmit(a.ctx, name, data)
+	})
+	go bridge.run(events)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/biz"
+	"loris-tunnel/internal/model"
+)
+
+type emitted struct {
+	name string
+	data any
+}
+
+func newTestBridge() (*eventBridge, *[]emitted) {
+	var out []emitted
+	return newEventBridge(func(name string, data any) {
+		out = append(out, emitted{name, data})
+	}), &out
+}
+
+func TestEventBridgeCoalescesPerTunnel(t *testing.T) {
+	bridge, out := newTestBridge()
+	bridge.handle(biz.BusEvent{Kind: biz.BusTunnelLatency, Latency: model.TunnelLatencyUpdate{TunnelID: 2, LatencyMs: 40}})
+	bridge.handle(biz.BusEvent{Kind: biz.BusTunnelStatus, Tunnel: model.Tunnel{ID: 2, Status: "busy"}})
+	bridge.handle(biz.BusEvent{Kind: biz.BusTunnelStatus, Tunnel: model.Tunnel{ID: 1, Status: "busy"}})
+	bridge.handle(biz.BusEvent{Kind: biz.BusTunnelStatus, Tunnel: model.Tunnel{ID: 2, Status: "running"}})
+	bridge.handle(biz.BusEvent{Kind: biz.BusTunnelLatency, Latency: model.TunnelLatencyUpdate{TunnelID: 1, LatencyMs: 12}})
+	bridge.handle(biz.BusEvent{Kind: biz.BusConfig, Config: model.ConfigChange{Kind: "jumper", ID: 3, Action: "updated"}})
+	bridge.handle(biz.BusEvent{Kind: biz.BusConfig, Config: model.ConfigChange{Kind: "group", ID: 1, Action: "deleted"}})
+	bridge.flush()
+
+	got := *out
+	if len(got) != 4 {
+		t.Fatalf("emitted %d events: %+v", len(got), got)
+	}
+	if got[0].name != configChangedEvent || len(got[0].data.([]model.ConfigChange)) != 2 {
+		t.Fatalf("config event = %+v", got[0])
+	}
+	if got[1].name != tunnelStatusEvent || got[1].data.(model.Tunnel).ID != 1 {
+		t.Fatalf("first status = %+v", got[1])
+	}
+	if tun := got[2].data.(model.Tunnel); got[2].name != tunnelStatusEvent || tun.ID != 2 || tun.Status != "running" {
+		t.Fatalf("second status = %+v", got[2])
+	}
+	// Tunnel 2's probe predates its status change and is dropped.
+	if got[3].name != tunnelLatencyEvent || got[3].data.(model.TunnelLatencyUpdate).TunnelID != 1 {
+		t.Fatalf("latency = %+v", got[3])
+	}
+
+	*out = nil
+	bridge.flush()
+	if len(*out) != 0 {
+		t.Fatalf("empty flush emitted %+v", *out)
+	}
+}
+
+func TestEventBridgeRateLimitsTraffic(t *testing.T) {
+	bridge, out := newTestBridge()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tick := func(ms int, up, down uint64) {
+		bridge.handle(biz.BusEvent{Kind: biz.BusTraffic, Time: start.Add(time.Duration(ms) * time.Millisecond), Up: up, Down: down})
+		bridge.flush()
+	}
+
+	for i, ms := range []int{0, 250, 500, 750} {
+		tick(ms, uint64(i*1000), uint64(i*4000))
+	}
+	if len(*out) != 0 {
+		t.Fatalf("traffic sent before a full interval: %+v", *out)
+	}
+	tick(1000, 4000, 16000)
+	if len(*out) != 1 || (*out)[0].data != (model.TrafficStats{UpBps: 4000, DownBps: 16000}) {
+		t.Fatalf("traffic = %+v", *out)
+	}
+
+	// A stopped tunnel shrinks the totals; that is no traffic, not negative.
+	tick(2000, 100, 200)
+	if len(*out) != 2 || (*out)[1].data != (model.TrafficStats{}) {
+		t.Fatalf("traffic after stop = %+v", *out)
+	}
+}
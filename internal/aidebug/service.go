@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/netproxy"
 )
 
 const (
@@ -90,9 +91,15 @@ func (s *Service) Diagnose(ctx context.Context, input DiagnosticInput) (model.AI
 	last := chain[len(chain)-1]
 
 	checks = append(checks, dnsCheck(ctx, first.Host)...)
-	checks = append(checks, tcpCheck(ctx, first.Host, first.Port, "tcp_first_hop"))
+	if strings.TrimSpace(first.ProxyCommand) != "" {
+		checks = append(checks, model.AIDebugCheck{Name: "tcp_first_hop", Status: "skipped", Detail: "First hop is reached through ProxyCommand."})
+	} else {
+		checks = append(checks, tcpCheck(ctx, first.UpstreamProxy, first.Host, first.Port, "tcp_first_hop"))
+	}
 	if len(chain) > 1 && (last.Host != first.Host || last.Port != first.Port) {
-		checks = append(checks, tcpCheck(ctx, last.Host, last.Port, "tcp_final_hop"))
+		// Later hops are dialed through the SSH connection to the hop before
+		// them, not from here; the ssh debug run below covers that path.
+		checks = append(checks, model.AIDebugCheck{Name: "tcp_final_hop", Status: "skipped", Detail: "Final hop is reached through the previous hop."})
 	}
 	checks = append(checks, pingCheck(ctx, first.Host))
 
@@ -185,18 +192,29 @@ func dnsCheck(ctx context.Context, host string) []model.AIDebugCheck {
 	return []model.AIDebugCheck{{Name: "dns", Status: "ok", Detail: fmt.Sprintf("Resolved %s to %s.", host, strings.Join(values, ", "))}}
 }
 
-func tcpCheck(ctx context.Context, host string, port int, name string) model.AIDebugCheck {
+// tcpCheck dials through the same upstream proxy dialSSH would use, so the
+// result reflects the path the tunnel actually takes.
+func tcpCheck(ctx context.Context, upstreamProxy, host string, port int, name string) model.AIDebugCheck {
 	if port <= 0 {
 		port = 22
 	}
 	addr := net.JoinHostPort(strings.TrimSpace(host), strconv.Itoa(port))
-	dialer := &net.Dialer{Timeout: probeTimeout}
-	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	dialer, err := netproxy.New(upstreamProxy)
+	if err != nil {
+		return model.AIDebugCheck{Name: name, Status: "error", Detail: fmt.Sprintf("Invalid upstream proxy: %v", err)}
+	}
+	via := ""
+	if proxy, _ := dialer.ProxyFor(addr); proxy != nil {
+		via = " via proxy " + netproxy.Describe(proxy.String())
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	conn, err := dialer.DialContext(dialCtx, "tcp", addr)
 	if err != nil {
-		return model.AIDebugCheck{Name: name, Status: "error", Detail: fmt.Sprintf("TCP connect to %s failed: %v", addr, err)}
+		return model.AIDebugCheck{Name: name, Status: "error", Detail: fmt.Sprintf("TCP connect to %s%s failed: %v", addr, via, err)}
 	}
 	_ = conn.Close()
-	return model.AIDebugCheck{Name: name, Status: "ok", Detail: fmt.Sprintf("TCP connect to %s succeeded.", addr)}
+	return model.AIDebugCheck{Name: name, Status: "ok", Detail: fmt.Sprintf("TCP connect to %s%s succeeded.", addr, via)}
 }
 
 func pingCheck(ctx context.Context, host string) model.AIDebugCheck {
@@ -380,16 +398,49 @@ func buildSSHConfig(chain []model.Jumper) (string, func(), []model.AIDebugCheck)
 		buf.WriteString("\n")
 		buf.WriteString("  LogLevel DEBUG3\n")
 		buf.WriteString("  NumberOfPasswordPrompts 1\n")
+		if hop.ForwardAgent {
+			buf.WriteString("  ForwardAgent yes\n")
+		}
+		for _, opt := range []struct{ key, value string }{
+			{"Ciphers", hop.Ciphers},
+			{"KexAlgorithms", hop.KeyExchanges},
+			{"MACs", hop.MACs},
+		} {
+			if value := strings.TrimSpace(opt.value); value != "" {
+				buf.WriteString("  " + opt.key + " " + value + "\n")
+			}
+		}
 		if hop.BypassHostVerification {
 			buf.WriteString("  StrictHostKeyChecking no\n")
 			buf.WriteString("  UserKnownHostsFile ")
 			buf.WriteString(os.DevNull)
 			buf.WriteString("\n")
+		} else {
+			if strings.TrimSpace(hop.HostKeyPolicy) == "accept_new" {
+				buf.WriteString("  StrictHostKeyChecking accept-new\n")
+			}
+			if knownHosts := strings.TrimSpace(hop.KnownHostsPath); knownHosts != "" {
+				buf.WriteString("  UserKnownHostsFile ")
+				buf.WriteString(knownHosts)
+				buf.WriteString("\n")
+			}
+			if hop.HashKnownHosts {
+				buf.WriteString("  HashKnownHosts yes\n")
+			}
+		}
+		authType := strings.TrimSpace(hop.AuthType)
+		if len(hop.AuthMethods) > 1 {
+			authType = "multiple"
 		}
-		switch strings.TrimSpace(hop.AuthType) {
+		switch authType {
+		case "multiple":
+			writeMultiAuthConfig(&buf, hop)
 		case "password":
 			buf.WriteString("  PreferredAuthentications password,keyboard-interactive\n")
 			buf.WriteString("  PubkeyAuthentication no\n")
+		case "keyboard_interactive":
+			buf.WriteString("  PreferredAuthentications keyboard-interactive\n")
+			buf.WriteString("  PubkeyAuthentication no\n")
 		case "ssh_key":
 			buf.WriteString("  PreferredAuthentications publickey\n")
 			buf.WriteString("  PubkeyAuthentication yes\n")
@@ -403,10 +454,25 @@ func buildSSHConfig(chain []model.Jumper) (string, func(), []model.AIDebugCheck)
 				buf.WriteString("\n")
 				buf.WriteString("  IdentitiesOnly yes\n")
 			}
+			if certPath := strings.TrimSpace(hop.CertificatePath); certPath != "" {
+				if resolved, err := resolveKeyPath(certPath); err == nil {
+					certPath = resolved
+				}
+				buf.WriteString("  CertificateFile ")
+				buf.WriteString(certPath)
+				buf.WriteString("\n")
+			}
 		default:
 			buf.WriteString("  PreferredAuthentications publickey\n")
 			buf.WriteString("  PubkeyAuthentication yes\n")
 		}
+		if i == 0 {
+			if proxyCommand := strings.TrimSpace(hop.ProxyCommand); proxyCommand != "" {
+				buf.WriteString("  ProxyCommand ")
+				buf.WriteString(proxyCommand)
+				buf.WriteString("\n")
+			}
+		}
 		if i > 0 {
 			buf.WriteString("  ProxyJump loris-hop-")
 			buf.WriteString(strconv.Itoa(i))
@@ -428,6 +494,51 @@ func buildSSHConfig(chain []model.Jumper) (string, func(), []model.AIDebugCheck)
 	return file.Name(), cleanup, []model.AIDebugCheck{{Name: "ssh_config", Status: "ok", Detail: fmt.Sprintf("Built temporary SSH config for %d hop(s).", len(chain))}}
 }
 
+// writeMultiAuthConfig mirrors an ordered auth method list. Agent and key
+// file both map to publickey, so the list is collapsed the same way the
+// forward package merges them.
+func writeMultiAuthConfig(buf *bytes.Buffer, hop model.Jumper) {
+	preferred := make([]string, 0, len(hop.AuthMethods))
+	seen := make(map[string]bool, len(hop.AuthMethods))
+	pubkey := false
+	for _, method := range hop.AuthMethods {
+		name := ""
+		switch strings.TrimSpace(method) {
+		case "ssh_agent", "ssh_key":
+			name = "publickey"
+			pubkey = true
+		case "password":
+			name = "password"
+		case "keyboard_interactive":
+			name = "keyboard-interactive"
+		}
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		preferred = append(preferred, name)
+	}
+	buf.WriteString("  PreferredAuthentications ")
+	buf.WriteString(strings.Join(preferred, ","))
+	buf.WriteString("\n")
+	if !pubkey {
+		buf.WriteString("  PubkeyAuthentication no\n")
+		return
+	}
+	buf.WriteString("  PubkeyAuthentication yes\n")
+	if keyPath := strings.TrimSpace(hop.KeyPath); keyPath != "" {
+		if resolved, err := resolveKeyPath(keyPath); err == nil {
+			keyPath = resolved
+		}
+		buf.WriteString("  IdentityFile ")
+		buf.WriteString(keyPath)
+		buf.WriteString("\n")
+	}
+	if hop.IdentitiesOnly {
+		buf.WriteString("  IdentitiesOnly yes\n")
+	}
+}
+
 func defaultTimeoutSeconds(timeoutMs int) int {
 	if timeoutMs <= 0 {
 		return 5
@@ -753,9 +864,21 @@ func jumpersSummary(jumpers []model.Jumper) []map[string]any {
 			"port":                   jumper.Port,
 			"user":                   strings.TrimSpace(jumper.User),
 			"authType":               strings.TrimSpace(jumper.AuthType),
+			"authMethods":            jumper.AuthMethods,
+			"identitiesOnly":         jumper.IdentitiesOnly,
 			"keyPath":                strings.TrimSpace(jumper.KeyPath),
+			"certificatePath":        strings.TrimSpace(jumper.CertificatePath),
 			"agentSocketPath":        strings.TrimSpace(jumper.AgentSocketPath),
+			"proxyCommand":           strings.TrimSpace(jumper.ProxyCommand),
+			"upstreamProxy":          netproxy.Describe(jumper.UpstreamProxy),
 			"bypassHostVerification": jumper.BypassHostVerification,
+			"hostKeyPolicy":          strings.TrimSpace(jumper.HostKeyPolicy),
+			"hostKeyFingerprint":     strings.TrimSpace(jumper.HostKeyFingerprint),
+			"knownHostsPath":         strings.TrimSpace(jumper.KnownHostsPath),
+			"ciphers":                strings.TrimSpace(jumper.Ciphers),
+			"keyExchanges":           strings.TrimSpace(jumper.KeyExchanges),
+			"macs":                   strings.TrimSpace(jumper.MACs),
+			"forwardAgent":           jumper.ForwardAgent,
 		})
 	}
 	return items
@@ -0,0 +1,193 @@
+package biz
+
+import (
+	"sync"
+	"time"
+
+	"loris-tunnel/internal/latency"
+	"loris-tunnel/internal/model"
+)
+
+// Bus event kinds.
+const (
+	BusTunnelStatus  = "tunnel_status"
+	BusTunnelLatency = "tunnel_latency"
+	BusTraffic       = "traffic"
+	BusConfig        = "config"
+)
+
+// trafficTick is how often TunnelBiz publishes traffic totals.
+// Subscribers that redraw less often coalesce the ticks.
+const trafficTick = 250 * time.Millisecond
+
+// BusEvent is one message on the Bus; which fields are set depends on Kind.
+// Tunnel carries its runtime fields as List returns them. Up and Down are
+// byte totals over the running tunnels, not rates.
+type BusEvent struct {
+	Kind    string
+	Time    time.Time
+	Tunnel  model.Tunnel
+	Latency model.TunnelLatencyUpdate
+	Up      uint64
+	Down    uint64
+	Config  model.ConfigChange
+}
+
+// Bus fans out state changes of the biz objects to subscribers such as the
+// UI. Unlike TunnelBiz.Subscribe it outlives a config import, so the app
+// creates one and hands it to each new set of biz objects. A nil *Bus drops
+// everything.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[chan BusEvent]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[chan BusEvent]struct{})}
+}
+
+// Subscribe returns a channel that receives every published event until
+// cancel is called. A subscriber that falls more than buffer events behind
+// misses events rather than blocking publishers.
+func (b *Bus) Subscribe(buffer int) (<-chan BusEvent, func()) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	ch := make(chan BusEvent, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// Publish sends evt to every subscriber without blocking, stamping the time
+// when unset.
+func (b *Bus) Publish(evt BusEvent) {
+	if b == nil {
+		return
+	}
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- evt:
+		default:
+		}
+	}
+}
+
+func (b *Bus) publishConfig(kind string, id int, action string) {
+	b.Publish(BusEvent{Kind: BusConfig, Config: model.ConfigChange{Kind: kind, ID: id, Action: action}})
+}
+
+// SetBus makes the biz publish tunnel status, latency and traffic updates
+// and tunnel config edits to bus. Call it before the biz is used.
+func (b *TunnelBiz) SetBus(bus *Bus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bus = bus
+}
+
+// SetBus makes the biz publish config edits to bus.
+func (b *JumperBiz) SetBus(bus *Bus) { b.bus = bus }
+
+// SetBus makes the biz publish config edits to bus.
+func (b *GroupBiz) SetBus(bus *Bus) { b.bus = bus }
+
+// SetBus makes the biz publish config edits to bus.
+func (b *ProfileBiz) SetBus(bus *Bus) { b.bus = bus }
+
+// SetBus makes the biz publish config edits to bus.
+func (b *NotificationBiz) SetBus(bus *Bus) { b.bus = bus }
+
+func (b *TunnelBiz) eventBus() *Bus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bus
+}
+
+// publishStatus sends t with its runtime fields attached.
+func (b *TunnelBiz) publishStatus(t model.Tunnel) {
+	bus := b.eventBus()
+	if bus == nil {
+		return
+	}
+	items := []model.Tunnel{t}
+	b.attachRuntimeStatus(items)
+	bus.Publish(BusEvent{Kind: BusTunnelStatus, Tunnel: items[0]})
+}
+
+// publishStatusByID is publishStatus for callers that only hold the ID,
+// such as health changes that do not touch the stored status.
+func (b *TunnelBiz) publishStatusByID(id int) {
+	if b.eventBus() == nil {
+		return
+	}
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return
+	}
+	if t, ok := findTunnelByID(cfg.Tunnels, id); ok {
+		b.publishStatus(t)
+	}
+}
+
+func (b *TunnelBiz) publishLatency(id int, sample latency.Sample) {
+	update := model.TunnelLatencyUpdate{TunnelID: id, Failed: sample.Failed || sample.TimedOut}
+	if !update.Failed {
+		update.LatencyMs = sample.Latency.Milliseconds()
+	}
+	b.eventBus().Publish(BusEvent{Kind: BusTunnelLatency, Latency: update})
+}
+
+func (b *TunnelBiz) publishConfig(id int, action string) {
+	b.eventBus().publishConfig("tunnel", id, action)
+}
+
+// StartTrafficTicks publishes the traffic totals every trafficTick until
+// Shutdown, so subscribers can derive rates without polling.
+func (b *TunnelBiz) StartTrafficTicks() {
+	b.mu.Lock()
+	if b.trafficStop != nil || b.bus == nil {
+		b.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	b.trafficStop = stop
+	b.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(trafficTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				up, down := b.TrafficSnapshot()
+				b.eventBus().Publish(BusEvent{Kind: BusTraffic, Time: now, Up: up, Down: down})
+			}
+		}
+	}()
+}
+
+func (b *TunnelBiz) stopTrafficTicks() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.trafficStop != nil {
+		close(b.trafficStop)
+		b.trafficStop = nil
+	}
+}
@@ -0,0 +1,84 @@
+package biz
+
+import (
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/model"
+)
+
+func TestBusPublishesTunnelChanges(t *testing.T) {
+	tunnelBiz, payload := newDependencyTestBiz(t)
+	bus := NewBus()
+	tunnelBiz.SetBus(bus)
+	events, cancel := bus.Subscribe(0)
+	defer cancel()
+
+	db, err := tunnelBiz.Create(payload("db", 15434))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	if evt := nextBusEvent(t, events); evt.Kind != BusConfig || evt.Config != (model.ConfigChange{Kind: "tunnel", ID: db.ID, Action: "created"}) {
+		t.Fatalf("create event = %+v", evt)
+	}
+
+	// The test jumper is unreachable, so the tunnel ends up in error.
+	_, _ = tunnelBiz.Toggle(db.ID, 0)
+	if evt := nextBusEvent(t, events); evt.Kind != BusTunnelStatus || evt.Tunnel.ID != db.ID || evt.Tunnel.Status != "error" || evt.Tunnel.LastError == "" {
+		t.Fatalf("status event = %+v", evt)
+	}
+
+	cancel()
+	cancel()
+	var nilBus *Bus
+	nilBus.Publish(BusEvent{Kind: BusTraffic})
+}
+
+func TestBusDropsEventsForSlowSubscribers(t *testing.T) {
+	bus := NewBus()
+	events, cancel := bus.Subscribe(2)
+	defer cancel()
+	for i := 0; i < 5; i++ {
+		bus.Publish(BusEvent{Kind: BusTraffic, Up: uint64(i)})
+	}
+	if len(events) != 2 {
+		t.Fatalf("buffered = %d, want 2", len(events))
+	}
+	if evt := <-events; evt.Up != 0 || evt.Time.IsZero() {
+		t.Fatalf("first event = %+v", evt)
+	}
+}
+
+func TestTunnelSubscriberCountsMissedEvents(t *testing.T) {
+	tunnelBiz, _ := newDependencyTestBiz(t)
+	events, cancel := tunnelBiz.Subscribe(1)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		tunnelBiz.publish(model.TunnelEvent{TunnelID: i})
+	}
+	for _, missed := range tunnelBiz.subs {
+		if missed != 2 {
+			t.Fatalf("missed = %d, want 2", missed)
+		}
+	}
+
+	// Catching up resets the count.
+	<-events
+	tunnelBiz.publish(model.TunnelEvent{TunnelID: 3})
+	for _, missed := range tunnelBiz.subs {
+		if missed != 0 {
+			t.Fatalf("missed after catching up = %d, want 0", missed)
+		}
+	}
+}
+
+func nextBusEvent(t *testing.T, events <-chan BusEvent) BusEvent {
+	t.Helper()
+	select {
+	case evt := <-events:
+		return evt
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a bus event")
+		return BusEvent{}
+	}
+}
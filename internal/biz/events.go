@@ -0,0 +1,62 @@
+package biz
+
+import (
+	"log/slog"
+
+	"loris-tunnel/internal/model"
+)
+
+// Subscribe returns a channel that receives every tunnel log entry as it is
+// recorded, status changes included. The channel is closed by cancel or by
+// Shutdown. A subscriber that falls more than buffer events behind misses
+// events rather than blocking tunnels; the loss is logged.
+func (b *TunnelBiz) Subscribe(buffer int) (<-chan model.TunnelEvent, func()) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	ch := make(chan model.TunnelEvent, buffer)
+	b.subMu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[chan model.TunnelEvent]int)
+	}
+	b.subs[ch] = 0
+	b.subMu.Unlock()
+
+	cancel := func() {
+		b.subMu.Lock()
+		defer b.subMu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+func (b *TunnelBiz) publish(evt model.TunnelEvent) {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+	for ch, missed := range b.subs {
+		select {
+		case ch <- evt:
+			if missed > 0 {
+				slog.Warn("tunnel event subscriber caught up", "missed", missed)
+				b.subs[ch] = 0
+			}
+		default:
+			if missed == 0 {
+				slog.Warn("tunnel event subscriber is full, dropping events", "tunnel_id", evt.TunnelID, "source", evt.Entry.Source, "event", evt.Entry.Event)
+			}
+			b.subs[ch] = missed + 1
+		}
+	}
+}
+
+func (b *TunnelBiz) closeSubscribers() {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+	for ch := range b.subs {
+		close(ch)
+	}
+	b.subs = nil
+}
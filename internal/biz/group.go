@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/journal"
 	"loris-tunnel/internal/model"
 )
 
@@ -16,6 +17,8 @@ var (
 
 type GroupBiz struct {
 	storage *conf.Storage
+	journal *journal.Journal
+	bus     *Bus
 }
 
 func NewGroupBiz(storage *conf.Storage) *GroupBiz {
@@ -55,6 +58,8 @@ func (b *GroupBiz) Create(payload model.TunnelGroupPayload) (model.TunnelGroup,
 		return model.TunnelGroup{}, err
 	}
 
+	recordConfig(b.journal, "group", created.Name, "created")
+	b.bus.publishConfig("group", created.ID, "created")
 	return created, nil
 }
 
@@ -95,6 +100,8 @@ func (b *GroupBiz) Update(id int, payload model.TunnelGroupPayload) (model.Tunne
 		return model.TunnelGroup{}, err
 	}
 
+	recordConfig(b.journal, "group", updated.Name, "updated")
+	b.bus.publishConfig("group", updated.ID, "updated")
 	return updated, nil
 }
 
@@ -103,6 +110,7 @@ func (b *GroupBiz) Delete(id int) error {
 		return fmt.Errorf("invalid group id")
 	}
 
+	var name string
 	_, err := b.storage.Update(func(cfg *conf.Config) error {
 		idx := -1
 		for i := range cfg.Groups {
@@ -115,6 +123,7 @@ func (b *GroupBiz) Delete(id int) error {
 			return ErrGroupNotFound
 		}
 
+		name = cfg.Groups[idx].Name
 		cfg.Groups = append(cfg.Groups[:idx], cfg.Groups[idx+1:]...)
 		for i := range cfg.Tunnels {
 			if cfg.Tunnels[i].GroupID == id {
@@ -123,6 +132,10 @@ func (b *GroupBiz) Delete(id int) error {
 		}
 		return nil
 	})
+	if err == nil {
+		recordConfig(b.journal, "group", name, "deleted")
+		b.bus.publishConfig("group", id, "deleted")
+	}
 	return err
 }
 
@@ -160,6 +173,9 @@ func (b *GroupBiz) Reorder(ids []int) error {
 		cfg.Groups = next
 		return nil
 	})
+	if err == nil {
+		b.bus.publishConfig("group", 0, "reordered")
+	}
 	return err
 }
 
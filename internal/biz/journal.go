@@ -0,0 +1,36 @@
+package biz
+
+import (
+	"fmt"
+
+	"loris-tunnel/internal/journal"
+	"loris-tunnel/internal/model"
+)
+
+// SetJournal makes the biz record lifecycle events and config edits into j.
+// Call it before the biz is used.
+func (b *TunnelBiz) SetJournal(j *journal.Journal) { b.journal = j }
+
+// SetJournal makes the biz record config edits into j.
+func (b *JumperBiz) SetJournal(j *journal.Journal) { b.journal = j }
+
+// SetJournal makes the biz record config edits into j.
+func (b *GroupBiz) SetJournal(j *journal.Journal) { b.journal = j }
+
+// SetJournal makes the biz record config edits into j.
+func (b *ProfileBiz) SetJournal(j *journal.Journal) { b.journal = j }
+
+// recordTunnel journals an event of one tunnel; err may be nil.
+func (b *TunnelBiz) recordTunnel(typ string, id int, name, message string, err error) {
+	entry := model.JournalEntry{Type: typ, TunnelID: id, Tunnel: name, Message: message}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	b.journal.Record(entry)
+}
+
+// recordConfig journals an edit of a jumper, group or profile, e.g.
+// `jumper "bastion" updated`.
+func recordConfig(j *journal.Journal, kind, name, action string) {
+	j.Record(model.JournalEntry{Type: journal.TypeConfig, Message: fmt.Sprintf("%s %q %s", kind, name, action)})
+}
@@ -0,0 +1,58 @@
+package biz
+
+import (
+	"testing"
+
+	"loris-tunnel/internal/journal"
+	"loris-tunnel/internal/model"
+)
+
+func TestTunnelBizJournalsEditsAndFailedStarts(t *testing.T) {
+	tunnelBiz, payload := newDependencyTestBiz(t)
+	j, err := journal.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	tunnelBiz.SetJournal(j)
+
+	db, err := tunnelBiz.Create(payload("db", 15432))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	// The jumper is unreachable, so the start fails.
+	if _, err := tunnelBiz.Toggle(db.ID, 0); err != nil {
+		t.Fatalf("toggle db: %v", err)
+	}
+	if err := tunnelBiz.Delete(db.ID); err != nil {
+		t.Fatalf("delete db: %v", err)
+	}
+
+	entries, err := j.Query(model.JournalQuery{TunnelID: db.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Type+": "+e.Message)
+		if e.Tunnel != "db" {
+			t.Errorf("entry %+v has tunnel %q", e, e.Tunnel)
+		}
+	}
+	want := []string{
+		"config: tunnel created",
+		"error: tunnel failed to start",
+		"config: tunnel deleted",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("journal = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("journal = %q, want %q", got, want)
+		}
+	}
+	if entries[1].Error == "" {
+		t.Fatal("failed start journaled without its error")
+	}
+}
@@ -7,7 +7,12 @@ import (
 
 	"loris-tunnel/internal/conf"
 	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/journal"
 	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/netproxy"
+	"loris-tunnel/internal/totp"
+
+	"golang.org/x/crypto/ssh"
 )
 
 var (
@@ -23,6 +28,8 @@ const (
 
 type JumperBiz struct {
 	storage *conf.Storage
+	journal *journal.Journal
+	bus     *Bus
 }
 
 func NewJumperBiz(storage *conf.Storage) *JumperBiz {
@@ -54,13 +61,28 @@ func (b *JumperBiz) Create(payload model.JumperPayload) (model.Jumper, error) {
 			Port:                   payload.Port,
 			User:                   payload.User,
 			AuthType:               payload.AuthType,
+			AuthMethods:            append([]string(nil), payload.AuthMethods...),
 			KeyPath:                payload.KeyPath,
+			CertificatePath:        payload.CertificatePath,
 			AgentSocketPath:        payload.AgentSocketPath,
+			ForwardAgent:           payload.ForwardAgent,
+			IdentitiesOnly:         payload.IdentitiesOnly,
+			IdentityFingerprint:    payload.IdentityFingerprint,
 			Password:               payload.Password,
+			TOTPSecret:             payload.TOTPSecret,
 			BypassHostVerification: payload.BypassHostVerification,
+			HostKeyPolicy:          payload.HostKeyPolicy,
+			HostKeyFingerprint:     payload.HostKeyFingerprint,
+			KnownHostsPath:         payload.KnownHostsPath,
+			HashKnownHosts:         payload.HashKnownHosts,
 			KeepAliveIntervalMs:    payload.KeepAliveIntervalMs,
 			TimeoutMs:              payload.TimeoutMs,
 			HostKeyAlgorithms:      payload.HostKeyAlgorithms,
+			Ciphers:                payload.Ciphers,
+			KeyExchanges:           payload.KeyExchanges,
+			MACs:                   payload.MACs,
+			ProxyCommand:           payload.ProxyCommand,
+			UpstreamProxy:          payload.UpstreamProxy,
 			Notes:                  payload.Notes,
 		}
 		cfg.Jumpers = append(cfg.Jumpers, created)
@@ -70,6 +92,8 @@ func (b *JumperBiz) Create(payload model.JumperPayload) (model.Jumper, error) {
 		return model.Jumper{}, err
 	}
 
+	recordConfig(b.journal, "jumper", created.Name, "created")
+	b.bus.publishConfig("jumper", created.ID, "created")
 	return created, nil
 }
 
@@ -78,11 +102,6 @@ func (b *JumperBiz) Update(id int, payload model.JumperPayload) (model.Jumper, e
 		return model.Jumper{}, fmt.Errorf("invalid jumper id")
 	}
 
-	payload = normalizeJumperPayload(payload)
-	if err := validateJumperPayload(payload); err != nil {
-		return model.Jumper{}, err
-	}
-
 	var updated model.Jumper
 	_, err := b.storage.Update(func(cfg *conf.Config) error {
 		idx := -1
@@ -95,6 +114,10 @@ func (b *JumperBiz) Update(id int, payload model.JumperPayload) (model.Jumper, e
 		if idx == -1 {
 			return ErrJumperNotFound
 		}
+		payload = normalizeJumperPayload(fillUnsentJumperFields(payload, cfg.Jumpers[idx]))
+		if err := validateJumperPayload(payload); err != nil {
+			return err
+		}
 
 		updated = model.Jumper{
 			ID:                     id,
@@ -103,13 +126,28 @@ func (b *JumperBiz) Update(id int, payload model.JumperPayload) (model.Jumper, e
 			Port:                   payload.Port,
 			User:                   payload.User,
 			AuthType:               payload.AuthType,
+			AuthMethods:            append([]string(nil), payload.AuthMethods...),
 			KeyPath:                payload.KeyPath,
+			CertificatePath:        payload.CertificatePath,
 			AgentSocketPath:        payload.AgentSocketPath,
+			ForwardAgent:           payload.ForwardAgent,
+			IdentitiesOnly:         payload.IdentitiesOnly,
+			IdentityFingerprint:    payload.IdentityFingerprint,
 			Password:               payload.Password,
+			TOTPSecret:             payload.TOTPSecret,
 			BypassHostVerification: payload.BypassHostVerification,
+			HostKeyPolicy:          payload.HostKeyPolicy,
+			HostKeyFingerprint:     payload.HostKeyFingerprint,
+			KnownHostsPath:         payload.KnownHostsPath,
+			HashKnownHosts:         payload.HashKnownHosts,
 			KeepAliveIntervalMs:    payload.KeepAliveIntervalMs,
 			TimeoutMs:              payload.TimeoutMs,
 			HostKeyAlgorithms:      payload.HostKeyAlgorithms,
+			Ciphers:                payload.Ciphers,
+			KeyExchanges:           payload.KeyExchanges,
+			MACs:                   payload.MACs,
+			ProxyCommand:           payload.ProxyCommand,
+			UpstreamProxy:          payload.UpstreamProxy,
 			Notes:                  payload.Notes,
 		}
 		cfg.Jumpers[idx] = updated
@@ -119,6 +157,8 @@ func (b *JumperBiz) Update(id int, payload model.JumperPayload) (model.Jumper, e
 		return model.Jumper{}, err
 	}
 
+	recordConfig(b.journal, "jumper", updated.Name, "updated")
+	b.bus.publishConfig("jumper", updated.ID, "updated")
 	return updated, nil
 }
 
@@ -127,6 +167,7 @@ func (b *JumperBiz) Delete(id int) error {
 		return fmt.Errorf("invalid jumper id")
 	}
 
+	var name string
 	_, err := b.storage.Update(func(cfg *conf.Config) error {
 		for _, tunnel := range cfg.Tunnels {
 			for _, jid := range tunnel.JumperIDs {
@@ -147,16 +188,60 @@ func (b *JumperBiz) Delete(id int) error {
 			return ErrJumperNotFound
 		}
 
+		name = cfg.Jumpers[idx].Name
 		cfg.Jumpers = append(cfg.Jumpers[:idx], cfg.Jumpers[idx+1:]...)
 		return nil
 	})
+	if err == nil {
+		recordConfig(b.journal, "jumper", name, "deleted")
+		b.bus.publishConfig("jumper", id, "deleted")
+	}
 	return err
 }
 
 func (b *JumperBiz) TestConnection(payload model.JumperPayload) error {
+	j, err := b.unsavedJumper(payload)
+	if err != nil {
+		return err
+	}
+	return forward.TestJumperConnection(j)
+}
+
+// CheckHostKey fetches the host key the jumper presents and reports whether
+// its pin or known_hosts trusts it.
+func (b *JumperBiz) CheckHostKey(payload model.JumperPayload) (model.HostKeyCheckResult, error) {
+	j, err := b.unsavedJumper(payload)
+	if err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	key, address, err := forward.FetchHostKey(j)
+	if err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	return hostKeyCheckResult(address, key, forward.CheckHostKey(j, address, key))
+}
+
+// TrustHostKey records the jumper's current host key in its known_hosts,
+// replacing conflicting entries. fingerprint must match the key the server
+// presents now so the user trusts exactly the key they were shown.
+func (b *JumperBiz) TrustHostKey(payload model.JumperPayload, fingerprint string) (model.HostKeyCheckResult, error) {
+	j, err := b.unsavedJumper(payload)
+	if err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	key, address, err := forward.TrustHostKey(j, fingerprint)
+	if err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	return hostKeyCheckResult(address, key, forward.CheckHostKey(j, address, key))
+}
+
+// unsavedJumper builds a jumper from an unsaved payload, filling the global
+// upstream proxy like saved jumpers get at start.
+func (b *JumperBiz) unsavedJumper(payload model.JumperPayload) (model.Jumper, error) {
 	payload = normalizeJumperPayload(payload)
 	if err := validateJumperPayload(payload); err != nil {
-		return err
+		return model.Jumper{}, err
 	}
 
 	j := model.Jumper{
@@ -165,17 +250,100 @@ func (b *JumperBiz) TestConnection(payload model.JumperPayload) error {
 		Port:                   payload.Port,
 		User:                   payload.User,
 		AuthType:               payload.AuthType,
+		AuthMethods:            append([]string(nil), payload.AuthMethods...),
 		KeyPath:                payload.KeyPath,
+		CertificatePath:        payload.CertificatePath,
 		AgentSocketPath:        payload.AgentSocketPath,
+		ForwardAgent:           payload.ForwardAgent,
+		IdentitiesOnly:         payload.IdentitiesOnly,
+		IdentityFingerprint:    payload.IdentityFingerprint,
 		Password:               payload.Password,
+		TOTPSecret:             payload.TOTPSecret,
 		BypassHostVerification: payload.BypassHostVerification,
+		HostKeyPolicy:          payload.HostKeyPolicy,
+		HostKeyFingerprint:     payload.HostKeyFingerprint,
+		KnownHostsPath:         payload.KnownHostsPath,
+		HashKnownHosts:         payload.HashKnownHosts,
 		KeepAliveIntervalMs:    payload.KeepAliveIntervalMs,
 		TimeoutMs:              payload.TimeoutMs,
 		HostKeyAlgorithms:      payload.HostKeyAlgorithms,
+		Ciphers:                payload.Ciphers,
+		KeyExchanges:           payload.KeyExchanges,
+		MACs:                   payload.MACs,
+		ProxyCommand:           payload.ProxyCommand,
+		UpstreamProxy:          payload.UpstreamProxy,
 		Notes:                  payload.Notes,
 	}
+	if j.UpstreamProxy == "" {
+		cfg, err := b.storage.Load()
+		if err != nil {
+			return model.Jumper{}, err
+		}
+		j.UpstreamProxy = cfg.UpstreamProxy
+	}
 
-	return forward.TestJumperConnection(j)
+	return j, nil
+}
+
+func hostKeyCheckResult(address string, key ssh.PublicKey, checkErr error) (model.HostKeyCheckResult, error) {
+	result := model.HostKeyCheckResult{
+		Host:        address,
+		Trusted:     checkErr == nil,
+		KeyType:     key.Type(),
+		Fingerprint: ssh.FingerprintSHA256(key),
+	}
+	if checkErr == nil {
+		return result, nil
+	}
+	var hkErr *forward.HostKeyError
+	if !errors.As(checkErr, &hkErr) {
+		return model.HostKeyCheckResult{}, checkErr
+	}
+	result.Reason = hkErr.Reason
+	result.KnownHostsPath = hkErr.KnownHostsPath
+	result.PinnedFingerprint = hkErr.PinnedFingerprint
+	result.ConflictLine = hkErr.ConflictLine
+	result.ConflictEntry = hkErr.ConflictEntry
+	result.ConflictKeyType = hkErr.ConflictKeyType
+	result.ConflictFingerprint = hkErr.ConflictFingerprint
+	return result, nil
+}
+
+// fillUnsentJumperFields copies stored values into the payload for the
+// connection settings a client left out, so a form that only knows the
+// basic fields does not erase the rest.
+func fillUnsentJumperFields(payload model.JumperPayload, stored model.Jumper) model.JumperPayload {
+	fill := func(key string, dst *string, src string) {
+		if !payload.Sets(key) {
+			*dst = src
+		}
+	}
+	fillBool := func(key string, dst *bool, src bool) {
+		if !payload.Sets(key) {
+			*dst = src
+		}
+	}
+	// A stored method chain only still applies while it starts with the
+	// method the client picked.
+	if !payload.Sets("authMethods") && len(stored.AuthMethods) > 0 && stored.AuthMethods[0] == payload.AuthType {
+		payload.AuthMethods = append([]string(nil), stored.AuthMethods...)
+	}
+	fillBool("forwardAgent", &payload.ForwardAgent, stored.ForwardAgent)
+	fillBool("identitiesOnly", &payload.IdentitiesOnly, stored.IdentitiesOnly)
+	fill("identityFingerprint", &payload.IdentityFingerprint, stored.IdentityFingerprint)
+	fill("totpSecret", &payload.TOTPSecret, stored.TOTPSecret)
+	fill("certificatePath", &payload.CertificatePath, stored.CertificatePath)
+	fill("hostKeyPolicy", &payload.HostKeyPolicy, stored.HostKeyPolicy)
+	fill("hostKeyFingerprint", &payload.HostKeyFingerprint, stored.HostKeyFingerprint)
+	fill("knownHostsPath", &payload.KnownHostsPath, stored.KnownHostsPath)
+	fillBool("hashKnownHosts", &payload.HashKnownHosts, stored.HashKnownHosts)
+	fill("hostKeyAlgorithms", &payload.HostKeyAlgorithms, stored.HostKeyAlgorithms)
+	fill("ciphers", &payload.Ciphers, stored.Ciphers)
+	fill("keyExchanges", &payload.KeyExchanges, stored.KeyExchanges)
+	fill("macs", &payload.MACs, stored.MACs)
+	fill("upstreamProxy", &payload.UpstreamProxy, stored.UpstreamProxy)
+	fill("proxyCommand", &payload.ProxyCommand, stored.ProxyCommand)
+	return payload
 }
 
 func normalizeJumperPayload(payload model.JumperPayload) model.JumperPayload {
@@ -184,8 +352,20 @@ func normalizeJumperPayload(payload model.JumperPayload) model.JumperPayload {
 	payload.User = strings.TrimSpace(payload.User)
 	payload.AuthType = strings.TrimSpace(payload.AuthType)
 	payload.KeyPath = strings.TrimSpace(payload.KeyPath)
+	payload.CertificatePath = strings.TrimSpace(payload.CertificatePath)
 	payload.AgentSocketPath = strings.TrimSpace(payload.AgentSocketPath)
 	payload.HostKeyAlgorithms = strings.TrimSpace(payload.HostKeyAlgorithms)
+	payload.Ciphers = strings.TrimSpace(payload.Ciphers)
+	payload.KeyExchanges = strings.TrimSpace(payload.KeyExchanges)
+	payload.MACs = strings.TrimSpace(payload.MACs)
+	payload.ProxyCommand = strings.TrimSpace(payload.ProxyCommand)
+	payload.UpstreamProxy = strings.TrimSpace(payload.UpstreamProxy)
+	payload.TOTPSecret = strings.TrimSpace(payload.TOTPSecret)
+	payload.IdentityFingerprint = strings.TrimSpace(payload.IdentityFingerprint)
+	payload.HostKeyPolicy = strings.TrimSpace(payload.HostKeyPolicy)
+	payload.HostKeyFingerprint = strings.TrimSpace(payload.HostKeyFingerprint)
+	payload.KnownHostsPath = strings.TrimSpace(payload.KnownHostsPath)
+	payload.AuthMethods = normalizeAuthMethods(payload.AuthMethods)
 	payload.Notes = strings.TrimSpace(payload.Notes)
 
 	if payload.Port <= 0 {
@@ -197,19 +377,67 @@ func normalizeJumperPayload(payload model.JumperPayload) model.JumperPayload {
 	if payload.KeepAliveIntervalMs < 0 {
 		payload.KeepAliveIntervalMs = defaultKeepAliveIntervalMs
 	}
+	if len(payload.AuthMethods) > 0 {
+		payload.AuthType = payload.AuthMethods[0]
+	}
 	if payload.AuthType == "" {
 		payload.AuthType = "ssh_key"
 	}
-	if payload.AuthType != "ssh_key" {
+	uses := func(method string) bool {
+		if len(payload.AuthMethods) == 0 {
+			return payload.AuthType == method
+		}
+		for _, m := range payload.AuthMethods {
+			if m == method {
+				return true
+			}
+		}
+		return false
+	}
+	if !uses("ssh_key") {
 		payload.KeyPath = ""
 	}
-	if payload.AuthType == "ssh_agent" {
+	if !uses("ssh_key") && !uses("ssh_agent") {
+		payload.CertificatePath = ""
+	}
+	if !uses("password") && !uses("ssh_key") && !uses("keyboard_interactive") {
 		payload.Password = ""
 	}
+	if !uses("keyboard_interactive") {
+		payload.TOTPSecret = ""
+	}
+	if !uses("ssh_agent") {
+		payload.IdentitiesOnly = false
+		payload.IdentityFingerprint = ""
+	}
 
 	return payload
 }
 
+// normalizeAuthMethods trims and de-duplicates an ordered auth method list.
+func normalizeAuthMethods(methods []string) []string {
+	if len(methods) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(methods))
+	seen := make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		method = strings.TrimSpace(method)
+		if method == "" {
+			continue
+		}
+		if _, ok := seen[method]; ok {
+			continue
+		}
+		seen[method] = struct{}{}
+		out = append(out, method)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
 func validateJumperPayload(payload model.JumperPayload) error {
 	if payload.Name == "" {
 		return fmt.Errorf("name is required")
@@ -232,18 +460,55 @@ func validateJumperPayload(payload model.JumperPayload) error {
 	if payload.KeepAliveIntervalMs > 0 && payload.KeepAliveIntervalMs < minKeepAliveIntervalMs {
 		return fmt.Errorf("keepAliveIntervalMs must be 0 (disable) or between %d and %d", minKeepAliveIntervalMs, maxKeepAliveIntervalMs)
 	}
-	switch payload.AuthType {
-	case "password":
-		if strings.TrimSpace(payload.Password) == "" {
-			return fmt.Errorf("password auth requires password")
-		}
-	case "ssh_key":
-		if payload.KeyPath == "" {
-			return fmt.Errorf("ssh_key auth requires keyPath")
+	methods := payload.AuthMethods
+	if len(methods) == 0 {
+		methods = []string{payload.AuthType}
+	}
+	for _, method := range methods {
+		switch method {
+		case "password":
+			if strings.TrimSpace(payload.Password) == "" {
+				return fmt.Errorf("password auth requires password")
+			}
+		case "ssh_key":
+			if payload.KeyPath == "" {
+				return fmt.Errorf("ssh_key auth requires keyPath")
+			}
+		case "ssh_agent":
+			if payload.IdentitiesOnly && payload.IdentityFingerprint == "" && payload.KeyPath == "" {
+				return fmt.Errorf("identitiesOnly requires identityFingerprint or an ssh_key method")
+			}
+		case "keyboard_interactive":
+			if payload.TOTPSecret != "" {
+				if err := totp.Validate(payload.TOTPSecret); err != nil {
+					return fmt.Errorf("totpSecret: %w", err)
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported authType: %s", method)
 		}
-	case "ssh_agent":
+	}
+	if err := netproxy.Validate(payload.UpstreamProxy); err != nil {
+		return fmt.Errorf("upstreamProxy: %w", err)
+	}
+	if err := forward.ValidateCiphers(payload.Ciphers); err != nil {
+		return fmt.Errorf("ciphers: %w", err)
+	}
+	if err := forward.ValidateKeyExchanges(payload.KeyExchanges); err != nil {
+		return fmt.Errorf("keyExchanges: %w", err)
+	}
+	if err := forward.ValidateMACs(payload.MACs); err != nil {
+		return fmt.Errorf("macs: %w", err)
+	}
+	switch payload.HostKeyPolicy {
+	case "", forward.HostKeyPolicyStrict, forward.HostKeyPolicyAcceptNew:
 	default:
-		return fmt.Errorf("unsupported authType: %s", payload.AuthType)
+		return fmt.Errorf("unsupported hostKeyPolicy: %s", payload.HostKeyPolicy)
+	}
+	if payload.HostKeyFingerprint != "" {
+		if err := forward.ValidateHostKeyFingerprint(payload.HostKeyFingerprint); err != nil {
+			return fmt.Errorf("hostKeyFingerprint: %w", err)
+		}
 	}
 	return nil
 }
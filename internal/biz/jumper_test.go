@@ -0,0 +1,201 @@
+package biz
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/model"
+)
+
+const testIdentityFingerprint = "SHA256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU"
+
+func decodeJumperPayload(t *testing.T, data string) model.JumperPayload {
+	t.Helper()
+	var payload model.JumperPayload
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	return payload
+}
+
+// basicJumperJSON is what a form that only knows the basic fields sends,
+// followed by extra, which must start with a comma when set.
+func basicJumperJSON(name, authType, extra string) string {
+	return `{
+		"name": "` + name + `", "host": "jump.example.com", "port": 22, "user": "root",
+		"authType": "` + authType + `", "keyPath": "", "agentSocketPath": "",
+		"password": "secret", "bypassHostVerification": false,
+		"keepAliveIntervalMs": 5000, "timeoutMs": 5000, "notes": ""` + extra + `
+	}`
+}
+
+func TestUpdateJumperKeepsFieldsThePayloadLeavesOut(t *testing.T) {
+	cases := []struct {
+		name string
+		// stored is the jumper before the update; its basic fields are
+		// filled in by the test.
+		stored model.JumperPayload
+		// clear sends the case's fields with empty values.
+		clear   string
+		kept    func(got, want model.Jumper) bool
+		cleared func(got model.Jumper) bool
+	}{
+		{
+			name:    "proxy command",
+			stored:  model.JumperPayload{AuthType: "password", ProxyCommand: "nc %h %p"},
+			clear:   `, "proxyCommand": ""`,
+			kept:    func(got, want model.Jumper) bool { return got.ProxyCommand == want.ProxyCommand },
+			cleared: func(got model.Jumper) bool { return got.ProxyCommand == "" },
+		},
+		{
+			name:    "upstream proxy",
+			stored:  model.JumperPayload{AuthType: "password", UpstreamProxy: "socks5://127.0.0.1:1080"},
+			clear:   `, "upstreamProxy": ""`,
+			kept:    func(got, want model.Jumper) bool { return got.UpstreamProxy == want.UpstreamProxy },
+			cleared: func(got model.Jumper) bool { return got.UpstreamProxy == "" },
+		},
+		{
+			name:    "totp secret",
+			stored:  model.JumperPayload{AuthType: "keyboard_interactive", TOTPSecret: "JBSWY3DPEHPK3PXP"},
+			clear:   `, "totpSecret": ""`,
+			kept:    func(got, want model.Jumper) bool { return got.TOTPSecret == want.TOTPSecret },
+			cleared: func(got model.Jumper) bool { return got.TOTPSecret == "" },
+		},
+		{
+			name:    "certificate",
+			stored:  model.JumperPayload{AuthType: "ssh_agent", CertificatePath: "/tmp/id_ed25519-cert.pub"},
+			clear:   `, "certificatePath": ""`,
+			kept:    func(got, want model.Jumper) bool { return got.CertificatePath == want.CertificatePath },
+			cleared: func(got model.Jumper) bool { return got.CertificatePath == "" },
+		},
+		{
+			name: "auth methods and identity filter",
+			stored: model.JumperPayload{
+				AuthType:            "password",
+				AuthMethods:         []string{"password", "ssh_agent"},
+				IdentitiesOnly:      true,
+				IdentityFingerprint: testIdentityFingerprint,
+			},
+			clear: `, "authMethods": [], "identitiesOnly": false, "identityFingerprint": ""`,
+			kept: func(got, want model.Jumper) bool {
+				return slices.Equal(got.AuthMethods, want.AuthMethods) && got.IdentitiesOnly && got.IdentityFingerprint == want.IdentityFingerprint
+			},
+			cleared: func(got model.Jumper) bool {
+				return len(got.AuthMethods) == 0 && !got.IdentitiesOnly && got.IdentityFingerprint == ""
+			},
+		},
+		{
+			name: "host key settings",
+			stored: model.JumperPayload{
+				AuthType:           "password",
+				HostKeyPolicy:      "accept_new",
+				HostKeyFingerprint: testIdentityFingerprint,
+				KnownHostsPath:     "/tmp/known_hosts",
+				HashKnownHosts:     true,
+			},
+			clear: `, "hostKeyPolicy": "", "hostKeyFingerprint": "", "knownHostsPath": "", "hashKnownHosts": false`,
+			kept: func(got, want model.Jumper) bool {
+				return got.HostKeyPolicy == want.HostKeyPolicy && got.HostKeyFingerprint == want.HostKeyFingerprint &&
+					got.KnownHostsPath == want.KnownHostsPath && got.HashKnownHosts
+			},
+			cleared: func(got model.Jumper) bool {
+				return got.HostKeyPolicy == "" && got.HostKeyFingerprint == "" && got.KnownHostsPath == "" && !got.HashKnownHosts
+			},
+		},
+		{
+			name:   "algorithms",
+			stored: model.JumperPayload{AuthType: "password", Ciphers: "aes128-ctr", KeyExchanges: "curve25519-sha256", MACs: "hmac-sha2-256"},
+			clear:  `, "ciphers": "", "keyExchanges": "", "macs": ""`,
+			kept: func(got, want model.Jumper) bool {
+				return got.Ciphers == want.Ciphers && got.KeyExchanges == want.KeyExchanges && got.MACs == want.MACs
+			},
+			cleared: func(got model.Jumper) bool { return got.Ciphers == "" && got.KeyExchanges == "" && got.MACs == "" },
+		},
+		{
+			name:    "agent forwarding",
+			stored:  model.JumperPayload{AuthType: "ssh_agent", ForwardAgent: true},
+			clear:   `, "forwardAgent": false`,
+			kept:    func(got, want model.Jumper) bool { return got.ForwardAgent },
+			cleared: func(got model.Jumper) bool { return !got.ForwardAgent },
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage, err := conf.NewStorage(filepath.Join(t.TempDir(), "config.toml"))
+			if err != nil {
+				t.Fatalf("new storage: %v", err)
+			}
+			jumpers := NewJumperBiz(storage)
+			stored := tc.stored
+			stored.Name, stored.Host, stored.User, stored.Password = "jump", "jump.example.com", "root", "secret"
+			created, err := jumpers.Create(stored)
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if tc.cleared(created) {
+				t.Fatalf("create did not store the case's fields: %+v", created)
+			}
+
+			// An older form only sends the basic fields.
+			updated, err := jumpers.Update(created.ID, decodeJumperPayload(t, basicJumperJSON("jump-renamed", stored.AuthType, "")))
+			if err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			if updated.Name != "jump-renamed" || !tc.kept(updated, created) {
+				t.Fatalf("update dropped fields the payload left out:\n got %+v\nwant %+v", updated, created)
+			}
+
+			// Sending a field, even empty, still replaces it.
+			updated, err = jumpers.Update(created.ID, decodeJumperPayload(t, basicJumperJSON("jump", stored.AuthType, tc.clear)))
+			if err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			if !tc.cleared(updated) {
+				t.Fatalf("cleared update = %+v", updated)
+			}
+
+			// Payloads built in Go set every field.
+			if _, err := jumpers.Update(created.ID, stored); err != nil {
+				t.Fatalf("restore: %v", err)
+			}
+			updated, err = jumpers.Update(created.ID, model.JumperPayload{Name: "jump", Host: "jump.example.com", User: "root", AuthType: "ssh_agent"})
+			if err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			if !tc.cleared(updated) {
+				t.Fatalf("full update = %+v", updated)
+			}
+		})
+	}
+}
+
+func TestUpdateJumperValidatesWithStoredFields(t *testing.T) {
+	storage, err := conf.NewStorage(filepath.Join(t.TempDir(), "config.toml"))
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+	jumpers := NewJumperBiz(storage)
+	created, err := jumpers.Create(model.JumperPayload{
+		Name:                "jump",
+		Host:                "jump.example.com",
+		User:                "root",
+		AuthMethods:         []string{"ssh_agent"},
+		IdentityFingerprint: testIdentityFingerprint,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// identitiesOnly needs a fingerprint, which only the stored jumper has.
+	updated, err := jumpers.Update(created.ID, decodeJumperPayload(t, basicJumperJSON("jump", "ssh_agent", `, "identitiesOnly": true`)))
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if !updated.IdentitiesOnly || updated.IdentityFingerprint != testIdentityFingerprint {
+		t.Fatalf("updated = %+v", updated)
+	}
+}
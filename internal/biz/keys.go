@@ -0,0 +1,137 @@
+package biz
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/keys"
+	"loris-tunnel/internal/model"
+)
+
+// keysDir is the managed key directory, next to the config file.
+func (b *JumperBiz) keysDir() string {
+	return filepath.Join(filepath.Dir(b.storage.Path()), "keys")
+}
+
+func (b *JumperBiz) ListKeys() ([]model.SSHKey, error) {
+	list, err := keys.List(b.keysDir())
+	if err != nil {
+		return nil, err
+	}
+	items := make([]model.SSHKey, 0, len(list))
+	for _, key := range list {
+		items = append(items, sshKeyModel(key))
+	}
+	return items, nil
+}
+
+func (b *JumperBiz) GenerateKey(payload model.SSHKeyGeneratePayload) (model.SSHKey, error) {
+	key, err := keys.Generate(b.keysDir(), keys.GenerateOptions{
+		Name:       payload.Name,
+		Type:       payload.Type,
+		Bits:       payload.Bits,
+		Passphrase: payload.Passphrase,
+		Comment:    payload.Comment,
+	})
+	if err != nil {
+		return model.SSHKey{}, err
+	}
+	slog.Info("ssh key generated", "name", key.Name, "type", key.Type, "fingerprint", key.Fingerprint)
+	return sshKeyModel(key), nil
+}
+
+// InstallKey appends a managed public key to ~/.ssh/authorized_keys on a
+// saved jumper, logging in with the jumper's current auth. Once a login
+// with the key succeeds the jumper is switched to ssh_key auth with that
+// key; passphrase must unlock the key and is saved for it.
+func (b *JumperBiz) InstallKey(jumperID int, keyName string, passphrase string) (model.SSHKeyInstallResult, error) {
+	key, err := keys.Load(b.keysDir(), strings.TrimSpace(keyName))
+	if err != nil {
+		return model.SSHKeyInstallResult{}, err
+	}
+	if err := keys.CheckPassphrase(key, passphrase); err != nil {
+		return model.SSHKeyInstallResult{}, err
+	}
+	command, err := keys.InstallCommand(key.AuthorizedKey)
+	if err != nil {
+		return model.SSHKeyInstallResult{}, err
+	}
+
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return model.SSHKeyInstallResult{}, err
+	}
+	jumper, ok := findJumperByID(cfg.Jumpers, jumperID)
+	if !ok {
+		return model.SSHKeyInstallResult{}, ErrJumperNotFound
+	}
+	chain := cfg.ApplyUpstreamProxy([]model.Jumper{jumper})
+
+	stdout, stderr, err := forward.ExecuteRemoteCommand(chain, command)
+	if err != nil {
+		if msg := strings.TrimSpace(stderr); msg != "" {
+			return model.SSHKeyInstallResult{}, fmt.Errorf("install key on %s failed: %w: %s", jumper.Name, err, msg)
+		}
+		return model.SSHKeyInstallResult{}, fmt.Errorf("install key on %s failed: %w", jumper.Name, err)
+	}
+	status := strings.TrimSpace(stdout)
+	if status != keys.InstallAdded && status != keys.InstallPresent {
+		return model.SSHKeyInstallResult{}, fmt.Errorf("install key on %s failed: unexpected output %q", jumper.Name, status)
+	}
+
+	switched := withKeyAuth(chain[0], key, passphrase)
+	if err := forward.TestJumperConnection(switched); err != nil {
+		return model.SSHKeyInstallResult{}, fmt.Errorf("key installed on %s but login with it failed, jumper auth unchanged: %w", jumper.Name, err)
+	}
+
+	var saved model.Jumper
+	_, err = b.storage.Update(func(cfg *conf.Config) error {
+		for i := range cfg.Jumpers {
+			if cfg.Jumpers[i].ID == jumperID {
+				cfg.Jumpers[i] = withKeyAuth(cfg.Jumpers[i], key, passphrase)
+				saved = cfg.Jumpers[i]
+				return nil
+			}
+		}
+		return ErrJumperNotFound
+	})
+	if err != nil {
+		return model.SSHKeyInstallResult{}, err
+	}
+	recordConfig(b.journal, "jumper", saved.Name, "updated")
+	b.bus.publishConfig("jumper", jumperID, "updated")
+	slog.Info("ssh key installed", "jumper", jumper.Name, "key", key.Name, "fingerprint", key.Fingerprint, "already_present", status == keys.InstallPresent)
+	return model.SSHKeyInstallResult{Jumper: saved, AlreadyPresent: status == keys.InstallPresent}, nil
+}
+
+// withKeyAuth switches jumper to authenticate with key only.
+func withKeyAuth(jumper model.Jumper, key keys.Key, passphrase string) model.Jumper {
+	jumper.AuthType = "ssh_key"
+	jumper.AuthMethods = nil
+	jumper.KeyPath = key.PrivateKeyPath
+	jumper.CertificatePath = ""
+	jumper.IdentitiesOnly = false
+	jumper.IdentityFingerprint = ""
+	jumper.Password = passphrase
+	jumper.TOTPSecret = ""
+	return jumper
+}
+
+func sshKeyModel(key keys.Key) model.SSHKey {
+	return model.SSHKey{
+		Name:           key.Name,
+		Type:           key.Type,
+		Bits:           key.Bits,
+		Fingerprint:    key.Fingerprint,
+		Comment:        key.Comment,
+		PrivateKeyPath: key.PrivateKeyPath,
+		PublicKeyPath:  key.PublicKeyPath,
+		PublicKey:      key.AuthorizedKey,
+		Encrypted:      key.Encrypted,
+		CreatedAt:      key.CreatedAt,
+	}
+}
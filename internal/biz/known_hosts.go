@@ -0,0 +1,193 @@
+package biz
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/hostkeys"
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrKnownHostsFileNotUsed = errors.New("known_hosts file is not used by any jumper")
+	ErrKnownHostEntryMarker  = errors.New("cert-authority and revoked entries cannot be replaced with a host key")
+	ErrKnownHostEntryUnused  = errors.New("known_hosts entry does not apply to the jumper")
+)
+
+// ListKnownHosts returns the known_hosts entries that apply to configured
+// jumpers, each with the ids of the jumpers it applies to.
+func (b *JumperBiz) ListKnownHosts() ([]model.KnownHostEntry, error) {
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := make(map[string][]hostkeys.Entry)
+	byLine := make(map[string]*model.KnownHostEntry)
+	var out []*model.KnownHostEntry
+	for _, jumper := range cfg.Jumpers {
+		path, err := forward.KnownHostsPath(jumper)
+		if err != nil {
+			return nil, err
+		}
+		entries, ok := parsed[path]
+		if !ok {
+			entries, err = hostkeys.Parse(path)
+			if err != nil {
+				return nil, err
+			}
+			parsed[path] = entries
+		}
+		address := jumperAddress(jumper)
+		for _, entry := range entries {
+			if !entry.Matches(address) {
+				continue
+			}
+			key := path + ":" + strconv.Itoa(entry.Line)
+			item, ok := byLine[key]
+			if !ok {
+				item = &model.KnownHostEntry{
+					Path:        path,
+					Line:        entry.Line,
+					Marker:      entry.Marker,
+					Hosts:       entry.Hosts,
+					Hashed:      entry.Hashed,
+					KeyType:     entry.KeyType,
+					Fingerprint: entry.Fingerprint,
+					Comment:     entry.Comment,
+				}
+				byLine[key] = item
+				out = append(out, item)
+			}
+			item.JumperIDs = append(item.JumperIDs, jumper.ID)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Line < out[j].Line
+	})
+	items := make([]model.KnownHostEntry, 0, len(out))
+	for _, item := range out {
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// RemoveKnownHost deletes a known_hosts line. path must be the known_hosts
+// file of a configured jumper and fingerprint the key listed for the line.
+func (b *JumperBiz) RemoveKnownHost(path string, line int, fingerprint string) error {
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return err
+	}
+	path, err = usedKnownHostsPath(cfg.Jumpers, path)
+	if err != nil {
+		return err
+	}
+	return hostkeys.Remove(path, line, fingerprint)
+}
+
+// ReplaceKnownHost swaps the key on a known_hosts line for the key the jumper
+// presents now, keeping the line's host patterns. fingerprint is the key listed
+// for the line and newFingerprint the presented key the user agreed to; if the
+// server presents a different key by then, nothing is written and the error
+// wraps forward.ErrHostKeyChanged.
+func (b *JumperBiz) ReplaceKnownHost(jumperID int, line int, fingerprint, newFingerprint string) (model.HostKeyCheckResult, error) {
+	if err := forward.ValidateHostKeyFingerprint(newFingerprint); err != nil {
+		return model.HostKeyCheckResult{}, fmt.Errorf("new fingerprint: %w", err)
+	}
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	jumper, ok := findJumperByID(cfg.Jumpers, jumperID)
+	if !ok {
+		return model.HostKeyCheckResult{}, ErrJumperNotFound
+	}
+	jumper = cfg.ApplyUpstreamProxy([]model.Jumper{jumper})[0]
+	path, err := forward.KnownHostsPath(jumper)
+	if err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+
+	entries, err := hostkeys.Parse(path)
+	if err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	var target *hostkeys.Entry
+	for i := range entries {
+		if entries[i].Line == line {
+			target = &entries[i]
+			break
+		}
+	}
+	if target == nil || !target.Matches(jumperAddress(jumper)) {
+		return model.HostKeyCheckResult{}, ErrKnownHostEntryUnused
+	}
+	if target.Marker != "" {
+		return model.HostKeyCheckResult{}, ErrKnownHostEntryMarker
+	}
+
+	key, address, err := forward.FetchHostKey(jumper)
+	if err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	if presented := ssh.FingerprintSHA256(key); presented != hostkeys.NormalizeFingerprint(newFingerprint) {
+		return model.HostKeyCheckResult{}, fmt.Errorf("%w: server now presents %s", forward.ErrHostKeyChanged, presented)
+	}
+	if err := hostkeys.Replace(path, line, fingerprint, key); err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	return hostKeyCheckResult(address, key, forward.CheckHostKey(jumper, address, key))
+}
+
+// FetchHostKey connects to a saved jumper without authenticating and reports
+// the host key it presents and whether it is trusted.
+func (b *JumperBiz) FetchHostKey(jumperID int) (model.HostKeyCheckResult, error) {
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	jumper, ok := findJumperByID(cfg.Jumpers, jumperID)
+	if !ok {
+		return model.HostKeyCheckResult{}, ErrJumperNotFound
+	}
+	jumper = cfg.ApplyUpstreamProxy([]model.Jumper{jumper})[0]
+	key, address, err := forward.FetchHostKey(jumper)
+	if err != nil {
+		return model.HostKeyCheckResult{}, err
+	}
+	return hostKeyCheckResult(address, key, forward.CheckHostKey(jumper, address, key))
+}
+
+func usedKnownHostsPath(jumpers []model.Jumper, path string) (string, error) {
+	want := filepath.Clean(path)
+	for _, jumper := range jumpers {
+		used, err := forward.KnownHostsPath(jumper)
+		if err != nil {
+			return "", err
+		}
+		if filepath.Clean(used) == want {
+			return used, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrKnownHostsFileNotUsed, path)
+}
+
+func jumperAddress(jumper model.Jumper) string {
+	port := jumper.Port
+	if port <= 0 {
+		port = 22
+	}
+	return net.JoinHostPort(jumper.Host, strconv.Itoa(port))
+}
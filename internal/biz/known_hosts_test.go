@@ -0,0 +1,120 @@
+package biz
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/hostkeys"
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestHostKey(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("host signer: %v", err)
+	}
+	return signer
+}
+
+// startHostKeyServer accepts SSH handshakes presenting hostKey; it never lets
+// a client authenticate.
+func startHostKeyServer(t *testing.T, hostKey ssh.Signer) (string, int) {
+	t.Helper()
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, errors.New("test server")
+		},
+	}
+	config.AddHostKey(hostKey)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _, _, _ = ssh.NewServerConn(conn, config)
+			}()
+		}
+	}()
+	host, portText, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	return host, port
+}
+
+func TestReplaceKnownHostChecksPresentedFingerprint(t *testing.T) {
+	storage, err := conf.NewStorage(filepath.Join(t.TempDir(), "config.toml"))
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+	presented := newTestHostKey(t)
+	host, port := startHostKeyServer(t, presented)
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	old := newTestHostKey(t).PublicKey()
+	if err := hostkeys.Append(knownHosts, net.JoinHostPort(host, strconv.Itoa(port)), old, false); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	jumpers := NewJumperBiz(storage)
+	jumper, err := jumpers.Create(model.JumperPayload{
+		Name:           "jump",
+		Host:           host,
+		Port:           port,
+		User:           "root",
+		AuthType:       "password",
+		Password:       "secret",
+		KnownHostsPath: knownHosts,
+		TimeoutMs:      2000,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	oldFingerprint := ssh.FingerprintSHA256(old)
+	before, err := os.ReadFile(knownHosts)
+	if err != nil {
+		t.Fatalf("read known_hosts: %v", err)
+	}
+
+	// The user agreed to a key the server no longer presents.
+	shown := ssh.FingerprintSHA256(newTestHostKey(t).PublicKey())
+	if _, err := jumpers.ReplaceKnownHost(jumper.ID, 1, oldFingerprint, shown); !errors.Is(err, forward.ErrHostKeyChanged) {
+		t.Fatalf("mismatch err = %v, want ErrHostKeyChanged", err)
+	}
+	if after, _ := os.ReadFile(knownHosts); string(after) != string(before) {
+		t.Fatalf("known_hosts changed on mismatch:\n%s", after)
+	}
+
+	result, err := jumpers.ReplaceKnownHost(jumper.ID, 1, oldFingerprint, ssh.FingerprintSHA256(presented.PublicKey()))
+	if err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	if result.Fingerprint != ssh.FingerprintSHA256(presented.PublicKey()) {
+		t.Fatalf("result = %+v", result)
+	}
+	entries, err := hostkeys.Parse(knownHosts)
+	if err != nil || len(entries) != 1 || entries[0].Fingerprint != ssh.FingerprintSHA256(presented.PublicKey()) {
+		t.Fatalf("entries = %+v, err = %v", entries, err)
+	}
+}
@@ -0,0 +1,64 @@
+package biz
+
+import (
+	"time"
+
+	"loris-tunnel/internal/latency"
+	"loris-tunnel/internal/model"
+)
+
+// TunnelLatency returns the tunnel's latency samples over the last window;
+// window <= 0 returns everything kept. Each sample is the round trip through
+// the tunnel's whole chain.
+func (b *TunnelBiz) TunnelLatency(id int, window time.Duration) model.LatencyHistory {
+	return latencyHistory(b.latency.Tunnel(id, windowStart(window)))
+}
+
+// JumperLatency returns the latency samples of every tunnel that reaches the
+// jumper directly over the last window.
+func (b *TunnelBiz) JumperLatency(id int, window time.Duration) model.LatencyHistory {
+	return latencyHistory(b.latency.Jumper(id, windowStart(window)))
+}
+
+// latencyHopID is the jumper a tunnel's probes measure on their own, or 0.
+// A probe crosses every hop of the chain, so only a single-hop tunnel's
+// samples can be put down to one jumper.
+func latencyHopID(jumpers []model.Jumper) int {
+	if len(jumpers) != 1 {
+		return 0
+	}
+	return jumpers[0].ID
+}
+
+func windowStart(window time.Duration) time.Time {
+	if window <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-window)
+}
+
+func latencyHistory(samples []latency.Sample) model.LatencyHistory {
+	out := model.LatencyHistory{Samples: make([]model.LatencySample, 0, len(samples))}
+	for _, s := range samples {
+		item := model.LatencySample{Time: s.Time, Failed: s.Failed, TimedOut: s.TimedOut}
+		if !s.Failed && !s.TimedOut {
+			item.LatencyMs = durationMs(s.Latency)
+		}
+		out.Samples = append(out.Samples, item)
+	}
+	stats := latency.Summarize(samples)
+	out.Stats = model.LatencyStats{
+		Count:    stats.Count,
+		Failures: stats.Failures,
+		Timeouts: stats.Timeouts,
+		MinMs:    durationMs(stats.Min),
+		AvgMs:    durationMs(stats.Avg),
+		P95Ms:    durationMs(stats.P95),
+		JitterMs: durationMs(stats.Jitter),
+	}
+	return out
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
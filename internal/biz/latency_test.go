@@ -0,0 +1,24 @@
+package biz
+
+import (
+	"testing"
+
+	"loris-tunnel/internal/model"
+)
+
+func TestLatencyHopIDOnlyForSingleHopChains(t *testing.T) {
+	cases := []struct {
+		jumpers []model.Jumper
+		want    int
+	}{
+		{nil, 0},
+		{[]model.Jumper{{ID: 7}}, 7},
+		// The round trip also crosses jumper 3, so it is no measure of 7.
+		{[]model.Jumper{{ID: 3}, {ID: 7}}, 0},
+	}
+	for _, tc := range cases {
+		if got := latencyHopID(tc.jumpers); got != tc.want {
+			t.Fatalf("latencyHopID(%+v) = %d, want %d", tc.jumpers, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package biz
+
+import (
+	"sync/atomic"
+
+	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/model"
+)
+
+// tunnelCounters are the metrics of one tunnel across its runs. The forward
+// runtime records events into Counters; bytes of runs that have ended are
+// folded in here because LocalForward.Traffic only covers a single run.
+type tunnelCounters struct {
+	forward.Counters
+	bytesUp   atomic.Uint64
+	bytesDown atomic.Uint64
+}
+
+// Metrics returns the counters of every configured tunnel, in config order.
+func (b *TunnelBiz) Metrics() ([]model.TunnelMetrics, error) {
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]model.TunnelMetrics, 0, len(cfg.Tunnels))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, t := range cfg.Tunnels {
+		m := model.TunnelMetrics{ID: t.ID, Name: t.Name, Mode: t.Mode}
+		if c, ok := b.counters[t.ID]; ok {
+			m.BytesUp = c.bytesUp.Load()
+			m.BytesDown = c.bytesDown.Load()
+			m.ReconnectAttempts = c.ReconnectAttempts.Load()
+			m.Disconnects = c.Disconnects.Load()
+			m.DialFailures = c.DialFailures.Load()
+		}
+		if run, ok := b.runs[t.ID]; ok && run != nil {
+			up, down := run.Traffic()
+			m.BytesUp += up
+			m.BytesDown += down
+			m.Running = t.Status == "running"
+			m.ActiveConns = run.ActiveConns()
+			if rtt, ok := run.LastLatency(); ok {
+				m.LatencyMs = durationMs(rtt)
+			}
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// Metrics returns the handshake failures of every configured jumper.
+func (b *JumperBiz) Metrics() ([]model.JumperMetrics, error) {
+	jumpers, err := b.List()
+	if err != nil {
+		return nil, err
+	}
+	failures := forward.HandshakeFailures()
+	out := make([]model.JumperMetrics, 0, len(jumpers))
+	for _, j := range jumpers {
+		out = append(out, model.JumperMetrics{ID: j.ID, Name: j.Name, HandshakeFailures: failures[j.ID]})
+	}
+	return out, nil
+}
+
+// countersFor returns the tunnel's counters, creating them on first use.
+// Callers hold b.mu.
+func (b *TunnelBiz) countersFor(id int) *tunnelCounters {
+	c, ok := b.counters[id]
+	if !ok {
+		c = &tunnelCounters{}
+		b.counters[id] = c
+	}
+	return c
+}
+
+// retireTraffic adds the bytes moved by a run that is leaving b.runs to the
+// tunnel's totals, so the byte counters never go backwards. Callers hold
+// b.mu.
+func (b *TunnelBiz) retireTraffic(id int, run *forward.LocalForward) {
+	if run == nil {
+		return
+	}
+	up, down := run.Traffic()
+	c := b.countersFor(id)
+	c.bytesUp.Add(up)
+	c.bytesDown.Add(down)
+}
+
+func (b *TunnelBiz) forgetCounters(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.counters, id)
+}
@@ -0,0 +1,50 @@
+package biz
+
+import (
+	"testing"
+)
+
+func TestTunnelMetricsSurviveRunsAndDelete(t *testing.T) {
+	tunnelBiz, payload := newDependencyTestBiz(t)
+	db, err := tunnelBiz.Create(payload("db", 15432))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+
+	tunnelBiz.mu.Lock()
+	c := tunnelBiz.countersFor(db.ID)
+	c.bytesUp.Add(100)
+	c.bytesDown.Add(200)
+	c.Disconnects.Add(2)
+	c.ReconnectAttempts.Add(5)
+	tunnelBiz.mu.Unlock()
+
+	// A failed start must not reset what earlier runs recorded.
+	if _, err := tunnelBiz.Toggle(db.ID, 0); err != nil {
+		t.Fatalf("toggle db: %v", err)
+	}
+	items, err := tunnelBiz.Metrics()
+	if err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("metrics = %+v", items)
+	}
+	got := items[0]
+	if got.Name != "db" || got.Mode != "local" || got.Running {
+		t.Fatalf("metrics = %+v", got)
+	}
+	if got.BytesUp != 100 || got.BytesDown != 200 || got.Disconnects != 2 || got.ReconnectAttempts != 5 {
+		t.Fatalf("counters = %+v", got)
+	}
+
+	if err := tunnelBiz.Delete(db.ID); err != nil {
+		t.Fatalf("delete db: %v", err)
+	}
+	tunnelBiz.mu.Lock()
+	_, kept := tunnelBiz.counters[db.ID]
+	tunnelBiz.mu.Unlock()
+	if kept {
+		t.Fatal("counters kept after delete")
+	}
+}
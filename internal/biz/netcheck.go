@@ -0,0 +1,60 @@
+package biz
+
+import (
+	"log/slog"
+	"sync"
+
+	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/netwatch"
+)
+
+const tunnelLogSourceNetwork = "network"
+
+// ProbeAll immediately probes the SSH connection of every running tunnel
+// after the network changed or the machine woke up. Stale connections are
+// closed so their tunnels reconnect now rather than when keepalives time
+// out. Overlapping calls are dropped while a round is in flight.
+func (b *TunnelBiz) ProbeAll(reason, detail string) {
+	if !b.probing.CompareAndSwap(false, true) {
+		return
+	}
+	defer b.probing.Store(false)
+
+	b.mu.Lock()
+	runs := make(map[int]*forward.LocalForward, len(b.runs))
+	for id, run := range b.runs {
+		runs[id] = run
+	}
+	b.mu.Unlock()
+	if len(runs) == 0 {
+		return
+	}
+
+	slog.Info("probing tunnels after network change", "reason", reason, "count", len(runs))
+	var wg sync.WaitGroup
+	for id, run := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := run.ProbeConnection(forward.DefaultProbeTimeout)
+			if err == nil {
+				return
+			}
+			message := "network changed, reconnecting stale connection"
+			if reason == netwatch.ReasonResume {
+				message = "woke from sleep, reconnecting stale connection"
+			}
+			if detail != "" {
+				message += " (" + detail + ")"
+			}
+			b.appendLog(id, model.TunnelLogEntry{
+				Source:  tunnelLogSourceNetwork,
+				Event:   reason,
+				Message: message,
+				Error:   err.Error(),
+			})
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,223 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/journal"
+	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/notify"
+)
+
+var (
+	ErrNotificationNotFound   = errors.New("notification not found")
+	ErrNotificationNameExists = errors.New("notification name already exists")
+)
+
+type NotificationBiz struct {
+	storage *conf.Storage
+	journal *journal.Journal
+	bus     *Bus
+}
+
+func NewNotificationBiz(storage *conf.Storage) *NotificationBiz {
+	return &NotificationBiz{storage: storage}
+}
+
+// SetJournal makes the biz record config edits into j.
+func (b *NotificationBiz) SetJournal(j *journal.Journal) { b.journal = j }
+
+func (b *NotificationBiz) List() ([]model.NotificationSink, error) {
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	items := append([]model.NotificationSink{}, cfg.Notifications...)
+	return items, nil
+}
+
+func (b *NotificationBiz) Create(payload model.NotificationSinkPayload) (model.NotificationSink, error) {
+	sink := notificationFromPayload(0, payload)
+	if err := validateNotification(sink); err != nil {
+		return model.NotificationSink{}, err
+	}
+
+	_, err := b.storage.Update(func(cfg *conf.Config) error {
+		if notificationNameTaken(cfg.Notifications, sink.Name, 0) {
+			return ErrNotificationNameExists
+		}
+		if err := validateProfileTunnels(cfg.Tunnels, sink.TunnelIDs); err != nil {
+			return err
+		}
+
+		sink.ID = nextNotificationID(cfg.Notifications)
+		cfg.Notifications = append(cfg.Notifications, sink)
+		return nil
+	})
+	if err != nil {
+		return model.NotificationSink{}, err
+	}
+
+	recordConfig(b.journal, "notification", sink.Name, "created")
+	b.bus.publishConfig("notification", sink.ID, "created")
+	return sink, nil
+}
+
+func (b *NotificationBiz) Update(id int, payload model.NotificationSinkPayload) (model.NotificationSink, error) {
+	if id <= 0 {
+		return model.NotificationSink{}, fmt.Errorf("invalid notification id")
+	}
+
+	sink := notificationFromPayload(id, payload)
+	if err := validateNotification(sink); err != nil {
+		return model.NotificationSink{}, err
+	}
+
+	_, err := b.storage.Update(func(cfg *conf.Config) error {
+		idx := slices.IndexFunc(cfg.Notifications, func(s model.NotificationSink) bool { return s.ID == id })
+		if idx == -1 {
+			return ErrNotificationNotFound
+		}
+		if notificationNameTaken(cfg.Notifications, sink.Name, id) {
+			return ErrNotificationNameExists
+		}
+		if err := validateProfileTunnels(cfg.Tunnels, sink.TunnelIDs); err != nil {
+			return err
+		}
+
+		cfg.Notifications[idx] = sink
+		return nil
+	})
+	if err != nil {
+		return model.NotificationSink{}, err
+	}
+
+	recordConfig(b.journal, "notification", sink.Name, "updated")
+	b.bus.publishConfig("notification", sink.ID, "updated")
+	return sink, nil
+}
+
+func (b *NotificationBiz) Delete(id int) error {
+	if id <= 0 {
+		return fmt.Errorf("invalid notification id")
+	}
+
+	var name string
+	_, err := b.storage.Update(func(cfg *conf.Config) error {
+		idx := slices.IndexFunc(cfg.Notifications, func(s model.NotificationSink) bool { return s.ID == id })
+		if idx == -1 {
+			return ErrNotificationNotFound
+		}
+
+		name = cfg.Notifications[idx].Name
+		cfg.Notifications = append(cfg.Notifications[:idx], cfg.Notifications[idx+1:]...)
+		return nil
+	})
+	if err == nil {
+		recordConfig(b.journal, "notification", name, "deleted")
+		b.bus.publishConfig("notification", id, "deleted")
+	}
+	return err
+}
+
+// Source gives a notifier the configured sinks and tunnel names, read from
+// the config whenever the notifier refreshes.
+func (b *NotificationBiz) Source() notify.Source {
+	return notify.Source{
+		Sinks: b.List,
+		TunnelNames: func() (map[int]string, error) {
+			cfg, err := b.storage.Load()
+			if err != nil {
+				return nil, err
+			}
+			names := make(map[int]string, len(cfg.Tunnels))
+			for _, t := range cfg.Tunnels {
+				names[t.ID] = t.Name
+			}
+			return names, nil
+		},
+	}
+}
+
+// Test sends a sample notification through a sink that has not been saved
+// yet, once and without retries, so the form can be checked as filled in.
+func (b *NotificationBiz) Test(ctx context.Context, payload model.NotificationSinkPayload) error {
+	sink := notificationFromPayload(0, payload)
+	if err := validateNotification(sink); err != nil {
+		return err
+	}
+	return notify.Send(ctx, sink, notify.Sample(sink.Name))
+}
+
+func notificationFromPayload(id int, payload model.NotificationSinkPayload) model.NotificationSink {
+	sink := model.NotificationSink{
+		ID:            id,
+		Name:          strings.TrimSpace(payload.Name),
+		Type:          strings.ToLower(strings.TrimSpace(payload.Type)),
+		Enabled:       payload.Enabled,
+		TunnelIDs:     normalizeJumperIDs(payload.TunnelIDs),
+		Events:        []string{},
+		DebounceMs:    min(max(payload.DebounceMs, 0), notify.MaxDebounceMs),
+		FlapThreshold: max(payload.FlapThreshold, 0),
+		FlapWindowMs:  max(payload.FlapWindowMs, 0),
+		Retries:       min(max(payload.Retries, 0), notify.MaxRetries),
+	}
+	for _, event := range payload.Events {
+		event = strings.TrimSpace(event)
+		if event != "" && !slices.Contains(sink.Events, event) {
+			sink.Events = append(sink.Events, event)
+		}
+	}
+	// Keep only the fields of the chosen type so switching types in the
+	// form does not leave a stale URL or command behind.
+	switch sink.Type {
+	case notify.TypeWebhook:
+		sink.URL = strings.TrimSpace(payload.URL)
+		sink.BodyTemplate = strings.TrimSpace(payload.BodyTemplate)
+		for k, v := range payload.Headers {
+			if k = strings.TrimSpace(k); k != "" {
+				if sink.Headers == nil {
+					sink.Headers = make(map[string]string)
+				}
+				sink.Headers[k] = strings.TrimSpace(v)
+			}
+		}
+	case notify.TypeCommand:
+		sink.Command = strings.TrimSpace(payload.Command)
+	}
+	return sink
+}
+
+func validateNotification(sink model.NotificationSink) error {
+	if sink.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return notify.Validate(sink)
+}
+
+func notificationNameTaken(items []model.NotificationSink, name string, excludeID int) bool {
+	for _, item := range items {
+		if excludeID > 0 && item.ID == excludeID {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(item.Name), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func nextNotificationID(items []model.NotificationSink) int {
+	next := 1
+	for _, item := range items {
+		if item.ID >= next {
+			next = item.ID + 1
+		}
+	}
+	return next
+}
@@ -0,0 +1,106 @@
+package biz
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/notify"
+)
+
+func TestNotificationCRUD(t *testing.T) {
+	tunnelBiz, payload := newDependencyTestBiz(t)
+	notifications := NewNotificationBiz(tunnelBiz.storage)
+	db, err := tunnelBiz.Create(payload("db", 15432))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+
+	if _, err := notifications.Create(model.NotificationSinkPayload{Name: "ghost", Type: "command", Command: "true", TunnelIDs: []int{999}}); !errors.Is(err, ErrTunnelNotFound) {
+		t.Fatalf("unknown tunnel err = %v", err)
+	}
+	if _, err := notifications.Create(model.NotificationSinkPayload{Name: "bad", Type: "webhook", URL: "not a url"}); !errors.Is(err, notify.ErrInvalidURL) {
+		t.Fatalf("bad url err = %v", err)
+	}
+
+	created, err := notifications.Create(model.NotificationSinkPayload{
+		Name: " ops ", Type: "Webhook", Enabled: true, URL: "https://hooks.example.com/x",
+		Command: "ignored", TunnelIDs: []int{db.ID, db.ID}, Events: []string{"error", "error"}, Retries: 99,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if created.Name != "ops" || created.Type != notify.TypeWebhook || created.Command != "" ||
+		len(created.TunnelIDs) != 1 || len(created.Events) != 1 || created.Retries != notify.MaxRetries {
+		t.Fatalf("created = %+v", created)
+	}
+	if _, err := notifications.Create(model.NotificationSinkPayload{Name: "OPS", Type: "command", Command: "true"}); !errors.Is(err, ErrNotificationNameExists) {
+		t.Fatalf("duplicate name err = %v", err)
+	}
+
+	updated, err := notifications.Update(created.ID, model.NotificationSinkPayload{Name: "ops", Type: "command", Command: "notify-send x", URL: "https://stale"})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.URL != "" || updated.Command != "notify-send x" {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	if err := notifications.Delete(created.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := notifications.Delete(created.ID); !errors.Is(err, ErrNotificationNotFound) {
+		t.Fatalf("delete again err = %v", err)
+	}
+}
+
+func TestNotifierReportsTunnelFailure(t *testing.T) {
+	tunnelBiz, payload := newDependencyTestBiz(t)
+	notifications := NewNotificationBiz(tunnelBiz.storage)
+	db, err := tunnelBiz.Create(payload("db", 15433))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+
+	got := make(chan model.Notification, 8)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var note model.Notification
+		if err := json.Unmarshal(body, &note); err != nil {
+			t.Errorf("body %q: %v", body, err)
+		}
+		got <- note
+	}))
+	defer ts.Close()
+	if _, err := notifications.Create(model.NotificationSinkPayload{
+		Name: "ops", Type: "webhook", Enabled: true, URL: ts.URL,
+		BodyTemplate: `{"event": {{json .Event}}, "tunnel": {{json .Tunnel}}, "tunnelId": {{.TunnelID}}}`,
+		Events:       []string{"error"},
+	}); err != nil {
+		t.Fatalf("create sink: %v", err)
+	}
+
+	notifier := notify.New(notifications.Source())
+	defer notifier.Close()
+	events, cancel := tunnelBiz.Subscribe(0)
+	defer cancel()
+	go notifier.Run(events)
+
+	// The test jumper is unreachable, so starting the tunnel fails.
+	if tunnel, _ := tunnelBiz.Toggle(db.ID, 0); tunnel.Status != "error" {
+		t.Fatalf("status = %q, want error", tunnel.Status)
+	}
+	select {
+	case note := <-got:
+		if note.Event != notify.EventError || note.TunnelID != db.ID || note.Tunnel != "db" {
+			t.Fatalf("notification = %+v", note)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification for the failed tunnel")
+	}
+}
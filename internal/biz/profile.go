@@ -0,0 +1,371 @@
+package biz
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/journal"
+	"loris-tunnel/internal/model"
+)
+
+var (
+	ErrProfileNotFound   = errors.New("profile not found")
+	ErrProfileNameExists = errors.New("profile name already exists")
+)
+
+const (
+	profileActionStarted = "started"
+	profileActionStopped = "stopped"
+	profileActionKept    = "kept"
+
+	tunnelLogSourceProfile = "profile"
+)
+
+type ProfileBiz struct {
+	storage *conf.Storage
+	journal *journal.Journal
+	bus     *Bus
+}
+
+func NewProfileBiz(storage *conf.Storage) *ProfileBiz {
+	return &ProfileBiz{storage: storage}
+}
+
+func (b *ProfileBiz) List() ([]model.TunnelProfile, error) {
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	items := append([]model.TunnelProfile{}, cfg.Profiles...)
+	return items, nil
+}
+
+// ActiveID returns the ID of the active profile, 0 when none is active.
+func (b *ProfileBiz) ActiveID() (int, error) {
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return 0, err
+	}
+	return cfg.ActiveProfileID, nil
+}
+
+func (b *ProfileBiz) Create(payload model.TunnelProfilePayload) (model.TunnelProfile, error) {
+	payload = normalizeProfilePayload(payload)
+	if err := validateProfilePayload(payload); err != nil {
+		return model.TunnelProfile{}, err
+	}
+
+	var created model.TunnelProfile
+	_, err := b.storage.Update(func(cfg *conf.Config) error {
+		if profileNameTaken(cfg.Profiles, payload.Name, 0) {
+			return ErrProfileNameExists
+		}
+		if err := validateProfileTunnels(cfg.Tunnels, payload.TunnelIDs); err != nil {
+			return err
+		}
+		if err := checkProfilePorts(cfg.Tunnels, payload.TunnelIDs); err != nil {
+			return err
+		}
+
+		created = model.TunnelProfile{
+			ID:        nextProfileID(cfg.Profiles),
+			Name:      payload.Name,
+			TunnelIDs: append([]int{}, payload.TunnelIDs...),
+		}
+		cfg.Profiles = append(cfg.Profiles, created)
+		return nil
+	})
+	if err != nil {
+		return model.TunnelProfile{}, err
+	}
+
+	recordConfig(b.journal, "profile", created.Name, "created")
+	b.bus.publishConfig("profile", created.ID, "created")
+	return created, nil
+}
+
+func (b *ProfileBiz) Update(id int, payload model.TunnelProfilePayload) (model.TunnelProfile, error) {
+	if id <= 0 {
+		return model.TunnelProfile{}, fmt.Errorf("invalid profile id")
+	}
+
+	payload = normalizeProfilePayload(payload)
+	if err := validateProfilePayload(payload); err != nil {
+		return model.TunnelProfile{}, err
+	}
+
+	var updated model.TunnelProfile
+	_, err := b.storage.Update(func(cfg *conf.Config) error {
+		idx := slices.IndexFunc(cfg.Profiles, func(p model.TunnelProfile) bool { return p.ID == id })
+		if idx == -1 {
+			return ErrProfileNotFound
+		}
+		if profileNameTaken(cfg.Profiles, payload.Name, id) {
+			return ErrProfileNameExists
+		}
+		if err := validateProfileTunnels(cfg.Tunnels, payload.TunnelIDs); err != nil {
+			return err
+		}
+		if err := checkProfilePorts(cfg.Tunnels, payload.TunnelIDs); err != nil {
+			return err
+		}
+
+		updated = model.TunnelProfile{
+			ID:        id,
+			Name:      payload.Name,
+			TunnelIDs: append([]int{}, payload.TunnelIDs...),
+		}
+		cfg.Profiles[idx] = updated
+		return nil
+	})
+	if err != nil {
+		return model.TunnelProfile{}, err
+	}
+
+	recordConfig(b.journal, "profile", updated.Name, "updated")
+	b.bus.publishConfig("profile", updated.ID, "updated")
+	return updated, nil
+}
+
+// Delete removes a profile. Deleting the active profile deactivates it but
+// leaves its tunnels running.
+func (b *ProfileBiz) Delete(id int) error {
+	if id <= 0 {
+		return fmt.Errorf("invalid profile id")
+	}
+
+	var name string
+	_, err := b.storage.Update(func(cfg *conf.Config) error {
+		idx := slices.IndexFunc(cfg.Profiles, func(p model.TunnelProfile) bool { return p.ID == id })
+		if idx == -1 {
+			return ErrProfileNotFound
+		}
+
+		name = cfg.Profiles[idx].Name
+		cfg.Profiles = append(cfg.Profiles[:idx], cfg.Profiles[idx+1:]...)
+		if cfg.ActiveProfileID == id {
+			cfg.ActiveProfileID = 0
+		}
+		return nil
+	})
+	if err == nil {
+		recordConfig(b.journal, "profile", name, "deleted")
+		b.bus.publishConfig("profile", id, "deleted")
+	}
+	return err
+}
+
+// ActivateProfile switches to profile id: running tunnels outside it are
+// stopped first, so its tunnels can take over their local ports, then its
+// tunnels and their dependencies start in dependency order. Nothing changes
+// when the profile needs more tunnels than maxRunning allows. id 0 only
+// clears the active profile and leaves tunnels as they are.
+func (b *TunnelBiz) ActivateProfile(id int, maxRunning int) (model.ProfileActivation, error) {
+	if id < 0 {
+		return model.ProfileActivation{}, fmt.Errorf("invalid profile id")
+	}
+	b.profileMu.Lock()
+	defer b.profileMu.Unlock()
+
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return model.ProfileActivation{}, err
+	}
+	activation := model.ProfileActivation{ProfileID: id, Results: []model.ProfileTunnelResult{}}
+	if id == 0 {
+		if err := b.setActiveProfile(0); err != nil {
+			return model.ProfileActivation{}, err
+		}
+		slog.Info("profile deactivated")
+		return activation, nil
+	}
+
+	profile, ok := findProfileByID(cfg.Profiles, id)
+	if !ok {
+		return model.ProfileActivation{}, ErrProfileNotFound
+	}
+	members := profileTunnels(cfg.Tunnels, profile)
+	if maxRunning > 0 && len(members) > maxRunning {
+		return model.ProfileActivation{}, fmt.Errorf("%w: profile %q needs %d tunnels, limit %d", ErrFreePlanRunningLimit, profile.Name, len(members), maxRunning)
+	}
+	wanted := make(map[int]bool, len(members))
+	for _, t := range members {
+		wanted[t.ID] = true
+	}
+
+	slog.Info("profile activate", "profile_id", profile.ID, "name", profile.Name, "tunnels", len(members))
+	b.setRunningLimit(maxRunning)
+	logMessage := fmt.Sprintf("profile %q activated", profile.Name)
+
+	// Stop dependents before what they depend on so nothing is paused on
+	// the way out.
+	var outside []model.Tunnel
+	for _, t := range cfg.Tunnels {
+		if !wanted[t.ID] && (b.isRunning(t.ID) || t.Status == "running" || t.Status == statusPaused) {
+			outside = append(outside, t)
+		}
+	}
+	outside = startOrder(outside)
+	slices.Reverse(outside)
+	for _, t := range outside {
+		result := model.ProfileTunnelResult{TunnelID: t.ID, Name: t.Name, Action: profileActionStopped}
+		if _, err := b.stop(t.ID); err != nil {
+			result.Error = err.Error()
+		}
+		b.appendLog(t.ID, model.TunnelLogEntry{Source: tunnelLogSourceProfile, Event: result.Action, Message: logMessage, Error: result.Error})
+		activation.Results = append(activation.Results, result)
+	}
+
+	if err := b.setActiveProfile(id); err != nil {
+		return model.ProfileActivation{}, err
+	}
+
+	if cfg, err = b.storage.Load(); err != nil {
+		return model.ProfileActivation{}, err
+	}
+	members = profileTunnels(cfg.Tunnels, profile)
+	started := make(map[int]*model.ProfileTunnelResult, len(members))
+	for _, level := range startLevels(members) {
+		var wg sync.WaitGroup
+		for _, t := range level {
+			result := &model.ProfileTunnelResult{TunnelID: t.ID, Name: t.Name, Action: profileActionKept}
+			started[t.ID] = result
+			if b.isRunning(t.ID) {
+				continue
+			}
+			result.Action = profileActionStarted
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if dep, waiting := b.pendingDependency(cfg.Tunnels, t); waiting {
+					_, _ = b.pause(t, dep, "")
+					result.Error = fmt.Sprintf("waiting for dependency %q", dep.Name)
+				} else if err := b.launch(cfg, t); err != nil {
+					result.Error = errReason(err)
+				}
+				b.appendLog(t.ID, model.TunnelLogEntry{Source: tunnelLogSourceProfile, Event: result.Action, Message: logMessage, Error: result.Error})
+			}()
+		}
+		wg.Wait()
+	}
+	for _, t := range members {
+		activation.Results = append(activation.Results, *started[t.ID])
+	}
+
+	if cfg, err = b.storage.Load(); err == nil {
+		for i := range activation.Results {
+			if t, ok := findTunnelByID(cfg.Tunnels, activation.Results[i].TunnelID); ok {
+				activation.Results[i].Status = t.Status
+			}
+		}
+	}
+	return activation, nil
+}
+
+func (b *TunnelBiz) setActiveProfile(id int) error {
+	_, err := b.storage.Update(func(cfg *conf.Config) error {
+		cfg.ActiveProfileID = id
+		return nil
+	})
+	if err == nil {
+		b.eventBus().publishConfig("profile", id, "activated")
+	}
+	return err
+}
+
+// activeProfileTunnels returns the tunnels of the active profile with their
+// dependencies, or ok false when no profile is active.
+func activeProfileTunnels(cfg *conf.Config) ([]model.Tunnel, bool) {
+	if cfg.ActiveProfileID <= 0 {
+		return nil, false
+	}
+	profile, ok := findProfileByID(cfg.Profiles, cfg.ActiveProfileID)
+	if !ok {
+		return nil, false
+	}
+	return profileTunnels(cfg.Tunnels, profile), true
+}
+
+// profileTunnels returns the profile's tunnels plus everything they depend
+// on, in start order.
+func profileTunnels(items []model.Tunnel, profile model.TunnelProfile) []model.Tunnel {
+	seen := make(map[int]bool)
+	var out []model.Tunnel
+	add := func(t model.Tunnel) {
+		if !seen[t.ID] {
+			seen[t.ID] = true
+			out = append(out, t)
+		}
+	}
+	for _, id := range profile.TunnelIDs {
+		t, ok := findTunnelByID(items, id)
+		if !ok {
+			continue
+		}
+		for _, dep := range dependencyClosure(items, id) {
+			add(dep)
+		}
+		add(t)
+	}
+	return startOrder(out)
+}
+
+func normalizeProfilePayload(payload model.TunnelProfilePayload) model.TunnelProfilePayload {
+	payload.Name = strings.TrimSpace(payload.Name)
+	payload.TunnelIDs = normalizeJumperIDs(payload.TunnelIDs)
+	return payload
+}
+
+func validateProfilePayload(payload model.TunnelProfilePayload) error {
+	if payload.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return nil
+}
+
+func validateProfileTunnels(items []model.Tunnel, ids []int) error {
+	for _, id := range ids {
+		if _, ok := findTunnelByID(items, id); !ok {
+			return fmt.Errorf("%w: %d", ErrTunnelNotFound, id)
+		}
+	}
+	return nil
+}
+
+func profileNameTaken(profiles []model.TunnelProfile, name string, excludeID int) bool {
+	normalized := strings.TrimSpace(name)
+	for _, profile := range profiles {
+		if excludeID > 0 && profile.ID == excludeID {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(profile.Name), normalized) {
+			return true
+		}
+	}
+	return false
+}
+
+func findProfileByID(items []model.TunnelProfile, id int) (model.TunnelProfile, bool) {
+	for _, item := range items {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return model.TunnelProfile{}, false
+}
+
+func nextProfileID(items []model.TunnelProfile) int {
+	next := 1
+	for _, item := range items {
+		if item.ID >= next {
+			next = item.ID + 1
+		}
+	}
+	return next
+}
@@ -0,0 +1,207 @@
+package biz
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/model"
+)
+
+func TestActivateProfileSwitchesTunnelSets(t *testing.T) {
+	tunnelBiz, payload := newDependencyTestBiz(t)
+	profileBiz := NewProfileBiz(tunnelBiz.storage)
+
+	db, err := tunnelBiz.Create(payload("db", 15432))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	stagingAPI, err := tunnelBiz.Create(payload("staging-api", 18080, db.ID))
+	if err != nil {
+		t.Fatalf("create staging-api: %v", err)
+	}
+	prodAPI, err := tunnelBiz.Create(payload("prod-api", 18081))
+	if err != nil {
+		t.Fatalf("create prod-api: %v", err)
+	}
+
+	if _, err := profileBiz.Create(model.TunnelProfilePayload{Name: "ghost", TunnelIDs: []int{999}}); !errors.Is(err, ErrTunnelNotFound) {
+		t.Fatalf("unknown tunnel err = %v", err)
+	}
+	staging, err := profileBiz.Create(model.TunnelProfilePayload{Name: "staging", TunnelIDs: []int{stagingAPI.ID, stagingAPI.ID}})
+	if err != nil {
+		t.Fatalf("create staging: %v", err)
+	}
+	if len(staging.TunnelIDs) != 1 {
+		t.Fatalf("staging tunnels = %v", staging.TunnelIDs)
+	}
+	if _, err := profileBiz.Create(model.TunnelProfilePayload{Name: "Staging"}); !errors.Is(err, ErrProfileNameExists) {
+		t.Fatalf("duplicate name err = %v", err)
+	}
+
+	// staging needs db as well, which a limit of one does not allow.
+	if _, err := tunnelBiz.ActivateProfile(staging.ID, 1); !errors.Is(err, ErrFreePlanRunningLimit) {
+		t.Fatalf("activate over limit err = %v", err)
+	}
+
+	// Pretend prod-api is running; activating staging must stop it first.
+	tunnelBiz.mu.Lock()
+	tunnelBiz.runs[prodAPI.ID] = forward.NewLocalForward(prodAPI, nil)
+	tunnelBiz.mu.Unlock()
+	if _, err := tunnelBiz.updateStatus(prodAPI.ID, "running", ""); err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+
+	activation, err := tunnelBiz.ActivateProfile(staging.ID, 0)
+	if err != nil {
+		t.Fatalf("activate staging: %v", err)
+	}
+	want := []struct {
+		id     int
+		action string
+		status string
+	}{
+		{prodAPI.ID, profileActionStopped, "stopped"},
+		{db.ID, profileActionStarted, "error"},
+		{stagingAPI.ID, profileActionStarted, statusPaused},
+	}
+	if len(activation.Results) != len(want) {
+		t.Fatalf("results = %+v", activation.Results)
+	}
+	for i, w := range want {
+		got := activation.Results[i]
+		if got.TunnelID != w.id || got.Action != w.action || got.Status != w.status {
+			t.Errorf("result %d = %+v, want tunnel %d %s/%s", i, got, w.id, w.action, w.status)
+		}
+	}
+	if tunnelBiz.isRunning(prodAPI.ID) {
+		t.Fatal("prod-api still running")
+	}
+	if active, err := profileBiz.ActiveID(); err != nil || active != staging.ID {
+		t.Fatalf("active profile = %d, %v", active, err)
+	}
+
+	if err := tunnelBiz.Delete(stagingAPI.ID); err != nil {
+		t.Fatalf("delete staging-api: %v", err)
+	}
+	profiles, err := profileBiz.List()
+	if err != nil {
+		t.Fatalf("list profiles: %v", err)
+	}
+	if len(profiles[0].TunnelIDs) != 0 {
+		t.Fatalf("deleting a tunnel should drop it from profiles, got %v", profiles[0].TunnelIDs)
+	}
+
+	if err := profileBiz.Delete(staging.ID); err != nil {
+		t.Fatalf("delete staging: %v", err)
+	}
+	if active, _ := profileBiz.ActiveID(); active != 0 {
+		t.Fatalf("active profile after delete = %d", active)
+	}
+}
+
+func TestStartAutoStartUsesActiveProfile(t *testing.T) {
+	tunnelBiz, payload := newDependencyTestBiz(t)
+	profileBiz := NewProfileBiz(tunnelBiz.storage)
+
+	flagged := payload("flagged", 15432)
+	flagged.AutoStart = true
+	flaggedTunnel, err := tunnelBiz.Create(flagged)
+	if err != nil {
+		t.Fatalf("create flagged: %v", err)
+	}
+	member, err := tunnelBiz.Create(payload("member", 18080))
+	if err != nil {
+		t.Fatalf("create member: %v", err)
+	}
+	profile, err := profileBiz.Create(model.TunnelProfilePayload{Name: "prod", TunnelIDs: []int{member.ID}})
+	if err != nil {
+		t.Fatalf("create profile: %v", err)
+	}
+	if err := tunnelBiz.setActiveProfile(profile.ID); err != nil {
+		t.Fatalf("set active profile: %v", err)
+	}
+
+	if err := tunnelBiz.StartAutoStart(0); err != nil {
+		t.Fatalf("auto start: %v", err)
+	}
+	items, err := tunnelBiz.List()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	// The jumper is unreachable, so an attempted start ends in error.
+	if got, _ := findTunnelByID(items, member.ID); got.Status != "error" {
+		t.Fatalf("profile tunnel status = %q, want error", got.Status)
+	}
+	if got, _ := findTunnelByID(items, flaggedTunnel.ID); got.Status != "stopped" {
+		t.Fatalf("auto-start tunnel outside the profile status = %q, want stopped", got.Status)
+	}
+}
+
+func TestActivateProfileReusesLocalPort(t *testing.T) {
+	tunnelBiz, payload := newDependencyTestBiz(t)
+	profileBiz := NewProfileBiz(tunnelBiz.storage)
+
+	// Both sets listen on the same port, which only works one at a time.
+	// Standalone tunnels may not share it.
+	stagingDB, err := tunnelBiz.Create(payload("staging-db", 15432))
+	if err != nil {
+		t.Fatalf("create staging-db: %v", err)
+	}
+	if _, err := tunnelBiz.Create(payload("prod-db", 15432)); !errors.Is(err, ErrLocalPortConflict) {
+		t.Fatalf("create a second standalone tunnel on the port: err = %v", err)
+	}
+	prodDB, err := tunnelBiz.Create(payload("prod-db", 16432))
+	if err != nil {
+		t.Fatalf("create prod-db: %v", err)
+	}
+	staging, err := profileBiz.Create(model.TunnelProfilePayload{Name: "staging", TunnelIDs: []int{stagingDB.ID}})
+	if err != nil {
+		t.Fatalf("create staging: %v", err)
+	}
+	if _, err := profileBiz.Create(model.TunnelProfilePayload{Name: "prod", TunnelIDs: []int{prodDB.ID}}); err != nil {
+		t.Fatalf("create prod: %v", err)
+	}
+	// Once each sits in its own profile they never run together.
+	if prodDB, err = tunnelBiz.Update(prodDB.ID, payload("prod-db", 15432)); err != nil {
+		t.Fatalf("move prod-db onto staging-db's port: %v", err)
+	}
+
+	// Pretend prod-db is running.
+	tunnelBiz.mu.Lock()
+	tunnelBiz.runs[prodDB.ID] = forward.NewLocalForward(prodDB, nil)
+	tunnelBiz.mu.Unlock()
+	if _, err := tunnelBiz.updateStatus(prodDB.ID, "running", ""); err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+
+	// Starting staging-db by hand meets the port held by prod-db.
+	started, err := tunnelBiz.Toggle(stagingDB.ID, 0)
+	if err != nil {
+		t.Fatalf("toggle staging-db: %v", err)
+	}
+	if started.Status != "error" || !strings.Contains(started.LastError, ErrLocalPortConflict.Error()) {
+		t.Fatalf("manual start = %s/%q, want a port conflict", started.Status, started.LastError)
+	}
+
+	// Activating staging stops prod-db first, so staging-db gets past the
+	// port check and only fails on the unreachable jumper.
+	activation, err := tunnelBiz.ActivateProfile(staging.ID, 0)
+	if err != nil {
+		t.Fatalf("activate staging: %v", err)
+	}
+	if len(activation.Results) != 2 {
+		t.Fatalf("results = %+v", activation.Results)
+	}
+	stopped, start := activation.Results[0], activation.Results[1]
+	if stopped.TunnelID != prodDB.ID || stopped.Action != profileActionStopped || stopped.Status != "stopped" {
+		t.Fatalf("first result = %+v, want prod-db stopped", stopped)
+	}
+	if start.TunnelID != stagingDB.ID || start.Action != profileActionStarted {
+		t.Fatalf("second result = %+v, want staging-db started", start)
+	}
+	if strings.Contains(start.Error, ErrLocalPortConflict.Error()) {
+		t.Fatalf("staging-db still clashed after prod-db stopped: %s", start.Error)
+	}
+}
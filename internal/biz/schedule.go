@@ -0,0 +1,301 @@
+package biz
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"loris-tunnel/internal/model"
+)
+
+var (
+	ErrTunnelNotRunning = errors.New("tunnel is not running")
+	ErrTunnelTTLNotSet  = errors.New("tunnel has no time-to-live")
+)
+
+const (
+	scheduleTick = 15 * time.Second
+
+	minTunnelTTLMs = 60 * 1000
+	maxTunnelTTLMs = 7 * 24 * 60 * 60 * 1000
+
+	scheduleActionStart = "start"
+	scheduleActionStop  = "stop"
+
+	tunnelLogSourceSchedule = "schedule"
+)
+
+// StartScheduler runs tunnel schedules and TTLs until Shutdown. limit
+// returns the running limit to start scheduled tunnels with, as for Toggle.
+func (b *TunnelBiz) StartScheduler(limit func() int) {
+	b.mu.Lock()
+	if b.schedStop != nil {
+		b.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	b.schedStop = stop
+	b.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(scheduleTick)
+		defer ticker.Stop()
+		b.runSchedule(time.Now(), limit())
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				b.runSchedule(now, limit())
+			}
+		}
+	}()
+}
+
+func (b *TunnelBiz) stopScheduler() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.schedStop != nil {
+		close(b.schedStop)
+		b.schedStop = nil
+	}
+}
+
+// runSchedule stops tunnels whose TTL ran out and fires the schedule
+// starts and stops due since the previous run. On the first run, tunnels
+// inside a start-stop window are started so a late launch catches up.
+func (b *TunnelBiz) runSchedule(now time.Time, maxRunning int) {
+	b.mu.Lock()
+	last := b.schedLast
+	b.schedLast = now
+	var expired []int
+	for id, at := range b.expiries {
+		if !at.After(now) {
+			expired = append(expired, id)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, id := range expired {
+		slog.Info("tunnel ttl expired", "tunnel_id", id)
+		if _, err := b.stop(id); err == nil {
+			b.appendLog(id, model.TunnelLogEntry{
+				Source:  tunnelLogSourceSchedule,
+				Event:   "ttl",
+				Message: "time-to-live expired, tunnel stopped",
+			})
+		}
+	}
+
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return
+	}
+	for _, t := range cfg.Tunnels {
+		if !scheduleEnabled(t.Schedule) {
+			continue
+		}
+		action := ""
+		if last.IsZero() {
+			if inScheduleWindow(t.Schedule, now) {
+				action = scheduleActionStart
+			}
+		} else {
+			action = scheduleActionBetween(t.Schedule, last, now)
+		}
+
+		entry := model.TunnelLogEntry{Source: tunnelLogSourceSchedule, Event: action}
+		switch action {
+		case scheduleActionStart:
+			if b.isRunning(t.ID) || t.Status == "busy" || t.Status == statusPaused {
+				continue
+			}
+			slog.Info("tunnel scheduled start", "tunnel_id", t.ID, "name", t.Name)
+			entry.Message = "scheduled start"
+			if maxRunning > 0 && b.RunningCount() >= maxRunning {
+				entry.Error = fmt.Sprintf("%v: limit %d", ErrFreePlanRunningLimit, maxRunning)
+			} else if _, err := b.start(cfg, t, maxRunning); err != nil {
+				entry.Error = err.Error()
+			}
+		case scheduleActionStop:
+			if !b.isRunning(t.ID) && t.Status != "running" && t.Status != statusPaused {
+				continue
+			}
+			slog.Info("tunnel scheduled stop", "tunnel_id", t.ID, "name", t.Name)
+			entry.Message = "scheduled stop"
+			if _, err := b.stop(t.ID); err != nil {
+				entry.Error = err.Error()
+			}
+		default:
+			continue
+		}
+		b.appendLog(t.ID, entry)
+	}
+}
+
+// ExtendTTL pushes a running tunnel's auto-stop back by extra.
+func (b *TunnelBiz) ExtendTTL(id int, extra time.Duration) (model.Tunnel, error) {
+	if extra <= 0 {
+		return model.Tunnel{}, fmt.Errorf("extension must be positive")
+	}
+	b.mu.Lock()
+	_, running := b.runs[id]
+	at, ok := b.expiries[id]
+	if running && ok {
+		at = at.Add(extra)
+		if limit := time.Now().Add(maxTunnelTTLMs * time.Millisecond); at.After(limit) {
+			at = limit
+		}
+		b.expiries[id] = at
+	}
+	b.mu.Unlock()
+	if !running {
+		return model.Tunnel{}, ErrTunnelNotRunning
+	}
+	if !ok {
+		return model.Tunnel{}, ErrTunnelTTLNotSet
+	}
+
+	b.appendLog(id, model.TunnelLogEntry{
+		Source:  tunnelLogSourceSchedule,
+		Event:   "ttl",
+		Message: fmt.Sprintf("time-to-live extended by %s, stops at %s", extra, at.Format(time.DateTime)),
+	})
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return model.Tunnel{}, err
+	}
+	tunnel, found := findTunnelByID(cfg.Tunnels, id)
+	if !found {
+		return model.Tunnel{}, ErrTunnelNotFound
+	}
+	items := []model.Tunnel{tunnel}
+	b.attachRuntimeStatus(items)
+	return items[0], nil
+}
+
+// ttlRemaining returns how long a running tunnel has left before its TTL
+// stops it.
+func (b *TunnelBiz) ttlRemaining(id int, now time.Time) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	at, ok := b.expiries[id]
+	if !ok {
+		return 0, false
+	}
+	if left := at.Sub(now); left > 0 {
+		return left, true
+	}
+	return 0, true
+}
+
+func scheduleEnabled(s model.TunnelSchedule) bool {
+	return s.StartAt != "" || s.StopAt != ""
+}
+
+func validateSchedule(s model.TunnelSchedule) error {
+	for _, clock := range []string{s.StartAt, s.StopAt} {
+		if clock == "" {
+			continue
+		}
+		if _, err := parseClock(clock); err != nil {
+			return err
+		}
+	}
+	if !scheduleEnabled(s) && len(s.Weekdays) > 0 {
+		return fmt.Errorf("schedule weekdays need a startAt or stopAt time")
+	}
+	for _, day := range s.Weekdays {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("schedule weekdays must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	}
+	if s.StartAt != "" && s.StartAt == s.StopAt {
+		return fmt.Errorf("schedule startAt and stopAt must differ")
+	}
+	return nil
+}
+
+func normalizeSchedule(s model.TunnelSchedule) model.TunnelSchedule {
+	s.StartAt = strings.TrimSpace(s.StartAt)
+	s.StopAt = strings.TrimSpace(s.StopAt)
+	days := slices.Clone(s.Weekdays)
+	slices.Sort(days)
+	s.Weekdays = slices.Compact(days)
+	return s
+}
+
+// parseClock parses "HH:MM" into the offset from midnight.
+func parseClock(clock string) (time.Duration, error) {
+	hh, mm, ok := strings.Cut(clock, ":")
+	h, errH := strconv.Atoi(hh)
+	m, errM := strconv.Atoi(mm)
+	if !ok || errH != nil || errM != nil || len(mm) != 2 || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid schedule time %q, want HH:MM", clock)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+func scheduleRunsOn(s model.TunnelSchedule, day time.Time) bool {
+	return len(s.Weekdays) == 0 || slices.Contains(s.Weekdays, int(day.Weekday()))
+}
+
+// scheduleMoments returns the start and stop times of the schedule's run
+// on day, zero when the schedule has no such time or does not run that day.
+func scheduleMoments(s model.TunnelSchedule, day time.Time) (start, stop time.Time) {
+	if !scheduleRunsOn(s, day) {
+		return time.Time{}, time.Time{}
+	}
+	startOffset, startErr := parseClock(s.StartAt)
+	if startErr == nil {
+		start = atClock(day, startOffset)
+	}
+	if stopOffset, err := parseClock(s.StopAt); err == nil {
+		if startErr == nil && stopOffset <= startOffset {
+			day = day.AddDate(0, 0, 1)
+		}
+		stop = atClock(day, stopOffset)
+	}
+	return start, stop
+}
+
+// atClock returns the wall-clock time offset after midnight on day.
+func atClock(day time.Time, offset time.Duration) time.Time {
+	h, m := int(offset/time.Hour), int(offset%time.Hour/time.Minute)
+	return time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, day.Location())
+}
+
+// scheduleActionBetween returns the last schedule action due in (from, to].
+func scheduleActionBetween(s model.TunnelSchedule, from, to time.Time) string {
+	action := ""
+	var at time.Time
+	for day := from.AddDate(0, 0, -1); !day.After(to.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		start, stop := scheduleMoments(s, day)
+		if !start.IsZero() && start.After(from) && !start.After(to) && !start.Before(at) {
+			action, at = scheduleActionStart, start
+		}
+		if !stop.IsZero() && stop.After(from) && !stop.After(to) && !stop.Before(at) {
+			action, at = scheduleActionStop, stop
+		}
+	}
+	return action
+}
+
+// inScheduleWindow reports whether now falls between a scheduled start and
+// its stop.
+func inScheduleWindow(s model.TunnelSchedule, now time.Time) bool {
+	if s.StartAt == "" || s.StopAt == "" {
+		return false
+	}
+	for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+		start, stop := scheduleMoments(s, day)
+		if !start.IsZero() && !now.Before(start) && now.Before(stop) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package biz
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/model"
+)
+
+func TestScheduleActionBetween(t *testing.T) {
+	// 2026-03-02 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, time.Local)
+	}
+	workHours := model.TunnelSchedule{StartAt: "09:00", StopAt: "18:00", Weekdays: []int{1, 2, 3, 4, 5}}
+	overnight := model.TunnelSchedule{StartAt: "22:00", StopAt: "02:00", Weekdays: []int{5}}
+
+	cases := []struct {
+		name     string
+		schedule model.TunnelSchedule
+		from, to time.Time
+		want     string
+	}{
+		{"monday start", workHours, at(2, 8, 59), at(2, 9, 0), scheduleActionStart},
+		{"already past start", workHours, at(2, 9, 0), at(2, 9, 15), ""},
+		{"monday stop", workHours, at(2, 17, 59), at(2, 18, 0), scheduleActionStop},
+		{"sunday is off", workHours, at(1, 8, 59), at(1, 9, 1), ""},
+		{"start and stop in one gap keeps the later", workHours, at(2, 8, 0), at(2, 19, 0), scheduleActionStop},
+		{"friday night start", overnight, at(6, 21, 59), at(6, 22, 0), scheduleActionStart},
+		{"overnight stop belongs to friday", overnight, at(7, 1, 59), at(7, 2, 0), scheduleActionStop},
+		{"no stop after thursday", overnight, at(6, 1, 59), at(6, 2, 0), ""},
+		{"stop only", model.TunnelSchedule{StopAt: "18:00"}, at(1, 17, 59), at(1, 18, 0), scheduleActionStop},
+	}
+	for _, tc := range cases {
+		if got := scheduleActionBetween(tc.schedule, tc.from, tc.to); got != tc.want {
+			t.Errorf("%s: action = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	if !inScheduleWindow(workHours, at(3, 12, 0)) || inScheduleWindow(workHours, at(3, 20, 0)) || inScheduleWindow(workHours, at(1, 12, 0)) {
+		t.Error("work hours window mismatch")
+	}
+	if !inScheduleWindow(overnight, at(7, 1, 0)) || inScheduleWindow(overnight, at(8, 1, 0)) {
+		t.Error("overnight window mismatch")
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	cases := []struct {
+		schedule model.TunnelSchedule
+		ok       bool
+	}{
+		{model.TunnelSchedule{}, true},
+		{model.TunnelSchedule{StartAt: "09:00", StopAt: "18:30", Weekdays: []int{1, 5}}, true},
+		{model.TunnelSchedule{StartAt: "9:00"}, true},
+		{model.TunnelSchedule{StartAt: "24:00"}, false},
+		{model.TunnelSchedule{StartAt: "09:5"}, false},
+		{model.TunnelSchedule{StartAt: "09:00", StopAt: "09:00"}, false},
+		{model.TunnelSchedule{StartAt: "09:00", Weekdays: []int{7}}, false},
+		{model.TunnelSchedule{Weekdays: []int{1}}, false},
+	}
+	for _, tc := range cases {
+		if err := validateSchedule(tc.schedule); (err == nil) != tc.ok {
+			t.Errorf("validateSchedule(%+v) = %v", tc.schedule, err)
+		}
+	}
+}
+
+func TestTTLExpiresAndExtends(t *testing.T) {
+	storage, err := conf.NewStorage(filepath.Join(t.TempDir(), "config.toml"))
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+	jumper, err := NewJumperBiz(storage).Create(model.JumperPayload{
+		Name:     "jump",
+		Host:     "jump.example.com",
+		Port:     22,
+		User:     "root",
+		AuthType: "ssh_agent",
+	})
+	if err != nil {
+		t.Fatalf("create jumper: %v", err)
+	}
+	tunnelBiz := NewTunnelBiz(storage)
+	payload := model.TunnelPayload{
+		Name:       "prod",
+		Mode:       "local",
+		JumperIDs:  []int{jumper.ID},
+		LocalPort:  15432,
+		RemoteHost: "10.0.0.1",
+		RemotePort: 5432,
+		TTLMs:      10,
+	}
+	if _, err := tunnelBiz.Create(payload); err == nil {
+		t.Fatal("a TTL under a minute should be rejected")
+	}
+	payload.TTLMs = 2 * 60 * 60 * 1000
+	created, err := tunnelBiz.Create(payload)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if _, err := tunnelBiz.ExtendTTL(created.ID, time.Hour); !errors.Is(err, ErrTunnelNotRunning) {
+		t.Fatalf("extend stopped tunnel err = %v", err)
+	}
+
+	// Pretend the tunnel started two hours ago.
+	now := time.Now()
+	tunnelBiz.mu.Lock()
+	tunnelBiz.runs[created.ID] = forward.NewLocalForward(created, nil)
+	tunnelBiz.expiries[created.ID] = now.Add(time.Minute)
+	tunnelBiz.mu.Unlock()
+	if _, err := tunnelBiz.updateStatus(created.ID, "running", ""); err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+
+	extended, err := tunnelBiz.ExtendTTL(created.ID, 30*time.Minute)
+	if err != nil {
+		t.Fatalf("extend: %v", err)
+	}
+	if left := time.Duration(extended.TTLRemainingMs) * time.Millisecond; left < 30*time.Minute || left > 31*time.Minute {
+		t.Fatalf("remaining after extend = %s", left)
+	}
+
+	tunnelBiz.runSchedule(now.Add(20*time.Minute), 0)
+	if !tunnelBiz.isRunning(created.ID) {
+		t.Fatal("tunnel stopped before its extended TTL")
+	}
+	tunnelBiz.runSchedule(now.Add(32*time.Minute), 0)
+	if tunnelBiz.isRunning(created.ID) {
+		t.Fatal("tunnel still running after its TTL")
+	}
+	items, err := tunnelBiz.List()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if got, _ := findTunnelByID(items, created.ID); got.Status != "stopped" || got.TTLRemainingMs != 0 {
+		t.Fatalf("after expiry = %q, %d ms left", got.Status, got.TTLRemainingMs)
+	}
+}
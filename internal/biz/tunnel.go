@@ -4,18 +4,23 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"loris-tunnel/internal/conf"
 	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/journal"
+	"loris-tunnel/internal/latency"
 	"loris-tunnel/internal/model"
 )
 
 var (
-	ErrTunnelNotFound         = errors.New("tunnel not found")
-	ErrFreePlanRunningLimit   = errors.New("free plan running tunnel limit exceeded")
+	ErrTunnelNotFound       = errors.New("tunnel not found")
+	ErrFreePlanRunningLimit = errors.New("free plan running tunnel limit exceeded")
+	ErrLocalPortConflict    = errors.New("local port is already used by another tunnel")
 )
 
 // FreePlanRunningLimit is the max concurrent running tunnels for non-Pro users.
@@ -25,12 +30,50 @@ type TunnelBiz struct {
 	storage *conf.Storage
 	mu      sync.Mutex
 	runs    map[int]*forward.LocalForward
+
+	logMu sync.Mutex
+	logs  map[int][]model.TunnelLogEntry
+
+	latency *latency.Registry
+
+	// maxRunning is the limit last passed to Toggle or StartAutoStart,
+	// applied when paused dependents resume on their own.
+	maxRunning int
+
+	// expiries holds when running tunnels with a TTL stop; the scheduler
+	// fields are guarded by mu as well.
+	expiries  map[int]time.Time
+	schedLast time.Time
+	schedStop chan struct{}
+
+	// probing is set while ProbeAll runs.
+	probing atomic.Bool
+
+	// profileMu serializes profile activations.
+	profileMu sync.Mutex
+
+	subMu sync.Mutex
+	// subs maps each subscriber to the events it has missed in a row.
+	subs map[chan model.TunnelEvent]int
+
+	// counters keeps per-tunnel metrics across runs; guarded by mu.
+	counters map[int]*tunnelCounters
+
+	journal *journal.Journal
+
+	// bus and trafficStop are guarded by mu.
+	bus         *Bus
+	trafficStop chan struct{}
 }
 
 func NewTunnelBiz(storage *conf.Storage) *TunnelBiz {
 	return &TunnelBiz{
-		storage: storage,
-		runs:    make(map[int]*forward.LocalForward),
+		storage:  storage,
+		runs:     make(map[int]*forward.LocalForward),
+		logs:     make(map[int][]model.TunnelLogEntry),
+		latency:  latency.NewRegistry(latency.DefaultLimit),
+		expiries: make(map[int]time.Time),
+		counters: make(map[int]*tunnelCounters),
 	}
 }
 
@@ -41,7 +84,7 @@ func (b *TunnelBiz) List() ([]model.Tunnel, error) {
 	}
 
 	items := append([]model.Tunnel{}, cfg.Tunnels...)
-	b.attachRuntimeLatencies(items)
+	b.attachRuntimeStatus(items)
 	return items, nil
 }
 
@@ -59,21 +102,35 @@ func (b *TunnelBiz) Create(payload model.TunnelPayload) (model.Tunnel, error) {
 		if err := validateGroupID(cfg.Groups, payload.GroupID); err != nil {
 			return err
 		}
+		if err := checkLocalPortConflict(cfg, 0, payload); err != nil {
+			return err
+		}
+		if err := validateTunnelDependencies(cfg.Tunnels, 0, payload.DependsOn); err != nil {
+			return err
+		}
 
 		created = model.Tunnel{
-			ID:          nextTunnelID(cfg.Tunnels),
-			Name:        payload.Name,
-			GroupID:     payload.GroupID,
-			Mode:        payload.Mode,
-			JumperIDs:   append([]int{}, payload.JumperIDs...),
-			LocalHost:   payload.LocalHost,
-			LocalPort:   payload.LocalPort,
-			RemoteHost:  payload.RemoteHost,
-			RemotePort:  payload.RemotePort,
-			AutoStart:   payload.AutoStart,
-			Status:      payload.Status,
-			LastError:   "",
-			Description: payload.Description,
+			ID:            nextTunnelID(cfg.Tunnels),
+			Name:          payload.Name,
+			GroupID:       payload.GroupID,
+			Mode:          payload.Mode,
+			JumperIDs:     append([]int{}, payload.JumperIDs...),
+			LocalHost:     payload.LocalHost,
+			LocalPort:     payload.LocalPort,
+			AutoLocalPort: payload.AutoLocalPort,
+			RemoteHost:    payload.RemoteHost,
+			RemotePort:    payload.RemotePort,
+			AutoStart:     payload.AutoStart,
+			Status:        payload.Status,
+			LastError:     "",
+			Description:   payload.Description,
+			Hooks:         payload.Hooks,
+			HealthCheck:   payload.HealthCheck,
+			DependsOn:     append([]int{}, payload.DependsOn...),
+			Lazy:          payload.Lazy,
+			IdleTimeoutMs: payload.IdleTimeoutMs,
+			Schedule:      payload.Schedule,
+			TTLMs:         payload.TTLMs,
 		}
 		cfg.Tunnels = append(cfg.Tunnels, created)
 		return nil
@@ -82,6 +139,8 @@ func (b *TunnelBiz) Create(payload model.TunnelPayload) (model.Tunnel, error) {
 		return model.Tunnel{}, err
 	}
 
+	b.recordTunnel(journal.TypeConfig, created.ID, created.Name, "tunnel created", nil)
+	b.publishConfig(created.ID, "created")
 	return created, nil
 }
 
@@ -117,21 +176,35 @@ func (b *TunnelBiz) Update(id int, payload model.TunnelPayload) (model.Tunnel, e
 		if idx == -1 {
 			return ErrTunnelNotFound
 		}
+		if err := checkLocalPortConflict(cfg, id, payload); err != nil {
+			return err
+		}
+		if err := validateTunnelDependencies(cfg.Tunnels, id, payload.DependsOn); err != nil {
+			return err
+		}
 
 		updated = model.Tunnel{
-			ID:          id,
-			Name:        payload.Name,
-			GroupID:     payload.GroupID,
-			Mode:        payload.Mode,
-			JumperIDs:   append([]int{}, payload.JumperIDs...),
-			LocalHost:   payload.LocalHost,
-			LocalPort:   payload.LocalPort,
-			RemoteHost:  payload.RemoteHost,
-			RemotePort:  payload.RemotePort,
-			AutoStart:   payload.AutoStart,
-			Status:      payload.Status,
-			LastError:   cfg.Tunnels[idx].LastError,
-			Description: payload.Description,
+			ID:            id,
+			Name:          payload.Name,
+			GroupID:       payload.GroupID,
+			Mode:          payload.Mode,
+			JumperIDs:     append([]int{}, payload.JumperIDs...),
+			LocalHost:     payload.LocalHost,
+			LocalPort:     payload.LocalPort,
+			AutoLocalPort: payload.AutoLocalPort,
+			RemoteHost:    payload.RemoteHost,
+			RemotePort:    payload.RemotePort,
+			AutoStart:     payload.AutoStart,
+			Status:        payload.Status,
+			LastError:     cfg.Tunnels[idx].LastError,
+			Description:   payload.Description,
+			Hooks:         payload.Hooks,
+			HealthCheck:   payload.HealthCheck,
+			DependsOn:     append([]int{}, payload.DependsOn...),
+			Lazy:          payload.Lazy,
+			IdleTimeoutMs: payload.IdleTimeoutMs,
+			Schedule:      payload.Schedule,
+			TTLMs:         payload.TTLMs,
 		}
 		cfg.Tunnels[idx] = updated
 		return nil
@@ -140,6 +213,8 @@ func (b *TunnelBiz) Update(id int, payload model.TunnelPayload) (model.Tunnel, e
 		return model.Tunnel{}, err
 	}
 
+	b.recordTunnel(journal.TypeConfig, id, updated.Name, "tunnel updated", nil)
+	b.publishConfig(id, "updated")
 	return updated, nil
 }
 
@@ -176,6 +251,8 @@ func (b *TunnelBiz) MoveToGroup(id int, groupID int) (model.Tunnel, error) {
 		return model.Tunnel{}, err
 	}
 
+	b.recordTunnel(journal.TypeConfig, id, updated.Name, "tunnel moved to another group", nil)
+	b.publishConfig(id, "moved")
 	return updated, nil
 }
 
@@ -187,6 +264,7 @@ func (b *TunnelBiz) Delete(id int) error {
 		return err
 	}
 
+	var name string
 	_, err := b.storage.Update(func(cfg *conf.Config) error {
 		idx := -1
 		for i := range cfg.Tunnels {
@@ -199,9 +277,23 @@ func (b *TunnelBiz) Delete(id int) error {
 			return ErrTunnelNotFound
 		}
 
+		name = cfg.Tunnels[idx].Name
 		cfg.Tunnels = append(cfg.Tunnels[:idx], cfg.Tunnels[idx+1:]...)
+		for i := range cfg.Tunnels {
+			cfg.Tunnels[i].DependsOn = slices.DeleteFunc(cfg.Tunnels[i].DependsOn, func(dep int) bool { return dep == id })
+		}
+		for i := range cfg.Profiles {
+			cfg.Profiles[i].TunnelIDs = slices.DeleteFunc(cfg.Profiles[i].TunnelIDs, func(tunnelID int) bool { return tunnelID == id })
+		}
 		return nil
 	})
+	if err == nil {
+		b.clearLog(id)
+		b.latency.ForgetTunnel(id)
+		b.forgetCounters(id)
+		b.recordTunnel(journal.TypeConfig, id, name, "tunnel deleted", nil)
+		b.publishConfig(id, "deleted")
+	}
 	return err
 }
 
@@ -228,15 +320,93 @@ func (b *TunnelBiz) Toggle(id int, maxRunning int) (model.Tunnel, error) {
 		return model.Tunnel{}, ErrTunnelNotFound
 	}
 
-	if b.isRunning(id) || tunnel.Status == "running" {
+	b.setRunningLimit(maxRunning)
+	if b.isRunning(id) || tunnel.Status == "running" || tunnel.Status == statusPaused {
 		slog.Info("tunnel toggle stop", "tunnel_id", tunnel.ID, "name", tunnel.Name)
-		if err := b.stopRuntime(id); err != nil {
+		return b.stop(id)
+	}
+	slog.Info("tunnel toggle start", "tunnel_id", tunnel.ID, "name", tunnel.Name)
+	return b.start(cfg, tunnel, maxRunning)
+}
+
+// Start starts a tunnel unless it is already running or paused, which
+// makes it safe to call repeatedly, unlike Toggle.
+func (b *TunnelBiz) Start(id int, maxRunning int) (model.Tunnel, error) {
+	if id <= 0 {
+		return model.Tunnel{}, fmt.Errorf("invalid tunnel id")
+	}
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return model.Tunnel{}, err
+	}
+	tunnel, ok := findTunnelByID(cfg.Tunnels, id)
+	if !ok {
+		return model.Tunnel{}, ErrTunnelNotFound
+	}
+
+	b.setRunningLimit(maxRunning)
+	if !b.isRunning(id) && tunnel.Status != statusPaused && tunnel.Status != "busy" {
+		slog.Info("tunnel start", "tunnel_id", tunnel.ID, "name", tunnel.Name)
+		if tunnel, err = b.start(cfg, tunnel, maxRunning); err != nil {
 			return model.Tunnel{}, err
 		}
-		return b.updateStatus(id, "stopped", "")
 	}
+	items := []model.Tunnel{tunnel}
+	b.attachRuntimeStatus(items)
+	return items[0], nil
+}
+
+// Stop stops a running or paused tunnel; stopping a stopped tunnel is a
+// no-op.
+func (b *TunnelBiz) Stop(id int) (model.Tunnel, error) {
+	if id <= 0 {
+		return model.Tunnel{}, fmt.Errorf("invalid tunnel id")
+	}
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return model.Tunnel{}, err
+	}
+	tunnel, ok := findTunnelByID(cfg.Tunnels, id)
+	if !ok {
+		return model.Tunnel{}, ErrTunnelNotFound
+	}
+	if !b.isRunning(id) && tunnel.Status != "running" && tunnel.Status != statusPaused {
+		return tunnel, nil
+	}
+	slog.Info("tunnel stop", "tunnel_id", tunnel.ID, "name", tunnel.Name)
+	return b.stop(id)
+}
 
-	if maxRunning > 0 && b.RunningCount() >= maxRunning {
+// stop stops a tunnel and pauses the tunnels depending on it.
+func (b *TunnelBiz) stop(id int) (model.Tunnel, error) {
+	if err := b.stopRuntime(id); err != nil {
+		return model.Tunnel{}, err
+	}
+	updated, err := b.updateStatus(id, "stopped", "")
+	if err == nil {
+		b.pauseDependents(id, "stopped")
+	}
+	return updated, err
+}
+
+// start starts a stopped tunnel after its dependencies. Failures to start
+// are recorded in the returned tunnel's status rather than returned.
+func (b *TunnelBiz) start(cfg *conf.Config, tunnel model.Tunnel, maxRunning int) (model.Tunnel, error) {
+	id := tunnel.ID
+	if b.isRunning(id) {
+		return tunnel, nil
+	}
+
+	// Dependencies that are not running yet start first, in order, and
+	// count against the running limit too.
+	deps := dependencyClosure(cfg.Tunnels, id)
+	toStart := 1
+	for _, dep := range deps {
+		if !b.isRunning(dep.ID) {
+			toStart++
+		}
+	}
+	if maxRunning > 0 && b.RunningCount()+toStart > maxRunning {
 		return model.Tunnel{}, fmt.Errorf("%w: limit %d", ErrFreePlanRunningLimit, maxRunning)
 	}
 
@@ -257,7 +427,21 @@ func (b *TunnelBiz) Toggle(id int, maxRunning int) (model.Tunnel, error) {
 		return updated, nil
 	}
 
-	if err := b.startRuntime(tunnel, jumpers); err != nil {
+	for _, dep := range deps {
+		if b.isRunning(dep.ID) {
+			continue
+		}
+		slog.Info("tunnel dependency start", "tunnel_id", tunnel.ID, "dependency_id", dep.ID, "name", dep.Name)
+		if err := b.launch(cfg, dep); err != nil {
+			return b.pause(tunnel, dep, errReason(err))
+		}
+	}
+
+	err = b.runningPortClash(cfg.Tunnels, tunnel)
+	if err == nil {
+		err = b.startRuntime(tunnel, cfg.ApplyUpstreamProxy(jumpers))
+	}
+	if err != nil {
 		updated, statusErr := b.updateStatus(id, "error", errReason(err))
 		if statusErr != nil {
 			return model.Tunnel{}, fmt.Errorf("start tunnel failed: %v (persist status failed: %v)", err, statusErr)
@@ -265,23 +449,24 @@ func (b *TunnelBiz) Toggle(id int, maxRunning int) (model.Tunnel, error) {
 		return updated, nil
 	}
 
-	slog.Info("tunnel toggle start", "tunnel_id", tunnel.ID, "name", tunnel.Name)
+	slog.Info("tunnel started", "tunnel_id", tunnel.ID, "name", tunnel.Name)
 	updated, err := b.updateStatus(id, "running", "")
 	if err != nil {
 		_ = b.stopRuntime(id)
 		return model.Tunnel{}, err
 	}
+	go b.resumeDependents(id)
 	return updated, nil
 }
 
-func (b *TunnelBiz) TestConnection(payload model.TunnelPayload, inlineJumper *model.JumperPayload) (time.Duration, error) {
+func (b *TunnelBiz) TestConnection(payload model.TunnelPayload, inlineJumper *model.JumperPayload) (time.Duration, []model.NegotiatedAlgorithms, error) {
 	payload = normalizeTunnelPayload(payload)
 	if payload.Status == "" {
 		payload.Status = "stopped"
 	}
 	allowEmptyJumpers := inlineJumper != nil
 	if err := validateTunnelPayloadWithOption(payload, !allowEmptyJumpers); err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
 	chain := make([]model.Jumper, 0, len(payload.JumperIDs)+1)
@@ -290,7 +475,7 @@ func (b *TunnelBiz) TestConnection(payload model.TunnelPayload, inlineJumper *mo
 	if inlineJumper != nil {
 		jumperPayload := normalizeJumperPayload(*inlineJumper)
 		if err := validateJumperPayload(jumperPayload); err != nil {
-			return 0, fmt.Errorf("jumper: %w", err)
+			return 0, nil, fmt.Errorf("jumper: %w", err)
 		}
 		inline = model.Jumper{
 			Name:                   jumperPayload.Name,
@@ -298,25 +483,40 @@ func (b *TunnelBiz) TestConnection(payload model.TunnelPayload, inlineJumper *mo
 			Port:                   jumperPayload.Port,
 			User:                   jumperPayload.User,
 			AuthType:               jumperPayload.AuthType,
+			AuthMethods:            append([]string(nil), jumperPayload.AuthMethods...),
 			KeyPath:                jumperPayload.KeyPath,
+			CertificatePath:        jumperPayload.CertificatePath,
 			AgentSocketPath:        jumperPayload.AgentSocketPath,
+			ForwardAgent:           jumperPayload.ForwardAgent,
+			IdentitiesOnly:         jumperPayload.IdentitiesOnly,
+			IdentityFingerprint:    jumperPayload.IdentityFingerprint,
 			Password:               jumperPayload.Password,
+			TOTPSecret:             jumperPayload.TOTPSecret,
 			BypassHostVerification: jumperPayload.BypassHostVerification,
+			HostKeyPolicy:          jumperPayload.HostKeyPolicy,
+			HostKeyFingerprint:     jumperPayload.HostKeyFingerprint,
+			KnownHostsPath:         jumperPayload.KnownHostsPath,
+			HashKnownHosts:         jumperPayload.HashKnownHosts,
 			KeepAliveIntervalMs:    jumperPayload.KeepAliveIntervalMs,
 			TimeoutMs:              jumperPayload.TimeoutMs,
 			HostKeyAlgorithms:      jumperPayload.HostKeyAlgorithms,
+			Ciphers:                jumperPayload.Ciphers,
+			KeyExchanges:           jumperPayload.KeyExchanges,
+			MACs:                   jumperPayload.MACs,
+			ProxyCommand:           jumperPayload.ProxyCommand,
+			UpstreamProxy:          jumperPayload.UpstreamProxy,
 			Notes:                  jumperPayload.Notes,
 		}
 		hasInline = true
 	}
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return 0, nil, err
+	}
 	if len(payload.JumperIDs) > 0 {
-		cfg, err := b.storage.Load()
-		if err != nil {
-			return 0, err
-		}
 		jumpers, err := collectJumpers(cfg.Jumpers, payload.JumperIDs)
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
 		chain = append(chain, jumpers...)
 	}
@@ -325,17 +525,41 @@ func (b *TunnelBiz) TestConnection(payload model.TunnelPayload, inlineJumper *mo
 	}
 
 	t := model.Tunnel{
-		Name:       payload.Name,
-		Mode:       payload.Mode,
-		LocalHost:  payload.LocalHost,
-		LocalPort:  payload.LocalPort,
-		RemoteHost: payload.RemoteHost,
-		RemotePort: payload.RemotePort,
+		Name:          payload.Name,
+		Mode:          payload.Mode,
+		LocalHost:     payload.LocalHost,
+		LocalPort:     payload.LocalPort,
+		AutoLocalPort: payload.AutoLocalPort,
+		RemoteHost:    payload.RemoteHost,
+		RemotePort:    payload.RemotePort,
+	}
+	return forward.TestTunnelConnection(t, cfg.ApplyUpstreamProxy(chain))
+}
+
+// TestSaved runs the connection test for a stored tunnel. A running local
+// tunnel already holds its port, so the test listens on a free one instead.
+func (b *TunnelBiz) TestSaved(id int) (time.Duration, []model.NegotiatedAlgorithms, error) {
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return 0, nil, err
+	}
+	tunnel, ok := findTunnelByID(cfg.Tunnels, id)
+	if !ok {
+		return 0, nil, ErrTunnelNotFound
+	}
+	jumpers, err := collectJumpers(cfg.Jumpers, tunnel.JumperIDs)
+	if err != nil {
+		return 0, nil, err
+	}
+	if b.isRunning(id) {
+		tunnel.AutoLocalPort = true
 	}
-	return forward.TestTunnelConnection(t, chain)
+	return forward.TestTunnelConnection(tunnel, cfg.ApplyUpstreamProxy(jumpers))
 }
 
-func (b *TunnelBiz) attachRuntimeLatencies(items []model.Tunnel) {
+// attachRuntimeStatus fills the runtime-only fields (latency, warnings) of
+// running tunnels from their live forwards.
+func (b *TunnelBiz) attachRuntimeStatus(items []model.Tunnel) {
 	if len(items) == 0 {
 		return
 	}
@@ -348,6 +572,11 @@ func (b *TunnelBiz) attachRuntimeLatencies(items []model.Tunnel) {
 	b.mu.Unlock()
 
 	for i := range items {
+		items[i].Warnings = nil
+		items[i].Health = nil
+		items[i].BoundLocalPort = 0
+		items[i].LazyState = ""
+		items[i].TTLRemainingMs = 0
 		if items[i].Status != "running" {
 			items[i].LatencyMs = 0
 			continue
@@ -357,6 +586,19 @@ func (b *TunnelBiz) attachRuntimeLatencies(items []model.Tunnel) {
 			items[i].LatencyMs = 0
 			continue
 		}
+		items[i].Warnings = run.Warnings()
+		if health, ok := run.Health(); ok {
+			items[i].Health = &health
+		}
+		if port, ok := run.BoundLocalPort(); ok {
+			items[i].BoundLocalPort = port
+		}
+		if state, ok := run.LazyState(); ok {
+			items[i].LazyState = state
+		}
+		if left, ok := b.ttlRemaining(items[i].ID, time.Now()); ok {
+			items[i].TTLRemainingMs = left.Milliseconds()
+		}
 		latency, hasLatency := run.LastLatency()
 		if !hasLatency || latency <= 0 {
 			items[i].LatencyMs = 0
@@ -384,22 +626,28 @@ func (b *TunnelBiz) TrafficSnapshot() (up, down uint64) {
 	return up, down
 }
 
-// StartAutoStart starts tunnels marked autoStart. maxRunning <= 0 means unlimited
-// (Pro); otherwise only the first maxRunning auto-start tunnels are started.
+// StartAutoStart starts tunnels marked autoStart, or the tunnels of the
+// active profile when one is active. maxRunning <= 0 means unlimited (Pro);
+// otherwise only the first maxRunning auto-start tunnels are started.
 func (b *TunnelBiz) StartAutoStart(maxRunning int) error {
 	cfg, err := b.storage.Load()
 	if err != nil {
 		return err
 	}
 
-	autoStartTunnels := make([]model.Tunnel, 0, len(cfg.Tunnels))
-	for _, t := range cfg.Tunnels {
-		if !t.AutoStart {
-			continue
+	autoStartTunnels, ok := activeProfileTunnels(cfg)
+	if !ok {
+		autoStartTunnels = make([]model.Tunnel, 0, len(cfg.Tunnels))
+		for _, t := range cfg.Tunnels {
+			if !t.AutoStart {
+				continue
+			}
+			autoStartTunnels = append(autoStartTunnels, t)
 		}
-		autoStartTunnels = append(autoStartTunnels, t)
 	}
 
+	b.setRunningLimit(maxRunning)
+	autoStartTunnels = startOrder(autoStartTunnels)
 	if maxRunning > 0 && len(autoStartTunnels) > maxRunning {
 		autoStartTunnels = autoStartTunnels[:maxRunning]
 	}
@@ -408,45 +656,54 @@ func (b *TunnelBiz) StartAutoStart(maxRunning int) error {
 		_, _ = b.updateStatus(t.ID, "busy", "")
 	}
 
-	var wg sync.WaitGroup
-	for _, tunnel := range autoStartTunnels {
-		t := tunnel
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if t.Mode != "local" && t.Mode != "remote" && t.Mode != "dynamic" {
-				_, _ = b.updateStatus(t.ID, "error", fmt.Sprintf("mode %s is not supported yet, only local, remote and dynamic forward are implemented", t.Mode))
-				return
-			}
-
-			jumpers, err := collectJumpers(cfg.Jumpers, t.JumperIDs)
-			if err != nil {
-				_, _ = b.updateStatus(t.ID, "error", "jumper not found")
-				return
-			}
-			if err := b.startRuntime(t, jumpers); err != nil {
-				_, _ = b.updateStatus(t.ID, "error", errReason(err))
-				return
-			}
-			_, _ = b.updateStatus(t.ID, "running", "")
-		}()
+	// Each level only depends on earlier ones, so tunnels within a level
+	// start concurrently and levels start one after another.
+	for _, level := range startLevels(autoStartTunnels) {
+		var wg sync.WaitGroup
+		for _, tunnel := range level {
+			t := tunnel
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if dep, waiting := b.pendingDependency(cfg.Tunnels, t); waiting {
+					_, _ = b.pause(t, dep, "")
+					return
+				}
+				_ = b.launch(cfg, t)
+			}()
+		}
+		wg.Wait()
 	}
-	wg.Wait()
 	return nil
 }
 
 func (b *TunnelBiz) Shutdown() {
+	b.stopScheduler()
+	b.stopTrafficTicks()
 	b.mu.Lock()
-	ids := make([]int, 0, len(b.runs))
-	for id := range b.runs {
-		ids = append(ids, id)
+	runs := make(map[int]*forward.LocalForward, len(b.runs))
+	for id, run := range b.runs {
+		runs[id] = run
 	}
 	b.mu.Unlock()
 
-	for _, id := range ids {
+	for id := range runs {
 		_ = b.stopRuntime(id)
 		_, _ = b.updateStatus(id, "stopped", "")
 	}
+	// Paused tunnels are not running either; don't carry the state over.
+	if cfg, err := b.storage.Load(); err == nil {
+		for _, t := range cfg.Tunnels {
+			if t.Status == statusPaused {
+				_, _ = b.updateStatus(t.ID, "stopped", "")
+			}
+		}
+	}
+	// Give stopped hooks the chance to clean up before the app exits.
+	for _, run := range runs {
+		run.WaitHooks()
+	}
+	b.closeSubscribers()
 }
 
 func (b *TunnelBiz) startRuntime(t model.Tunnel, jumpers []model.Jumper) error {
@@ -458,8 +715,20 @@ func (b *TunnelBiz) startRuntime(t model.Tunnel, jumpers []model.Jumper) error {
 	b.mu.Unlock()
 
 	run := forward.NewLocalForward(t, jumpers)
+	run.SetHookObserver(func(result forward.HookResult) {
+		b.appendHookLog(t.ID, result)
+	})
+	hopID := latencyHopID(jumpers)
+	run.SetLatencyRecorder(func(sample latency.Sample) {
+		b.latency.Record(t.ID, hopID, sample)
+		b.publishLatency(t.ID, sample)
+	})
+	b.mu.Lock()
+	run.SetCounters(&b.countersFor(t.ID).Counters)
+	b.mu.Unlock()
 	if err := run.Start(); err != nil {
 		slog.Error("tunnel runtime start failed", "tunnel_id", t.ID, "name", t.Name, "err", err)
+		b.recordTunnel(journal.TypeError, t.ID, t.Name, "tunnel failed to start", err)
 		return err
 	}
 
@@ -470,8 +739,12 @@ func (b *TunnelBiz) startRuntime(t model.Tunnel, jumpers []model.Jumper) error {
 		return nil
 	}
 	b.runs[t.ID] = run
+	if t.TTLMs > 0 {
+		b.expiries[t.ID] = time.Now().Add(time.Duration(t.TTLMs) * time.Millisecond)
+	}
 	b.mu.Unlock()
 	slog.Info("tunnel runtime started", "tunnel_id", t.ID, "name", t.Name)
+	b.recordTunnel(journal.TypeStart, t.ID, t.Name, "tunnel started", nil)
 
 	go b.watchRuntime(t.ID, run)
 	return nil
@@ -494,11 +767,15 @@ func (b *TunnelBiz) watchRuntime(id int, run *forward.LocalForward) {
 				return
 			}
 			delete(b.runs, id)
+			delete(b.expiries, id)
+			b.retireTraffic(id, run)
 			b.mu.Unlock()
 
 			if run.Err() != nil {
 				slog.Warn("tunnel runtime exited with error", "tunnel_id", id, "err", run.Err())
+				b.recordTunnel(journal.TypeError, id, run.Name(), "tunnel stopped after an error", run.Err())
 				_, _ = b.updateStatus(id, "error", errReason(run.Err()))
+				b.pauseDependents(id, errReason(run.Err()))
 			} else {
 				slog.Info("tunnel runtime exited", "tunnel_id", id)
 			}
@@ -517,10 +794,26 @@ func (b *TunnelBiz) watchRuntime(id int, run *forward.LocalForward) {
 			switch evt.Type {
 			case forward.RuntimeEventDisconnected:
 				slog.Warn("tunnel runtime disconnected", "tunnel_id", id, "err", evt.Err)
+				b.recordTunnel(journal.TypeDisconnect, id, run.Name(), "connection lost", evt.Err)
 				_, _ = b.updateStatus(id, "error", errReason(evt.Err))
+				b.pauseDependents(id, errReason(evt.Err))
+			case forward.RuntimeEventReconnectFailed:
+				b.journal.Record(model.JournalEntry{
+					Type:     journal.TypeReconnectAttempt,
+					TunnelID: id,
+					Tunnel:   run.Name(),
+					Message:  fmt.Sprintf("reconnect attempt %d failed", evt.Attempt),
+					Error:    errReason(evt.Err),
+					Attempt:  evt.Attempt,
+				})
 			case forward.RuntimeEventReconnected:
 				slog.Info("tunnel runtime reconnected", "tunnel_id", id)
+				b.recordTunnel(journal.TypeReconnect, id, run.Name(), "reconnected", nil)
 				_, _ = b.updateStatus(id, "running", "")
+				go b.resumeDependents(id)
+			case forward.RuntimeEventDegraded, forward.RuntimeEventRecovered:
+				b.appendHealthLog(id, evt)
+				b.publishStatusByID(id)
 			}
 		}
 	}
@@ -531,13 +824,17 @@ func (b *TunnelBiz) stopRuntime(id int) error {
 	run, ok := b.runs[id]
 	if ok {
 		delete(b.runs, id)
+		delete(b.expiries, id)
+		b.retireTraffic(id, run)
 	}
 	b.mu.Unlock()
 
 	if !ok {
 		return nil
 	}
-	return run.Stop()
+	err := run.Stop()
+	b.recordTunnel(journal.TypeStop, id, run.Name(), "tunnel stopped", err)
+	return err
 }
 
 func (b *TunnelBiz) isRunning(id int) bool {
@@ -568,6 +865,8 @@ func (b *TunnelBiz) updateStatus(id int, status, lastError string) (model.Tunnel
 	if err != nil {
 		return model.Tunnel{}, err
 	}
+	b.appendStatusLog(updated)
+	b.publishStatus(updated)
 	if updated.LastError != "" {
 		slog.Info("tunnel status updated", "tunnel_id", updated.ID, "name", updated.Name, "status", updated.Status, "error", updated.LastError)
 	} else {
@@ -591,6 +890,10 @@ func normalizeTunnelPayload(payload model.TunnelPayload) model.TunnelPayload {
 	payload.Description = strings.TrimSpace(payload.Description)
 	payload.Status = strings.TrimSpace(payload.Status)
 	payload.JumperIDs = normalizeJumperIDs(payload.JumperIDs)
+	payload.Hooks = normalizeTunnelHooks(payload.Hooks)
+	payload.HealthCheck = normalizeHealthCheck(payload.HealthCheck)
+	payload.DependsOn = normalizeJumperIDs(payload.DependsOn)
+	payload.Schedule = normalizeSchedule(payload.Schedule)
 	if payload.GroupID < 0 {
 		payload.GroupID = 0
 	}
@@ -604,6 +907,9 @@ func normalizeTunnelPayload(payload model.TunnelPayload) model.TunnelPayload {
 	if payload.LocalHost == "" {
 		payload.LocalHost = "127.0.0.1"
 	}
+	if payload.AutoLocalPort {
+		payload.LocalPort = 0
+	}
 
 	return payload
 }
@@ -622,14 +928,18 @@ func validateTunnelPayloadWithOption(payload model.TunnelPayload, requireJumpers
 	if payload.LocalHost == "" {
 		return fmt.Errorf("localHost is required")
 	}
-	if payload.LocalPort < 1 || payload.LocalPort > 65535 {
-		return fmt.Errorf("localPort must be between 1 and 65535")
-	}
 	switch payload.Mode {
 	case "local", "remote", "dynamic":
 	default:
 		return fmt.Errorf("unsupported mode: %s", payload.Mode)
 	}
+	if payload.AutoLocalPort {
+		if payload.Mode == "remote" {
+			return fmt.Errorf("autoLocalPort is only supported for local and dynamic mode")
+		}
+	} else if payload.LocalPort < 1 || payload.LocalPort > 65535 {
+		return fmt.Errorf("localPort must be between 1 and 65535")
+	}
 	if payload.Mode != "dynamic" {
 		if payload.RemoteHost == "" {
 			return fmt.Errorf("remoteHost is required for non-dynamic mode")
@@ -639,13 +949,160 @@ func validateTunnelPayloadWithOption(payload model.TunnelPayload, requireJumpers
 		}
 	}
 	switch payload.Status {
-	case "running", "stopped", "error":
+	case "running", "stopped", "error", statusPaused:
 	default:
 		return fmt.Errorf("unsupported status: %s", payload.Status)
 	}
+	if payload.Hooks.TimeoutMs < 0 || payload.Hooks.TimeoutMs > forward.MaxHookTimeoutMs {
+		return fmt.Errorf("hooks.timeoutMs must be between 0 and %d", forward.MaxHookTimeoutMs)
+	}
+	if err := forward.ValidateHealthCheck(model.Tunnel{
+		Mode:        payload.Mode,
+		RemoteHost:  payload.RemoteHost,
+		RemotePort:  payload.RemotePort,
+		HealthCheck: payload.HealthCheck,
+	}); err != nil {
+		return err
+	}
+	if err := validateSchedule(payload.Schedule); err != nil {
+		return err
+	}
+	if payload.TTLMs != 0 && (payload.TTLMs < minTunnelTTLMs || payload.TTLMs > maxTunnelTTLMs) {
+		return fmt.Errorf("ttlMs must be between %d and %d", minTunnelTTLMs, maxTunnelTTLMs)
+	}
+	if err := forward.ValidateLazy(model.Tunnel{
+		Mode:          payload.Mode,
+		Lazy:          payload.Lazy,
+		IdleTimeoutMs: payload.IdleTimeoutMs,
+		HealthCheck:   payload.HealthCheck,
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkLocalPortConflict rejects a local or dynamic tunnel that would
+// listen on the same port as another saved tunnel. The exception is a pair
+// that can never run together: each sits only in profiles the other is not
+// in and neither depends on the other, as when profiles swap staging for
+// prod. runningPortClash still catches those when both are started by hand.
+// Remote tunnels only dial their local port and auto-port tunnels pick a
+// free one at start, so neither can clash.
+func checkLocalPortConflict(cfg *conf.Config, selfID int, payload model.TunnelPayload) error {
+	if !listensLocally(payload.Mode, payload.AutoLocalPort) {
+		return nil
+	}
+	for _, item := range cfg.Tunnels {
+		if item.ID == selfID || !portsClash(item, payload.Mode, payload.AutoLocalPort, payload.LocalHost, payload.LocalPort) {
+			continue
+		}
+		linked := slices.Contains(payload.DependsOn, item.ID) || (selfID > 0 && slices.Contains(item.DependsOn, selfID))
+		if !linked && separateProfiles(cfg.Profiles, selfID, item.ID) {
+			continue
+		}
+		return fmt.Errorf("%w: %s:%d is used by tunnel %q", ErrLocalPortConflict, item.LocalHost, item.LocalPort, item.Name)
+	}
+	return nil
+}
+
+// checkProfilePorts rejects a profile holding two tunnels that listen on
+// the same local port, since activating it would start both.
+func checkProfilePorts(items []model.Tunnel, ids []int) error {
+	for i, id := range ids {
+		a, ok := findTunnelByID(items, id)
+		if !ok {
+			continue
+		}
+		for _, otherID := range ids[i+1:] {
+			b, ok := findTunnelByID(items, otherID)
+			if ok && portsClash(a, b.Mode, b.AutoLocalPort, b.LocalHost, b.LocalPort) {
+				return fmt.Errorf("%w: tunnels %q and %q both use %s:%d", ErrLocalPortConflict, a.Name, b.Name, a.LocalHost, a.LocalPort)
+			}
+		}
+	}
+	return nil
+}
+
+// runningPortClash reports a tunnel that is running on the local port t
+// is about to listen on.
+func (b *TunnelBiz) runningPortClash(items []model.Tunnel, t model.Tunnel) error {
+	for _, item := range items {
+		if item.ID == t.ID || !b.isRunning(item.ID) {
+			continue
+		}
+		if portsClash(item, t.Mode, t.AutoLocalPort, t.LocalHost, t.LocalPort) {
+			return fmt.Errorf("%w: %s:%d is used by running tunnel %q", ErrLocalPortConflict, item.LocalHost, item.LocalPort, item.Name)
+		}
+	}
 	return nil
 }
 
+func portsClash(item model.Tunnel, mode string, autoPort bool, host string, port int) bool {
+	return listensLocally(mode, autoPort) && listensLocally(item.Mode, item.AutoLocalPort) &&
+		item.LocalPort == port && localHostsOverlap(item.LocalHost, host)
+}
+
+// separateProfiles reports whether tunnels a and b both belong to profiles
+// but never to the same one, so activating a profile starts at most one.
+func separateProfiles(profiles []model.TunnelProfile, a, b int) bool {
+	if a <= 0 || b <= 0 {
+		return false
+	}
+	inA, inB := false, false
+	for _, p := range profiles {
+		hasA, hasB := slices.Contains(p.TunnelIDs, a), slices.Contains(p.TunnelIDs, b)
+		if hasA && hasB {
+			return false
+		}
+		inA, inB = inA || hasA, inB || hasB
+	}
+	return inA && inB
+}
+
+func listensLocally(mode string, autoPort bool) bool {
+	if autoPort {
+		return false
+	}
+	mode = strings.TrimSpace(mode)
+	return mode == "" || mode == "local" || mode == "dynamic"
+}
+
+// localHostsOverlap reports whether listening on both hosts would compete
+// for the same port: the same address, or either side is a wildcard.
+func localHostsOverlap(a, b string) bool {
+	a, b = canonicalLocalHost(a), canonicalLocalHost(b)
+	return a == b || isWildcardHost(a) || isWildcardHost(b)
+}
+
+func canonicalLocalHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" {
+		return "127.0.0.1"
+	}
+	return host
+}
+
+func isWildcardHost(host string) bool {
+	return host == "0.0.0.0" || host == "::" || host == "*"
+}
+
+func normalizeTunnelHooks(hooks model.TunnelHooks) model.TunnelHooks {
+	hooks.PreStart = strings.TrimSpace(hooks.PreStart)
+	hooks.OnStarted = strings.TrimSpace(hooks.OnStarted)
+	hooks.OnStopped = strings.TrimSpace(hooks.OnStopped)
+	hooks.OnDisconnected = strings.TrimSpace(hooks.OnDisconnected)
+	hooks.OnReconnected = strings.TrimSpace(hooks.OnReconnected)
+	return hooks
+}
+
+func normalizeHealthCheck(check model.TunnelHealthCheck) model.TunnelHealthCheck {
+	check.Type = strings.ToLower(strings.TrimSpace(check.Type))
+	check.Target = strings.TrimSpace(check.Target)
+	check.Path = strings.TrimSpace(check.Path)
+	check.ServerName = strings.TrimSpace(check.ServerName)
+	return check
+}
+
 func collectJumpers(items []model.Jumper, ids []int) ([]model.Jumper, error) {
 	if len(ids) == 0 {
 		return nil, ErrJumperNotFound
@@ -0,0 +1,260 @@
+package biz
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/model"
+)
+
+var (
+	ErrTunnelDependencyNotFound = errors.New("dependency tunnel not found")
+	ErrTunnelDependencyCycle    = errors.New("tunnel dependencies form a cycle")
+)
+
+// statusPaused marks a tunnel stopped because a tunnel it depends on is not
+// running. It is started again once all its dependencies are back.
+const statusPaused = "paused"
+
+// validateTunnelDependencies checks that deps name existing tunnels other
+// than selfID and that giving selfID those dependencies keeps the graph
+// acyclic. selfID is 0 for a tunnel being created, which nothing can
+// depend on yet.
+func validateTunnelDependencies(items []model.Tunnel, selfID int, deps []int) error {
+	for _, dep := range deps {
+		if dep == selfID {
+			return fmt.Errorf("%w: a tunnel cannot depend on itself", ErrTunnelDependencyCycle)
+		}
+		if _, ok := findTunnelByID(items, dep); !ok {
+			return fmt.Errorf("%w: %d", ErrTunnelDependencyNotFound, dep)
+		}
+	}
+	if selfID <= 0 {
+		return nil
+	}
+
+	edges := dependencyEdges(items)
+	edges[selfID] = deps
+	visited := make(map[int]bool)
+	var reaches func(id int) bool
+	reaches = func(id int) bool {
+		if id == selfID {
+			return true
+		}
+		if visited[id] {
+			return false
+		}
+		visited[id] = true
+		for _, next := range edges[id] {
+			if reaches(next) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, dep := range deps {
+		if reaches(dep) {
+			name := fmt.Sprint(dep)
+			if t, ok := findTunnelByID(items, dep); ok {
+				name = fmt.Sprintf("%q", t.Name)
+			}
+			return fmt.Errorf("%w through tunnel %s", ErrTunnelDependencyCycle, name)
+		}
+	}
+	return nil
+}
+
+func dependencyEdges(items []model.Tunnel) map[int][]int {
+	edges := make(map[int][]int, len(items))
+	for _, t := range items {
+		edges[t.ID] = t.DependsOn
+	}
+	return edges
+}
+
+// startOrder sorts tunnels so that every tunnel comes after the ones it
+// depends on, keeping the config order otherwise. Dependencies outside
+// tunnels are ignored.
+func startOrder(tunnels []model.Tunnel) []model.Tunnel {
+	pending := make(map[int]bool, len(tunnels))
+	for _, t := range tunnels {
+		pending[t.ID] = true
+	}
+	ordered := make([]model.Tunnel, 0, len(tunnels))
+	for len(ordered) < len(tunnels) {
+		progressed := false
+		for _, t := range tunnels {
+			if !pending[t.ID] || slices.ContainsFunc(t.DependsOn, func(dep int) bool { return pending[dep] }) {
+				continue
+			}
+			pending[t.ID] = false
+			ordered = append(ordered, t)
+			progressed = true
+		}
+		if !progressed {
+			// Only reachable with a cycle saved before validation existed;
+			// start the rest in config order rather than not at all.
+			for _, t := range tunnels {
+				if pending[t.ID] {
+					pending[t.ID] = false
+					ordered = append(ordered, t)
+				}
+			}
+		}
+	}
+	return ordered
+}
+
+// startLevels groups tunnels into batches that can start concurrently:
+// each batch only depends on tunnels in earlier batches.
+func startLevels(tunnels []model.Tunnel) [][]model.Tunnel {
+	level := make(map[int]int, len(tunnels))
+	var levels [][]model.Tunnel
+	for _, t := range startOrder(tunnels) {
+		n := 0
+		for _, dep := range t.DependsOn {
+			if l, ok := level[dep]; ok && l+1 > n {
+				n = l + 1
+			}
+		}
+		level[t.ID] = n
+		for len(levels) <= n {
+			levels = append(levels, nil)
+		}
+		levels[n] = append(levels[n], t)
+	}
+	return levels
+}
+
+// dependencyClosure returns id's transitive dependencies in start order,
+// without id itself.
+func dependencyClosure(items []model.Tunnel, id int) []model.Tunnel {
+	seen := map[int]bool{id: true}
+	var collected []model.Tunnel
+	queue := []int{id}
+	for len(queue) > 0 {
+		t, ok := findTunnelByID(items, queue[0])
+		queue = queue[1:]
+		if !ok {
+			continue
+		}
+		for _, dep := range t.DependsOn {
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			if depTunnel, ok := findTunnelByID(items, dep); ok {
+				collected = append(collected, depTunnel)
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return startOrder(collected)
+}
+
+// pendingDependency returns the first dependency of t that is not running.
+func (b *TunnelBiz) pendingDependency(items []model.Tunnel, t model.Tunnel) (model.Tunnel, bool) {
+	for _, dep := range t.DependsOn {
+		if b.isRunning(dep) {
+			continue
+		}
+		if depTunnel, ok := findTunnelByID(items, dep); ok {
+			return depTunnel, true
+		}
+	}
+	return model.Tunnel{}, false
+}
+
+func (b *TunnelBiz) pause(t model.Tunnel, dep model.Tunnel, reason string) (model.Tunnel, error) {
+	msg := fmt.Sprintf("waiting for dependency %q", dep.Name)
+	if reason != "" {
+		msg += ": " + reason
+	}
+	return b.updateStatus(t.ID, statusPaused, msg)
+}
+
+// pauseDependents stops every running tunnel that depends on id, directly
+// or not, and marks it paused until id is back.
+func (b *TunnelBiz) pauseDependents(id int, reason string) {
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return
+	}
+	dep, ok := findTunnelByID(cfg.Tunnels, id)
+	if !ok {
+		return
+	}
+	for _, t := range cfg.Tunnels {
+		if !slices.Contains(t.DependsOn, id) || !b.isRunning(t.ID) {
+			continue
+		}
+		slog.Info("tunnel paused by dependency", "tunnel_id", t.ID, "name", t.Name, "dependency_id", id)
+		_ = b.stopRuntime(t.ID)
+		_, _ = b.pause(t, dep, reason)
+		b.pauseDependents(t.ID, statusPaused)
+	}
+}
+
+// resumeDependents restarts paused tunnels depending on id whose
+// dependencies are now all running, then their own dependents.
+func (b *TunnelBiz) resumeDependents(id int) {
+	cfg, err := b.storage.Load()
+	if err != nil {
+		return
+	}
+	for _, t := range cfg.Tunnels {
+		if t.Status != statusPaused || !slices.Contains(t.DependsOn, id) {
+			continue
+		}
+		if _, waiting := b.pendingDependency(cfg.Tunnels, t); waiting {
+			continue
+		}
+		if limit := b.runningLimit(); limit > 0 && b.RunningCount() >= limit {
+			_, _ = b.updateStatus(t.ID, statusPaused, fmt.Sprintf("%v: limit %d", ErrFreePlanRunningLimit, limit))
+			continue
+		}
+		slog.Info("tunnel resumed after dependency", "tunnel_id", t.ID, "name", t.Name, "dependency_id", id)
+		if err := b.launch(cfg, t); err == nil {
+			b.resumeDependents(t.ID)
+		}
+	}
+}
+
+// launch starts t and records the outcome as its status.
+func (b *TunnelBiz) launch(cfg *conf.Config, t model.Tunnel) error {
+	if t.Mode != "local" && t.Mode != "remote" && t.Mode != "dynamic" {
+		err := fmt.Errorf("mode %s is not supported yet, only local, remote and dynamic forward are implemented", t.Mode)
+		_, _ = b.updateStatus(t.ID, "error", err.Error())
+		return err
+	}
+	jumpers, err := collectJumpers(cfg.Jumpers, t.JumperIDs)
+	if err != nil {
+		_, _ = b.updateStatus(t.ID, "error", "jumper not found")
+		return err
+	}
+	err = b.runningPortClash(cfg.Tunnels, t)
+	if err == nil {
+		err = b.startRuntime(t, cfg.ApplyUpstreamProxy(jumpers))
+	}
+	if err != nil {
+		_, _ = b.updateStatus(t.ID, "error", errReason(err))
+		return err
+	}
+	_, _ = b.updateStatus(t.ID, "running", "")
+	return nil
+}
+
+func (b *TunnelBiz) setRunningLimit(maxRunning int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maxRunning = maxRunning
+}
+
+func (b *TunnelBiz) runningLimit() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.maxRunning
+}
@@ -0,0 +1,160 @@
+package biz
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/model"
+)
+
+func newDependencyTestBiz(t *testing.T) (*TunnelBiz, func(name string, port int, deps ...int) model.TunnelPayload) {
+	t.Helper()
+	storage, err := conf.NewStorage(filepath.Join(t.TempDir(), "config.toml"))
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+	jumper, err := NewJumperBiz(storage).Create(model.JumperPayload{
+		Name:      "jump",
+		Host:      "127.0.0.1",
+		Port:      1,
+		User:      "root",
+		AuthType:  "ssh_agent",
+		TimeoutMs: 500,
+	})
+	if err != nil {
+		t.Fatalf("create jumper: %v", err)
+	}
+	payload := func(name string, port int, deps ...int) model.TunnelPayload {
+		return model.TunnelPayload{
+			Name:       name,
+			Mode:       "local",
+			JumperIDs:  []int{jumper.ID},
+			LocalHost:  "127.0.0.1",
+			LocalPort:  port,
+			RemoteHost: "10.0.0.1",
+			RemotePort: 22,
+			DependsOn:  deps,
+		}
+	}
+	return NewTunnelBiz(storage), payload
+}
+
+func TestTunnelDependencyValidation(t *testing.T) {
+	tunnelBiz, payload := newDependencyTestBiz(t)
+
+	db, err := tunnelBiz.Create(payload("db", 15432))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	api, err := tunnelBiz.Create(payload("api", 18080, db.ID))
+	if err != nil {
+		t.Fatalf("create api: %v", err)
+	}
+	web, err := tunnelBiz.Create(payload("web", 18443, api.ID, api.ID, 0))
+	if err != nil {
+		t.Fatalf("create web: %v", err)
+	}
+	if len(web.DependsOn) != 1 || web.DependsOn[0] != api.ID {
+		t.Fatalf("web dependsOn = %v, want [%d]", web.DependsOn, api.ID)
+	}
+
+	if _, err := tunnelBiz.Create(payload("ghost", 18000, 999)); !errors.Is(err, ErrTunnelDependencyNotFound) {
+		t.Fatalf("unknown dependency err = %v", err)
+	}
+	if _, err := tunnelBiz.Update(db.ID, payload("db", 15432, db.ID)); !errors.Is(err, ErrTunnelDependencyCycle) {
+		t.Fatalf("self dependency err = %v", err)
+	}
+	if _, err := tunnelBiz.Update(db.ID, payload("db", 15432, web.ID)); !errors.Is(err, ErrTunnelDependencyCycle) {
+		t.Fatalf("db -> web -> api -> db err = %v", err)
+	}
+
+	if err := tunnelBiz.Delete(api.ID); err != nil {
+		t.Fatalf("delete api: %v", err)
+	}
+	items, err := tunnelBiz.List()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if got, _ := findTunnelByID(items, web.ID); len(got.DependsOn) != 0 {
+		t.Fatalf("deleting api should drop it from web's dependencies, got %v", got.DependsOn)
+	}
+}
+
+func TestStartLevels(t *testing.T) {
+	tunnels := []model.Tunnel{
+		{ID: 1, Name: "web", DependsOn: []int{2, 3}},
+		{ID: 2, Name: "api", DependsOn: []int{3}},
+		{ID: 3, Name: "db"},
+		{ID: 4, Name: "cache"},
+		{ID: 5, Name: "report", DependsOn: []int{9}},
+	}
+	levels := startLevels(tunnels)
+	var got [][]string
+	for _, level := range levels {
+		var names []string
+		for _, tunnel := range level {
+			names = append(names, tunnel.Name)
+		}
+		got = append(got, names)
+	}
+	want := [][]string{{"db", "cache", "report"}, {"api"}, {"web"}}
+	if len(got) != len(want) {
+		t.Fatalf("levels = %v, want %v", got, want)
+	}
+	for i := range want {
+		if len(got[i]) != len(want[i]) {
+			t.Fatalf("levels = %v, want %v", got, want)
+		}
+		for j := range want[i] {
+			if got[i][j] != want[i][j] {
+				t.Fatalf("levels = %v, want %v", got, want)
+			}
+		}
+	}
+
+	if deps := dependencyClosure(tunnels, 1); len(deps) != 2 || deps[0].ID != 3 || deps[1].ID != 2 {
+		t.Fatalf("closure of web = %+v", deps)
+	}
+}
+
+func TestToggleStartsDependenciesFirstAndPausesOnFailure(t *testing.T) {
+	tunnelBiz, payload := newDependencyTestBiz(t)
+
+	db, err := tunnelBiz.Create(payload("db", 15432))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	api, err := tunnelBiz.Create(payload("api", 18080, db.ID))
+	if err != nil {
+		t.Fatalf("create api: %v", err)
+	}
+
+	// The jumper is unreachable, so db fails to start and api waits for it.
+	got, err := tunnelBiz.Toggle(api.ID, 0)
+	if err != nil {
+		t.Fatalf("toggle api: %v", err)
+	}
+	if got.Status != statusPaused {
+		t.Fatalf("api status = %q (%s), want paused", got.Status, got.LastError)
+	}
+	items, err := tunnelBiz.List()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if dbNow, _ := findTunnelByID(items, db.ID); dbNow.Status != "error" {
+		t.Fatalf("db status = %q, want error", dbNow.Status)
+	}
+
+	// Toggling a paused tunnel stops it.
+	got, err = tunnelBiz.Toggle(api.ID, 0)
+	if err != nil || got.Status != "stopped" {
+		t.Fatalf("toggle paused api = %q, %v", got.Status, err)
+	}
+
+	// Starting api needs db too, which the running limit must allow.
+	if _, err := tunnelBiz.Toggle(api.ID, 1); !errors.Is(err, ErrFreePlanRunningLimit) {
+		t.Fatalf("toggle api with limit 1 err = %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package biz
+
+import (
+	"fmt"
+	"time"
+
+	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/model"
+)
+
+// tunnelLogLimit bounds the in-memory log kept for each tunnel.
+const tunnelLogLimit = 200
+
+const (
+	tunnelLogSourceStatus = "status"
+	tunnelLogSourceHook   = "hook"
+	tunnelLogSourceHealth = "health"
+)
+
+// Log returns the runtime log of a tunnel, oldest first.
+func (b *TunnelBiz) Log(id int) []model.TunnelLogEntry {
+	b.logMu.Lock()
+	defer b.logMu.Unlock()
+	return append([]model.TunnelLogEntry(nil), b.logs[id]...)
+}
+
+func (b *TunnelBiz) appendLog(id int, entry model.TunnelLogEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	b.logMu.Lock()
+	entries := append(b.logs[id], entry)
+	if over := len(entries) - tunnelLogLimit; over > 0 {
+		entries = append(entries[:0:0], entries[over:]...)
+	}
+	b.logs[id] = entries
+	b.logMu.Unlock()
+	b.publish(model.TunnelEvent{TunnelID: id, Entry: entry})
+}
+
+func (b *TunnelBiz) clearLog(id int) {
+	b.logMu.Lock()
+	defer b.logMu.Unlock()
+	delete(b.logs, id)
+}
+
+func (b *TunnelBiz) appendStatusLog(t model.Tunnel) {
+	b.appendLog(t.ID, model.TunnelLogEntry{
+		Source:  tunnelLogSourceStatus,
+		Event:   t.Status,
+		Message: "status changed to " + t.Status,
+		Error:   t.LastError,
+	})
+}
+
+func (b *TunnelBiz) appendHookLog(id int, result forward.HookResult) {
+	where := "local"
+	if result.Remote {
+		where = "remote"
+	}
+	took := result.Duration.Round(time.Millisecond)
+	entry := model.TunnelLogEntry{
+		Source:  tunnelLogSourceHook,
+		Event:   result.Event,
+		Message: fmt.Sprintf("%s hook %q finished in %s", where, result.Command, took),
+		Output:  result.Output,
+	}
+	if result.Err != nil {
+		entry.Message = fmt.Sprintf("%s hook %q failed after %s", where, result.Command, took)
+		entry.Error = result.Err.Error()
+	}
+	b.appendLog(id, entry)
+}
+
+func (b *TunnelBiz) appendHealthLog(id int, evt forward.RuntimeEvent) {
+	entry := model.TunnelLogEntry{
+		Source:  tunnelLogSourceHealth,
+		Event:   string(evt.Type),
+		Message: "health check recovered",
+	}
+	if evt.Type == forward.RuntimeEventDegraded {
+		entry.Message = "health check failing, tunnel degraded"
+	}
+	if evt.Err != nil {
+		entry.Error = evt.Err.Error()
+	}
+	b.appendLog(id, entry)
+}
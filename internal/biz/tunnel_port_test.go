@@ -0,0 +1,127 @@
+package biz
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/model"
+)
+
+func TestLocalPortConflicts(t *testing.T) {
+	storage, err := conf.NewStorage(filepath.Join(t.TempDir(), "config.toml"))
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+	jumper, err := NewJumperBiz(storage).Create(model.JumperPayload{
+		Name:     "jump",
+		Host:     "jump.example.com",
+		Port:     22,
+		User:     "root",
+		AuthType: "ssh_agent",
+	})
+	if err != nil {
+		t.Fatalf("create jumper: %v", err)
+	}
+	tunnelBiz := NewTunnelBiz(storage)
+	payload := func(name, mode, host string, port int, deps ...int) model.TunnelPayload {
+		return model.TunnelPayload{
+			Name:       name,
+			Mode:       mode,
+			JumperIDs:  []int{jumper.ID},
+			LocalHost:  host,
+			LocalPort:  port,
+			RemoteHost: "10.0.0.1",
+			RemotePort: 5432,
+			DependsOn:  deps,
+		}
+	}
+
+	db, err := tunnelBiz.Create(payload("db", "local", "127.0.0.1", 15432))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		payload model.TunnelPayload
+		clash   bool
+	}{
+		{"same host and port", payload("db2", "local", "127.0.0.1", 15432), true},
+		{"wildcard host", payload("db3", "dynamic", "0.0.0.0", 15432), true},
+		{"dependent tunnel", payload("db4", "local", "", 15432, db.ID), true},
+		{"other loopback address", payload("db5", "local", "127.0.0.2", 15432), false},
+		{"remote mode only dials the port", payload("db6", "remote", "127.0.0.1", 15432), false},
+		{"other port", payload("db7", "local", "127.0.0.1", 15433), false},
+	}
+	for _, tc := range cases {
+		_, err := tunnelBiz.Create(tc.payload)
+		if clash := errors.Is(err, ErrLocalPortConflict); clash != tc.clash {
+			t.Errorf("%s: err = %v, want clash %v", tc.name, err, tc.clash)
+		}
+	}
+
+	// Saving a tunnel against its own port is not a clash; tunnels kept in
+	// separate profiles may share one, but not once a profile holds both.
+	if _, err := tunnelBiz.Update(db.ID, payload("db", "local", "127.0.0.1", 15432)); err != nil {
+		t.Fatalf("update db in place: %v", err)
+	}
+	other, err := tunnelBiz.Create(payload("db-staging", "local", "127.0.0.1", 16432))
+	if err != nil {
+		t.Fatalf("create db-staging: %v", err)
+	}
+	profiles := NewProfileBiz(storage)
+	if _, err := profiles.Create(model.TunnelProfilePayload{Name: "prod", TunnelIDs: []int{db.ID}}); err != nil {
+		t.Fatalf("create prod profile: %v", err)
+	}
+	if _, err := tunnelBiz.Update(other.ID, payload("db-staging", "local", "", 15432)); !errors.Is(err, ErrLocalPortConflict) {
+		t.Fatalf("update a standalone tunnel onto a profiled tunnel's port: err = %v", err)
+	}
+	if _, err := profiles.Create(model.TunnelProfilePayload{Name: "staging", TunnelIDs: []int{other.ID}}); err != nil {
+		t.Fatalf("create staging profile: %v", err)
+	}
+	if _, err := tunnelBiz.Update(other.ID, payload("db-staging", "local", "", 15432)); err != nil {
+		t.Fatalf("update onto the port of a tunnel in another profile: %v", err)
+	}
+	if _, err := profiles.Create(model.TunnelProfilePayload{Name: "both", TunnelIDs: []int{db.ID, other.ID}}); !errors.Is(err, ErrLocalPortConflict) {
+		t.Fatalf("profile with two tunnels on one port: err = %v", err)
+	}
+
+	auto := payload("auto", "local", "127.0.0.1", 15432)
+	auto.AutoLocalPort = true
+	created, err := tunnelBiz.Create(auto)
+	if err != nil {
+		t.Fatalf("create auto-port tunnel: %v", err)
+	}
+	if !created.AutoLocalPort || created.LocalPort != 0 {
+		t.Fatalf("auto-port tunnel = %+v", created)
+	}
+	auto.Name, auto.Mode = "auto-remote", "remote"
+	if _, err := tunnelBiz.Create(auto); err == nil {
+		t.Fatal("auto local port should be rejected for remote mode")
+	}
+}
+
+func TestLocalPortConflictBetweenStandaloneTunnels(t *testing.T) {
+	tunnelBiz, payload := newDependencyTestBiz(t)
+
+	db, err := tunnelBiz.Create(payload("db", 15432))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	if _, err := tunnelBiz.Create(payload("db-copy", 15432)); !errors.Is(err, ErrLocalPortConflict) {
+		t.Fatalf("create on db's port: err = %v, want ErrLocalPortConflict", err)
+	}
+
+	cache, err := tunnelBiz.Create(payload("cache", 16379))
+	if err != nil {
+		t.Fatalf("create cache: %v", err)
+	}
+	if _, err := tunnelBiz.Update(cache.ID, payload("cache", 15432)); !errors.Is(err, ErrLocalPortConflict) {
+		t.Fatalf("update onto db's port: err = %v, want ErrLocalPortConflict", err)
+	}
+	if _, err := tunnelBiz.Update(db.ID, payload("db", 15432)); err != nil {
+		t.Fatalf("update db in place: %v", err)
+	}
+}
@@ -48,13 +48,21 @@ func getDefaultConfigDir() string {
 
 // Config is persisted in TOML storage.
 type Config struct {
-	Version int                 `toml:"version"`
-	Jumpers []model.Jumper      `toml:"jumpers"`
-	Groups  []model.TunnelGroup `toml:"groups"`
-	Tunnels []model.Tunnel      `toml:"tunnels"`
-	AutoRun                 bool `toml:"auto_run"`
-	TrafficMonitorEnabled   bool `toml:"traffic_monitor_enabled"`
-	License                 LicenseConfig       `toml:"license"`
+	Version               int                      `toml:"version"`
+	Jumpers               []model.Jumper           `toml:"jumpers"`
+	Groups                []model.TunnelGroup      `toml:"groups"`
+	Tunnels               []model.Tunnel           `toml:"tunnels"`
+	Profiles              []model.TunnelProfile    `toml:"profiles"`
+	ActiveProfileID       int                      `toml:"active_profile_id"`
+	AutoRun               bool                     `toml:"auto_run"`
+	TrafficMonitorEnabled bool                     `toml:"traffic_monitor_enabled"`
+	UpstreamProxy         string                   `toml:"upstream_proxy"`
+	APIEnabled            bool                     `toml:"api_enabled"`
+	APIPort               int                      `toml:"api_port"`
+	MetricsEnabled        bool                     `toml:"metrics_enabled"`
+	MetricsPort           int                      `toml:"metrics_port"`
+	Notifications         []model.NotificationSink `toml:"notifications"`
+	License               LicenseConfig            `toml:"license"`
 }
 
 type LicenseConfig struct {
@@ -80,10 +88,12 @@ func ResolveConfigPath() string {
 // DefaultConfig creates an empty config.
 func DefaultConfig() *Config {
 	return &Config{
-		Version: currentConfigVersion,
-		Jumpers: []model.Jumper{},
-		Groups:  []model.TunnelGroup{},
-		Tunnels: []model.Tunnel{},
+		Version:               currentConfigVersion,
+		Jumpers:               []model.Jumper{},
+		Groups:                []model.TunnelGroup{},
+		Tunnels:               []model.Tunnel{},
+		Profiles:              []model.TunnelProfile{},
+		Notifications:         []model.NotificationSink{},
 		AutoRun:               false,
 		TrafficMonitorEnabled: true,
 		License:               LicenseConfig{},
@@ -98,13 +108,21 @@ func (c *Config) Clone() *Config {
 
 	out := &Config{
 		Version:               c.Version,
+		ActiveProfileID:       c.ActiveProfileID,
 		AutoRun:               c.AutoRun,
 		TrafficMonitorEnabled: c.TrafficMonitorEnabled,
+		UpstreamProxy:         c.UpstreamProxy,
+		APIEnabled:            c.APIEnabled,
+		APIPort:               c.APIPort,
+		MetricsEnabled:        c.MetricsEnabled,
+		MetricsPort:           c.MetricsPort,
 		License:               c.License,
 	}
 	out.Jumpers = append(out.Jumpers, c.Jumpers...)
 	out.Groups = append(out.Groups, c.Groups...)
 	out.Tunnels = append(out.Tunnels, c.Tunnels...)
+	out.Profiles = append(out.Profiles, c.Profiles...)
+	out.Notifications = append(out.Notifications, c.Notifications...)
 	return out
 }
 
@@ -122,13 +140,32 @@ func (c *Config) Normalize() {
 	if c.Tunnels == nil {
 		c.Tunnels = []model.Tunnel{}
 	}
+	if c.Profiles == nil {
+		c.Profiles = []model.TunnelProfile{}
+	}
+	if c.Notifications == nil {
+		c.Notifications = []model.NotificationSink{}
+	}
 	c.License.Code = strings.TrimSpace(c.License.Code)
+	c.UpstreamProxy = strings.TrimSpace(c.UpstreamProxy)
 	// AutoRun defaults to false; no need to set if already present
 	for i := range c.Tunnels {
 		c.Tunnels[i].JumperIDs = normalizeJumperIDs(c.Tunnels[i].JumperIDs)
 	}
 }
 
+// ApplyUpstreamProxy returns a copy of chain whose first hop falls back to the
+// global upstream proxy when it has none of its own. Later hops are reached
+// through the SSH chain and never use a proxy.
+func (c *Config) ApplyUpstreamProxy(chain []model.Jumper) []model.Jumper {
+	out := append([]model.Jumper(nil), chain...)
+	if c == nil || len(out) == 0 || strings.TrimSpace(out[0].UpstreamProxy) != "" {
+		return out
+	}
+	out[0].UpstreamProxy = c.UpstreamProxy
+	return out
+}
+
 func normalizeJumperIDs(ids []int) []int {
 	out := make([]int, 0, len(ids))
 	seen := make(map[int]struct{}, len(ids)+1)
@@ -0,0 +1,28 @@
+package conf
+
+import (
+	"testing"
+
+	"loris-tunnel/internal/model"
+)
+
+func TestApplyUpstreamProxyFallsBackOnFirstHopOnly(t *testing.T) {
+	cfg := &Config{UpstreamProxy: "system"}
+	chain := []model.Jumper{{ID: 1}, {ID: 2}}
+
+	got := cfg.ApplyUpstreamProxy(chain)
+	if got[0].UpstreamProxy != "system" {
+		t.Fatalf("first hop proxy = %q, want system", got[0].UpstreamProxy)
+	}
+	if got[1].UpstreamProxy != "" {
+		t.Fatalf("second hop proxy = %q, want empty", got[1].UpstreamProxy)
+	}
+	if chain[0].UpstreamProxy != "" {
+		t.Fatal("ApplyUpstreamProxy mutated the input chain")
+	}
+
+	chain[0].UpstreamProxy = "socks5://127.0.0.1:1080"
+	if got := cfg.ApplyUpstreamProxy(chain); got[0].UpstreamProxy != "socks5://127.0.0.1:1080" {
+		t.Fatalf("jumper proxy overridden: %q", got[0].UpstreamProxy)
+	}
+}
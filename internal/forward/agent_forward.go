@@ -0,0 +1,171 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentAuditLimit bounds the in-memory log of forwarded agent requests.
+const agentAuditLimit = 200
+
+// ErrAgentOperationRefused is returned to the remote side for agent
+// operations that would change the local agent.
+var ErrAgentOperationRefused = errors.New("operation not permitted over a forwarded agent")
+
+var (
+	agentAuditMu  sync.Mutex
+	agentAuditLog []model.AgentForwardEvent
+)
+
+// AgentForwardEvents returns the most recent forwarded agent requests, oldest
+// first.
+func AgentForwardEvents() []model.AgentForwardEvent {
+	agentAuditMu.Lock()
+	defer agentAuditMu.Unlock()
+	return append([]model.AgentForwardEvent(nil), agentAuditLog...)
+}
+
+func recordAgentForwardEvent(event model.AgentForwardEvent) {
+	attrs := []any{"jumper", event.Jumper, "op", event.Operation, "allowed", event.Allowed}
+	if event.KeyFingerprint != "" {
+		attrs = append(attrs, "key", event.KeyFingerprint, "comment", event.KeyComment)
+	}
+	if event.Error != "" {
+		attrs = append(attrs, "err", event.Error)
+	}
+	slog.Info("forwarded agent request", attrs...)
+
+	agentAuditMu.Lock()
+	defer agentAuditMu.Unlock()
+	agentAuditLog = append(agentAuditLog, event)
+	if over := len(agentAuditLog) - agentAuditLimit; over > 0 {
+		agentAuditLog = append(agentAuditLog[:0:0], agentAuditLog[over:]...)
+	}
+}
+
+// enableAgentForwarding lets sessions on client reach the local agent when
+// the jumper asks for it. Requests are served by an auditing wrapper rather
+// than agent.ForwardToRemote so each one is logged and key management is
+// refused.
+func enableAgentForwarding(client *ssh.Client, jumper model.Jumper) error {
+	if !jumper.ForwardAgent {
+		return nil
+	}
+	if _, _, err := getSSHAgent(jumper.AgentSocketPath); err != nil {
+		return fmt.Errorf("forward agent: %w", err)
+	}
+	keyring := &auditedAgent{jumper: jumperDisplayName(jumper), socketPath: jumper.AgentSocketPath}
+	if err := agent.ForwardToAgent(client, keyring); err != nil {
+		return fmt.Errorf("forward agent: %w", err)
+	}
+	return nil
+}
+
+// newChainSession opens a session on the last hop of a chain, requesting
+// agent forwarding when that hop has ForwardAgent set.
+func newChainSession(client *ssh.Client, jumpers []model.Jumper) (*ssh.Session, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("create ssh session failed: %w", err)
+	}
+	if len(jumpers) > 0 && jumpers[len(jumpers)-1].ForwardAgent {
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			_ = session.Close()
+			return nil, fmt.Errorf("request agent forwarding failed: %w", err)
+		}
+	}
+	return session, nil
+}
+
+// auditedAgent serves forwarded agent requests from the local agent. The
+// agent is resolved per request so a reconnected local agent keeps working.
+type auditedAgent struct {
+	jumper     string
+	socketPath string
+}
+
+func (a *auditedAgent) record(op string, key ssh.PublicKey, comment string, err error) {
+	event := model.AgentForwardEvent{
+		Time:       time.Now(),
+		Jumper:     a.jumper,
+		Operation:  op,
+		KeyComment: comment,
+		Allowed:    err == nil,
+	}
+	if key != nil {
+		event.KeyFingerprint = ssh.FingerprintSHA256(key)
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	recordAgentForwardEvent(event)
+}
+
+func (a *auditedAgent) local() (agent.ExtendedAgent, error) {
+	inst, _, err := getSSHAgent(a.socketPath)
+	return inst, err
+}
+
+func (a *auditedAgent) List() ([]*agent.Key, error) {
+	inst, err := a.local()
+	if err != nil {
+		a.record("list", nil, "", err)
+		return nil, err
+	}
+	keys, err := inst.List()
+	a.record("list", nil, "", err)
+	return keys, err
+}
+
+func (a *auditedAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+func (a *auditedAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	inst, err := a.local()
+	if err != nil {
+		a.record("sign", key, "", err)
+		return nil, err
+	}
+	sig, err := inst.SignWithFlags(key, data, flags)
+	a.record("sign", key, agentKeyComment(inst, key), err)
+	return sig, err
+}
+
+// agentKeyComment returns the agent's comment for key, which usually names
+// the key's owner or file.
+func agentKeyComment(inst agent.Agent, key ssh.PublicKey) string {
+	keys, err := inst.List()
+	if err != nil {
+		return ""
+	}
+	for _, k := range keys {
+		if string(k.Marshal()) == string(key.Marshal()) {
+			return k.Comment
+		}
+	}
+	return ""
+}
+
+func (a *auditedAgent) refuse(op string) error {
+	a.record(op, nil, "", ErrAgentOperationRefused)
+	return ErrAgentOperationRefused
+}
+
+func (a *auditedAgent) Add(agent.AddedKey) error       { return a.refuse("add") }
+func (a *auditedAgent) Remove(ssh.PublicKey) error     { return a.refuse("remove") }
+func (a *auditedAgent) RemoveAll() error               { return a.refuse("remove_all") }
+func (a *auditedAgent) Lock([]byte) error              { return a.refuse("lock") }
+func (a *auditedAgent) Unlock([]byte) error            { return a.refuse("unlock") }
+func (a *auditedAgent) Signers() ([]ssh.Signer, error) { return nil, a.refuse("signers") }
+func (a *auditedAgent) Extension(string, []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
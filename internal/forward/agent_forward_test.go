@@ -0,0 +1,223 @@
+package forward
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// startTestAgent serves an in-memory keyring with one key on a unix socket
+// and points the agent lookup at it.
+func startTestAgent(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("unix agent socket")
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv, Comment: "ops@laptop"}); err != nil {
+		t.Fatalf("add key: %v", err)
+	}
+
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen agent: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	resetSSHAgent()
+	t.Setenv("LORIS_TUNNEL_SSH_AUTH_SOCK", sock)
+	t.Cleanup(resetSSHAgent)
+
+	signers, _ := keyring.Signers()
+	return signers[0].PublicKey()
+}
+
+type forwardedAgentResult struct {
+	keys    int
+	signErr error
+	addErr  error
+}
+
+// agentForwardingServer accepts exec sessions and, when agent forwarding is
+// requested, lists and uses the forwarded agent like a remote git would.
+func agentForwardingServer(results chan<- forwardedAgentResult) func(*ssh.ServerConn, <-chan ssh.NewChannel) {
+	return func(sconn *ssh.ServerConn, chans <-chan ssh.NewChannel) {
+		for newCh := range chans {
+			if newCh.ChannelType() != "session" {
+				_ = newCh.Reject(ssh.UnknownChannelType, "session only")
+				continue
+			}
+			ch, reqs, err := newCh.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer ch.Close()
+				forwarded := false
+				for req := range reqs {
+					switch req.Type {
+					case "auth-agent-req@openssh.com":
+						forwarded = true
+						_ = req.Reply(true, nil)
+					case "exec":
+						_ = req.Reply(true, nil)
+						if forwarded {
+							results <- useForwardedAgent(sconn)
+						}
+						_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+						return
+					default:
+						_ = req.Reply(false, nil)
+					}
+				}
+			}()
+		}
+	}
+}
+
+func useForwardedAgent(sconn *ssh.ServerConn) forwardedAgentResult {
+	ch, reqs, err := sconn.OpenChannel("auth-agent@openssh.com", nil)
+	if err != nil {
+		return forwardedAgentResult{signErr: err}
+	}
+	defer ch.Close()
+	go ssh.DiscardRequests(reqs)
+
+	remote := agent.NewClient(ch)
+	keys, err := remote.List()
+	if err != nil || len(keys) == 0 {
+		return forwardedAgentResult{signErr: errors.New("no forwarded keys")}
+	}
+	_, signErr := remote.Sign(keys[0], []byte("challenge"))
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	addErr := remote.Add(agent.AddedKey{PrivateKey: priv})
+	return forwardedAgentResult{keys: len(keys), signErr: signErr, addErr: addErr}
+}
+
+func TestExecuteRemoteCommandForwardsAgentWithAudit(t *testing.T) {
+	agentKey := startTestAgent(t)
+	results := make(chan forwardedAgentResult, 1)
+	host, port, _ := startTestSSHServerWithHandler(t, &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}, agentForwardingServer(results))
+
+	before := len(AgentForwardEvents())
+	_, _, err := ExecuteRemoteCommand([]model.Jumper{{
+		Name:                   "bastion",
+		Host:                   host,
+		Port:                   port,
+		User:                   "ops",
+		AuthType:               "password",
+		Password:               "pw",
+		ForwardAgent:           true,
+		BypassHostVerification: true,
+		TimeoutMs:              2000,
+	}}, "git fetch")
+	if err != nil {
+		t.Fatalf("ExecuteRemoteCommand: %v", err)
+	}
+
+	result := <-results
+	if result.keys != 1 || result.signErr != nil {
+		t.Fatalf("forwarded agent: keys=%d sign=%v", result.keys, result.signErr)
+	}
+	if result.addErr == nil {
+		t.Fatal("adding keys through the forwarded agent should be refused")
+	}
+
+	events := AgentForwardEvents()[before:]
+	var ops []string
+	for _, e := range events {
+		ops = append(ops, e.Operation)
+		if e.Jumper != "bastion" {
+			t.Fatalf("event jumper = %q", e.Jumper)
+		}
+	}
+	if len(events) != 3 || ops[0] != "list" || ops[1] != "sign" || ops[2] != "add" {
+		t.Fatalf("audit ops = %q", ops)
+	}
+	if sign := events[1]; !sign.Allowed || sign.KeyFingerprint != ssh.FingerprintSHA256(agentKey) || sign.KeyComment != "ops@laptop" {
+		t.Fatalf("sign event = %+v", sign)
+	}
+	if events[2].Allowed {
+		t.Fatalf("add event = %+v, want refused", events[2])
+	}
+}
+
+func TestPreStartHookForwardsAgent(t *testing.T) {
+	startTestAgent(t)
+	results := make(chan forwardedAgentResult, 1)
+	host, port, _ := startTestSSHServerWithHandler(t, &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}, agentForwardingServer(results))
+
+	jumpers := []model.Jumper{{
+		Name:                   "bastion",
+		Host:                   host,
+		Port:                   port,
+		User:                   "ops",
+		AuthType:               "password",
+		Password:               "pw",
+		ForwardAgent:           true,
+		BypassHostVerification: true,
+		TimeoutMs:              2000,
+	}}
+	client, closeChain, err := dialSSHChain(jumpers)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer closeChain()
+
+	run := NewLocalForward(model.Tunnel{
+		Name:  "db",
+		Mode:  "local",
+		Hooks: model.TunnelHooks{PreStart: "git pull"},
+	}, jumpers)
+	if err := run.runPreStartHook(client); err != nil {
+		t.Fatalf("runPreStartHook: %v", err)
+	}
+	select {
+	case result := <-results:
+		if result.keys != 1 || result.signErr != nil {
+			t.Fatalf("forwarded agent: keys=%d sign=%v", result.keys, result.signErr)
+		}
+	default:
+		t.Fatal("pre-start hook session did not request agent forwarding")
+	}
+}
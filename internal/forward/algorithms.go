@@ -0,0 +1,169 @@
+package forward
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The tables below mirror what golang.org/x/crypto/ssh implements; names
+// outside them would be dropped silently by ssh.Config.SetDefaults, so they
+// are rejected up front instead. The default lists are what the client sends
+// when a setting is empty.
+var (
+	supportedCipherAlgorithms = []string{
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+		"arcfour256", "arcfour128", "arcfour",
+		"aes128-cbc", "3des-cbc",
+	}
+	defaultCipherAlgorithms = []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+	}
+
+	supportedKexAlgorithms = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512",
+		"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+	}
+	defaultKexAlgorithms = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group14-sha1",
+	}
+
+	supportedMACAlgorithms = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512", "hmac-sha1", "hmac-sha1-96",
+	}
+	defaultMACAlgorithms = supportedMACAlgorithms
+)
+
+// ValidateCiphers checks an OpenSSH style Ciphers value.
+func ValidateCiphers(spec string) error {
+	_, err := parseAlgorithmSpec(spec, defaultCipherAlgorithms, supportedCipherAlgorithms)
+	return err
+}
+
+// ValidateKeyExchanges checks an OpenSSH style KexAlgorithms value.
+func ValidateKeyExchanges(spec string) error {
+	_, err := parseAlgorithmSpec(spec, defaultKexAlgorithms, supportedKexAlgorithms)
+	return err
+}
+
+// ValidateMACs checks an OpenSSH style MACs value.
+func ValidateMACs(spec string) error {
+	_, err := parseAlgorithmSpec(spec, defaultMACAlgorithms, supportedMACAlgorithms)
+	return err
+}
+
+// applyAlgorithmSettings sets the jumper's cipher, key exchange and MAC
+// preferences on conf.
+func applyAlgorithmSettings(conf *ssh.ClientConfig, jumper model.Jumper) error {
+	var err error
+	if conf.Ciphers, err = parseAlgorithmSpec(jumper.Ciphers, defaultCipherAlgorithms, supportedCipherAlgorithms); err != nil {
+		return fmt.Errorf("ciphers: %w", err)
+	}
+	if conf.KeyExchanges, err = parseAlgorithmSpec(jumper.KeyExchanges, defaultKexAlgorithms, supportedKexAlgorithms); err != nil {
+		return fmt.Errorf("keyExchanges: %w", err)
+	}
+	if conf.MACs, err = parseAlgorithmSpec(jumper.MACs, defaultMACAlgorithms, supportedMACAlgorithms); err != nil {
+		return fmt.Errorf("macs: %w", err)
+	}
+	return nil
+}
+
+// parseAlgorithmSpec resolves an algorithm setting written like OpenSSH's
+// Ciphers/KexAlgorithms/MACs against defaults:
+//   - "a,b"  use exactly a and b
+//   - "+a,b" append a and b to the defaults
+//   - "^a,b" put a and b in front of the defaults
+//   - "-a,b" remove a and b (wildcards allowed) from the defaults
+//
+// An empty spec returns nil so the library defaults apply.
+func parseAlgorithmSpec(spec string, defaults, supported []string) ([]string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	op := byte(0)
+	switch spec[0] {
+	case '+', '-', '^':
+		op = spec[0]
+		spec = spec[1:]
+	}
+	var names []string
+	for _, name := range splitAlgorithms(spec) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("algorithm list is empty")
+	}
+	for _, name := range names {
+		if op == '-' && strings.ContainsAny(name, "*?") {
+			continue
+		}
+		if !hasAlgorithm(supported, name) {
+			return nil, fmt.Errorf("unsupported algorithm %q (supported: %s)", name, strings.Join(supported, ","))
+		}
+	}
+
+	var out []string
+	switch op {
+	case '+':
+		out = appendUnique(append([]string(nil), defaults...), names...)
+	case '^':
+		out = appendUnique(append([]string(nil), names...), defaults...)
+	case '-':
+		for _, algo := range defaults {
+			if !matchesAnyPattern(names, algo) {
+				out = append(out, algo)
+			}
+		}
+	default:
+		out = appendUnique(nil, names...)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%q leaves no algorithms enabled", spec)
+	}
+	return out, nil
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if !hasAlgorithm(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func hasAlgorithm(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
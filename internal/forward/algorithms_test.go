@@ -0,0 +1,95 @@
+package forward
+
+import (
+	"strings"
+	"testing"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseAlgorithmSpec(t *testing.T) {
+	defaults := []string{"a", "b", "c-old"}
+	supported := []string{"a", "b", "c-old", "d"}
+	cases := []struct {
+		spec string
+		want string
+	}{
+		{"", ""},
+		{"d, a", "d,a"},
+		{"+d", "a,b,c-old,d"},
+		{"^d,b", "d,b,a,c-old"},
+		{"-c-*", "a,b"},
+		{"-b", "a,c-old"},
+	}
+	for _, tc := range cases {
+		got, err := parseAlgorithmSpec(tc.spec, defaults, supported)
+		if err != nil {
+			t.Fatalf("parseAlgorithmSpec(%q): %v", tc.spec, err)
+		}
+		if strings.Join(got, ",") != tc.want {
+			t.Errorf("parseAlgorithmSpec(%q) = %q, want %q", tc.spec, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"+unknown", "x", "-a,b,c-old", ","} {
+		if _, err := parseAlgorithmSpec(bad, defaults, supported); err == nil {
+			t.Errorf("parseAlgorithmSpec(%q) should fail", bad)
+		}
+	}
+	if err := ValidateKeyExchanges("+diffie-hellman-group1-sha1"); err != nil {
+		t.Fatalf("legacy kex rejected: %v", err)
+	}
+	if err := ValidateCiphers("aes128-ctr,blowfish-cbc"); err == nil {
+		t.Fatal("blowfish-cbc is not implemented and should be rejected")
+	}
+}
+
+func TestDialRecordsNegotiatedAlgorithms(t *testing.T) {
+	server := &ssh.ServerConfig{
+		Config: ssh.Config{
+			KeyExchanges: []string{"diffie-hellman-group16-sha512"},
+			Ciphers:      []string{"aes256-ctr"},
+			MACs:         []string{"hmac-sha2-512"},
+		},
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	host, port, hostKey := startTestSSHServer(t, server)
+	jumper := model.Jumper{
+		Name:                   "legacy",
+		Host:                   host,
+		Port:                   port,
+		User:                   "ops",
+		AuthType:               "password",
+		Password:               "pw",
+		BypassHostVerification: true,
+		TimeoutMs:              2000,
+	}
+
+	if _, _, err := dialSSHChain([]model.Jumper{jumper}); err == nil {
+		t.Fatal("dial with default key exchanges should fail against a group16-only server")
+	}
+
+	jumper.KeyExchanges = "+diffie-hellman-group16-sha512"
+	jumper.Ciphers = "-aes128-*"
+	algs := make([]model.NegotiatedAlgorithms, 1)
+	_, closeChain, err := dialSSHChainRecording([]model.Jumper{jumper}, algs)
+	if err != nil {
+		t.Fatalf("dial with legacy kex: %v", err)
+	}
+	closeChain()
+
+	want := model.NegotiatedAlgorithms{
+		Jumper:      "legacy",
+		KeyExchange: "diffie-hellman-group16-sha512",
+		HostKey:     hostKey.Type(),
+		Cipher:      "aes256-ctr",
+		MAC:         "hmac-sha2-512",
+	}
+	if algs[0] != want {
+		t.Fatalf("negotiated = %+v, want %+v", algs[0], want)
+	}
+}
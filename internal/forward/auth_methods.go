@@ -0,0 +1,328 @@
+package forward
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"loris-tunnel/internal/hostkeys"
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// jumperAuthMethods returns the jumper's auth methods in the order they are
+// tried. Jumpers without an explicit list use their single AuthType.
+func jumperAuthMethods(jumper model.Jumper) []string {
+	out := make([]string, 0, len(jumper.AuthMethods)+1)
+	seen := make(map[string]struct{}, len(jumper.AuthMethods)+1)
+	for _, method := range jumper.AuthMethods {
+		method = strings.TrimSpace(method)
+		if method == "" {
+			continue
+		}
+		if _, ok := seen[method]; ok {
+			continue
+		}
+		seen[method] = struct{}{}
+		out = append(out, method)
+	}
+	if len(out) == 0 {
+		out = append(out, strings.TrimSpace(jumper.AuthType))
+	}
+	return out
+}
+
+func isPublicKeyAuthMethod(method string) bool {
+	return method == "ssh_agent" || method == "ssh_key"
+}
+
+// makeAuthMethods builds the ssh.AuthMethods for jumper in its configured
+// order. The SSH client only tries each wire method ("publickey", "password",
+// ...) once, so agent and key-file signers are merged into one publickey
+// method placed where the first of them appears, with duplicate keys dropped.
+//
+// With a single method any failure to load credentials is returned as is.
+// With several, a source that cannot be loaded is skipped and recorded in the
+// trace so the next method still gets its turn.
+func makeAuthMethods(jumper model.Jumper) ([]ssh.AuthMethod, *authTrace, error) {
+	methods := jumperAuthMethods(jumper)
+	trace := newAuthTrace(methods)
+	strict := len(methods) == 1
+
+	var pubkeySources []string
+	for _, method := range methods {
+		if isPublicKeyAuthMethod(method) {
+			pubkeySources = append(pubkeySources, method)
+		}
+	}
+
+	var keyFile []ssh.Signer
+	for _, source := range pubkeySources {
+		if source != "ssh_key" {
+			continue
+		}
+		signers, err := keyFileSigners(jumper)
+		if err != nil {
+			if strict {
+				return nil, nil, err
+			}
+			trace.skip("ssh_key", err.Error())
+		}
+		keyFile = signers
+	}
+
+	filter, err := makeIdentityFilter(jumper, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := make([]ssh.AuthMethod, 0, len(methods))
+	pubkeyAdded := false
+	for _, method := range methods {
+		switch method {
+		case "ssh_agent", "ssh_key":
+			if pubkeyAdded {
+				continue
+			}
+			pubkeyAdded = true
+			out = append(out, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				return collectPublicKeySigners(jumper, pubkeySources, keyFile, filter, trace, strict)
+			}))
+		case "password":
+			if jumper.Password == "" {
+				if strict {
+					return nil, nil, fmt.Errorf("password auth requires password")
+				}
+				trace.skip("password", "no password configured")
+				continue
+			}
+			password := jumper.Password
+			out = append(out, ssh.PasswordCallback(func() (string, error) {
+				trace.attempt("password", "password sent")
+				return password, nil
+			}))
+		case "keyboard_interactive":
+			challenge, err := makeKeyboardInteractiveChallenge(jumper, trace.pauseDeadline)
+			if err != nil {
+				return nil, nil, err
+			}
+			out = append(out, ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers, err := challenge(name, instruction, questions, echos)
+				if err != nil {
+					trace.skip("keyboard_interactive", err.Error())
+					return nil, err
+				}
+				if len(questions) > 0 {
+					trace.attempt("keyboard_interactive", fmt.Sprintf("answered %d question(s)", len(questions)))
+				}
+				return answers, nil
+			}))
+		default:
+			return nil, nil, fmt.Errorf("unsupported authType: %s", method)
+		}
+	}
+	if len(out) == 0 {
+		return nil, nil, fmt.Errorf("no usable auth method: %s", trace)
+	}
+	return out, trace, nil
+}
+
+// collectPublicKeySigners gathers signers from the publickey sources in
+// order, dropping keys already offered by an earlier source.
+func collectPublicKeySigners(jumper model.Jumper, sources []string, keyFile []ssh.Signer, filter *identityFilter, trace *authTrace, strict bool) ([]ssh.Signer, error) {
+	var out []ssh.Signer
+	seen := make(map[string]struct{})
+	add := func(signers []ssh.Signer) int {
+		added := 0
+		for _, signer := range signers {
+			key := string(signer.PublicKey().Marshal())
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			out = append(out, signer)
+			added++
+		}
+		return added
+	}
+
+	for _, source := range sources {
+		switch source {
+		case "ssh_key":
+			if n := add(keyFile); n > 0 {
+				trace.attempt("ssh_key", fmt.Sprintf("offered %d key(s)", n))
+			}
+		case "ssh_agent":
+			signers, err := getSSHAgentSigners(jumper)
+			if err != nil {
+				if strict {
+					return nil, err
+				}
+				trace.skip("ssh_agent", err.Error())
+				continue
+			}
+			total := len(signers)
+			signers = filter.apply(signers)
+			if len(signers) == 0 {
+				reason := fmt.Sprintf("none of the %d agent key(s) match the allowed identity", total)
+				if strict {
+					return nil, errors.New(reason)
+				}
+				trace.skip("ssh_agent", reason)
+				continue
+			}
+			if n := add(signers); n > 0 {
+				trace.attempt("ssh_agent", fmt.Sprintf("offered %d key(s)", n))
+			} else {
+				trace.skip("ssh_agent", "agent keys duplicate the key file")
+			}
+		}
+	}
+	return out, nil
+}
+
+// identityFilter restricts agent signers to explicitly allowed public keys,
+// like OpenSSH's IdentitiesOnly. A nil filter allows everything.
+type identityFilter struct {
+	fingerprints map[string]struct{}
+}
+
+func makeIdentityFilter(jumper model.Jumper, keyFile []ssh.Signer) (*identityFilter, error) {
+	if !jumper.IdentitiesOnly {
+		return nil, nil
+	}
+	f := &identityFilter{fingerprints: make(map[string]struct{})}
+	if fp := strings.TrimSpace(jumper.IdentityFingerprint); fp != "" {
+		f.fingerprints[hostkeys.NormalizeFingerprint(fp)] = struct{}{}
+	}
+	for _, signer := range keyFile {
+		f.fingerprints[ssh.FingerprintSHA256(underlyingKey(signer.PublicKey()))] = struct{}{}
+	}
+	if len(f.fingerprints) == 0 {
+		return nil, fmt.Errorf("identitiesOnly requires identityFingerprint or a key file")
+	}
+	return f, nil
+}
+
+func (f *identityFilter) apply(signers []ssh.Signer) []ssh.Signer {
+	if f == nil {
+		return signers
+	}
+	out := signers[:0:0]
+	for _, signer := range signers {
+		if _, ok := f.fingerprints[ssh.FingerprintSHA256(underlyingKey(signer.PublicKey()))]; ok {
+			out = append(out, signer)
+		}
+	}
+	return out
+}
+
+// underlyingKey returns the plain key of a certificate so a certificate and
+// its key share one fingerprint.
+func underlyingKey(pub ssh.PublicKey) ssh.PublicKey {
+	if cert, ok := pub.(*ssh.Certificate); ok {
+		return cert.Key
+	}
+	return pub
+}
+
+// authTrace records what each configured auth method did during one
+// handshake so a failure can say why every method failed.
+type authTrace struct {
+	mu      sync.Mutex
+	methods []string
+	notes   map[string][]string
+	tried   map[string]bool
+
+	// setDeadline, when the dial path binds one, moves the handshake
+	// deadline so a prompt waiting on the user can suspend it.
+	setDeadline func(time.Time)
+	timeout     time.Duration
+}
+
+func newAuthTrace(methods []string) *authTrace {
+	return &authTrace{
+		methods: append([]string(nil), methods...),
+		notes:   make(map[string][]string),
+		tried:   make(map[string]bool),
+	}
+}
+
+// bindDeadline registers how the dial path bounds the handshake.
+func (t *authTrace) bindDeadline(timeout time.Duration, set func(time.Time)) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.setDeadline = set
+	t.timeout = timeout
+}
+
+// pauseDeadline lifts the handshake deadline and returns the function that
+// restarts it with a full timeout.
+func (t *authTrace) pauseDeadline() (resume func()) {
+	if t == nil {
+		return func() {}
+	}
+	t.mu.Lock()
+	set, timeout := t.setDeadline, t.timeout
+	t.mu.Unlock()
+	if set == nil || timeout <= 0 {
+		return func() {}
+	}
+	set(time.Time{})
+	return func() { set(time.Now().Add(timeout)) }
+}
+
+func (t *authTrace) attempt(method, detail string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tried[method] = true
+	t.notes[method] = append(t.notes[method], detail)
+}
+
+func (t *authTrace) skip(method, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.notes[method] = append(t.notes[method], "skipped: "+reason)
+}
+
+func (t *authTrace) String() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, 0, len(t.methods))
+	for _, method := range t.methods {
+		var b bytes.Buffer
+		b.WriteString(method)
+		b.WriteString(": ")
+		notes := t.notes[method]
+		switch {
+		case len(notes) == 0:
+			b.WriteString("not attempted (server did not offer it or an earlier method ended auth)")
+		case t.tried[method]:
+			b.WriteString("rejected by server (")
+			b.WriteString(strings.Join(notes, "; "))
+			b.WriteString(")")
+		default:
+			b.WriteString(strings.Join(notes, "; "))
+		}
+		parts = append(parts, b.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// annotate adds the trace to authentication failures.
+func (t *authTrace) annotate(err error) error {
+	if t == nil || err == nil || !strings.Contains(err.Error(), "unable to authenticate") {
+		return err
+	}
+	return fmt.Errorf("%w [auth methods: %s]", err, t)
+}
@@ -0,0 +1,135 @@
+package forward
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func writeTestKey(t *testing.T) (string, ssh.Signer) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	return keyPath, signer
+}
+
+func withoutSSHAgent(t *testing.T) {
+	t.Helper()
+	resetSSHAgent()
+	t.Setenv("LORIS_TUNNEL_SSH_AUTH_SOCK", "")
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(resetSSHAgent)
+}
+
+func TestJumperAuthMethodsFallsBackToAuthType(t *testing.T) {
+	if got := jumperAuthMethods(model.Jumper{AuthType: "ssh_agent"}); len(got) != 1 || got[0] != "ssh_agent" {
+		t.Fatalf("methods = %q", got)
+	}
+	got := jumperAuthMethods(model.Jumper{AuthType: "password", AuthMethods: []string{"ssh_agent", " ssh_key", "ssh_agent", "", "password"}})
+	if strings.Join(got, ",") != "ssh_agent,ssh_key,password" {
+		t.Fatalf("methods = %q", got)
+	}
+}
+
+func TestDialSSHFallsBackThroughOrderedMethods(t *testing.T) {
+	withoutSSHAgent(t)
+	keyPath, _ := writeTestKey(t)
+	host, port, _ := startTestSSHServer(t, &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, fmt.Errorf("no keys trusted")
+		},
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != "pw" {
+				return nil, fmt.Errorf("bad password")
+			}
+			return nil, nil
+		},
+	})
+
+	jumper := model.Jumper{
+		Host:                   host,
+		Port:                   port,
+		User:                   "ops",
+		AuthType:               "ssh_agent",
+		AuthMethods:            []string{"ssh_agent", "ssh_key", "password"},
+		KeyPath:                keyPath,
+		Password:               "pw",
+		BypassHostVerification: true,
+		TimeoutMs:              2000,
+	}
+	client, err := dialSSH(jumper)
+	if err != nil {
+		t.Fatalf("dialSSH: %v", err)
+	}
+	_ = client.Close()
+
+	jumper.Password = "wrong"
+	_, err = dialSSH(jumper)
+	if err == nil {
+		t.Fatal("dialSSH with wrong password should fail")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		"ssh_agent: skipped:",
+		"ssh_key: rejected by server (offered 1 key(s))",
+		"password: rejected by server (password sent)",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("error %q does not contain %q", msg, want)
+		}
+	}
+}
+
+func TestCollectPublicKeySignersDedupAndIdentityFilter(t *testing.T) {
+	_, keep := writeTestKey(t)
+	_, other := writeTestKey(t)
+
+	trace := newAuthTrace([]string{"ssh_key"})
+	got, err := collectPublicKeySigners(model.Jumper{}, []string{"ssh_key", "ssh_key"}, []ssh.Signer{keep, keep}, nil, trace, true)
+	if err != nil || len(got) != 1 {
+		t.Fatalf("dedup signers = %d, %v", len(got), err)
+	}
+
+	filter, err := makeIdentityFilter(model.Jumper{IdentitiesOnly: true, IdentityFingerprint: ssh.FingerprintSHA256(keep.PublicKey())}, nil)
+	if err != nil {
+		t.Fatalf("makeIdentityFilter: %v", err)
+	}
+	filtered := filter.apply([]ssh.Signer{other, keep})
+	if len(filtered) != 1 || ssh.FingerprintSHA256(filtered[0].PublicKey()) != ssh.FingerprintSHA256(keep.PublicKey()) {
+		t.Fatalf("filtered = %d signers", len(filtered))
+	}
+
+	bare := strings.TrimPrefix(ssh.FingerprintSHA256(keep.PublicKey()), "SHA256:")
+	filter, _ = makeIdentityFilter(model.Jumper{IdentitiesOnly: true, IdentityFingerprint: bare}, nil)
+	if len(filter.apply([]ssh.Signer{keep})) != 1 {
+		t.Fatal("bare fingerprint did not match")
+	}
+
+	if _, err := makeIdentityFilter(model.Jumper{IdentitiesOnly: true}, nil); err == nil {
+		t.Fatal("identitiesOnly without fingerprint or key file should fail")
+	}
+}
@@ -0,0 +1,170 @@
+package forward
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// certExpiry is the validity end of a user certificate a jumper authenticates with.
+type certExpiry struct {
+	jumper      string
+	keyID       string
+	validBefore time.Time
+}
+
+// loadUserCertificate reads an OpenSSH user certificate (*-cert.pub).
+func loadUserCertificate(path string) (*ssh.Certificate, error) {
+	resolvedPath, err := resolveKeyPath(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(resolvedPath)
+	if err != nil {
+		return nil, fmt.Errorf("read certificate failed (%s): %w", resolvedPath, err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate failed (%s): %w", resolvedPath, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is a public key, not a certificate", resolvedPath)
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("%s is a host certificate, not a user certificate", resolvedPath)
+	}
+	return cert, nil
+}
+
+// jumperCertificate returns the certificate configured for jumper, or the
+// <key>-cert.pub next to its key file when none is configured, like OpenSSH.
+// A missing auto-discovered file is not an error.
+func jumperCertificate(jumper model.Jumper) (*ssh.Certificate, error) {
+	if certPath := strings.TrimSpace(jumper.CertificatePath); certPath != "" {
+		return loadUserCertificate(certPath)
+	}
+	if !slices.Contains(jumperAuthMethods(jumper), "ssh_key") || strings.TrimSpace(jumper.KeyPath) == "" {
+		return nil, nil
+	}
+	keyPath, err := resolveKeyPath(jumper.KeyPath)
+	if err != nil {
+		return nil, nil
+	}
+	certPath := keyPath + "-cert.pub"
+	if _, err := os.Stat(certPath); err != nil {
+		return nil, nil
+	}
+	return loadUserCertificate(certPath)
+}
+
+// certSignerFor pairs cert with signer when they share the same public key.
+func certSignerFor(cert *ssh.Certificate, signer ssh.Signer) (ssh.Signer, bool) {
+	if cert == nil || signer == nil {
+		return nil, false
+	}
+	if !bytes.Equal(cert.Key.Marshal(), signer.PublicKey().Marshal()) {
+		return nil, false
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, false
+	}
+	return certSigner, true
+}
+
+func isCertificateSigner(signer ssh.Signer) bool {
+	_, ok := signer.PublicKey().(*ssh.Certificate)
+	return ok
+}
+
+// preferCertificateSigners moves certificate signers to the front so servers
+// that only trust the CA see them before the bare keys.
+func preferCertificateSigners(signers []ssh.Signer) {
+	sort.SliceStable(signers, func(i, j int) bool {
+		return isCertificateSigner(signers[i]) && !isCertificateSigner(signers[j])
+	})
+}
+
+// collectCertificateExpiries lists the validity of every user certificate the
+// chain may authenticate with: configured or discovered files, and
+// certificates held by the agent for jumpers that may use it.
+func collectCertificateExpiries(jumpers []model.Jumper) []certExpiry {
+	var out []certExpiry
+	add := func(jumper model.Jumper, cert *ssh.Certificate) {
+		if cert == nil || cert.ValidBefore == ssh.CertTimeInfinity {
+			return
+		}
+		out = append(out, certExpiry{
+			jumper:      jumperDisplayName(jumper),
+			keyID:       cert.KeyId,
+			validBefore: time.Unix(int64(cert.ValidBefore), 0),
+		})
+	}
+
+	for _, jumper := range jumpers {
+		cert, err := jumperCertificate(jumper)
+		if err != nil {
+			slog.Warn("load certificate failed", "jumper", jumperDisplayName(jumper), "err", err)
+		}
+		add(jumper, cert)
+
+		if !slices.Contains(jumperAuthMethods(jumper), "ssh_agent") || cert != nil {
+			continue
+		}
+		a, _, err := getSSHAgent(jumper.AgentSocketPath)
+		if err != nil {
+			continue
+		}
+		keys, err := a.List()
+		if err != nil {
+			continue
+		}
+		for _, key := range keys {
+			pub, err := ssh.ParsePublicKey(key.Marshal())
+			if err != nil {
+				continue
+			}
+			if agentCert, ok := pub.(*ssh.Certificate); ok && agentCert.CertType == ssh.UserCert {
+				add(jumper, agentCert)
+			}
+		}
+	}
+	return out
+}
+
+// certificateWarnings reports certificates that are expired at now or expire
+// before window has passed, i.e. before a reconnect could give up.
+func certificateWarnings(expiries []certExpiry, now time.Time, window time.Duration) []string {
+	var out []string
+	for _, e := range expiries {
+		label := "certificate"
+		if e.keyID != "" {
+			label = fmt.Sprintf("certificate %q", e.keyID)
+		}
+		at := e.validBefore.Local().Format(time.RFC3339)
+		switch {
+		case !now.Before(e.validBefore):
+			out = append(out, fmt.Sprintf("%s for jumper %s expired at %s", label, e.jumper, at))
+		case e.validBefore.Sub(now) <= window:
+			out = append(out, fmt.Sprintf("%s for jumper %s expires at %s", label, e.jumper, at))
+		}
+	}
+	return out
+}
+
+func jumperDisplayName(jumper model.Jumper) string {
+	if name := strings.TrimSpace(jumper.Name); name != "" {
+		return name
+	}
+	return strings.TrimSpace(jumper.Host)
+}
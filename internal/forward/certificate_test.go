@@ -0,0 +1,165 @@
+package forward
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type testCA struct {
+	signer ssh.Signer
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ca key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("ca signer: %v", err)
+	}
+	return &testCA{signer: signer}
+}
+
+// writeUserKeyAndCert writes id_ed25519 and id_ed25519-cert.pub into dir.
+func (ca *testCA) writeUserKeyAndCert(t *testing.T, dir string, validBefore time.Time) string {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate user key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("marshal user key: %v", err)
+	}
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	pub, err := ssh.NewPublicKey(priv.Public())
+	if err != nil {
+		t.Fatalf("user public key: %v", err)
+	}
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.UserCert,
+		KeyId:           "ops@example",
+		ValidPrincipals: []string{"ops"},
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, ca.signer); err != nil {
+		t.Fatalf("sign cert: %v", err)
+	}
+	if err := os.WriteFile(keyPath+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0o644); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	return keyPath
+}
+
+func TestJumperCertificateAutoDiscovery(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	keyPath := ca.writeUserKeyAndCert(t, dir, time.Now().Add(time.Hour))
+
+	cert, err := jumperCertificate(model.Jumper{AuthType: "ssh_key", KeyPath: keyPath})
+	if err != nil || cert == nil || cert.KeyId != "ops@example" {
+		t.Fatalf("auto-discovered cert = %v, %v", cert, err)
+	}
+
+	// The key need not be the first method tried.
+	fallback := model.Jumper{AuthType: "password", AuthMethods: []string{"password", "ssh_key"}, KeyPath: keyPath}
+	if cert, err := jumperCertificate(fallback); err != nil || cert == nil {
+		t.Fatalf("fallback key cert = %v, %v", cert, err)
+	}
+
+	if err := os.Remove(keyPath + "-cert.pub"); err != nil {
+		t.Fatalf("remove cert: %v", err)
+	}
+	if cert, err := jumperCertificate(model.Jumper{AuthType: "ssh_key", KeyPath: keyPath}); cert != nil || err != nil {
+		t.Fatalf("missing auto cert = %v, %v; want nil, nil", cert, err)
+	}
+	if _, err := jumperCertificate(model.Jumper{AuthType: "ssh_key", KeyPath: keyPath, CertificatePath: keyPath + "-cert.pub"}); err == nil {
+		t.Fatal("missing explicit certificate should fail")
+	}
+}
+
+func TestDialSSHWithUserCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	keyPath := ca.writeUserKeyAndCert(t, t.TempDir(), time.Now().Add(time.Hour))
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(ca.signer.PublicKey().Marshal())
+		},
+	}
+	host, port, _ := startTestSSHServer(t, &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if _, ok := key.(*ssh.Certificate); !ok {
+				return nil, fmt.Errorf("only certificates are trusted")
+			}
+			return checker.Authenticate(conn, key)
+		},
+	})
+
+	client, err := dialSSH(model.Jumper{
+		Host:                   host,
+		Port:                   port,
+		User:                   "ops",
+		AuthType:               "ssh_key",
+		KeyPath:                keyPath,
+		BypassHostVerification: true,
+		TimeoutMs:              2000,
+	})
+	if err != nil {
+		t.Fatalf("dialSSH with certificate: %v", err)
+	}
+	_ = client.Close()
+}
+
+func TestCertificateWarnings(t *testing.T) {
+	now := time.Now()
+	expiries := []certExpiry{
+		{jumper: "fresh", keyID: "a", validBefore: now.Add(2 * time.Hour)},
+		{jumper: "soon", keyID: "b", validBefore: now.Add(5 * time.Minute)},
+		{jumper: "old", validBefore: now.Add(-time.Minute)},
+	}
+	got := certificateWarnings(expiries, now, reconnectTimeout)
+	if len(got) != 2 {
+		t.Fatalf("warnings = %q, want 2", got)
+	}
+	if !strings.Contains(got[0], `"b"`) || !strings.Contains(got[0], "soon") || !strings.Contains(got[0], "expires at") {
+		t.Fatalf("expiring warning = %q", got[0])
+	}
+	if !strings.Contains(got[1], "old") || !strings.Contains(got[1], "expired at") {
+		t.Fatalf("expired warning = %q", got[1])
+	}
+}
+
+func TestCollectCertificateExpiriesSkipsPlainKeys(t *testing.T) {
+	ca := newTestCA(t)
+	validBefore := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	keyPath := ca.writeUserKeyAndCert(t, t.TempDir(), validBefore)
+
+	got := collectCertificateExpiries([]model.Jumper{
+		{Name: "bastion", AuthType: "ssh_key", KeyPath: keyPath},
+		{Name: "password-hop", AuthType: "password"},
+		{Name: "fallback", AuthType: "password", AuthMethods: []string{"password", "ssh_key"}, KeyPath: keyPath},
+	})
+	if len(got) != 2 || got[0].jumper != "bastion" || got[1].jumper != "fallback" || !got[0].validBefore.Equal(validBefore) {
+		t.Fatalf("expiries = %+v", got)
+	}
+}
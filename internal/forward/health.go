@@ -0,0 +1,276 @@
+package forward
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	HealthCheckTCP   = "tcp"
+	HealthCheckHTTP  = "http"
+	HealthCheckHTTPS = "https"
+	HealthCheckTLS   = "tls"
+
+	HealthUnknown  = "unknown"
+	HealthHealthy  = "healthy"
+	HealthDegraded = "degraded"
+
+	defaultHealthInterval = 30 * time.Second
+	minHealthIntervalMs   = 1000
+	defaultHealthTimeout  = 5 * time.Second
+)
+
+// HealthCheckTarget returns the address a tunnel's health check probes: the
+// configured target, or the remote target of a local forward.
+func HealthCheckTarget(tunnel model.Tunnel) string {
+	if target := strings.TrimSpace(tunnel.HealthCheck.Target); target != "" {
+		return target
+	}
+	if normalizeForwardMode(tunnel.Mode) != "local" || strings.TrimSpace(tunnel.RemoteHost) == "" {
+		return ""
+	}
+	return net.JoinHostPort(strings.TrimSpace(tunnel.RemoteHost), strconv.Itoa(tunnel.RemotePort))
+}
+
+// ValidateHealthCheck checks a tunnel's health check settings.
+func ValidateHealthCheck(tunnel model.Tunnel) error {
+	check := tunnel.HealthCheck
+	switch check.Type {
+	case "":
+		return nil
+	case HealthCheckTCP, HealthCheckHTTP, HealthCheckHTTPS, HealthCheckTLS:
+	default:
+		return fmt.Errorf("unsupported health check type: %s", check.Type)
+	}
+	target := HealthCheckTarget(tunnel)
+	if target == "" {
+		return fmt.Errorf("health check target is required for %s tunnels", normalizeForwardMode(tunnel.Mode))
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil || host == "" {
+		return fmt.Errorf("health check target must be host:port: %s", target)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("health check target port must be between 1 and 65535")
+	}
+	if check.Path != "" && !strings.HasPrefix(check.Path, "/") {
+		return fmt.Errorf("health check path must start with /")
+	}
+	if check.ExpectStatus != 0 && (check.ExpectStatus < 100 || check.ExpectStatus > 599) {
+		return fmt.Errorf("health check expectStatus must be a valid HTTP status")
+	}
+	if check.IntervalMs != 0 && check.IntervalMs < minHealthIntervalMs {
+		return fmt.Errorf("health check intervalMs must be at least %d", minHealthIntervalMs)
+	}
+	if check.TimeoutMs < 0 || check.FailureThreshold < 0 || check.ReconnectAfter < 0 {
+		return fmt.Errorf("health check timeoutMs, failureThreshold and reconnectAfter must not be negative")
+	}
+	return nil
+}
+
+func healthInterval(check model.TunnelHealthCheck) time.Duration {
+	if check.IntervalMs <= 0 {
+		return defaultHealthInterval
+	}
+	return time.Duration(check.IntervalMs) * time.Millisecond
+}
+
+func healthTimeout(check model.TunnelHealthCheck) time.Duration {
+	if check.TimeoutMs <= 0 {
+		return defaultHealthTimeout
+	}
+	return time.Duration(check.TimeoutMs) * time.Millisecond
+}
+
+// runHealthCheck probes target through client once.
+func runHealthCheck(client *ssh.Client, check model.TunnelHealthCheck, target string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout(check))
+	defer cancel()
+
+	switch check.Type {
+	case HealthCheckTCP:
+		conn, err := client.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return fmt.Errorf("tcp connect %s failed: %w", target, err)
+		}
+		return conn.Close()
+	case HealthCheckTLS:
+		conn, err := client.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return fmt.Errorf("tcp connect %s failed: %w", target, err)
+		}
+		defer conn.Close()
+		tlsConn := tls.Client(conn, healthTLSConfig(check, target))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("tls handshake with %s failed: %w", target, err)
+		}
+		return nil
+	case HealthCheckHTTP, HealthCheckHTTPS:
+		return runHTTPHealthCheck(ctx, client, check, target)
+	}
+	return fmt.Errorf("unsupported health check type: %s", check.Type)
+}
+
+func runHTTPHealthCheck(ctx context.Context, client *ssh.Client, check model.TunnelHealthCheck, target string) error {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return client.DialContext(ctx, network, addr)
+		},
+		TLSClientConfig:   healthTLSConfig(check, target),
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	httpClient := &http.Client{
+		Transport: transport,
+		// The status of the first response is what gets checked.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	path := check.Path
+	if path == "" {
+		path = "/"
+	}
+	url := check.Type + "://" + target + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("build health check request failed: %w", err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("GET %s failed: %w", url, err)
+	}
+	_ = resp.Body.Close()
+
+	if check.ExpectStatus != 0 {
+		if resp.StatusCode != check.ExpectStatus {
+			return fmt.Errorf("GET %s returned %d, want %d", url, resp.StatusCode, check.ExpectStatus)
+		}
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+func healthTLSConfig(check model.TunnelHealthCheck, target string) *tls.Config {
+	serverName := strings.TrimSpace(check.ServerName)
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(target)
+	}
+	return &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: check.InsecureSkipVerify,
+	}
+}
+
+// Health returns the tunnel's health check state; ok is false when the
+// tunnel has no health check.
+func (f *LocalForward) Health() (model.TunnelHealth, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.tunnel.HealthCheck.Type == "" {
+		return model.TunnelHealth{}, false
+	}
+	health := f.health
+	if health.State == "" {
+		health.State = HealthUnknown
+	}
+	return health, true
+}
+
+// monitorHealth runs the tunnel's health check until the forward stops.
+// Checks are skipped while the tunnel is reconnecting.
+func (f *LocalForward) monitorHealth(stop <-chan struct{}) {
+	check := f.tunnel.HealthCheck
+	target := HealthCheckTarget(f.tunnel)
+	ticker := time.NewTicker(healthInterval(check))
+	defer ticker.Stop()
+
+	sinceReconnect := 0
+	for {
+		f.mu.Lock()
+		client := f.client
+		f.mu.Unlock()
+		if client != nil {
+			err := runHealthCheck(client, check, target)
+			if f.recordHealth(err) && err != nil {
+				sinceReconnect++
+				if check.ReconnectAfter > 0 && sinceReconnect >= check.ReconnectAfter {
+					sinceReconnect = 0
+					slog.Warn("tunnel health check forcing reconnect", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "err", err)
+					// Closing the last hop makes the lifecycle monitor see a
+					// lost connection and reconnect the whole chain.
+					_ = client.Close()
+				}
+			} else {
+				sinceReconnect = 0
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordHealth updates the health state with one check result and emits
+// degraded/recovered events on transitions. It returns false when the
+// forward is stopping and the result was dropped.
+func (f *LocalForward) recordHealth(checkErr error) bool {
+	now := time.Now()
+	threshold := f.tunnel.HealthCheck.FailureThreshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	f.mu.Lock()
+	if f.stopping {
+		f.mu.Unlock()
+		return false
+	}
+	prev := f.health.State
+	f.health.LastCheck = &now
+	if checkErr == nil {
+		f.health.LastSuccess = &now
+		f.health.LastError = ""
+		f.health.ConsecutiveFailures = 0
+		f.health.State = HealthHealthy
+	} else {
+		f.health.LastFailure = &now
+		f.health.LastError = checkErr.Error()
+		f.health.ConsecutiveFailures++
+		if f.health.ConsecutiveFailures >= threshold {
+			f.health.State = HealthDegraded
+		} else if prev == "" {
+			f.health.State = HealthUnknown
+		}
+	}
+	state := f.health.State
+	f.mu.Unlock()
+
+	switch {
+	case state == HealthDegraded && prev != HealthDegraded:
+		slog.Warn("tunnel degraded", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "err", checkErr)
+		f.emitEvent(RuntimeEvent{Type: RuntimeEventDegraded, Err: checkErr})
+	case state == HealthHealthy && prev == HealthDegraded:
+		slog.Info("tunnel recovered", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name)
+		f.emitEvent(RuntimeEvent{Type: RuntimeEventRecovered})
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package forward
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// directTCPIPServer serves direct-tcpip channels by dialing the requested
+// address locally, like a jumper forwarding to its network.
+func directTCPIPServer(_ *ssh.ServerConn, chans <-chan ssh.NewChannel) {
+	for newCh := range chans {
+		if newCh.ChannelType() != "direct-tcpip" {
+			_ = newCh.Reject(ssh.UnknownChannelType, "direct-tcpip only")
+			continue
+		}
+		var req struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newCh.ExtraData(), &req); err != nil {
+			_ = newCh.Reject(ssh.ConnectionFailed, "bad request")
+			continue
+		}
+		target, err := net.Dial("tcp", net.JoinHostPort(req.Host, strconv.Itoa(int(req.Port))))
+		if err != nil {
+			_ = newCh.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, reqs, err := newCh.Accept()
+		if err != nil {
+			_ = target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(reqs)
+		go func() {
+			defer ch.Close()
+			defer target.Close()
+			go func() { _, _ = io.Copy(target, ch) }()
+			_, _ = io.Copy(ch, target)
+		}()
+	}
+}
+
+func dialHealthTestClient(t *testing.T) *ssh.Client {
+	t.Helper()
+	host, port, _ := startTestSSHServerWithHandler(t, &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}, directTCPIPServer)
+	client, err := dialSSH(model.Jumper{
+		Host:                   host,
+		Port:                   port,
+		User:                   "ops",
+		AuthType:               "password",
+		Password:               "pw",
+		BypassHostVerification: true,
+		TimeoutMs:              2000,
+	})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestRunHealthCheckThroughClient(t *testing.T) {
+	client := dialHealthTestClient(t)
+
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer web.Close()
+	webAddr := strings.TrimPrefix(web.URL, "http://")
+
+	httpCheck := model.TunnelHealthCheck{Type: HealthCheckHTTP, Path: "/healthz", TimeoutMs: 2000}
+	if err := runHealthCheck(client, httpCheck, webAddr); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("http check err = %v, want 503 failure", err)
+	}
+	status.Store(http.StatusOK)
+	if err := runHealthCheck(client, httpCheck, webAddr); err != nil {
+		t.Fatalf("http check: %v", err)
+	}
+	httpCheck.ExpectStatus = http.StatusNoContent
+	if err := runHealthCheck(client, httpCheck, webAddr); err == nil {
+		t.Fatal("http check should fail when the status is not the expected one")
+	}
+
+	if err := runHealthCheck(client, model.TunnelHealthCheck{Type: HealthCheckTCP}, webAddr); err != nil {
+		t.Fatalf("tcp check: %v", err)
+	}
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	_ = closed.Close()
+	if err := runHealthCheck(client, model.TunnelHealthCheck{Type: HealthCheckTCP}, closedAddr); err == nil {
+		t.Fatal("tcp check to a closed port should fail")
+	}
+
+	tlsWeb := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer tlsWeb.Close()
+	tlsAddr := strings.TrimPrefix(tlsWeb.URL, "https://")
+	if err := runHealthCheck(client, model.TunnelHealthCheck{Type: HealthCheckTLS}, tlsAddr); err == nil {
+		t.Fatal("tls check should reject the self-signed certificate")
+	}
+	if err := runHealthCheck(client, model.TunnelHealthCheck{Type: HealthCheckTLS, InsecureSkipVerify: true}, tlsAddr); err != nil {
+		t.Fatalf("tls check: %v", err)
+	}
+}
+
+func TestRecordHealthTransitions(t *testing.T) {
+	f := NewLocalForward(model.Tunnel{
+		Name:        "db",
+		HealthCheck: model.TunnelHealthCheck{Type: HealthCheckTCP, FailureThreshold: 2},
+	}, nil)
+	f.events = make(chan RuntimeEvent, 8)
+
+	if health, _ := f.Health(); health.State != HealthUnknown {
+		t.Fatalf("initial state = %q", health.State)
+	}
+	down := errors.New("connection refused")
+	f.recordHealth(down)
+	if health, _ := f.Health(); health.State != HealthUnknown || health.ConsecutiveFailures != 1 {
+		t.Fatalf("after one failure = %+v", health)
+	}
+	f.recordHealth(down)
+	health, _ := f.Health()
+	if health.State != HealthDegraded || health.LastFailure == nil || health.LastSuccess != nil || health.LastError != down.Error() {
+		t.Fatalf("after two failures = %+v", health)
+	}
+	if evt := <-f.events; evt.Type != RuntimeEventDegraded || !errors.Is(evt.Err, down) {
+		t.Fatalf("event = %+v, want degraded", evt)
+	}
+
+	f.recordHealth(nil)
+	health, _ = f.Health()
+	if health.State != HealthHealthy || health.LastSuccess == nil || health.ConsecutiveFailures != 0 {
+		t.Fatalf("after success = %+v", health)
+	}
+	if evt := <-f.events; evt.Type != RuntimeEventRecovered {
+		t.Fatalf("event = %+v, want recovered", evt)
+	}
+	if len(f.events) != 0 {
+		t.Fatalf("unexpected extra events: %d", len(f.events))
+	}
+}
+
+func TestValidateHealthCheck(t *testing.T) {
+	local := model.Tunnel{Mode: "local", RemoteHost: "10.0.0.5", RemotePort: 5432}
+	cases := []struct {
+		name  string
+		mode  string
+		check model.TunnelHealthCheck
+		ok    bool
+	}{
+		{"disabled", "local", model.TunnelHealthCheck{}, true},
+		{"tcp defaults to remote target", "local", model.TunnelHealthCheck{Type: "tcp"}, true},
+		{"dynamic needs target", "dynamic", model.TunnelHealthCheck{Type: "tcp"}, false},
+		{"dynamic with target", "dynamic", model.TunnelHealthCheck{Type: "https", Target: "intranet:443"}, true},
+		{"unknown type", "local", model.TunnelHealthCheck{Type: "icmp"}, false},
+		{"bad path", "local", model.TunnelHealthCheck{Type: "http", Path: "healthz"}, false},
+		{"bad status", "local", model.TunnelHealthCheck{Type: "http", ExpectStatus: 42}, false},
+		{"interval too short", "local", model.TunnelHealthCheck{Type: "tcp", IntervalMs: 10}, false},
+		{"bad target", "local", model.TunnelHealthCheck{Type: "tcp", Target: "nohost"}, false},
+	}
+	for _, tc := range cases {
+		tunnel := local
+		tunnel.Mode = tc.mode
+		tunnel.HealthCheck = tc.check
+		if err := ValidateHealthCheck(tunnel); (err == nil) != tc.ok {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	HookPreStart     = "pre_start"
+	HookStarted      = "started"
+	HookStopped      = "stopped"
+	HookDisconnected = "disconnected"
+	HookReconnected  = "reconnected"
+
+	defaultHookTimeout = 30 * time.Second
+	MaxHookTimeoutMs   = 10 * 60 * 1000
+	hookOutputLimit    = 8192
+	// hookWaitDelay bounds how long a finished hook may keep its output
+	// pipes open through background children.
+	hookWaitDelay = time.Second
+)
+
+var ErrHookTimeout = errors.New("hook timed out")
+
+// HookResult is the outcome of one hook run. Output holds the tail of the
+// command's combined stdout and stderr.
+type HookResult struct {
+	Event    string
+	Command  string
+	Remote   bool
+	Output   string
+	Duration time.Duration
+	Err      error
+}
+
+// HookObserver receives the result of every hook a forward runs.
+type HookObserver func(HookResult)
+
+func hookCommand(hooks model.TunnelHooks, event string) string {
+	switch event {
+	case HookPreStart:
+		return strings.TrimSpace(hooks.PreStart)
+	case HookStarted:
+		return strings.TrimSpace(hooks.OnStarted)
+	case HookStopped:
+		return strings.TrimSpace(hooks.OnStopped)
+	case HookDisconnected:
+		return strings.TrimSpace(hooks.OnDisconnected)
+	case HookReconnected:
+		return strings.TrimSpace(hooks.OnReconnected)
+	}
+	return ""
+}
+
+func hookTimeout(hooks model.TunnelHooks) time.Duration {
+	if hooks.TimeoutMs <= 0 {
+		return defaultHookTimeout
+	}
+	return time.Duration(hooks.TimeoutMs) * time.Millisecond
+}
+
+// hookEnv describes the tunnel to a hook as LORIS_TUNNEL_* variables.
+// cause is the error behind a disconnected or stopped event, if any.
+func hookEnv(tunnel model.Tunnel, jumpers []model.Jumper, event string, cause error) []string {
+	env := []string{
+		"LORIS_TUNNEL_EVENT=" + event,
+		"LORIS_TUNNEL_ID=" + strconv.Itoa(tunnel.ID),
+		"LORIS_TUNNEL_NAME=" + tunnel.Name,
+		"LORIS_TUNNEL_MODE=" + normalizeForwardMode(tunnel.Mode),
+		"LORIS_TUNNEL_LOCAL_HOST=" + tunnel.LocalHost,
+		"LORIS_TUNNEL_LOCAL_PORT=" + strconv.Itoa(tunnel.LocalPort),
+		"LORIS_TUNNEL_REMOTE_HOST=" + tunnel.RemoteHost,
+		"LORIS_TUNNEL_REMOTE_PORT=" + strconv.Itoa(tunnel.RemotePort),
+	}
+	if len(jumpers) > 0 {
+		last := jumpers[len(jumpers)-1]
+		env = append(env,
+			"LORIS_TUNNEL_JUMPER="+jumperDisplayName(last),
+			"LORIS_TUNNEL_JUMPER_HOST="+last.Host,
+		)
+	}
+	if cause != nil {
+		env = append(env, "LORIS_TUNNEL_ERROR="+strings.TrimSpace(cause.Error()))
+	}
+	return env
+}
+
+// runLocalHook runs command through the local shell with the tunnel's
+// environment, killing it when timeout passes.
+func runLocalHook(command string, env []string, timeout time.Duration) (string, error) {
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(), env...)
+	output := &tailBuffer{limit: hookOutputLimit}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.WaitDelay = hookWaitDelay
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("start hook failed: %w", err)
+	}
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-waitErr:
+		return output.String(), err
+	case <-timer.C:
+		killShellCommand(cmd)
+		<-waitErr
+		return output.String(), fmt.Errorf("%w after %s", ErrHookTimeout, timeout)
+	}
+}
+
+// RunLocalCommand runs command through the local shell the same way local
+// hooks run, for other features that execute user commands. It returns the
+// tail of the combined output.
+func RunLocalCommand(command string, env []string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	return runLocalHook(command, env, timeout)
+}
+
+// runRemoteHook runs command on the host client is connected to. SSH servers
+// usually refuse environment requests, so the variables are passed through
+// env(1), and sh runs the command whatever the remote login shell is. The
+// session forwards the agent when the last of jumpers has ForwardAgent set.
+func runRemoteHook(client *ssh.Client, jumpers []model.Jumper, command string, env []string, timeout time.Duration) (string, error) {
+	session, err := newChainSession(client, jumpers)
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	output := &tailBuffer{limit: hookOutputLimit}
+	session.Stdout = output
+	session.Stderr = output
+
+	var b strings.Builder
+	b.WriteString("env")
+	for _, kv := range env {
+		b.WriteByte(' ')
+		b.WriteString(posixQuote(kv))
+	}
+	b.WriteString(" sh -c ")
+	b.WriteString(posixQuote(command))
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- session.Run(b.String()) }()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-runErr:
+		return output.String(), err
+	case <-timer.C:
+		_ = session.Signal(ssh.SIGKILL)
+		_ = session.Close()
+		return output.String(), fmt.Errorf("%w after %s", ErrHookTimeout, timeout)
+	}
+}
+
+// posixQuote single-quotes s for a POSIX shell.
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runPreStartHook runs the tunnel's pre-start command on the last hop.
+func (f *LocalForward) runPreStartHook(client *ssh.Client) error {
+	command := hookCommand(f.tunnel.Hooks, HookPreStart)
+	if command == "" {
+		return nil
+	}
+	started := time.Now()
+	output, err := runRemoteHook(client, f.jumpers, command, hookEnv(f.tunnel, f.jumpers, HookPreStart, nil), hookTimeout(f.tunnel.Hooks))
+	f.reportHook(HookResult{
+		Event:    HookPreStart,
+		Command:  command,
+		Remote:   true,
+		Output:   output,
+		Duration: time.Since(started),
+		Err:      err,
+	})
+	if err != nil {
+		return fmt.Errorf("pre-start hook failed: %w", err)
+	}
+	return nil
+}
+
+// runLocalHookAsync runs the local hook for event, if one is set, without
+// blocking the tunnel. WaitHooks waits for hooks still running.
+func (f *LocalForward) runLocalHookAsync(event string, cause error) {
+	command := hookCommand(f.tunnel.Hooks, event)
+	if command == "" {
+		return
+	}
+	env := hookEnv(f.tunnel, f.jumpers, event, cause)
+	timeout := hookTimeout(f.tunnel.Hooks)
+	f.hookWG.Add(1)
+	go func() {
+		defer f.hookWG.Done()
+		started := time.Now()
+		output, err := runLocalHook(command, env, timeout)
+		f.reportHook(HookResult{
+			Event:    event,
+			Command:  command,
+			Output:   output,
+			Duration: time.Since(started),
+			Err:      err,
+		})
+	}()
+}
+
+// runStoppedHook runs the stopped hook once per forward, whether the tunnel
+// was stopped or gave up reconnecting.
+func (f *LocalForward) runStoppedHook(cause error) {
+	f.stoppedHookOnce.Do(func() {
+		f.runLocalHookAsync(HookStopped, cause)
+	})
+}
+
+func (f *LocalForward) reportHook(result HookResult) {
+	attrs := []any{
+		"tunnel_id", f.tunnel.ID,
+		"name", f.tunnel.Name,
+		"event", result.Event,
+		"remote", result.Remote,
+		"duration", result.Duration.String(),
+	}
+	if result.Err != nil {
+		slog.Warn("tunnel hook failed", append(attrs, "err", result.Err)...)
+	} else {
+		slog.Info("tunnel hook finished", attrs...)
+	}
+
+	f.mu.Lock()
+	observer := f.hookObserver
+	f.mu.Unlock()
+	if observer != nil {
+		observer(result)
+	}
+}
+
+// SetHookObserver registers fn to receive the results of the tunnel's hooks.
+// Call it before Start.
+func (f *LocalForward) SetHookObserver(fn HookObserver) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hookObserver = fn
+}
+
+// WaitHooks blocks until local hooks that are still running have finished
+// or timed out.
+func (f *LocalForward) WaitHooks() {
+	f.hookWG.Wait()
+}
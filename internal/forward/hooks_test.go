@@ -0,0 +1,160 @@
+package forward
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func skipWithoutSh(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+}
+
+// execServer runs exec requests with the local sh, standing in for a remote
+// host.
+func execServer(_ *ssh.ServerConn, chans <-chan ssh.NewChannel) {
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			_ = newCh.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		ch, reqs, err := newCh.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer ch.Close()
+			for req := range reqs {
+				if req.Type != "exec" {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+					_ = req.Reply(false, nil)
+					return
+				}
+				_ = req.Reply(true, nil)
+				cmd := exec.Command("sh", "-c", payload.Command)
+				cmd.Stdout = ch
+				cmd.Stderr = ch.Stderr()
+				status := uint32(0)
+				if err := cmd.Run(); err != nil {
+					status = 1
+					var exitErr *exec.ExitError
+					if errors.As(err, &exitErr) {
+						status = uint32(exitErr.ExitCode())
+					}
+				}
+				_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+func hookTestJumper(t *testing.T) model.Jumper {
+	t.Helper()
+	host, port, _ := startTestSSHServerWithHandler(t, &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}, execServer)
+	return model.Jumper{
+		Name:                   "bastion",
+		Host:                   host,
+		Port:                   port,
+		User:                   "ops",
+		AuthType:               "password",
+		Password:               "pw",
+		BypassHostVerification: true,
+		TimeoutMs:              2000,
+	}
+}
+
+func TestRunLocalHookEnvOutputAndTimeout(t *testing.T) {
+	skipWithoutSh(t)
+	tunnel := model.Tunnel{ID: 7, Name: "db's tunnel", Mode: "local", LocalHost: "127.0.0.1", LocalPort: 15432}
+	env := hookEnv(tunnel, []model.Jumper{{Name: "bastion", Host: "10.0.0.1"}}, HookStarted, nil)
+
+	output, err := runLocalHook(`echo "$LORIS_TUNNEL_EVENT $LORIS_TUNNEL_NAME $LORIS_TUNNEL_LOCAL_PORT $LORIS_TUNNEL_JUMPER"; echo oops >&2; exit 3`, env, 5*time.Second)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("err = %v, want exit status 3", err)
+	}
+	if output != "started db's tunnel 15432 bastion\noops\n" {
+		t.Fatalf("output = %q", output)
+	}
+
+	started := time.Now()
+	_, err = runLocalHook("sleep 10", env, 200*time.Millisecond)
+	if !errors.Is(err, ErrHookTimeout) {
+		t.Fatalf("err = %v, want ErrHookTimeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("timed out hook took %s", elapsed)
+	}
+}
+
+func TestPreStartHookRunsRemotelyAndAbortsStart(t *testing.T) {
+	skipWithoutSh(t)
+	jumper := hookTestJumper(t)
+
+	var mu sync.Mutex
+	var results []HookResult
+	observe := func(r HookResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, r)
+	}
+
+	client, err := dialSSH(jumper)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+	run := NewLocalForward(model.Tunnel{
+		ID:    3,
+		Name:  "it's db",
+		Mode:  "local",
+		Hooks: model.TunnelHooks{PreStart: `echo "ready $LORIS_TUNNEL_NAME via $LORIS_TUNNEL_JUMPER"`},
+	}, []model.Jumper{jumper})
+	run.SetHookObserver(observe)
+	if err := run.runPreStartHook(client); err != nil {
+		t.Fatalf("runPreStartHook: %v", err)
+	}
+	if len(results) != 1 || !results[0].Remote || results[0].Output != "ready it's db via bastion\n" {
+		t.Fatalf("results = %+v", results)
+	}
+
+	failing := NewLocalForward(model.Tunnel{
+		Name:       "db",
+		Mode:       "local",
+		LocalPort:  1,
+		RemoteHost: "127.0.0.1",
+		RemotePort: 5432,
+		Hooks:      model.TunnelHooks{PreStart: "echo not yet; exit 1"},
+	}, []model.Jumper{jumper})
+	failing.SetHookObserver(observe)
+	err = failing.Start()
+	if err == nil || !strings.Contains(err.Error(), "pre-start hook failed") {
+		t.Fatalf("Start err = %v, want pre-start failure", err)
+	}
+	if last := results[len(results)-1]; last.Err == nil || last.Output != "not yet\n" {
+		t.Fatalf("failed hook result = %+v", last)
+	}
+}
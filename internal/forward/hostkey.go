@@ -0,0 +1,343 @@
+package forward
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"loris-tunnel/internal/hostkeys"
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// HostKeyPolicyStrict only accepts hosts already in known_hosts.
+	HostKeyPolicyStrict = "strict"
+	// HostKeyPolicyAcceptNew records unknown hosts on first use but still
+	// rejects changed keys, like OpenSSH's StrictHostKeyChecking=accept-new.
+	HostKeyPolicyAcceptNew = "accept_new"
+)
+
+// Host key verification failure reasons reported in HostKeyError.Reason.
+const (
+	HostKeyUnknown     = "unknown"
+	HostKeyMismatch    = "mismatch"
+	HostKeyPinMismatch = "pin_mismatch"
+	HostKeyRevoked     = "revoked"
+)
+
+// HostKeyError describes a rejected host key with enough detail for the UI to
+// show the fingerprint and offer to trust the key.
+type HostKeyError struct {
+	Host           string
+	Reason         string
+	KeyType        string
+	Fingerprint    string
+	KnownHostsPath string
+	// PinnedFingerprint is set for pin_mismatch.
+	PinnedFingerprint string
+	// ConflictLine/ConflictEntry point at the known_hosts line that holds a
+	// different (or revoked) key for the host; zero/empty for unknown hosts.
+	ConflictLine        int
+	ConflictEntry       string
+	ConflictKeyType     string
+	ConflictFingerprint string
+}
+
+func (e *HostKeyError) Error() string {
+	presented := fmt.Sprintf("%s %s", e.KeyType, e.Fingerprint)
+	switch e.Reason {
+	case HostKeyPinMismatch:
+		return fmt.Sprintf("host key for %s does not match pinned fingerprint %s: server presented %s", e.Host, e.PinnedFingerprint, presented)
+	case HostKeyMismatch:
+		return fmt.Sprintf("host key mismatch for %s: server presented %s, %s:%d has %s %s", e.Host, presented, e.KnownHostsPath, e.ConflictLine, e.ConflictKeyType, e.ConflictFingerprint)
+	case HostKeyRevoked:
+		return fmt.Sprintf("host key for %s is revoked (%s:%d): %s", e.Host, e.KnownHostsPath, e.ConflictLine, presented)
+	default:
+		return fmt.Sprintf("host key for %s is not in %s: server presented %s", e.Host, e.KnownHostsPath, presented)
+	}
+}
+
+// KnownHostsPath returns the known_hosts file used for jumper.
+func KnownHostsPath(jumper model.Jumper) (string, error) {
+	if custom := strings.TrimSpace(jumper.KnownHostsPath); custom != "" {
+		return resolveKeyPath(custom)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home dir failed: %w", err)
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
+
+// ValidateHostKeyFingerprint checks that fp is a SHA256 fingerprint as
+// printed by ssh-keygen -l, with or without the "SHA256:" prefix.
+func ValidateHostKeyFingerprint(fp string) error {
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(hostkeys.NormalizeFingerprint(fp), "SHA256:"))
+	if err != nil || len(raw) != sha256.Size {
+		return fmt.Errorf("expected a SHA256 fingerprint like SHA256:<43 base64 chars>")
+	}
+	return nil
+}
+
+func normalizeHostKeyPolicy(policy string) string {
+	if strings.TrimSpace(policy) == HostKeyPolicyAcceptNew {
+		return HostKeyPolicyAcceptNew
+	}
+	return HostKeyPolicyStrict
+}
+
+func makeHostKeyCallback(jumper model.Jumper) (ssh.HostKeyCallback, error) {
+	pin := strings.TrimSpace(jumper.HostKeyFingerprint)
+	if pin != "" {
+		// A pinned fingerprint is authoritative: known_hosts is not consulted.
+		want := hostkeys.NormalizeFingerprint(pin)
+		return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != want {
+				return &HostKeyError{
+					Host:              hostname,
+					Reason:            HostKeyPinMismatch,
+					KeyType:           key.Type(),
+					Fingerprint:       got,
+					PinnedFingerprint: want,
+				}
+			}
+			return nil
+		}, nil
+	}
+	if jumper.BypassHostVerification {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	path, err := KnownHostsPath(jumper)
+	if err != nil {
+		return nil, err
+	}
+	acceptNew := normalizeHostKeyPolicy(jumper.HostKeyPolicy) == HostKeyPolicyAcceptNew
+	if acceptNew {
+		if err := hostkeys.EnsureFile(path); err != nil {
+			return nil, err
+		}
+	}
+	check, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("known_hosts load failed (%s): %w", path, err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := checkKnownHost(check, path, hostname, remote, key)
+		var hkErr *HostKeyError
+		if !acceptNew || !errors.As(err, &hkErr) || hkErr.Reason != HostKeyUnknown {
+			return err
+		}
+		if err := hostkeys.Append(path, hostname, key, jumper.HashKnownHosts); err != nil {
+			return err
+		}
+		slog.Info("host key accepted on first use", "host", hostname, "key_type", key.Type(), "fingerprint", ssh.FingerprintSHA256(key), "known_hosts", path)
+		return nil
+	}, nil
+}
+
+// checkKnownHost runs a knownhosts callback and converts its errors into
+// HostKeyError.
+func checkKnownHost(check ssh.HostKeyCallback, path, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	err := check(hostname, remote, key)
+	if err == nil {
+		return nil
+	}
+	out := &HostKeyError{
+		Host:           hostname,
+		KeyType:        key.Type(),
+		Fingerprint:    ssh.FingerprintSHA256(key),
+		KnownHostsPath: path,
+	}
+
+	var revoked *knownhosts.RevokedError
+	if errors.As(err, &revoked) {
+		out.Reason = HostKeyRevoked
+		out.fillConflict(revoked.Revoked)
+		return out
+	}
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+	if len(keyErr.Want) == 0 {
+		out.Reason = HostKeyUnknown
+		return out
+	}
+	out.Reason = HostKeyMismatch
+	conflict := keyErr.Want[0]
+	for _, want := range keyErr.Want {
+		if want.Key.Type() == key.Type() {
+			conflict = want
+			break
+		}
+	}
+	out.fillConflict(conflict)
+	return out
+}
+
+func (e *HostKeyError) fillConflict(known knownhosts.KnownKey) {
+	e.KnownHostsPath = known.Filename
+	e.ConflictLine = known.Line
+	e.ConflictKeyType = known.Key.Type()
+	e.ConflictFingerprint = ssh.FingerprintSHA256(known.Key)
+	e.ConflictEntry = readKnownHostsLine(known.Filename, known.Line)
+}
+
+func readKnownHostsLine(path string, line int) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if n == line {
+			return strings.TrimSpace(scanner.Text())
+		}
+	}
+	return ""
+}
+
+var errHostKeyCaptured = errors.New("host key captured")
+
+// FetchHostKey connects to the jumper's first hop (honouring ProxyCommand and
+// upstream proxy) and returns the host key it presents, without
+// authenticating. address is the "host:port" used for known_hosts lookups.
+func FetchHostKey(jumper model.Jumper) (ssh.PublicKey, string, error) {
+	var captured ssh.PublicKey
+	conf := &ssh.ClientConfig{
+		User: strings.TrimSpace(jumper.User),
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			captured = key
+			return errHostKeyCaptured
+		},
+		Timeout: dialTimeoutFromJumper(jumper),
+	}
+	if conf.User == "" {
+		conf.User = "root"
+	}
+	if jumper.HostKeyAlgorithms != "" {
+		conf.HostKeyAlgorithms = parseHostKeyAlgorithms(jumper.HostKeyAlgorithms)
+	}
+	if err := applyAlgorithmSettings(conf, jumper); err != nil {
+		return nil, "", err
+	}
+
+	host := strings.TrimSpace(jumper.Host)
+	if host == "" {
+		return nil, "", fmt.Errorf("jumper host is required")
+	}
+	port := jumper.Port
+	if port <= 0 {
+		port = 22
+	}
+	address := net.JoinHostPort(host, fmt.Sprint(port))
+
+	client, err := dialFirstHop(jumper, conf, nil, nil)
+	if client != nil {
+		_ = client.Close()
+	}
+	if captured == nil {
+		if err == nil {
+			err = errors.New("server did not present a host key")
+		}
+		return nil, address, err
+	}
+	return captured, address, nil
+}
+
+// CheckHostKey verifies key for address against the jumper's pin or
+// known_hosts without modifying anything. It returns nil when trusted.
+func CheckHostKey(jumper model.Jumper, address string, key ssh.PublicKey) error {
+	strict := jumper
+	strict.BypassHostVerification = false
+	strict.HostKeyPolicy = HostKeyPolicyStrict
+	path, err := KnownHostsPath(strict)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(strict.HostKeyFingerprint) == "" {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return &HostKeyError{Host: address, Reason: HostKeyUnknown, KeyType: key.Type(), Fingerprint: ssh.FingerprintSHA256(key), KnownHostsPath: path}
+		}
+	}
+	cb, err := makeHostKeyCallback(strict)
+	if err != nil {
+		return err
+	}
+	return cb(address, &net.TCPAddr{}, key)
+}
+
+// ErrHostKeyChanged is returned by TrustHostKey when the server no longer
+// presents the key the user agreed to trust.
+var ErrHostKeyChanged = errors.New("host key changed since it was shown")
+
+// TrustHostKey fetches the jumper's host key and, when it matches fingerprint,
+// records it in the jumper's known_hosts. It returns the key and the
+// "host:port" it was recorded for.
+func TrustHostKey(jumper model.Jumper, fingerprint string) (ssh.PublicKey, string, error) {
+	if err := ValidateHostKeyFingerprint(fingerprint); err != nil {
+		return nil, "", fmt.Errorf("fingerprint: %w", err)
+	}
+	key, address, err := FetchHostKey(jumper)
+	if err != nil {
+		return nil, address, err
+	}
+	if presented := ssh.FingerprintSHA256(key); presented != hostkeys.NormalizeFingerprint(fingerprint) {
+		return nil, address, fmt.Errorf("%w: server now presents %s", ErrHostKeyChanged, presented)
+	}
+	if err := trustHostKey(jumper, address, key); err != nil {
+		return nil, address, err
+	}
+	return key, address, nil
+}
+
+// trustHostKey makes key the trusted key for address in the jumper's
+// known_hosts: entries holding a different key for the host are removed and
+// the new key is appended. Revoked keys and pinned jumpers are refused.
+func trustHostKey(jumper model.Jumper, address string, key ssh.PublicKey) error {
+	if strings.TrimSpace(jumper.HostKeyFingerprint) != "" {
+		return fmt.Errorf("jumper pins its host key; update hostKeyFingerprint instead")
+	}
+	path, err := KnownHostsPath(jumper)
+	if err != nil {
+		return err
+	}
+	// Each pass removes one conflicting line; a host rarely has more than a
+	// few, the bound only guards against a file that keeps changing.
+	for i := 0; i < 64; i++ {
+		err := CheckHostKey(jumper, address, key)
+		if err == nil {
+			return nil
+		}
+		var hkErr *HostKeyError
+		if !errors.As(err, &hkErr) {
+			return err
+		}
+		switch hkErr.Reason {
+		case HostKeyUnknown:
+			return hostkeys.Append(path, address, key, jumper.HashKnownHosts)
+		case HostKeyMismatch:
+			if err := hostkeys.Remove(hkErr.KnownHostsPath, hkErr.ConflictLine, hkErr.ConflictFingerprint); err != nil {
+				return err
+			}
+			slog.Info("removed conflicting known_hosts entry", "host", address, "known_hosts", hkErr.KnownHostsPath, "line", hkErr.ConflictLine)
+		default:
+			return err
+		}
+	}
+	return fmt.Errorf("known_hosts still conflicts for %s after removing old entries", address)
+}
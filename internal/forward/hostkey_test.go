@@ -0,0 +1,134 @@
+package forward
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"loris-tunnel/internal/hostkeys"
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func startPasswordTestServer(t *testing.T) (model.Jumper, ssh.PublicKey) {
+	t.Helper()
+	host, port, hostKey := startTestSSHServer(t, &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	})
+	return model.Jumper{
+		Host:           host,
+		Port:           port,
+		User:           "ops",
+		AuthType:       "password",
+		Password:       "pw",
+		TimeoutMs:      2000,
+		KnownHostsPath: filepath.Join(t.TempDir(), "ssh", "known_hosts"),
+	}, hostKey
+}
+
+func TestAcceptNewAppendsKnownHost(t *testing.T) {
+	for _, hashed := range []bool{false, true} {
+		jumper, hostKey := startPasswordTestServer(t)
+		jumper.HostKeyPolicy = HostKeyPolicyAcceptNew
+		jumper.HashKnownHosts = hashed
+
+		client, err := dialSSH(jumper)
+		if err != nil {
+			t.Fatalf("hashed=%v: dialSSH: %v", hashed, err)
+		}
+		_ = client.Close()
+
+		raw, err := os.ReadFile(jumper.KnownHostsPath)
+		if err != nil {
+			t.Fatalf("read known_hosts: %v", err)
+		}
+		entry := string(raw)
+		if strings.HasPrefix(entry, "|1|") != hashed || !strings.Contains(entry, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostKey)))) {
+			t.Fatalf("hashed=%v: known_hosts = %q", hashed, entry)
+		}
+
+		// The recorded entry must satisfy strict checking on the next dial.
+		jumper.HostKeyPolicy = HostKeyPolicyStrict
+		client, err = dialSSH(jumper)
+		if err != nil {
+			t.Fatalf("hashed=%v: strict dial after accept-new: %v", hashed, err)
+		}
+		_ = client.Close()
+	}
+}
+
+func TestStrictMismatchReturnsHostKeyError(t *testing.T) {
+	jumper, hostKey := startPasswordTestServer(t)
+	_, other := writeTestKey(t)
+	address := net.JoinHostPort(jumper.Host, strconv.Itoa(jumper.Port))
+	if err := hostkeys.Append(jumper.KnownHostsPath, address, other.PublicKey(), false); err != nil {
+		t.Fatalf("hostkeys.Append: %v", err)
+	}
+
+	jumper.HostKeyPolicy = HostKeyPolicyAcceptNew
+	_, err := dialSSH(jumper)
+	var hkErr *HostKeyError
+	if !errors.As(err, &hkErr) {
+		t.Fatalf("dialSSH error = %v, want HostKeyError", err)
+	}
+	if hkErr.Reason != HostKeyMismatch || hkErr.Fingerprint != ssh.FingerprintSHA256(hostKey) || hkErr.KeyType != hostKey.Type() {
+		t.Fatalf("HostKeyError = %+v", hkErr)
+	}
+	if hkErr.ConflictLine != 1 || hkErr.ConflictFingerprint != ssh.FingerprintSHA256(other.PublicKey()) || !strings.Contains(hkErr.ConflictEntry, jumper.Host) {
+		t.Fatalf("conflict = line %d %q %s", hkErr.ConflictLine, hkErr.ConflictEntry, hkErr.ConflictFingerprint)
+	}
+
+	if _, _, err := TrustHostKey(jumper, hkErr.ConflictFingerprint); !errors.Is(err, ErrHostKeyChanged) {
+		t.Fatalf("TrustHostKey with stale fingerprint = %v, want ErrHostKeyChanged", err)
+	}
+	if _, got, err := TrustHostKey(jumper, hkErr.Fingerprint); err != nil || got != address {
+		t.Fatalf("TrustHostKey = %q, %v", got, err)
+	}
+	if err := CheckHostKey(jumper, address, hostKey); err != nil {
+		t.Fatalf("CheckHostKey after trust: %v", err)
+	}
+	raw, _ := os.ReadFile(jumper.KnownHostsPath)
+	if strings.Count(string(raw), "\n") != 1 {
+		t.Fatalf("known_hosts after trust = %q, want only the new entry", raw)
+	}
+}
+
+func TestPinnedHostKeyFingerprint(t *testing.T) {
+	jumper, hostKey := startPasswordTestServer(t)
+	// A pin is checked even with host verification bypassed and no known_hosts.
+	jumper.BypassHostVerification = true
+	jumper.HostKeyFingerprint = strings.TrimPrefix(ssh.FingerprintSHA256(hostKey), "SHA256:")
+	client, err := dialSSH(jumper)
+	if err != nil {
+		t.Fatalf("dialSSH with matching pin: %v", err)
+	}
+	_ = client.Close()
+
+	_, other := writeTestKey(t)
+	jumper.HostKeyFingerprint = ssh.FingerprintSHA256(other.PublicKey())
+	_, err = dialSSH(jumper)
+	var hkErr *HostKeyError
+	if !errors.As(err, &hkErr) || hkErr.Reason != HostKeyPinMismatch || hkErr.PinnedFingerprint != jumper.HostKeyFingerprint {
+		t.Fatalf("dialSSH with wrong pin = %v", err)
+	}
+}
+
+func TestValidateHostKeyFingerprint(t *testing.T) {
+	_, signer := writeTestKey(t)
+	fp := ssh.FingerprintSHA256(signer.PublicKey())
+	for _, ok := range []string{fp, strings.TrimPrefix(fp, "SHA256:")} {
+		if err := ValidateHostKeyFingerprint(ok); err != nil {
+			t.Fatalf("ValidateHostKeyFingerprint(%q) = %v", ok, err)
+		}
+	}
+	if err := ValidateHostKeyFingerprint("MD5:aa:bb"); err == nil {
+		t.Fatal("MD5 fingerprint should be rejected")
+	}
+}
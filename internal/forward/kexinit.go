@@ -0,0 +1,173 @@
+package forward
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+
+	"loris-tunnel/internal/model"
+)
+
+const (
+	msgKexInit = 20
+	// kexSniffLimit bounds how much of the unencrypted handshake is buffered
+	// while looking for KEXINIT.
+	kexSniffLimit = 256 * 1024
+)
+
+// kexInitSniffer wraps a connection and reads the first KEXINIT sent in each
+// direction, which travel in clear text, to work out which algorithms the
+// handshake settles on. x/crypto does not expose the negotiated algorithms.
+type kexInitSniffer struct {
+	net.Conn
+
+	mu     sync.Mutex
+	out    kexInitStream
+	in     kexInitStream
+	result *model.NegotiatedAlgorithms
+}
+
+func newKexInitSniffer(conn net.Conn, result *model.NegotiatedAlgorithms) net.Conn {
+	if result == nil {
+		return conn
+	}
+	return &kexInitSniffer{Conn: conn, result: result}
+}
+
+func (s *kexInitSniffer) Read(p []byte) (int, error) {
+	n, err := s.Conn.Read(p)
+	if n > 0 {
+		s.observe(&s.in, p[:n])
+	}
+	return n, err
+}
+
+func (s *kexInitSniffer) Write(p []byte) (int, error) {
+	s.observe(&s.out, p)
+	return s.Conn.Write(p)
+}
+
+func (s *kexInitSniffer) observe(stream *kexInitStream, p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stream.done {
+		return
+	}
+	stream.feed(p)
+	if s.out.lists != nil && s.in.lists != nil && s.result.KeyExchange == "" {
+		*s.result = negotiateAlgorithms(s.result.Jumper, s.out.lists, s.in.lists)
+	}
+}
+
+// kexInitStream parses one direction of the handshake up to its first binary
+// packet: the version line (plus any banner lines before it) and KEXINIT.
+type kexInitStream struct {
+	buf         []byte
+	versionSeen bool
+	done        bool
+	lists       [][]string
+}
+
+func (k *kexInitStream) feed(p []byte) {
+	k.buf = append(k.buf, p...)
+	for !k.versionSeen {
+		idx := bytes.IndexByte(k.buf, '\n')
+		if idx < 0 {
+			k.giveUpIfLarge()
+			return
+		}
+		line := k.buf[:idx]
+		k.buf = k.buf[idx+1:]
+		if bytes.HasPrefix(line, []byte("SSH-")) {
+			k.versionSeen = true
+		}
+	}
+	if len(k.buf) < 5 {
+		return
+	}
+	length := binary.BigEndian.Uint32(k.buf[:4])
+	if length > kexSniffLimit {
+		k.stop()
+		return
+	}
+	if uint32(len(k.buf)-4) < length {
+		return
+	}
+	padding := uint32(k.buf[4])
+	if padding+1 > length {
+		k.stop()
+		return
+	}
+	payload := k.buf[5 : 4+length-padding]
+	if len(payload) > 0 && payload[0] == msgKexInit {
+		k.lists = parseKexInitLists(payload)
+	}
+	k.stop()
+}
+
+func (k *kexInitStream) giveUpIfLarge() {
+	if len(k.buf) > kexSniffLimit {
+		k.stop()
+	}
+}
+
+func (k *kexInitStream) stop() {
+	k.done = true
+	k.buf = nil
+}
+
+// parseKexInitLists returns the name-lists of a KEXINIT payload in wire
+// order: kex, host key, cipher c2s, cipher s2c, mac c2s, mac s2c, ...
+func parseKexInitLists(payload []byte) [][]string {
+	// message type + 16 byte cookie
+	rest := payload[1:]
+	if len(rest) < 16 {
+		return nil
+	}
+	rest = rest[16:]
+	lists := make([][]string, 0, 10)
+	for i := 0; i < 10; i++ {
+		if len(rest) < 4 {
+			return nil
+		}
+		n := binary.BigEndian.Uint32(rest[:4])
+		rest = rest[4:]
+		if uint32(len(rest)) < n {
+			return nil
+		}
+		var names []string
+		if n > 0 {
+			names = strings.Split(string(rest[:n]), ",")
+		}
+		lists = append(lists, names)
+		rest = rest[n:]
+	}
+	return lists
+}
+
+// negotiateAlgorithms applies RFC 4253 section 7.1: for each category the
+// first client algorithm the server also lists wins.
+func negotiateAlgorithms(jumper string, client, server [][]string) model.NegotiatedAlgorithms {
+	pick := func(i int) string {
+		for _, algo := range client[i] {
+			if hasAlgorithm(server[i], algo) {
+				return algo
+			}
+		}
+		return ""
+	}
+	out := model.NegotiatedAlgorithms{
+		Jumper:      jumper,
+		KeyExchange: pick(0),
+		HostKey:     pick(1),
+		Cipher:      pick(2),
+		MAC:         pick(4),
+	}
+	// AEAD ciphers authenticate packets themselves; the MAC is not used.
+	if strings.Contains(out.Cipher, "gcm") || strings.HasPrefix(out.Cipher, "chacha20-poly1305") {
+		out.MAC = ""
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/totp"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrNoChallengePrompter is returned when a keyboard-interactive question
+// cannot be answered from stored credentials and nobody can be asked.
+var ErrNoChallengePrompter = errors.New("keyboard-interactive prompt needs user input")
+
+// ChallengeRequest describes the questions the server asked that could not be
+// answered automatically.
+type ChallengeRequest struct {
+	JumperName  string
+	Host        string
+	User        string
+	Name        string
+	Instruction string
+	Questions   []string
+	Echos       []bool
+}
+
+// ChallengePrompter asks the user to answer req. It must return one answer per
+// question or an error (for example on timeout).
+type ChallengePrompter func(req ChallengeRequest) ([]string, error)
+
+var (
+	challengePrompterMu sync.RWMutex
+	challengePrompter   ChallengePrompter
+)
+
+// SetChallengePrompter installs the prompter used for keyboard-interactive
+// questions that stored secrets cannot answer. Pass nil to disable prompting.
+func SetChallengePrompter(p ChallengePrompter) {
+	challengePrompterMu.Lock()
+	defer challengePrompterMu.Unlock()
+	challengePrompter = p
+}
+
+func currentChallengePrompter() ChallengePrompter {
+	challengePrompterMu.RLock()
+	defer challengePrompterMu.RUnlock()
+	return challengePrompter
+}
+
+var otpQuestionHints = []string{"verification", "one-time", "otp", "passcode", "token", "code", "2fa", "authenticator", "mfa"}
+
+// isOTPQuestion guesses whether a prompt asks for a one-time code.
+func isOTPQuestion(question string) bool {
+	q := strings.ToLower(question)
+	for _, hint := range otpQuestionHints {
+		if strings.Contains(q, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPasswordQuestion(question string) bool {
+	return strings.Contains(strings.ToLower(question), "password")
+}
+
+// makeKeyboardInteractiveChallenge answers password questions from the stored
+// password and one-time-code questions from the stored TOTP secret, and only
+// falls back to the prompter for whatever is left. With a TOTP secret set the
+// whole exchange runs unattended, which is what reconnects rely on. pause,
+// when non-nil, suspends the handshake deadline while the user answers.
+func makeKeyboardInteractiveChallenge(jumper model.Jumper, pause func() (resume func())) (ssh.KeyboardInteractiveChallenge, error) {
+	var otp *totp.Generator
+	if secret := strings.TrimSpace(jumper.TOTPSecret); secret != "" {
+		g, err := totp.New(secret)
+		if err != nil {
+			return nil, err
+		}
+		otp = g
+	}
+
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		pending := make([]int, 0, len(questions))
+		for i, question := range questions {
+			switch {
+			case otp != nil && isOTPQuestion(question):
+				answers[i] = otp.Now()
+			case jumper.Password != "" && isPasswordQuestion(question):
+				answers[i] = jumper.Password
+			default:
+				pending = append(pending, i)
+			}
+		}
+		if len(pending) == 0 {
+			return answers, nil
+		}
+
+		req := ChallengeRequest{
+			JumperName:  strings.TrimSpace(jumper.Name),
+			Host:        strings.TrimSpace(jumper.Host),
+			User:        strings.TrimSpace(jumper.User),
+			Name:        name,
+			Instruction: instruction,
+		}
+		for _, i := range pending {
+			req.Questions = append(req.Questions, questions[i])
+			echo := false
+			if i < len(echos) {
+				echo = echos[i]
+			}
+			req.Echos = append(req.Echos, echo)
+		}
+
+		prompter := currentChallengePrompter()
+		if prompter == nil {
+			return nil, fmt.Errorf("%w: %q", ErrNoChallengePrompter, req.Questions[0])
+		}
+		slog.Info("keyboard-interactive prompt", "jumper", req.JumperName, "host", req.Host, "questions", len(req.Questions))
+		resume := func() {}
+		if pause != nil {
+			resume = pause()
+		}
+		replies, err := prompter(req)
+		resume()
+		if err != nil {
+			return nil, err
+		}
+		if len(replies) != len(pending) {
+			return nil, fmt.Errorf("keyboard-interactive prompt expected %d answers, got %d", len(pending), len(replies))
+		}
+		for j, i := range pending {
+			answers[i] = replies[j]
+		}
+		return answers, nil
+	}, nil
+}
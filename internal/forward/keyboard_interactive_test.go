@@ -0,0 +1,124 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/totp"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestKeyboardInteractiveAnswersFromStoredSecrets(t *testing.T) {
+	SetChallengePrompter(nil)
+	challenge, err := makeKeyboardInteractiveChallenge(model.Jumper{Password: "pw", TOTPSecret: testTOTPSecret}, nil)
+	if err != nil {
+		t.Fatalf("make challenge: %v", err)
+	}
+
+	answers, err := challenge("", "", []string{"Password: ", "Verification code: "}, []bool{false, true})
+	if err != nil {
+		t.Fatalf("challenge: %v", err)
+	}
+	g, _ := totp.New(testTOTPSecret)
+	if answers[0] != "pw" || answers[1] != g.Now() {
+		t.Fatalf("answers = %q", answers)
+	}
+
+	if _, err := challenge("", "", []string{"Favourite colour? "}, []bool{true}); !errors.Is(err, ErrNoChallengePrompter) {
+		t.Fatalf("unknown question err = %v, want ErrNoChallengePrompter", err)
+	}
+}
+
+func TestKeyboardInteractivePromptsOnlyForUnansweredQuestions(t *testing.T) {
+	var got ChallengeRequest
+	SetChallengePrompter(func(req ChallengeRequest) ([]string, error) {
+		got = req
+		return []string{"blue"}, nil
+	})
+	defer SetChallengePrompter(nil)
+
+	challenge, err := makeKeyboardInteractiveChallenge(model.Jumper{Name: "bastion", Password: "pw"}, nil)
+	if err != nil {
+		t.Fatalf("make challenge: %v", err)
+	}
+	answers, err := challenge("", "hello", []string{"Password: ", "Favourite colour? "}, []bool{false, true})
+	if err != nil {
+		t.Fatalf("challenge: %v", err)
+	}
+	if answers[0] != "pw" || answers[1] != "blue" {
+		t.Fatalf("answers = %q", answers)
+	}
+	if len(got.Questions) != 1 || got.Questions[0] != "Favourite colour? " || !got.Echos[0] || got.JumperName != "bastion" {
+		t.Fatalf("prompt request = %+v", got)
+	}
+}
+
+func TestKeyboardInteractivePromptPausesHandshakeDeadline(t *testing.T) {
+	var deadlines []time.Time
+	trace := newAuthTrace([]string{"keyboard_interactive"})
+	trace.bindDeadline(time.Second, func(d time.Time) { deadlines = append(deadlines, d) })
+
+	SetChallengePrompter(func(req ChallengeRequest) ([]string, error) {
+		if len(deadlines) != 1 || !deadlines[0].IsZero() {
+			t.Errorf("deadlines while prompting = %v, want one cleared deadline", deadlines)
+		}
+		return []string{"123456"}, nil
+	})
+	defer SetChallengePrompter(nil)
+
+	challenge, err := makeKeyboardInteractiveChallenge(model.Jumper{Name: "bastion"}, trace.pauseDeadline)
+	if err != nil {
+		t.Fatalf("make challenge: %v", err)
+	}
+	start := time.Now()
+	if _, err := challenge("", "", []string{"Code: "}, []bool{false}); err != nil {
+		t.Fatalf("challenge: %v", err)
+	}
+	if len(deadlines) != 2 || deadlines[1].Before(start.Add(time.Second)) {
+		t.Fatalf("deadlines = %v, want the deadline restored a full timeout after the prompt", deadlines)
+	}
+}
+
+func TestMakeAuthMethodsRejectsInvalidTOTPSecret(t *testing.T) {
+	if _, _, err := makeAuthMethods(model.Jumper{AuthType: "keyboard_interactive", TOTPSecret: "not base32!"}); !errors.Is(err, totp.ErrInvalidSecret) {
+		t.Fatalf("err = %v, want ErrInvalidSecret", err)
+	}
+}
+
+func TestDialSSHKeyboardInteractiveWithTOTP(t *testing.T) {
+	SetChallengePrompter(nil)
+	g, _ := totp.New(testTOTPSecret)
+	host, port, _ := startTestSSHServer(t, &ssh.ServerConfig{
+		KeyboardInteractiveCallback: func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "", []string{"Password: ", "OTP: "}, []bool{false, false})
+			if err != nil {
+				return nil, err
+			}
+			if now := time.Now(); answers[0] != "pw" || (answers[1] != g.At(now) && answers[1] != g.At(now.Add(-30*time.Second))) {
+				return nil, fmt.Errorf("wrong answers")
+			}
+			return nil, nil
+		},
+	})
+
+	client, err := dialSSH(model.Jumper{
+		Host:                   host,
+		Port:                   port,
+		User:                   "ops",
+		AuthType:               "keyboard_interactive",
+		Password:               "pw",
+		TOTPSecret:             testTOTPSecret,
+		BypassHostVerification: true,
+		TimeoutMs:              2000,
+	})
+	if err != nil {
+		t.Fatalf("dialSSH: %v", err)
+	}
+	_ = client.Close()
+}
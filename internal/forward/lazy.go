@@ -0,0 +1,241 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"loris-tunnel/internal/latency"
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Lazy tunnels bind their local listener at start but only dial the SSH
+// chain when a client connects, and drop it again once idle.
+const (
+	LazyStateListening  = "listening"
+	LazyStateConnecting = "connecting"
+	LazyStateConnected  = "connected"
+
+	DefaultLazyIdleTimeout = 5 * time.Minute
+	minLazyIdleTimeoutMs   = 1000
+	maxLazyIdleTimeoutMs   = 24 * 60 * 60 * 1000
+)
+
+var errForwardStopping = errors.New("tunnel is stopping")
+
+// ValidateLazy checks a tunnel's lazy settings. Remote forwards need the
+// SSH connection to listen at all, and health checks would keep a lazy
+// tunnel connected, so neither can be lazy.
+func ValidateLazy(tunnel model.Tunnel) error {
+	if !tunnel.Lazy {
+		return nil
+	}
+	if normalizeForwardMode(tunnel.Mode) == "remote" {
+		return fmt.Errorf("lazy mode is only supported for local and dynamic tunnels")
+	}
+	if tunnel.HealthCheck.Type != "" {
+		return fmt.Errorf("health checks are not supported for lazy tunnels")
+	}
+	if tunnel.IdleTimeoutMs != 0 && (tunnel.IdleTimeoutMs < minLazyIdleTimeoutMs || tunnel.IdleTimeoutMs > maxLazyIdleTimeoutMs) {
+		return fmt.Errorf("idleTimeoutMs must be between %d and %d", minLazyIdleTimeoutMs, maxLazyIdleTimeoutMs)
+	}
+	return nil
+}
+
+func (f *LocalForward) isLazy() bool {
+	return f.tunnel.Lazy && normalizeForwardMode(f.tunnel.Mode) != "remote"
+}
+
+func (f *LocalForward) idleTimeout() time.Duration {
+	if f.tunnel.IdleTimeoutMs > 0 {
+		return time.Duration(f.tunnel.IdleTimeoutMs) * time.Millisecond
+	}
+	return DefaultLazyIdleTimeout
+}
+
+// startLazy binds the local listener without touching the network. The
+// pre-start hook runs on every dial instead.
+func (f *LocalForward) startLazy() error {
+	localAddr := localListenAddr(f.tunnel)
+	ln, err := listenLocal(localAddr)
+	if err != nil {
+		runErr := fmt.Errorf("listen %s failed: %w", localAddr, err)
+		f.setRunErr(runErr)
+		slog.Error("tunnel listen failed", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "addr", localAddr, "err", runErr)
+		return runErr
+	}
+
+	f.mu.Lock()
+	f.listener = ln
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+		f.tunnel.LocalPort = addr.Port
+		f.boundLocalPort = addr.Port
+	}
+	f.serving = true
+	f.lazyState = LazyStateListening
+	done := f.done
+	f.mu.Unlock()
+
+	slog.Info("tunnel listening lazily", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "addr", ln.Addr().String(), "idle_timeout", f.idleTimeout().String())
+	go f.serveLocal(done)
+	f.runLocalHookAsync(HookStarted, nil)
+	return nil
+}
+
+// LazyState reports whether a lazy tunnel is listening, connecting or
+// connected. ok is false for tunnels that are not lazy.
+func (f *LocalForward) LazyState() (state string, ok bool) {
+	if !f.isLazy() {
+		return "", false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lazyState, f.lazyState != ""
+}
+
+// acquireLazyConn counts an accepted connection, cancels a pending idle
+// disconnect and returns the current client, if any. Taking the client under
+// the same lock keeps idleDisconnect from closing it once handed out.
+// releaseLazyConn arms the idle disconnect again once the last one is gone.
+func (f *LocalForward) acquireLazyConn() *ssh.Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.activeConns++
+	if f.idleTimer != nil {
+		f.idleTimer.Stop()
+		f.idleTimer = nil
+	}
+	return f.client
+}
+
+func (f *LocalForward) releaseLazyConn() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.activeConns--
+	if f.activeConns > 0 || f.client == nil || f.stopping {
+		return
+	}
+	f.idleTimer = time.AfterFunc(f.idleTimeout(), f.idleDisconnect)
+}
+
+// lazyClient returns the SSH client, dialing the chain first if needed.
+// Concurrent callers wait for the same dial.
+func (f *LocalForward) lazyClient() (*ssh.Client, error) {
+	f.dialMu.Lock()
+	defer f.dialMu.Unlock()
+
+	f.mu.Lock()
+	client := f.client
+	stopping := f.stopping
+	if client == nil && !stopping {
+		f.lazyState = LazyStateConnecting
+	}
+	f.mu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+	if stopping {
+		return nil, errForwardStopping
+	}
+
+	slog.Info("tunnel lazy dial", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name)
+	client, closeChain, err := dialSSHChain(f.jumpers)
+	if err == nil {
+		if hookErr := f.runPreStartHook(client); hookErr != nil {
+			closeChain()
+			err = hookErr
+		}
+	}
+	if err != nil {
+		f.setLazyState(LazyStateListening)
+		slog.Warn("tunnel lazy dial failed", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "err", err)
+		return nil, err
+	}
+
+	f.mu.Lock()
+	if f.stopping {
+		f.mu.Unlock()
+		closeChain()
+		return nil, errForwardStopping
+	}
+	f.client = client
+	f.clientClose = closeChain
+	f.lastLatency = 0
+	f.lazyState = LazyStateConnected
+	f.mu.Unlock()
+
+	if rtt, latencyErr := TestJumperLatency(client); latencyErr == nil {
+		f.setLastLatency(rtt)
+		f.recordLatency(latency.Sample{Time: time.Now(), Latency: rtt})
+	} else {
+		f.recordLatency(latency.Sample{Time: time.Now(), Failed: true})
+	}
+	f.refreshCertificateExpiry()
+	go f.watchLazyClient(client)
+	return client, nil
+}
+
+// watchLazyClient keeps the connection alive and, when it is lost, goes
+// back to listening so the next client dials again. Losing an idle
+// connection is not a tunnel failure.
+func (f *LocalForward) watchLazyClient(client *ssh.Client) {
+	lossErr := f.waitClientLoss(client)
+
+	f.mu.Lock()
+	current := f.client == client
+	var closeChain func()
+	if current {
+		closeChain = f.clientClose
+		f.client = nil
+		f.clientClose = nil
+		f.lastLatency = 0
+		f.lazyState = LazyStateListening
+	}
+	f.mu.Unlock()
+	if !current {
+		return
+	}
+
+	if closeChain != nil {
+		closeChain()
+	}
+	if lossErr == nil {
+		return
+	}
+	slog.Warn("tunnel lazy connection lost", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "err", lossErr)
+	f.countDisconnect()
+	f.runLocalHookAsync(HookDisconnected, lossErr)
+}
+
+func (f *LocalForward) idleDisconnect() {
+	f.mu.Lock()
+	if f.stopping || f.activeConns > 0 || f.client == nil {
+		f.mu.Unlock()
+		return
+	}
+	client := f.client
+	closeChain := f.clientClose
+	f.client = nil
+	f.clientClose = nil
+	f.lastLatency = 0
+	f.lazyState = LazyStateListening
+	f.idleTimer = nil
+	f.mu.Unlock()
+
+	slog.Info("tunnel idle, closing ssh connection", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "idle_timeout", f.idleTimeout().String())
+	if closeChain != nil {
+		closeChain()
+	} else {
+		_ = client.Close()
+	}
+}
+
+func (f *LocalForward) setLazyState(state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lazyState = state
+}
@@ -0,0 +1,176 @@
+package forward
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func waitLazyState(t *testing.T, f *LocalForward, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		state, _ := f.LazyState()
+		if state == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("lazy state = %q, want %q", state, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLazyForwardDialsOnDemandAndDisconnectsWhenIdle(t *testing.T) {
+	var sessions atomic.Int32
+	host, port, _ := startTestSSHServerWithHandler(t, &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}, func(conn *ssh.ServerConn, chans <-chan ssh.NewChannel) {
+		sessions.Add(1)
+		directTCPIPServer(conn, chans)
+	})
+
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	echoPort := echo.Addr().(*net.TCPAddr).Port
+
+	f := NewLocalForward(model.Tunnel{
+		ID:            1,
+		Name:          "lazy",
+		Mode:          "local",
+		LocalHost:     "127.0.0.1",
+		AutoLocalPort: true,
+		RemoteHost:    "127.0.0.1",
+		RemotePort:    echoPort,
+		Lazy:          true,
+		IdleTimeoutMs: 200,
+	}, []model.Jumper{{
+		Host:                   host,
+		Port:                   port,
+		User:                   "ops",
+		AuthType:               "password",
+		Password:               "pw",
+		BypassHostVerification: true,
+		TimeoutMs:              2000,
+	}})
+	if err := f.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer f.Stop()
+
+	if state, ok := f.LazyState(); !ok || state != LazyStateListening {
+		t.Fatalf("state after start = %q, %v", state, ok)
+	}
+	if n := sessions.Load(); n != 0 {
+		t.Fatalf("lazy start opened %d ssh sessions", n)
+	}
+	localPort, _ := f.BoundLocalPort()
+	localAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort))
+
+	roundTrip := func() {
+		t.Helper()
+		conn, err := net.Dial("tcp", localAddr)
+		if err != nil {
+			t.Fatalf("dial tunnel: %v", err)
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+			t.Fatalf("echo = %q, %v", buf, err)
+		}
+		if state, _ := f.LazyState(); state != LazyStateConnected {
+			t.Fatalf("state with an open connection = %q", state)
+		}
+	}
+
+	roundTrip()
+	waitLazyState(t, f, LazyStateListening)
+	if n := sessions.Load(); n != 1 {
+		t.Fatalf("ssh sessions after first use = %d, want 1", n)
+	}
+
+	roundTrip()
+	waitLazyState(t, f, LazyStateListening)
+	if n := sessions.Load(); n != 2 {
+		t.Fatalf("ssh sessions after reuse past idle = %d, want 2", n)
+	}
+}
+
+func TestValidateLazy(t *testing.T) {
+	cases := []struct {
+		name   string
+		tunnel model.Tunnel
+		ok     bool
+	}{
+		{"not lazy", model.Tunnel{Mode: "remote"}, true},
+		{"local", model.Tunnel{Mode: "local", Lazy: true}, true},
+		{"dynamic with idle", model.Tunnel{Mode: "dynamic", Lazy: true, IdleTimeoutMs: 60000}, true},
+		{"remote", model.Tunnel{Mode: "remote", Lazy: true}, false},
+		{"idle too short", model.Tunnel{Mode: "local", Lazy: true, IdleTimeoutMs: 10}, false},
+		{"health check", model.Tunnel{Mode: "local", Lazy: true, HealthCheck: model.TunnelHealthCheck{Type: HealthCheckTCP}}, false},
+	}
+	for _, tc := range cases {
+		if err := ValidateLazy(tc.tunnel); (err == nil) != tc.ok {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+	}
+}
+
+func TestWatchLazyClientClosesChainOnCleanLoss(t *testing.T) {
+	f := NewLocalForward(model.Tunnel{Name: "db", Mode: "local", Lazy: true}, nil)
+	client := &ssh.Client{}
+	var closed atomic.Int32
+	f.setClient(client, func() { closed.Add(1) })
+
+	// Without a stop signal the wait ends at once and reports no error.
+	f.watchLazyClient(client)
+	if closed.Load() != 1 {
+		t.Fatalf("chain closed %d times, want 1", closed.Load())
+	}
+	if state, _ := f.LazyState(); state != LazyStateListening || f.client != nil {
+		t.Fatalf("state = %q, client = %v", state, f.client)
+	}
+}
+
+func TestAcquireLazyConnHoldsClientAgainstIdleDisconnect(t *testing.T) {
+	f := NewLocalForward(model.Tunnel{Name: "db", Mode: "local", Lazy: true}, nil)
+	client := &ssh.Client{}
+	var closed atomic.Int32
+	f.setClient(client, func() { closed.Add(1) })
+
+	if got := f.acquireLazyConn(); got != client {
+		t.Fatalf("acquired client = %v, want the current one", got)
+	}
+	f.idleDisconnect()
+	if closed.Load() != 0 || f.client != client {
+		t.Fatal("idle disconnect closed a client that was handed out")
+	}
+}
@@ -0,0 +1,65 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/portinfo"
+)
+
+// localListenAddr is the address a local or dynamic tunnel listens on.
+// Auto-port tunnels ask the OS for a free port.
+func localListenAddr(tunnel model.Tunnel) string {
+	localHost := strings.TrimSpace(tunnel.LocalHost)
+	if localHost == "" {
+		localHost = "127.0.0.1"
+	}
+	port := tunnel.LocalPort
+	if tunnel.AutoLocalPort {
+		port = 0
+	}
+	return net.JoinHostPort(localHost, strconv.Itoa(port))
+}
+
+// listenLocal listens on addr. When the port is taken, the error names the
+// process holding it where the platform lets us find out.
+func listenLocal(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err == nil {
+		return ln, nil
+	}
+	if owner := portOwner(addr); owner != "" {
+		return nil, fmt.Errorf("%w (in use by %s)", err, owner)
+	}
+	return nil, err
+}
+
+func portOwner(addr string) string {
+	_, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port == 0 {
+		return ""
+	}
+	proc, err := portinfo.ListeningProcess(port)
+	if err != nil {
+		return ""
+	}
+	return proc.String()
+}
+
+// BoundLocalPort returns the local port the running tunnel actually
+// listens on, which differs from the configured one for auto-port tunnels.
+func (f *LocalForward) BoundLocalPort() (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.boundLocalPort <= 0 {
+		return 0, false
+	}
+	return f.boundLocalPort, true
+}
@@ -0,0 +1,35 @@
+package forward
+
+import (
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+
+	"loris-tunnel/internal/model"
+)
+
+func TestLocalListenAddr(t *testing.T) {
+	if got := localListenAddr(model.Tunnel{LocalPort: 8080}); got != "127.0.0.1:8080" {
+		t.Fatalf("default host addr = %q", got)
+	}
+	if got := localListenAddr(model.Tunnel{LocalHost: "::1", LocalPort: 8080, AutoLocalPort: true}); got != "[::1]:0" {
+		t.Fatalf("auto port addr = %q", got)
+	}
+}
+
+func TestListenLocalNamesPortOwner(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	_, err = listenLocal(busy.Addr().String())
+	if err == nil {
+		t.Fatal("listening on a busy port should fail")
+	}
+	if runtime.GOOS == "linux" && !strings.Contains(err.Error(), "in use by") {
+		t.Fatalf("err = %v, want the port owner named", err)
+	}
+}
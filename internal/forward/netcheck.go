@@ -0,0 +1,66 @@
+package forward
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"loris-tunnel/internal/latency"
+)
+
+// DefaultProbeTimeout bounds ProbeConnection when no timeout is given.
+const DefaultProbeTimeout = 3 * time.Second
+
+// ProbeConnection sends a keepalive over the current SSH connection right
+// away instead of waiting for the keepalive ticker. When the probe fails or
+// times out the connection is closed, so the tunnel reconnects (or, for a
+// lazy tunnel, dials again on the next client). It returns nil when there is
+// no connection to probe.
+func (f *LocalForward) ProbeConnection(timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	f.mu.Lock()
+	client := f.client
+	stopping := f.stopping
+	f.mu.Unlock()
+	if client == nil || stopping {
+		return nil
+	}
+
+	type probeResult struct {
+		latency time.Duration
+		err     error
+	}
+	result := make(chan probeResult, 1)
+	go func() {
+		rtt, err := TestJumperLatency(client)
+		result <- probeResult{latency: rtt, err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var probeErr error
+	select {
+	case probe := <-result:
+		if probe.err == nil {
+			f.setLastLatency(probe.latency)
+			f.recordLatency(latency.Sample{Time: time.Now(), Latency: probe.latency})
+			slog.Debug("tunnel probe ok", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "latency", probe.latency.String())
+			return nil
+		}
+		f.recordLatency(latency.Sample{Time: time.Now(), Failed: true})
+		probeErr = fmt.Errorf("probe failed: %w", probe.err)
+	case <-timer.C:
+		f.recordLatency(latency.Sample{Time: time.Now(), TimedOut: true})
+		probeErr = fmt.Errorf("probe timeout after %s", timeout)
+	}
+	if f.isStopping() {
+		return nil
+	}
+
+	slog.Warn("tunnel probe failed, forcing reconnect", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "err", probeErr)
+	_ = client.Close()
+	return probeErr
+}
@@ -0,0 +1,131 @@
+package forward
+
+import (
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/model"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// staleProxy relays TCP to target. After freeze, connections accepted so far
+// swallow their traffic without closing, like a link that died during sleep.
+type staleProxy struct {
+	accepted atomic.Int32
+	frozen   atomic.Int32
+}
+
+func (p *staleProxy) freeze() { p.frozen.Store(p.accepted.Load()) }
+
+func startStaleProxy(t *testing.T, target string) (*staleProxy, string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	p := &staleProxy{}
+	relay := func(gen int32, dst, src net.Conn) {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := src.Read(buf)
+			if err != nil {
+				_ = dst.Close()
+				return
+			}
+			if gen <= p.frozen.Load() {
+				continue
+			}
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				_ = conn.Close()
+				continue
+			}
+			gen := p.accepted.Add(1)
+			go relay(gen, upstream, conn)
+			go relay(gen, conn, upstream)
+		}
+	}()
+	host, portText, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	return p, host, port
+}
+
+func TestProbeConnectionForcesReconnectOfStaleClient(t *testing.T) {
+	sshHost, sshPort, _ := startTestSSHServerWithHandler(t, &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}, directTCPIPServer)
+	proxy, host, port := startStaleProxy(t, net.JoinHostPort(sshHost, strconv.Itoa(sshPort)))
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	f := NewLocalForward(model.Tunnel{
+		ID:            1,
+		Name:          "probe",
+		Mode:          "local",
+		LocalHost:     "127.0.0.1",
+		AutoLocalPort: true,
+		RemoteHost:    "127.0.0.1",
+		RemotePort:    target.Addr().(*net.TCPAddr).Port,
+	}, []model.Jumper{{
+		Host:                   host,
+		Port:                   port,
+		User:                   "ops",
+		AuthType:               "password",
+		Password:               "pw",
+		BypassHostVerification: true,
+		TimeoutMs:              2000,
+	}})
+	if err := f.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer f.Stop()
+
+	if err := f.ProbeConnection(time.Second); err != nil {
+		t.Fatalf("probe of a healthy connection: %v", err)
+	}
+
+	proxy.freeze()
+	if err := f.ProbeConnection(200 * time.Millisecond); err == nil {
+		t.Fatal("probe of a stale connection should fail")
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-f.Events():
+			if !ok {
+				t.Fatalf("tunnel stopped: %v", f.Err())
+			}
+			if event.Type != RuntimeEventReconnected {
+				continue
+			}
+			if err := f.ProbeConnection(time.Second); err != nil {
+				t.Fatalf("probe after reconnect: %v", err)
+			}
+			return
+		case <-timeout:
+			t.Fatal("tunnel did not reconnect after a failed probe")
+		}
+	}
+}
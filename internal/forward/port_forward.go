@@ -16,11 +16,12 @@ import (
 	"sync/atomic"
 	"time"
 
+	"loris-tunnel/internal/latency"
 	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/netproxy"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
-	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 var ErrUnsupportedMode = errors.New("only local, remote and dynamic modes are supported")
@@ -41,13 +42,18 @@ var (
 type RuntimeEventType string
 
 const (
-	RuntimeEventDisconnected RuntimeEventType = "disconnected"
-	RuntimeEventReconnected  RuntimeEventType = "reconnected"
+	RuntimeEventDisconnected    RuntimeEventType = "disconnected"
+	RuntimeEventReconnectFailed RuntimeEventType = "reconnect_failed"
+	RuntimeEventReconnected     RuntimeEventType = "reconnected"
+	RuntimeEventDegraded        RuntimeEventType = "degraded"
+	RuntimeEventRecovered       RuntimeEventType = "recovered"
 )
 
 type RuntimeEvent struct {
 	Type RuntimeEventType
 	Err  error
+	// Attempt numbers reconnect attempts, starting at 1.
+	Attempt int
 }
 
 type LocalForward struct {
@@ -65,10 +71,25 @@ type LocalForward struct {
 	events      chan RuntimeEvent
 	keepStop    chan struct{}
 	lastLatency time.Duration
+	certExpiry  []certExpiry
 	bytesUp     atomic.Uint64
 	bytesDown   atomic.Uint64
 	stopOnce    sync.Once
 	wg          sync.WaitGroup
+
+	serving         bool
+	boundLocalPort  int
+	lazyState       string
+	activeConns     int
+	idleTimer       *time.Timer
+	dialMu          sync.Mutex
+	health          model.TunnelHealth
+	latencyRecorder func(latency.Sample)
+	counters        *Counters
+	openConns       atomic.Int64
+	hookObserver    HookObserver
+	hookWG          sync.WaitGroup
+	stoppedHookOnce sync.Once
 }
 
 func NewLocalForward(tunnel model.Tunnel, jumpers []model.Jumper) *LocalForward {
@@ -104,6 +125,9 @@ func (f *LocalForward) Start() error {
 		"keepalive_interval_ms", f.lastJumper().KeepAliveIntervalMs,
 		"timeout_ms", f.lastJumper().TimeoutMs,
 	)
+	if f.isLazy() {
+		return f.startLazy()
+	}
 
 	client, closeChain, err := dialSSHChain(f.jumpers)
 	if err != nil {
@@ -111,6 +135,12 @@ func (f *LocalForward) Start() error {
 		slog.Error("tunnel initial dial failed", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "err", err)
 		return err
 	}
+	if err := f.runPreStartHook(client); err != nil {
+		closeChain()
+		f.setRunErr(err)
+		slog.Error("tunnel pre-start hook failed", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "err", err)
+		return err
+	}
 	if mode == "local" {
 		probeTimeout := dialTimeoutFromJumper(f.lastJumper())
 		if err := probeRemoteDial(client, f.tunnel.RemoteHost, f.tunnel.RemotePort, probeTimeout); err != nil {
@@ -141,12 +171,8 @@ func (f *LocalForward) Start() error {
 			return err
 		}
 	} else {
-		localHost := strings.TrimSpace(f.tunnel.LocalHost)
-		if localHost == "" {
-			localHost = "127.0.0.1"
-		}
-		localAddr := net.JoinHostPort(localHost, strconv.Itoa(f.tunnel.LocalPort))
-		ln, err = net.Listen("tcp", localAddr)
+		localAddr := localListenAddr(f.tunnel)
+		ln, err = listenLocal(localAddr)
 		if err != nil {
 			closeChain()
 			runErr := fmt.Errorf("listen %s failed: %w", localAddr, err)
@@ -160,13 +186,26 @@ func (f *LocalForward) Start() error {
 	f.client = client
 	f.clientClose = closeChain
 	f.listener = ln
+	if mode != "remote" {
+		if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+			// Hooks and the runtime status report the port actually bound.
+			f.tunnel.LocalPort = addr.Port
+			f.boundLocalPort = addr.Port
+		}
+	}
 	f.lastLatency = 0
+	f.serving = true
 	done := f.done
+	keepStop := f.keepStop
 	f.mu.Unlock()
 
-	if latency, latencyErr := TestJumperLatency(client); latencyErr == nil {
-		f.setLastLatency(latency)
+	if rtt, latencyErr := TestJumperLatency(client); latencyErr == nil {
+		f.setLastLatency(rtt)
+		f.recordLatency(latency.Sample{Time: time.Now(), Latency: rtt})
+	} else {
+		f.recordLatency(latency.Sample{Time: time.Now(), Failed: true})
 	}
+	f.refreshCertificateExpiry()
 
 	if mode == "remote" {
 		go f.serveRemote(done)
@@ -174,6 +213,10 @@ func (f *LocalForward) Start() error {
 		go f.serveLocal(done)
 	}
 	go f.monitorClientLifecycle(client)
+	if f.tunnel.HealthCheck.Type != "" {
+		go f.monitorHealth(keepStop)
+	}
+	f.runLocalHookAsync(HookStarted, nil)
 	return nil
 }
 
@@ -187,9 +230,14 @@ func (f *LocalForward) Stop() error {
 		closeClient := f.clientClose
 		done := f.done
 		keepStop := f.keepStop
+		serving := f.serving
 		f.listener = nil
 		f.client = nil
 		f.clientClose = nil
+		if f.idleTimer != nil {
+			f.idleTimer.Stop()
+			f.idleTimer = nil
+		}
 		f.mu.Unlock()
 
 		if keepStop != nil {
@@ -207,6 +255,9 @@ func (f *LocalForward) Stop() error {
 			<-done
 		}
 		f.wg.Wait()
+		if serving {
+			f.runStoppedHook(nil)
+		}
 	})
 	return nil
 }
@@ -238,6 +289,30 @@ func (f *LocalForward) LastLatency() (time.Duration, bool) {
 	return f.lastLatency, true
 }
 
+// Warnings returns runtime notices for the tunnel, such as user certificates
+// that are expired or will expire before a reconnect could complete.
+func (f *LocalForward) Warnings() []string {
+	f.mu.Lock()
+	expiries := append([]certExpiry(nil), f.certExpiry...)
+	f.mu.Unlock()
+	return certificateWarnings(expiries, time.Now(), reconnectTimeout)
+}
+
+func (f *LocalForward) refreshCertificateExpiry() {
+	expiries := collectCertificateExpiries(f.jumpers)
+	for _, warning := range certificateWarnings(expiries, time.Now(), reconnectTimeout) {
+		slog.Warn("tunnel certificate warning", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "warning", warning)
+	}
+	f.mu.Lock()
+	f.certExpiry = expiries
+	f.mu.Unlock()
+}
+
+// Name returns the name of the tunnel being forwarded.
+func (f *LocalForward) Name() string {
+	return f.tunnel.Name
+}
+
 func (f *LocalForward) Traffic() (up, down uint64) {
 	return f.bytesUp.Load(), f.bytesDown.Load()
 }
@@ -312,10 +387,26 @@ func (f *LocalForward) serveRemote(done chan struct{}) {
 }
 
 func (f *LocalForward) handleConn(localConn net.Conn) {
-	f.mu.Lock()
-	client := f.client
-	f.mu.Unlock()
-
+	f.openConns.Add(1)
+	defer f.openConns.Add(-1)
+
+	var client *ssh.Client
+	if f.isLazy() {
+		client = f.acquireLazyConn()
+		defer f.releaseLazyConn()
+		if client == nil {
+			var err error
+			if client, err = f.lazyClient(); err != nil {
+				f.countDialFailure()
+				_ = localConn.Close()
+				return
+			}
+		}
+	} else {
+		f.mu.Lock()
+		client = f.client
+		f.mu.Unlock()
+	}
 	if client == nil {
 		_ = localConn.Close()
 		return
@@ -336,6 +427,7 @@ func (f *LocalForward) handleLocalConn(localConn net.Conn, client *ssh.Client) {
 	remoteAddr := net.JoinHostPort(strings.TrimSpace(f.tunnel.RemoteHost), strconv.Itoa(f.tunnel.RemotePort))
 	remoteConn, err := client.Dial("tcp", remoteAddr)
 	if err != nil {
+		f.countDialFailure()
 		_ = localConn.Close()
 		return
 	}
@@ -352,6 +444,7 @@ func (f *LocalForward) handleDynamicConn(localConn net.Conn, client *ssh.Client)
 
 	remoteConn, err := client.Dial("tcp", targetAddr)
 	if err != nil {
+		f.countDialFailure()
 		_ = writeSOCKS5Reply(localConn, socksReplyGeneralFailure)
 		_ = localConn.Close()
 		return
@@ -374,6 +467,7 @@ func (f *LocalForward) handleRemoteConn(remoteConn net.Conn) {
 	localAddr := net.JoinHostPort(localHost, strconv.Itoa(f.tunnel.LocalPort))
 	localConn, err := net.Dial("tcp", localAddr)
 	if err != nil {
+		f.countDialFailure()
 		_ = remoteConn.Close()
 		return
 	}
@@ -390,10 +484,12 @@ func (f *LocalForward) monitorClientLifecycle(client *ssh.Client) {
 		}
 
 		slog.Warn("tunnel connection lost", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "err", disconnectErr)
+		f.countDisconnect()
 		f.emitEvent(RuntimeEvent{
 			Type: RuntimeEventDisconnected,
 			Err:  disconnectErr,
 		})
+		f.runLocalHookAsync(HookDisconnected, disconnectErr)
 		f.setClient(nil, nil)
 
 		reconnectedClient, reconnectClose, reconnectErr := f.reconnectWithBackoff()
@@ -401,6 +497,7 @@ func (f *LocalForward) monitorClientLifecycle(client *ssh.Client) {
 			f.setRunErr(fmt.Errorf("%v: %w", disconnectErr, reconnectErr))
 			slog.Error("tunnel reconnect failed", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "err", reconnectErr)
 			f.closeListener()
+			f.runStoppedHook(f.Err())
 			return
 		}
 		if reconnectedClient == nil {
@@ -409,6 +506,7 @@ func (f *LocalForward) monitorClientLifecycle(client *ssh.Client) {
 		f.emitEvent(RuntimeEvent{
 			Type: RuntimeEventReconnected,
 		})
+		f.runLocalHookAsync(HookReconnected, nil)
 		slog.Info("tunnel reconnected", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name)
 		f.setClient(reconnectedClient, reconnectClose)
 		client = reconnectedClient
@@ -503,6 +601,7 @@ func (f *LocalForward) reconnectWithBackoff() (*ssh.Client, func(), error) {
 			return nil, nil, nil
 		}
 		attempt++
+		f.countReconnectAttempt()
 		slog.Info("tunnel reconnect attempt", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "attempt", attempt, "wait", wait.String())
 
 		client, closeChain, err := dialSSHChain(f.jumpers)
@@ -513,17 +612,20 @@ func (f *LocalForward) reconnectWithBackoff() (*ssh.Client, func(), error) {
 					closeChain()
 					lastErr = listenErr
 					slog.Warn("tunnel remote listen rebind failed", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "attempt", attempt, "err", listenErr)
+					f.emitEvent(RuntimeEvent{Type: RuntimeEventReconnectFailed, Err: listenErr, Attempt: attempt})
 					wait = nextReconnectWait(wait)
 					continue
 				}
 				f.replaceListener(ln)
 			}
 			slog.Info("tunnel reconnect succeeded", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "attempt", attempt)
+			f.refreshCertificateExpiry()
 			return client, closeChain, nil
 		}
 
 		lastErr = err
 		slog.Warn("tunnel reconnect failed", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "attempt", attempt, "err", err)
+		f.emitEvent(RuntimeEvent{Type: RuntimeEventReconnectFailed, Err: err, Attempt: attempt})
 		wait = nextReconnectWait(wait)
 	}
 
@@ -625,12 +727,14 @@ func (f *LocalForward) runKeepAliveProbe(
 	case probe := <-result:
 		if probe.err == nil {
 			f.setLastLatency(probe.latency)
+			f.recordLatency(latency.Sample{Time: time.Now(), Latency: probe.latency})
 			slog.Debug("tunnel keepalive probe ok", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name)
 			return true
 		}
 		if f.isStopping() {
 			return false
 		}
+		f.recordLatency(latency.Sample{Time: time.Now(), Failed: true})
 		report(fmt.Errorf("keepalive failed: %w", probe.err))
 		slog.Warn("tunnel keepalive failed", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "err", probe.err)
 		_ = client.Close()
@@ -639,6 +743,7 @@ func (f *LocalForward) runKeepAliveProbe(
 		if f.isStopping() {
 			return false
 		}
+		f.recordLatency(latency.Sample{Time: time.Now(), TimedOut: true})
 		timeoutErr := fmt.Errorf("keepalive timeout after %s", timeout)
 		report(timeoutErr)
 		slog.Warn("tunnel keepalive timeout", "tunnel_id", f.tunnel.ID, "name", f.tunnel.Name, "timeout", timeout.String())
@@ -665,6 +770,23 @@ func (f *LocalForward) setClient(client *ssh.Client, closeFn func()) {
 	}
 }
 
+// SetLatencyRecorder registers fn to receive every latency probe of the
+// tunnel, answered or not. Call it before Start.
+func (f *LocalForward) SetLatencyRecorder(fn func(latency.Sample)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latencyRecorder = fn
+}
+
+func (f *LocalForward) recordLatency(sample latency.Sample) {
+	f.mu.Lock()
+	record := f.latencyRecorder
+	f.mu.Unlock()
+	if record != nil {
+		record(sample)
+	}
+}
+
 func (f *LocalForward) setLastLatency(latency time.Duration) {
 	if latency <= 0 {
 		return
@@ -792,11 +914,27 @@ func (f *LocalForward) Bridge(local, remote net.Conn) {
 }
 
 func dialSSH(jumper model.Jumper) (*ssh.Client, error) {
-	conf, err := makeSSHClientConfig(jumper)
+	return dialSSHRecording(jumper, nil)
+}
+
+// dialSSHRecording is dialSSH that also fills algs, when non-nil, with the
+// algorithms the handshake negotiated.
+func dialSSHRecording(jumper model.Jumper, algs *model.NegotiatedAlgorithms) (*ssh.Client, error) {
+	conf, trace, err := makeSSHClientConfig(jumper)
 	if err != nil {
 		return nil, err
 	}
+	client, err := dialFirstHop(jumper, conf, trace, algs)
+	if err != nil {
+		recordHandshakeFailure(jumper.ID)
+	}
+	return client, trace.annotate(err)
+}
 
+// dialFirstHop connects to the first jumper directly, through its
+// ProxyCommand or through an upstream proxy. trace, when non-nil, receives the
+// handshake deadline so keyboard-interactive prompts can pause it.
+func dialFirstHop(jumper model.Jumper, conf *ssh.ClientConfig, trace *authTrace, algs *model.NegotiatedAlgorithms) (*ssh.Client, error) {
 	host := strings.TrimSpace(jumper.Host)
 	if host == "" {
 		return nil, fmt.Errorf("jumper host is required")
@@ -807,11 +945,78 @@ func dialSSH(jumper model.Jumper) (*ssh.Client, error) {
 	}
 	addr := net.JoinHostPort(host, strconv.Itoa(port))
 
-	client, err := ssh.Dial("tcp", addr, conf)
+	if strings.TrimSpace(jumper.ProxyCommand) != "" {
+		return dialSSHViaProxyCommand(jumper, host, port, addr, conf, trace, algs)
+	}
+
+	if proxy := strings.TrimSpace(jumper.UpstreamProxy); proxy != "" && !strings.EqualFold(proxy, netproxy.ModeDirect) {
+		return dialSSHViaUpstreamProxy(proxy, addr, conf, trace, algs)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, conf.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("ssh dial %s failed: %w", addr, err)
+	}
+	cconn, chans, reqs, err := ssh.NewClientConn(newKexInitSniffer(conn, algs), addr, conf)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("ssh dial %s failed: %w", addr, err)
+	}
+	return ssh.NewClient(cconn, chans, reqs), nil
+}
+
+// dialSSHViaUpstreamProxy opens the first TCP connection through an HTTP
+// CONNECT or SOCKS5 proxy and performs the SSH handshake over it.
+func dialSSHViaUpstreamProxy(proxy, addr string, conf *ssh.ClientConfig, trace *authTrace, algs *model.NegotiatedAlgorithms) (*ssh.Client, error) {
+	dialer, err := netproxy.New(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("upstream proxy: %w", err)
+	}
+	conn, err := dialer.DialTimeout("tcp", addr, conf.Timeout)
 	if err != nil {
 		return nil, fmt.Errorf("ssh dial %s failed: %w", addr, err)
 	}
-	return client, nil
+
+	if conf.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(conf.Timeout))
+		trace.bindDeadline(conf.Timeout, func(d time.Time) { _ = conn.SetDeadline(d) })
+	}
+	cconn, chans, reqs, err := ssh.NewClientConn(newKexInitSniffer(conn, algs), addr, conf)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("ssh handshake %s via upstream proxy failed: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(cconn, chans, reqs), nil
+}
+
+// dialSSHViaProxyCommand runs the jumper's ProxyCommand and performs the SSH
+// handshake over its stdio. The process lives as long as the returned client.
+func dialSSHViaProxyCommand(jumper model.Jumper, host string, port int, addr string, conf *ssh.ClientConfig, trace *authTrace, algs *model.NegotiatedAlgorithms) (*ssh.Client, error) {
+	conn, err := dialProxyCommand(jumper.ProxyCommand, host, port, strings.TrimSpace(jumper.User))
+	if err != nil {
+		return nil, fmt.Errorf("ssh dial %s via proxy command failed: %w", addr, err)
+	}
+
+	// Pipes have no deadlines, so bound the handshake by closing the process.
+	timer := time.AfterFunc(conf.Timeout, func() { _ = conn.Close() })
+	trace.bindDeadline(conf.Timeout, func(d time.Time) {
+		if d.IsZero() {
+			timer.Stop()
+			return
+		}
+		timer.Reset(time.Until(d))
+	})
+	cconn, chans, reqs, err := ssh.NewClientConn(newKexInitSniffer(conn, algs), addr, conf)
+	timer.Stop()
+	if err != nil {
+		_ = conn.Close()
+		if stderr := conn.Stderr(); stderr != "" {
+			return nil, fmt.Errorf("ssh handshake %s via proxy command failed: %w (proxy stderr: %s)", addr, err, stderr)
+		}
+		return nil, fmt.Errorf("ssh handshake %s via proxy command failed: %w", addr, err)
+	}
+	return ssh.NewClient(cconn, chans, reqs), nil
 }
 
 // ExecuteRemoteCommand runs one shell command on the last hop of an SSH chain.
@@ -826,9 +1031,9 @@ func ExecuteRemoteCommand(jumpers []model.Jumper, command string) (string, strin
 	}
 	defer closeChain()
 
-	session, err := client.NewSession()
+	session, err := newChainSession(client, jumpers)
 	if err != nil {
-		return "", "", fmt.Errorf("create ssh session failed: %w", err)
+		return "", "", err
 	}
 	defer session.Close()
 
@@ -844,15 +1049,33 @@ func ExecuteRemoteCommand(jumpers []model.Jumper, command string) (string, strin
 }
 
 func dialSSHChain(jumpers []model.Jumper) (*ssh.Client, func(), error) {
+	return dialSSHChainRecording(jumpers, nil)
+}
+
+// dialSSHChainRecording is dialSSHChain that also records the algorithms
+// negotiated with each hop into algs, which must then have one element per
+// jumper.
+func dialSSHChainRecording(jumpers []model.Jumper, algs []model.NegotiatedAlgorithms) (*ssh.Client, func(), error) {
 	if len(jumpers) == 0 {
 		return nil, nil, fmt.Errorf("at least one jumper is required")
 	}
+	hopAlgorithms := func(i int) *model.NegotiatedAlgorithms {
+		if algs == nil {
+			return nil
+		}
+		algs[i].Jumper = jumperDisplayName(jumpers[i])
+		return &algs[i]
+	}
 
 	clients := make([]*ssh.Client, 0, len(jumpers))
-	first, err := dialSSH(jumpers[0])
+	first, err := dialSSHRecording(jumpers[0], hopAlgorithms(0))
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := enableAgentForwarding(first, jumpers[0]); err != nil {
+		_ = first.Close()
+		return nil, nil, err
+	}
 	clients = append(clients, first)
 	current := first
 
@@ -865,9 +1088,11 @@ func dialSSHChain(jumpers []model.Jumper) (*ssh.Client, func(), error) {
 		})
 	}
 
+	// Later hops are reached through the previous client, so their
+	// ProxyCommand (if any) is ignored, matching how the chain is built.
 	for i := 1; i < len(jumpers); i++ {
 		next := jumpers[i]
-		conf, err := makeSSHClientConfig(next)
+		conf, trace, err := makeSSHClientConfig(next)
 		if err != nil {
 			closeAll()
 			return nil, nil, err
@@ -886,39 +1111,48 @@ func dialSSHChain(jumpers []model.Jumper) (*ssh.Client, func(), error) {
 
 		conn, err := current.Dial("tcp", addr)
 		if err != nil {
+			recordHandshakeFailure(next.ID)
 			closeAll()
 			return nil, nil, fmt.Errorf("ssh dial %s via hop %d failed: %w", addr, i, err)
 		}
 
-		cconn, chans, reqs, err := ssh.NewClientConn(conn, addr, conf)
+		cconn, chans, reqs, err := ssh.NewClientConn(newKexInitSniffer(conn, hopAlgorithms(i)), addr, conf)
 		if err != nil {
+			recordHandshakeFailure(next.ID)
 			_ = conn.Close()
 			closeAll()
-			return nil, nil, fmt.Errorf("ssh handshake %s via hop %d failed: %w", addr, i, err)
+			return nil, nil, fmt.Errorf("ssh handshake %s via hop %d failed: %w", addr, i, trace.annotate(err))
 		}
 
 		client := ssh.NewClient(cconn, chans, reqs)
 		clients = append(clients, client)
 		current = client
+		if err := enableAgentForwarding(client, next); err != nil {
+			closeAll()
+			return nil, nil, err
+		}
 	}
 
 	return current, closeAll, nil
 }
 
-func makeSSHClientConfig(jumper model.Jumper) (*ssh.ClientConfig, error) {
+// makeSSHClientConfig builds the client config for one hop. The returned
+// trace explains authentication failures; pass handshake errors through
+// trace.annotate.
+func makeSSHClientConfig(jumper model.Jumper) (*ssh.ClientConfig, *authTrace, error) {
 	user := strings.TrimSpace(jumper.User)
 	if user == "" {
-		return nil, fmt.Errorf("jumper user is required")
+		return nil, nil, fmt.Errorf("jumper user is required")
 	}
 
-	auth, err := makeAuthMethod(jumper)
+	auth, trace, err := makeAuthMethods(jumper)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	cb, err := makeHostKeyCallback(jumper.BypassHostVerification)
+	cb, err := makeHostKeyCallback(jumper)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	timeout := time.Duration(jumper.TimeoutMs) * time.Millisecond
@@ -928,7 +1162,7 @@ func makeSSHClientConfig(jumper model.Jumper) (*ssh.ClientConfig, error) {
 
 	config := &ssh.ClientConfig{
 		User:            user,
-		Auth:            []ssh.AuthMethod{auth},
+		Auth:            auth,
 		HostKeyCallback: cb,
 		Timeout:         timeout,
 	}
@@ -938,30 +1172,33 @@ func makeSSHClientConfig(jumper model.Jumper) (*ssh.ClientConfig, error) {
 		algorithms := parseHostKeyAlgorithms(jumper.HostKeyAlgorithms)
 		config.HostKeyAlgorithms = algorithms
 	}
+	if err := applyAlgorithmSettings(config, jumper); err != nil {
+		return nil, nil, err
+	}
 
-	return config, nil
+	return config, trace, nil
 }
 
-func makeAuthMethod(jumper model.Jumper) (ssh.AuthMethod, error) {
-	switch strings.TrimSpace(jumper.AuthType) {
-	case "password":
-		if jumper.Password == "" {
-			return nil, fmt.Errorf("password auth requires password")
-		}
-		return ssh.Password(jumper.Password), nil
-	case "ssh_key":
-		signer, err := loadPrivateSigner(jumper.KeyPath, jumper.Password)
-		if err != nil {
-			return nil, err
-		}
-		return ssh.PublicKeys(ensureSignerSupportsLegacyRSA(signer)), nil
-	case "ssh_agent":
-		return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
-			return getSSHAgentSigners(jumper)
-		}), nil
-	default:
-		return nil, fmt.Errorf("unsupported authType: %s", jumper.AuthType)
+// keyFileSigners loads the jumper's key file, preceded by its certificate
+// signer when a certificate is configured or discovered.
+func keyFileSigners(jumper model.Jumper) ([]ssh.Signer, error) {
+	signer, err := loadPrivateSigner(jumper.KeyPath, jumper.Password)
+	if err != nil {
+		return nil, err
 	}
+	signer = ensureSignerSupportsLegacyRSA(signer)
+	cert, err := jumperCertificate(jumper)
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		return []ssh.Signer{signer}, nil
+	}
+	certSigner, ok := certSignerFor(cert, signer)
+	if !ok {
+		return nil, fmt.Errorf("certificate does not match key file %s", strings.TrimSpace(jumper.KeyPath))
+	}
+	return []ssh.Signer{certSigner, signer}, nil
 }
 
 func getSSHAgentSigners(jumper model.Jumper) ([]ssh.Signer, error) {
@@ -990,6 +1227,24 @@ func getSSHAgentSigners(jumper model.Jumper) ([]ssh.Signer, error) {
 	for i := range signers {
 		signers[i] = ensureSignerSupportsLegacyRSA(signers[i])
 	}
+	if strings.TrimSpace(jumper.CertificatePath) != "" {
+		cert, err := loadUserCertificate(jumper.CertificatePath)
+		if err != nil {
+			return nil, err
+		}
+		paired := false
+		for _, signer := range signers {
+			if certSigner, ok := certSignerFor(cert, signer); ok {
+				signers = append([]ssh.Signer{certSigner}, signers...)
+				paired = true
+				break
+			}
+		}
+		if !paired {
+			return nil, fmt.Errorf("ssh agent holds no key matching certificate %s; selected socket=%s", strings.TrimSpace(jumper.CertificatePath), sock)
+		}
+	}
+	preferCertificateSigners(signers)
 	return signers, nil
 }
 
@@ -1016,24 +1271,6 @@ func ensureSignerSupportsLegacyRSA(signer ssh.Signer) ssh.Signer {
 	return compatibleSigner
 }
 
-func makeHostKeyCallback(bypass bool) (ssh.HostKeyCallback, error) {
-	if bypass {
-		return ssh.InsecureIgnoreHostKey(), nil
-	}
-
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("resolve home dir failed: %w", err)
-	}
-	knownHostsPath := filepath.Join(home, ".ssh", "known_hosts")
-
-	cb, err := knownhosts.New(knownHostsPath)
-	if err != nil {
-		return nil, fmt.Errorf("known_hosts load failed (%s): %w", knownHostsPath, err)
-	}
-	return cb, nil
-}
-
 func loadPrivateSigner(keyPath, passphrase string) (ssh.Signer, error) {
 	resolvedPath, err := resolveKeyPath(keyPath)
 	if err != nil {
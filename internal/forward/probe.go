@@ -35,59 +35,57 @@ func TestJumperConnection(jumper model.Jumper) error {
 	return client.Close()
 }
 
-// TestTunnelConnection verifies tunnel prerequisites and target reachability.
+// TestTunnelConnection verifies tunnel prerequisites and target reachability,
+// returning the latency and the algorithms negotiated with each hop.
 // Currently it supports "local", "remote" and "dynamic" modes only.
-func TestTunnelConnection(tunnel model.Tunnel, jumpers []model.Jumper) (time.Duration, error) {
+func TestTunnelConnection(tunnel model.Tunnel, jumpers []model.Jumper) (time.Duration, []model.NegotiatedAlgorithms, error) {
 	mode := strings.TrimSpace(tunnel.Mode)
 	if mode == "" {
 		mode = "local"
 	}
 	if mode != "local" && mode != "remote" && mode != "dynamic" {
-		return 0, fmt.Errorf("mode %s test is not supported yet", mode)
+		return 0, nil, fmt.Errorf("mode %s test is not supported yet", mode)
 	}
 
 	if mode == "local" || mode == "dynamic" {
-		localHost := strings.TrimSpace(tunnel.LocalHost)
-		if localHost == "" {
-			localHost = "127.0.0.1"
-		}
-		localAddr := net.JoinHostPort(localHost, strconv.Itoa(tunnel.LocalPort))
-		ln, err := net.Listen("tcp", localAddr)
+		localAddr := localListenAddr(tunnel)
+		ln, err := listenLocal(localAddr)
 		if err != nil {
-			return 0, fmt.Errorf("local listen %s failed: %w", localAddr, err)
+			return 0, nil, fmt.Errorf("local listen %s failed: %w", localAddr, err)
 		}
 		_ = ln.Close()
 	}
 
-	client, closeChain, err := dialSSHChain(jumpers)
+	algs := make([]model.NegotiatedAlgorithms, len(jumpers))
+	client, closeChain, err := dialSSHChainRecording(jumpers, algs)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 	defer closeChain()
 
 	latency, err := TestJumperLatency(client)
 	if err != nil {
-		return 0, fmt.Errorf("measure ssh latency failed: %w", err)
+		return 0, nil, fmt.Errorf("measure ssh latency failed: %w", err)
 	}
 
 	if mode == "dynamic" {
 		if err := probeDynamicForwardCapability(client); err != nil {
-			return 0, err
+			return 0, nil, err
 		}
-		return latency, nil
+		return latency, algs, nil
 	}
 	if mode == "remote" {
 		if err := probeRemoteListen(client, tunnel.RemoteHost, tunnel.RemotePort); err != nil {
-			return 0, err
+			return 0, nil, err
 		}
-		return latency, nil
+		return latency, algs, nil
 	}
 
 	timeout := dialTimeoutFromJumpers(jumpers)
 	if err := probeRemoteDial(client, tunnel.RemoteHost, tunnel.RemotePort, timeout); err != nil {
-		return 0, err
+		return 0, nil, err
 	}
-	return latency, nil
+	return latency, algs, nil
 }
 
 func dialTimeoutFromJumpers(jumpers []model.Jumper) time.Duration {
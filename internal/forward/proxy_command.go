@@ -0,0 +1,176 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const proxyCommandStderrLimit = 2048
+
+// expandProxyCommand applies the OpenSSH-style %h/%p/%r/%% tokens to command.
+// Unknown tokens are kept verbatim so the shell sees what the user typed.
+func expandProxyCommand(command, host string, port int, user string) string {
+	var b strings.Builder
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		if c != '%' || i+1 >= len(command) {
+			b.WriteByte(c)
+			continue
+		}
+		switch command[i+1] {
+		case 'h':
+			b.WriteString(host)
+		case 'p':
+			b.WriteString(strconv.Itoa(port))
+		case 'r':
+			b.WriteString(user)
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte(c)
+			b.WriteByte(command[i+1])
+		}
+		i++
+	}
+	return b.String()
+}
+
+// dialProxyCommand starts command through the platform shell and returns its
+// stdin/stdout as a net.Conn. Closing the conn terminates the process.
+func dialProxyCommand(command, host string, port int, user string) (*proxyCommandConn, error) {
+	expanded := strings.TrimSpace(expandProxyCommand(command, host, port, user))
+	if expanded == "" {
+		return nil, fmt.Errorf("proxy command is empty")
+	}
+
+	cmd := proxyCommandShell(expanded)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("proxy command stdin failed: %w", err)
+	}
+	// Use a plain pipe rather than StdoutPipe: Wait closes the latter as soon
+	// as the process exits, which could drop bytes the SSH layer has not read.
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		_ = stdin.Close()
+		return nil, fmt.Errorf("proxy command stdout failed: %w", err)
+	}
+	cmd.Stdout = stdoutWriter
+	stderr := &tailBuffer{limit: proxyCommandStderrLimit}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		_ = stdin.Close()
+		_ = stdout.Close()
+		_ = stdoutWriter.Close()
+		return nil, fmt.Errorf("start proxy command failed: %w", err)
+	}
+	_ = stdoutWriter.Close()
+	slog.Debug("proxy command started", "host", host, "port", port, "pid", cmd.Process.Pid)
+
+	conn := &proxyCommandConn{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		addr:   proxyCommandAddr(expanded),
+		exited: make(chan struct{}),
+	}
+	go conn.wait()
+	return conn, nil
+}
+
+// proxyCommandConn adapts a child process's stdio to net.Conn so it can carry
+// an SSH transport. Deadlines are not supported by pipes and are ignored.
+type proxyCommandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr *tailBuffer
+	addr   proxyCommandAddr
+
+	exited    chan struct{}
+	waitErr   error
+	closeOnce sync.Once
+}
+
+func (c *proxyCommandConn) wait() {
+	c.waitErr = c.cmd.Wait()
+	close(c.exited)
+	if c.waitErr != nil {
+		slog.Debug("proxy command exited", "command", string(c.addr), "err", c.waitErr, "stderr", c.stderr.String())
+	}
+}
+
+func (c *proxyCommandConn) Read(b []byte) (int, error) {
+	n, err := c.stdout.Read(b)
+	if errors.Is(err, os.ErrClosed) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+func (c *proxyCommandConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+func (c *proxyCommandConn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.stdin.Close()
+		select {
+		case <-c.exited:
+		case <-time.After(500 * time.Millisecond):
+			killShellCommand(c.cmd)
+			<-c.exited
+		}
+		_ = c.stdout.Close()
+	})
+	return nil
+}
+
+// Stderr returns the tail of the process's stderr for error reporting.
+func (c *proxyCommandConn) Stderr() string {
+	return strings.TrimSpace(c.stderr.String())
+}
+
+func (c *proxyCommandConn) LocalAddr() net.Addr  { return c.addr }
+func (c *proxyCommandConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *proxyCommandConn) SetDeadline(_ time.Time) error      { return nil }
+func (c *proxyCommandConn) SetReadDeadline(_ time.Time) error  { return nil }
+func (c *proxyCommandConn) SetWriteDeadline(_ time.Time) error { return nil }
+
+type proxyCommandAddr string
+
+func (a proxyCommandAddr) Network() string { return "proxycommand" }
+func (a proxyCommandAddr) String() string  { return string(a) }
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.limit; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
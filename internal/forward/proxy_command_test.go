@@ -0,0 +1,75 @@
+package forward
+
+import (
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestExpandProxyCommand(t *testing.T) {
+	cases := []struct {
+		command string
+		want    string
+	}{
+		{command: "nc %h %p", want: "nc bastion.example.com 2222"},
+		{command: "aws ssm start-session --target %h --parameters portNumber=%p", want: "aws ssm start-session --target bastion.example.com --parameters portNumber=2222"},
+		{command: "connect -u %r %h:%p", want: "connect -u ops bastion.example.com:2222"},
+		{command: "echo 100%% %x", want: "echo 100% %x"},
+		{command: "trailing %", want: "trailing %"},
+	}
+	for _, tc := range cases {
+		if got := expandProxyCommand(tc.command, "bastion.example.com", 2222, "ops"); got != tc.want {
+			t.Fatalf("expandProxyCommand(%q) = %q, want %q", tc.command, got, tc.want)
+		}
+	}
+}
+
+func TestProxyCommandConnRoundTrip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses cat")
+	}
+	conn, err := dialProxyCommand("cat", "ignored", 22, "root")
+	if err != nil {
+		t.Fatalf("dialProxyCommand: %v", err)
+	}
+
+	payload := []byte("SSH-2.0-probe\r\n")
+	if _, err := conn.Write(payload); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, len(payload))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(buf) != string(payload) {
+		t.Fatalf("echo = %q, want %q", buf, payload)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	select {
+	case <-conn.exited:
+	default:
+		t.Fatal("proxy command still running after Close")
+	}
+}
+
+func TestProxyCommandConnReportsExit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	conn, err := dialProxyCommand("echo boom >&2; exit 3", "ignored", 22, "root")
+	if err != nil {
+		t.Fatalf("dialProxyCommand: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("read until EOF: %v", err)
+	}
+	<-conn.exited
+	if got := conn.Stderr(); got != "boom" {
+		t.Fatalf("stderr = %q, want boom", got)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package forward
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+func proxyCommandShell(command string) *exec.Cmd {
+	// Like OpenSSH, exec the command so the shell does not linger between us and it.
+	return shellCommand("exec " + command)
+}
+
+// shellCommand runs command through the user's shell in its own process
+// group.
+func shellCommand(command string) *exec.Cmd {
+	shell := strings.TrimSpace(os.Getenv("SHELL"))
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell, "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+func killShellCommand(cmd *exec.Cmd) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	// Kill the whole process group so helpers spawned by the command go too.
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
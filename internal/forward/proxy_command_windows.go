@@ -0,0 +1,28 @@
+//go:build windows
+
+package forward
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func proxyCommandShell(command string) *exec.Cmd {
+	return shellCommand(command)
+}
+
+func shellCommand(command string) *exec.Cmd {
+	cmd := exec.Command("cmd.exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		HideWindow: true,
+		CmdLine:    `cmd.exe /C ` + command,
+	}
+	return cmd
+}
+
+func killShellCommand(cmd *exec.Cmd) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	_ = cmd.Process.Kill()
+}
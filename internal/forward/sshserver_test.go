@@ -0,0 +1,66 @@
+package forward
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startTestSSHServer runs an in-process SSH server that completes handshakes
+// with config and then drops every channel. It returns the listen host/port
+// and the server's host key.
+func startTestSSHServer(t *testing.T, config *ssh.ServerConfig) (string, int, ssh.PublicKey) {
+	t.Helper()
+	return startTestSSHServerWithHandler(t, config, func(_ *ssh.ServerConn, chans <-chan ssh.NewChannel) {
+		for ch := range chans {
+			_ = ch.Reject(ssh.Prohibited, "test server")
+		}
+	})
+}
+
+// startTestSSHServerWithHandler is startTestSSHServer with the channels of
+// each connection passed to handle.
+func startTestSSHServerWithHandler(t *testing.T, config *ssh.ServerConfig, handle func(*ssh.ServerConn, <-chan ssh.NewChannel)) (string, int, ssh.PublicKey) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("host signer: %v", err)
+	}
+	config.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				defer sconn.Close()
+				go ssh.DiscardRequests(reqs)
+				handle(sconn, chans)
+			}()
+		}
+	}()
+
+	host, portText, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	return host, port, hostSigner.PublicKey()
+}
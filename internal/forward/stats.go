@@ -0,0 +1,73 @@
+package forward
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Counters accumulates connection events of one tunnel. The owner keeps one
+// per tunnel and hands it to every LocalForward it starts, so the totals
+// survive restarts.
+type Counters struct {
+	// ReconnectAttempts counts dials made while recovering a lost connection.
+	ReconnectAttempts atomic.Uint64
+	// Disconnects counts SSH connections lost while the tunnel was running.
+	Disconnects atomic.Uint64
+	// DialFailures counts forwarded connections that could not be opened.
+	DialFailures atomic.Uint64
+}
+
+var (
+	handshakeMu       sync.Mutex
+	handshakeFailures = make(map[int]uint64)
+)
+
+// HandshakeFailures returns, per jumper ID, how many times connecting to
+// that hop failed since the process started.
+func HandshakeFailures() map[int]uint64 {
+	handshakeMu.Lock()
+	defer handshakeMu.Unlock()
+	out := make(map[int]uint64, len(handshakeFailures))
+	for id, n := range handshakeFailures {
+		out[id] = n
+	}
+	return out
+}
+
+func recordHandshakeFailure(jumperID int) {
+	// Unsaved jumpers being tested from the editor have no ID yet.
+	if jumperID <= 0 {
+		return
+	}
+	handshakeMu.Lock()
+	defer handshakeMu.Unlock()
+	handshakeFailures[jumperID]++
+}
+
+// SetCounters makes the forward record into c. Call it before Start.
+func (f *LocalForward) SetCounters(c *Counters) {
+	f.counters = c
+}
+
+// ActiveConns returns how many forwarded connections are open.
+func (f *LocalForward) ActiveConns() int {
+	return int(f.openConns.Load())
+}
+
+func (f *LocalForward) countReconnectAttempt() {
+	if f.counters != nil {
+		f.counters.ReconnectAttempts.Add(1)
+	}
+}
+
+func (f *LocalForward) countDisconnect() {
+	if f.counters != nil {
+		f.counters.Disconnects.Add(1)
+	}
+}
+
+func (f *LocalForward) countDialFailure() {
+	if f.counters != nil {
+		f.counters.DialFailures.Add(1)
+	}
+}
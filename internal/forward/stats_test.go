@@ -0,0 +1,41 @@
+package forward
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"loris-tunnel/internal/model"
+)
+
+func TestCountersRecordDialAndHandshakeFailures(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+
+	counters := &Counters{}
+	f := NewLocalForward(model.Tunnel{ID: 1, Name: "rev", Mode: "remote", LocalHost: "127.0.0.1", LocalPort: closedPort}, nil)
+	f.SetCounters(counters)
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	f.handleRemoteConn(conn)
+	if got := counters.DialFailures.Load(); got != 1 {
+		t.Fatalf("dial failures = %d, want 1", got)
+	}
+	if got := f.ActiveConns(); got != 0 {
+		t.Fatalf("active conns = %d, want 0", got)
+	}
+
+	jumper := model.Jumper{ID: 4242, Name: "down", Host: "127.0.0.1", Port: closedPort, User: "root", AuthType: "password", Password: "x", TimeoutMs: 500,
+		HostKeyPolicy: HostKeyPolicyAcceptNew, KnownHostsPath: filepath.Join(t.TempDir(), "known_hosts")}
+	before := HandshakeFailures()[jumper.ID]
+	if _, _, err := dialSSHChain([]model.Jumper{jumper}); err == nil {
+		t.Fatal("dial to a closed port succeeded")
+	}
+	if got := HandshakeFailures()[jumper.ID]; got != before+1 {
+		t.Fatalf("handshake failures = %d, want %d", got, before+1)
+	}
+}
@@ -0,0 +1,139 @@
+package hostkeys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// mu serialises edits so concurrent dials and UI actions do not interleave
+// writes to the same file.
+var mu sync.Mutex
+
+// FormatLine formats a known_hosts entry for address ("host:port"), with the
+// host name hashed like `ssh-keygen -H` when hashed is set.
+func FormatLine(address string, key ssh.PublicKey, hashed bool) string {
+	host := knownhosts.Normalize(address)
+	if hashed {
+		host = knownhosts.HashHostname(host)
+	}
+	return knownhosts.Line([]string{host}, key)
+}
+
+// EnsureFile creates file and its directory with private permissions when
+// they do not exist yet.
+func EnsureFile(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return fmt.Errorf("create known_hosts dir failed: %w", err)
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("create known_hosts failed (%s): %w", file, err)
+	}
+	return f.Close()
+}
+
+// Append adds an entry for address to file, creating the file if needed.
+func Append(file, address string, key ssh.PublicKey, hashed bool) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := EnsureFile(file); err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("read known_hosts failed (%s): %w", file, err)
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open known_hosts failed (%s): %w", file, err)
+	}
+	defer f.Close()
+
+	line := FormatLine(address, key, hashed) + "\n"
+	if len(raw) > 0 && raw[len(raw)-1] != '\n' {
+		line = "\n" + line
+	}
+	if _, err := f.WriteString(line); err != nil {
+		return fmt.Errorf("write known_hosts failed (%s): %w", file, err)
+	}
+	return nil
+}
+
+// Remove deletes the entry on line, like `ssh-keygen -R` for a single line.
+// fingerprint must match the key currently on that line.
+func Remove(file string, line int, fingerprint string) error {
+	return editLine(file, line, fingerprint, func(Entry, string) (string, bool) {
+		return "", false
+	})
+}
+
+// Replace swaps the key on line for key, keeping its marker and host patterns
+// (hashed or not). fingerprint must match the key currently on that line.
+func Replace(file string, line int, fingerprint string, key ssh.PublicKey) error {
+	return editLine(file, line, fingerprint, func(entry Entry, text string) (string, bool) {
+		fields := strings.Fields(text)
+		prefix := fields[0]
+		if entry.Marker != "" {
+			prefix = fields[0] + " " + fields[1]
+		}
+		return prefix + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))), true
+	})
+}
+
+// editLine rewrites file with line replaced by the result of edit, or dropped
+// when edit returns false. The file is replaced atomically, keeping its mode.
+func editLine(file string, line int, fingerprint string, edit func(Entry, string) (string, bool)) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("stat known_hosts failed (%s): %w", file, err)
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("read known_hosts failed (%s): %w", file, err)
+	}
+	lines := strings.SplitAfter(string(raw), "\n")
+	if line < 1 || line > len(lines) {
+		return fmt.Errorf("%w: line %d is out of range (%s)", ErrEntryChanged, line, file)
+	}
+	text := strings.TrimRight(lines[line-1], "\r\n")
+	entry, ok := parseLine(text)
+	if !ok || entry.Fingerprint != NormalizeFingerprint(fingerprint) {
+		return fmt.Errorf("%w: line %d of %s no longer holds %s", ErrEntryChanged, line, file, fingerprint)
+	}
+
+	if replacement, keep := edit(entry, strings.TrimSpace(text)); keep {
+		lines[line-1] = replacement + "\n"
+	} else {
+		lines = append(lines[:line-1], lines[line:]...)
+	}
+
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "")), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("write known_hosts failed (%s): %w", tmp, err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("replace known_hosts failed (%s): %w", file, err)
+	}
+	return nil
+}
+
+// NormalizeFingerprint accepts "SHA256:xxx", with any case of the prefix, or
+// the bare base64 part and returns the "SHA256:xxx" form.
+func NormalizeFingerprint(fp string) string {
+	fp = strings.TrimSpace(fp)
+	if strings.HasPrefix(strings.ToUpper(fp), "SHA256:") {
+		return "SHA256:" + fp[len("SHA256:"):]
+	}
+	return "SHA256:" + fp
+}
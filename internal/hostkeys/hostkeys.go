@@ -0,0 +1,160 @@
+// Package hostkeys reads and edits OpenSSH known_hosts files.
+package hostkeys
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Markers that may prefix a known_hosts line.
+const (
+	MarkerCertAuthority = "cert-authority"
+	MarkerRevoked       = "revoked"
+)
+
+// ErrEntryChanged is returned when an edit targets a line that no longer
+// holds the expected key, e.g. because the file was edited meanwhile.
+var ErrEntryChanged = errors.New("known_hosts entry changed")
+
+// Entry is one key line of a known_hosts file.
+type Entry struct {
+	Line int
+	// Marker is "", MarkerCertAuthority or MarkerRevoked.
+	Marker string
+	// Hosts holds the host patterns as written; a hashed entry has a single
+	// "|1|salt|hash" element.
+	Hosts       []string
+	Hashed      bool
+	Key         ssh.PublicKey
+	KeyType     string
+	Fingerprint string
+	Comment     string
+}
+
+// Parse reads all key lines from a known_hosts file. Comments, blank lines and
+// lines that cannot be parsed are skipped. A missing file has no entries.
+func Parse(file string) ([]Entry, error) {
+	raw, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read known_hosts failed (%s): %w", file, err)
+	}
+	return ParseBytes(raw), nil
+}
+
+// ParseBytes parses known_hosts content; see Parse.
+func ParseBytes(raw []byte) []Entry {
+	var out []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if entry, ok := parseLine(scanner.Text()); ok {
+			entry.Line = n
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+func parseLine(line string) (Entry, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Entry{}, false
+	}
+	var entry Entry
+	if strings.HasPrefix(line, "@") {
+		marker, rest, ok := strings.Cut(line, " ")
+		if !ok {
+			return Entry{}, false
+		}
+		switch marker[1:] {
+		case MarkerCertAuthority, MarkerRevoked:
+			entry.Marker = marker[1:]
+		default:
+			return Entry{}, false
+		}
+		line = strings.TrimSpace(rest)
+	}
+	hosts, keyText, ok := strings.Cut(line, " ")
+	if !ok {
+		return Entry{}, false
+	}
+	key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(keyText)))
+	if err != nil {
+		return Entry{}, false
+	}
+	entry.Hosts = strings.Split(hosts, ",")
+	entry.Hashed = strings.HasPrefix(hosts, "|1|")
+	entry.Key = key
+	entry.KeyType = key.Type()
+	entry.Fingerprint = ssh.FingerprintSHA256(key)
+	entry.Comment = comment
+	return entry, true
+}
+
+// Matches reports whether the entry applies to address ("host:port"). Revoked
+// entries apply to every host, as the SSH client rejects a revoked key
+// wherever it is presented.
+func (e Entry) Matches(address string) bool {
+	if e.Marker == MarkerRevoked {
+		return true
+	}
+	host := knownhosts.Normalize(address)
+	if e.Hashed {
+		return len(e.Hosts) == 1 && hashedMatch(e.Hosts[0], host)
+	}
+	matched := false
+	for _, pattern := range e.Hosts {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if !wildcardMatch(pattern, host) {
+			continue
+		}
+		if negate {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+func hashedMatch(encoded, host string) bool {
+	parts := strings.Split(encoded, "|")
+	if len(parts) != 4 || parts[1] != "1" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// wildcardMatch matches OpenSSH host patterns, where '*' and '?' are the only
+// special characters.
+func wildcardMatch(pattern, host string) bool {
+	// path.Match treats '[' and '\' specially; escape them so bracketed
+	// "[host]:port" patterns compare literally.
+	escaped := strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`).Replace(pattern)
+	ok, err := path.Match(escaped, host)
+	return err == nil && ok
+}
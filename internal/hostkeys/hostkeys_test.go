@@ -0,0 +1,113 @@
+package hostkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("public key: %v", err)
+	}
+	return key
+}
+
+func authorized(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestParseMarkersAndMatching(t *testing.T) {
+	plain, ca, revoked, hashed := newTestKey(t), newTestKey(t), newTestKey(t), newTestKey(t)
+	content := strings.Join([]string{
+		"# comment",
+		"bastion.example.com,10.0.0.5 " + authorized(plain) + " ops@laptop",
+		"@cert-authority *.example.com,!db.example.com " + authorized(ca),
+		"@revoked * " + authorized(revoked),
+		knownhosts.HashHostname("[jump.example.com]:2222") + " " + authorized(hashed),
+		"not a valid line",
+		"",
+	}, "\n")
+
+	entries := ParseBytes([]byte(content))
+	if len(entries) != 4 {
+		t.Fatalf("entries = %d, want 4", len(entries))
+	}
+	if e := entries[0]; e.Line != 2 || e.Marker != "" || e.Hashed || e.Comment != "ops@laptop" || e.Fingerprint != ssh.FingerprintSHA256(plain) {
+		t.Fatalf("plain entry = %+v", e)
+	}
+	if entries[1].Marker != MarkerCertAuthority || entries[2].Marker != MarkerRevoked || !entries[3].Hashed {
+		t.Fatalf("markers = %q %q hashed=%v", entries[1].Marker, entries[2].Marker, entries[3].Hashed)
+	}
+
+	cases := []struct {
+		entry   int
+		address string
+		want    bool
+	}{
+		{0, "bastion.example.com:22", true},
+		{0, "10.0.0.5:22", true},
+		{0, "bastion.example.com:2222", false},
+		{1, "web.example.com:22", true},
+		{1, "db.example.com:22", false},
+		{2, "anything.internal:22", true},
+		{3, "jump.example.com:2222", true},
+		{3, "jump.example.com:22", false},
+	}
+	for _, tc := range cases {
+		if got := entries[tc.entry].Matches(tc.address); got != tc.want {
+			t.Errorf("entry %d Matches(%q) = %v, want %v", tc.entry, tc.address, got, tc.want)
+		}
+	}
+}
+
+func TestRemoveAndReplace(t *testing.T) {
+	oldKey, otherKey, newKey := newTestKey(t), newTestKey(t), newTestKey(t)
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	if err := Append(file, "bastion.example.com:22", oldKey, true); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := Append(file, "other.example.com:22", otherKey, false); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	entries, err := Parse(file)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Parse = %d entries, %v", len(entries), err)
+	}
+	hashedHost := entries[0].Hosts[0]
+
+	if err := Replace(file, 1, ssh.FingerprintSHA256(otherKey), newKey); !errors.Is(err, ErrEntryChanged) {
+		t.Fatalf("Replace with stale fingerprint = %v, want ErrEntryChanged", err)
+	}
+	if err := Replace(file, 1, ssh.FingerprintSHA256(oldKey), newKey); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	entries, _ = Parse(file)
+	if entries[0].Hosts[0] != hashedHost || entries[0].Fingerprint != ssh.FingerprintSHA256(newKey) || !entries[0].Matches("bastion.example.com:22") {
+		t.Fatalf("replaced entry = %+v", entries[0])
+	}
+
+	if err := Remove(file, 1, ssh.FingerprintSHA256(newKey)); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	entries, _ = Parse(file)
+	if len(entries) != 1 || entries[0].Line != 1 || entries[0].Fingerprint != ssh.FingerprintSHA256(otherKey) {
+		t.Fatalf("entries after remove = %+v", entries)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("known_hosts mode = %v, %v", info.Mode().Perm(), err)
+	}
+}
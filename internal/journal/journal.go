@@ -0,0 +1,299 @@
+// Package journal keeps a persistent, append-only history of tunnel
+// lifecycle events and config changes as JSON lines in the config
+// directory, rotating the file once it grows past a size limit.
+package journal
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"loris-tunnel/internal/model"
+)
+
+const (
+	FileName = "journal.jsonl"
+
+	// DefaultMaxSize is the size at which the journal rotates.
+	DefaultMaxSize = 4 << 20
+	// DefaultBackups is how many rotated files are kept besides the
+	// current one.
+	DefaultBackups = 3
+)
+
+// Entry types.
+const (
+	TypeStart            = "start"
+	TypeStop             = "stop"
+	TypeError            = "error"
+	TypeDisconnect       = "disconnect"
+	TypeReconnectAttempt = "reconnect_attempt"
+	TypeReconnect        = "reconnect"
+	TypeConfig           = "config"
+	TypeImport           = "import"
+)
+
+// Export formats.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+var ErrUnsupportedFormat = errors.New("export format must be json or csv")
+
+// Journal appends entries to dir/journal.jsonl. A nil *Journal discards
+// everything, so callers need not check whether one was configured.
+type Journal struct {
+	path    string
+	maxSize int64
+	backups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens the journal in dir with the default rotation limits.
+func Open(dir string) (*Journal, error) {
+	return OpenWithLimits(dir, DefaultMaxSize, DefaultBackups)
+}
+
+// OpenWithLimits opens the journal in dir, rotating once the file reaches
+// maxSize bytes and keeping backups rotated files.
+func OpenWithLimits(dir string, maxSize int64, backups int) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create journal dir: %w", err)
+	}
+	j := &Journal{
+		path:    filepath.Join(dir, FileName),
+		maxSize: maxSize,
+		backups: max(backups, 0),
+	}
+	if err := j.openFile(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Path returns the current journal file.
+func (j *Journal) Path() string {
+	if j == nil {
+		return ""
+	}
+	return j.path
+}
+
+// Record appends e, stamping the time when unset. Write failures are logged
+// rather than returned: losing a journal line must not fail the operation
+// being journaled.
+func (j *Journal) Record(e model.JournalEntry) {
+	if j == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if err := j.append(e); err != nil {
+		slog.Warn("journal write failed", "type", e.Type, "err", err)
+	}
+}
+
+func (j *Journal) append(e model.JournalEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return errors.New("journal closed")
+	}
+	if j.maxSize > 0 && j.size > 0 && j.size+int64(len(line)) > j.maxSize {
+		if err := j.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	return err
+}
+
+// rotateLocked shifts journal.N.jsonl to N+1, dropping the oldest, and
+// starts a fresh current file.
+func (j *Journal) rotateLocked() error {
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("close journal: %w", err)
+	}
+	j.file = nil
+	if j.backups == 0 {
+		if err := os.Remove(j.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("rotate journal: %w", err)
+		}
+	} else {
+		_ = os.Remove(j.backupPath(j.backups))
+		for i := j.backups - 1; i >= 1; i-- {
+			if err := os.Rename(j.backupPath(i), j.backupPath(i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("rotate journal: %w", err)
+			}
+		}
+		if err := os.Rename(j.path, j.backupPath(1)); err != nil {
+			return fmt.Errorf("rotate journal: %w", err)
+		}
+	}
+	return j.openFile()
+}
+
+func (j *Journal) openFile() error {
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("open journal: %w", err)
+	}
+	j.file = file
+	j.size = info.Size()
+	return nil
+}
+
+func (j *Journal) backupPath(n int) string {
+	ext := filepath.Ext(j.path)
+	return j.path[:len(j.path)-len(ext)] + "." + strconv.Itoa(n) + ext
+}
+
+// Close closes the journal file; later Records are dropped.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// Query returns the entries matching q, oldest first, reading rotated
+// files before the current one. Lines that fail to parse, such as one cut
+// short by a crash or still being written, are skipped. The files are read
+// without holding up Record, so a rotation during the read may repeat or
+// skip entries.
+func (j *Journal) Query(q model.JournalQuery) ([]model.JournalEntry, error) {
+	if j == nil {
+		return nil, nil
+	}
+	j.mu.Lock()
+	paths := make([]string, 0, j.backups+1)
+	for i := j.backups; i >= 1; i-- {
+		paths = append(paths, j.backupPath(i))
+	}
+	paths = append(paths, j.path)
+	j.mu.Unlock()
+
+	var out []model.JournalEntry
+	for _, path := range paths {
+		entries, err := readMatching(path, q)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, entries...)
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out, nil
+}
+
+func readMatching(path string, q model.JournalQuery) ([]model.JournalEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	defer file.Close()
+
+	var out []model.JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e model.JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if matches(e, q) {
+			out = append(out, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	return out, nil
+}
+
+func matches(e model.JournalEntry, q model.JournalQuery) bool {
+	if q.TunnelID > 0 && e.TunnelID != q.TunnelID {
+		return false
+	}
+	if len(q.Types) > 0 && !slices.Contains(q.Types, e.Type) {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Export writes entries to w as a JSON array or as CSV with a header row.
+func Export(w io.Writer, entries []model.JournalEntry, format string) error {
+	switch format {
+	case FormatJSON:
+		if entries == nil {
+			entries = []model.JournalEntry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"time", "type", "tunnel_id", "tunnel", "message", "error", "attempt"})
+		for _, e := range entries {
+			tunnelID, attempt := "", ""
+			if e.TunnelID > 0 {
+				tunnelID = strconv.Itoa(e.TunnelID)
+			}
+			if e.Attempt > 0 {
+				attempt = strconv.Itoa(e.Attempt)
+			}
+			_ = cw.Write([]string{
+				e.Time.Format(time.RFC3339Nano), e.Type, tunnelID, e.Tunnel, e.Message, e.Error, attempt,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return ErrUnsupportedFormat
+	}
+}
@@ -0,0 +1,178 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/model"
+)
+
+func TestRecordQueryAndRotate(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenWithLimits(dir, 400, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 12; i++ {
+		e := model.JournalEntry{
+			Time:     base.Add(time.Duration(i) * time.Minute),
+			Type:     TypeStart,
+			TunnelID: 1 + i%2,
+			Tunnel:   "db",
+			Message:  "tunnel started",
+		}
+		if i%3 == 0 {
+			e.Type = TypeDisconnect
+			e.Error = "ssh connection closed"
+		}
+		j.Record(e)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "journal.1.jsonl")); err != nil {
+		t.Fatalf("journal did not rotate: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "journal.3.jsonl")); err == nil {
+		t.Fatal("kept more backups than configured")
+	}
+
+	all, err := j.Query(model.JournalQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 || len(all) >= 12 {
+		t.Fatalf("expected the oldest entries rotated away, got %d", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Time.Before(all[i-1].Time) {
+			t.Fatalf("entries out of order at %d", i)
+		}
+	}
+	last := all[len(all)-1]
+	if !last.Time.Equal(base.Add(11 * time.Minute)) {
+		t.Fatalf("newest entry = %v", last.Time)
+	}
+
+	filtered, err := j.Query(model.JournalQuery{
+		TunnelID: 2,
+		Types:    []string{TypeStart, TypeDisconnect},
+		Since:    base.Add(7 * time.Minute),
+		Until:    base.Add(11 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Minute 7 is a tunnel 2 start and 9 a disconnect; 11 is excluded by Until.
+	if len(filtered) != 2 || filtered[0].Time.Minute() != 7 || filtered[1].Time.Minute() != 9 {
+		t.Fatalf("filtered = %+v", filtered)
+	}
+
+	limited, err := j.Query(model.JournalQuery{Limit: 1})
+	if err != nil || len(limited) != 1 || !limited[0].Time.Equal(last.Time) {
+		t.Fatalf("limited = %+v, %v", limited, err)
+	}
+}
+
+func TestQuerySkipsTruncatedLines(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Record(model.JournalEntry{Type: TypeImport, Message: "config imported"})
+	_ = j.Close()
+
+	f, err := os.OpenFile(filepath.Join(dir, FileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"time":"2026-03-01T12:00:00Z","ty`)
+	_ = f.Close()
+
+	j, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	entries, err := j.Query(model.JournalQuery{})
+	if err != nil || len(entries) != 1 || entries[0].Type != TypeImport {
+		t.Fatalf("entries = %+v, %v", entries, err)
+	}
+}
+
+func TestQueryWhileRecording(t *testing.T) {
+	j, err := OpenWithLimits(t.TempDir(), 400, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			j.Record(model.JournalEntry{Type: TypeStart, TunnelID: 1, Message: "tunnel started"})
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		if _, err := j.Query(model.JournalQuery{}); err != nil {
+			t.Fatalf("query while recording: %v", err)
+		}
+	}
+	if got, err := j.Query(model.JournalQuery{}); err != nil || len(got) == 0 {
+		t.Fatalf("query after recording = %d entries, %v", len(got), err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	entries := []model.JournalEntry{
+		{Time: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), Type: TypeReconnectAttempt, TunnelID: 3, Tunnel: "web, prod", Message: "reconnect attempt failed", Error: "dial tcp: refused", Attempt: 2},
+		{Time: time.Date(2026, 3, 1, 12, 5, 0, 0, time.UTC), Type: TypeImport, Message: "config imported"},
+	}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, entries, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][3] != "web, prod" || rows[1][6] != "2" || rows[2][2] != "" {
+		t.Fatalf("csv rows = %q", rows)
+	}
+
+	buf.Reset()
+	if err := Export(&buf, entries, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []model.JournalEntry
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 2 || decoded[0].Attempt != 2 {
+		t.Fatalf("json = %s, %v", buf.String(), err)
+	}
+
+	if err := Export(&buf, entries, "xml"); err != ErrUnsupportedFormat {
+		t.Fatalf("unsupported format err = %v", err)
+	}
+}
+
+func TestNilJournalDiscards(t *testing.T) {
+	var j *Journal
+	j.Record(model.JournalEntry{Type: TypeStart})
+	entries, err := j.Query(model.JournalQuery{})
+	if err != nil || entries != nil || j.Close() != nil {
+		t.Fatalf("nil journal = %v, %v", entries, err)
+	}
+}
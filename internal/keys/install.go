@@ -0,0 +1,53 @@
+package keys
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// InstallAdded and InstallPresent are what InstallCommand prints on
+	// success.
+	InstallAdded   = "added"
+	InstallPresent = "present"
+)
+
+// InstallCommand returns a command that appends authorizedKey to
+// ~/.ssh/authorized_keys on a remote host, like ssh-copy-id. It creates the
+// directory and file with private permissions and does nothing when a line
+// with the same key is already there, whatever its options or comment. The
+// script runs under sh so it works whatever the remote login shell is; it
+// prints InstallAdded or InstallPresent.
+func InstallCommand(authorizedKey string) (string, error) {
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return "", fmt.Errorf("parse public key failed: %w", err)
+	}
+	blob := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	line := blob
+	if comment = strings.Join(strings.Fields(comment), " "); comment != "" {
+		line += " " + comment
+	}
+
+	script := strings.Join([]string{
+		`umask 077`,
+		`dir="$HOME/.ssh"`,
+		`file="$dir/authorized_keys"`,
+		`mkdir -p "$dir" || exit 1`,
+		`touch "$file" || exit 1`,
+		`chmod 700 "$dir"`,
+		`chmod 600 "$file"`,
+		`if grep -qF ` + shellQuote(blob) + ` "$file"; then echo ` + InstallPresent + `; exit 0; fi`,
+		`if [ -s "$file" ] && [ -n "$(tail -c 1 "$file")" ]; then echo >> "$file" || exit 1; fi`,
+		`printf '%s\n' ` + shellQuote(line) + ` >> "$file" || exit 1`,
+		`echo ` + InstallAdded,
+	}, "\n")
+	return "sh -c " + shellQuote(script), nil
+}
+
+// shellQuote single-quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,280 @@
+// Package keys manages SSH key pairs generated by the app and the shell
+// command that installs a public key into a remote authorized_keys file.
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	TypeEd25519 = "ed25519"
+	TypeRSA     = "rsa"
+
+	DefaultRSABits = 3072
+	minRSABits     = 2048
+	maxRSABits     = 8192
+
+	publicKeySuffix = ".pub"
+)
+
+var (
+	ErrInvalidName     = errors.New("key name may only contain letters, digits, '.', '_' and '-'")
+	ErrUnsupportedType = errors.New("key type must be ed25519 or rsa")
+	ErrInvalidRSABits  = fmt.Errorf("rsa key size must be between %d and %d bits", minRSABits, maxRSABits)
+	ErrKeyExists       = errors.New("key already exists")
+	ErrKeyNotFound     = errors.New("key not found")
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Key is a key pair in the managed directory.
+type Key struct {
+	Name           string
+	Type           string
+	Bits           int
+	Fingerprint    string
+	Comment        string
+	PrivateKeyPath string
+	PublicKeyPath  string
+	Encrypted      bool
+	CreatedAt      time.Time
+	AuthorizedKey  string
+}
+
+// GenerateOptions describes a key pair to generate.
+type GenerateOptions struct {
+	Name       string
+	Type       string
+	Bits       int
+	Passphrase string
+	Comment    string
+}
+
+// Generate creates a key pair in dir: the private key in OpenSSH format,
+// encrypted when a passphrase is given, and the public key next to it with a
+// ".pub" suffix. Existing keys are never overwritten.
+func Generate(dir string, opts GenerateOptions) (Key, error) {
+	name := strings.TrimSpace(opts.Name)
+	if !namePattern.MatchString(name) || strings.HasSuffix(name, publicKeySuffix) {
+		return Key{}, ErrInvalidName
+	}
+	comment := strings.Join(strings.Fields(opts.Comment), " ")
+
+	var priv crypto.PrivateKey
+	switch strings.ToLower(strings.TrimSpace(opts.Type)) {
+	case "", TypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return Key{}, fmt.Errorf("generate ed25519 key failed: %w", err)
+		}
+		priv = key
+	case TypeRSA:
+		bits := opts.Bits
+		if bits == 0 {
+			bits = DefaultRSABits
+		}
+		if bits < minRSABits || bits > maxRSABits {
+			return Key{}, ErrInvalidRSABits
+		}
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return Key{}, fmt.Errorf("generate rsa key failed: %w", err)
+		}
+		priv = key
+	default:
+		return Key{}, ErrUnsupportedType
+	}
+
+	var block *pem.Block
+	var err error
+	if opts.Passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, comment, []byte(opts.Passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(priv, comment)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("encode private key failed: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return Key{}, fmt.Errorf("encode public key failed: %w", err)
+	}
+	pub := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	if comment != "" {
+		pub += " " + comment
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return Key{}, fmt.Errorf("create key dir failed: %w", err)
+	}
+	privPath := filepath.Join(dir, name)
+	pubPath := privPath + publicKeySuffix
+	if err := writeNew(privPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		return Key{}, err
+	}
+	if err := writeNew(pubPath, []byte(pub+"\n"), 0o644); err != nil {
+		_ = os.Remove(privPath)
+		return Key{}, err
+	}
+	return Load(dir, name)
+}
+
+func writeNew(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%w: %s", ErrKeyExists, filepath.Base(path))
+		}
+		return fmt.Errorf("write key failed (%s): %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("write key failed (%s): %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("write key failed (%s): %w", path, err)
+	}
+	return nil
+}
+
+// List returns the key pairs in dir sorted by name. A missing directory has
+// no keys; files that are not a readable key pair are skipped.
+func List(dir string) ([]Key, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read key dir failed: %w", err)
+	}
+	var out []Key
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), publicKeySuffix)
+		if !ok || entry.IsDir() || !namePattern.MatchString(name) {
+			continue
+		}
+		key, err := Load(dir, name)
+		if err != nil {
+			continue
+		}
+		out = append(out, key)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Load reads the key pair called name from dir.
+func Load(dir, name string) (Key, error) {
+	if !namePattern.MatchString(name) {
+		return Key{}, ErrInvalidName
+	}
+	privPath := filepath.Join(dir, name)
+	pubPath := privPath + publicKeySuffix
+	pubRaw, err := os.ReadFile(pubPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Key{}, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+		}
+		return Key{}, fmt.Errorf("read public key failed (%s): %w", pubPath, err)
+	}
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey(pubRaw)
+	if err != nil {
+		return Key{}, fmt.Errorf("parse public key failed (%s): %w", pubPath, err)
+	}
+	privRaw, err := os.ReadFile(privPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Key{}, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+		}
+		return Key{}, fmt.Errorf("read private key failed (%s): %w", privPath, err)
+	}
+	info, err := os.Stat(privPath)
+	if err != nil {
+		return Key{}, fmt.Errorf("stat private key failed (%s): %w", privPath, err)
+	}
+
+	encrypted := false
+	if _, err := ssh.ParseRawPrivateKey(privRaw); err != nil {
+		var missing *ssh.PassphraseMissingError
+		if !errors.As(err, &missing) {
+			return Key{}, fmt.Errorf("parse private key failed (%s): %w", privPath, err)
+		}
+		encrypted = true
+	}
+
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		authorized += " " + comment
+	}
+	return Key{
+		Name:           name,
+		Type:           keyType(pub),
+		Bits:           keyBits(pub),
+		Fingerprint:    ssh.FingerprintSHA256(pub),
+		Comment:        comment,
+		PrivateKeyPath: privPath,
+		PublicKeyPath:  pubPath,
+		Encrypted:      encrypted,
+		CreatedAt:      info.ModTime(),
+		AuthorizedKey:  authorized,
+	}, nil
+}
+
+// CheckPassphrase reports whether passphrase opens the private key. An
+// unencrypted key only accepts an empty passphrase.
+func CheckPassphrase(key Key, passphrase string) error {
+	raw, err := os.ReadFile(key.PrivateKeyPath)
+	if err != nil {
+		return fmt.Errorf("read private key failed (%s): %w", key.PrivateKeyPath, err)
+	}
+	if !key.Encrypted {
+		if passphrase != "" {
+			return fmt.Errorf("key %s has no passphrase", key.Name)
+		}
+		return nil
+	}
+	if _, err := ssh.ParseRawPrivateKeyWithPassphrase(raw, []byte(passphrase)); err != nil {
+		return fmt.Errorf("unlock key %s failed: %w", key.Name, err)
+	}
+	return nil
+}
+
+func keyType(pub ssh.PublicKey) string {
+	switch pub.Type() {
+	case ssh.KeyAlgoED25519:
+		return TypeEd25519
+	case ssh.KeyAlgoRSA:
+		return TypeRSA
+	}
+	return pub.Type()
+}
+
+func keyBits(pub ssh.PublicKey) int {
+	cpk, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	switch k := cpk.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case ed25519.PublicKey:
+		return 256
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package keys
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGenerateAndList(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+
+	ed, err := Generate(dir, GenerateOptions{Name: "laptop", Comment: "ops@laptop"})
+	if err != nil {
+		t.Fatalf("Generate ed25519: %v", err)
+	}
+	if ed.Type != TypeEd25519 || ed.Bits != 256 || ed.Encrypted || ed.Comment != "ops@laptop" {
+		t.Fatalf("ed25519 key = %+v", ed)
+	}
+	if !strings.HasPrefix(ed.Fingerprint, "SHA256:") || !strings.HasSuffix(ed.AuthorizedKey, " ops@laptop") {
+		t.Fatalf("ed25519 key = %+v", ed)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(ed.PrivateKeyPath)
+		if err != nil {
+			t.Fatalf("stat private key: %v", err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Fatalf("private key mode = %o", perm)
+		}
+	}
+
+	rsaKey, err := Generate(dir, GenerateOptions{Name: "ci", Type: "rsa", Bits: 2048, Passphrase: "s3cret"})
+	if err != nil {
+		t.Fatalf("Generate rsa: %v", err)
+	}
+	if rsaKey.Type != TypeRSA || rsaKey.Bits != 2048 || !rsaKey.Encrypted {
+		t.Fatalf("rsa key = %+v", rsaKey)
+	}
+	if err := CheckPassphrase(rsaKey, "s3cret"); err != nil {
+		t.Fatalf("CheckPassphrase: %v", err)
+	}
+	if err := CheckPassphrase(rsaKey, "wrong"); err == nil {
+		t.Fatal("wrong passphrase accepted")
+	}
+
+	if _, err := Generate(dir, GenerateOptions{Name: "laptop"}); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("overwrite err = %v, want ErrKeyExists", err)
+	}
+	if _, err := Generate(dir, GenerateOptions{Name: "../escape"}); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("bad name err = %v, want ErrInvalidName", err)
+	}
+	if _, err := Generate(dir, GenerateOptions{Name: "small", Type: "rsa", Bits: 1024}); !errors.Is(err, ErrInvalidRSABits) {
+		t.Fatalf("small rsa err = %v, want ErrInvalidRSABits", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := List(dir)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "ci" || list[1].Name != "laptop" {
+		t.Fatalf("List = %+v", list)
+	}
+	if list[1].Fingerprint != ed.Fingerprint {
+		t.Fatalf("listed fingerprint = %s, want %s", list[1].Fingerprint, ed.Fingerprint)
+	}
+
+	missing, err := List(filepath.Join(dir, "missing"))
+	if err != nil || missing != nil {
+		t.Fatalf("List(missing) = %v, %v", missing, err)
+	}
+}
+
+func TestInstallCommandIsIdempotent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	key, err := Generate(t.TempDir(), GenerateOptions{Name: "id", Comment: "it's me"})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	cmd, err := InstallCommand(key.AuthorizedKey)
+	if err != nil {
+		t.Fatalf("InstallCommand: %v", err)
+	}
+
+	home := t.TempDir()
+	authorized := filepath.Join(home, ".ssh", "authorized_keys")
+	run := func() string {
+		c := exec.Command("sh", "-c", cmd)
+		c.Env = append(os.Environ(), "HOME="+home)
+		out, err := c.CombinedOutput()
+		if err != nil {
+			t.Fatalf("run install: %v\n%s", err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(authorized), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(authorized, []byte("ssh-ed25519 AAAAexisting other"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out := run(); out != InstallAdded {
+		t.Fatalf("first install printed %q", out)
+	}
+	if out := run(); out != InstallPresent {
+		t.Fatalf("second install printed %q", out)
+	}
+
+	raw, err := os.ReadFile(authorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ssh-ed25519 AAAAexisting other\n" + key.AuthorizedKey + "\n"
+	if string(raw) != want {
+		t.Fatalf("authorized_keys = %q, want %q", raw, want)
+	}
+	info, err := os.Stat(authorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("authorized_keys mode = %o", perm)
+	}
+}
@@ -0,0 +1,181 @@
+// Package latency keeps bounded histories of SSH round-trip samples per
+// tunnel and per jumper and summarises them.
+package latency
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLimit keeps an hour of samples at the default 5s keepalive.
+const DefaultLimit = 720
+
+// Sample is one latency probe. Latency is only meaningful when the probe
+// neither failed nor timed out.
+type Sample struct {
+	Time     time.Time
+	Latency  time.Duration
+	Failed   bool
+	TimedOut bool
+}
+
+// Stats summarises a run of samples. Min, Avg, P95 and Jitter only count
+// answered probes; Jitter is the mean difference between consecutive ones.
+type Stats struct {
+	Count    int
+	Failures int
+	Timeouts int
+	Min      time.Duration
+	Avg      time.Duration
+	P95      time.Duration
+	Jitter   time.Duration
+}
+
+// Summarize computes Stats for samples in time order.
+func Summarize(samples []Sample) Stats {
+	stats := Stats{Count: len(samples)}
+	ok := make([]time.Duration, 0, len(samples))
+	var sum, jitterSum time.Duration
+	var prev time.Duration
+	havePrev := false
+	for _, s := range samples {
+		switch {
+		case s.TimedOut:
+			stats.Timeouts++
+			continue
+		case s.Failed:
+			stats.Failures++
+			continue
+		}
+		ok = append(ok, s.Latency)
+		sum += s.Latency
+		if havePrev {
+			d := s.Latency - prev
+			if d < 0 {
+				d = -d
+			}
+			jitterSum += d
+		}
+		prev = s.Latency
+		havePrev = true
+	}
+	if len(ok) == 0 {
+		return stats
+	}
+
+	stats.Avg = sum / time.Duration(len(ok))
+	if len(ok) > 1 {
+		stats.Jitter = jitterSum / time.Duration(len(ok)-1)
+	}
+	sort.Slice(ok, func(i, j int) bool { return ok[i] < ok[j] })
+	stats.Min = ok[0]
+	// Nearest-rank percentile.
+	rank := int(math.Ceil(0.95*float64(len(ok)))) - 1
+	stats.P95 = ok[rank]
+	return stats
+}
+
+// History is a bounded, time-ordered list of samples safe for concurrent
+// use.
+type History struct {
+	mu      sync.Mutex
+	limit   int
+	samples []Sample
+}
+
+func NewHistory(limit int) *History {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return &History{limit: limit}
+}
+
+// Add appends s, dropping the oldest sample when the history is full.
+func (h *History) Add(s Sample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples = append(h.samples, s)
+	if over := len(h.samples) - h.limit; over > 0 {
+		h.samples = append(h.samples[:0:0], h.samples[over:]...)
+	}
+}
+
+// Since returns the samples taken at or after since, oldest first. A zero
+// since returns them all.
+func (h *History) Since(since time.Time) []Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	start := sort.Search(len(h.samples), func(i int) bool {
+		return !h.samples[i].Time.Before(since)
+	})
+	return append([]Sample(nil), h.samples[start:]...)
+}
+
+// Registry holds a history per tunnel, each sample covering the tunnel's
+// whole chain, and an aggregate per jumper fed by the tunnels whose samples
+// measure that jumper alone.
+type Registry struct {
+	mu      sync.Mutex
+	limit   int
+	tunnels map[int]*History
+	jumpers map[int]*History
+}
+
+func NewRegistry(limit int) *Registry {
+	return &Registry{
+		limit:   limit,
+		tunnels: make(map[int]*History),
+		jumpers: make(map[int]*History),
+	}
+}
+
+// Record adds s to the tunnel's history and the jumper's aggregate. An id
+// <= 0 skips that history.
+func (r *Registry) Record(tunnelID, jumperID int, s Sample) {
+	if tunnelID > 0 {
+		r.history(r.tunnels, tunnelID).Add(s)
+	}
+	if jumperID > 0 {
+		r.history(r.jumpers, jumperID).Add(s)
+	}
+}
+
+func (r *Registry) history(m map[int]*History, id int) *History {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := m[id]
+	if !ok {
+		h = NewHistory(r.limit)
+		m[id] = h
+	}
+	return h
+}
+
+// Tunnel returns the tunnel's samples taken at or after since.
+func (r *Registry) Tunnel(id int, since time.Time) []Sample {
+	return r.lookup(r.tunnels, id, since)
+}
+
+// Jumper returns the jumper's aggregated samples taken at or after since.
+func (r *Registry) Jumper(id int, since time.Time) []Sample {
+	return r.lookup(r.jumpers, id, since)
+}
+
+func (r *Registry) lookup(m map[int]*History, id int, since time.Time) []Sample {
+	r.mu.Lock()
+	h, ok := m[id]
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return h.Since(since)
+}
+
+// ForgetTunnel drops a deleted tunnel's history.
+func (r *Registry) ForgetTunnel(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tunnels, id)
+}
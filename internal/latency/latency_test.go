@@ -0,0 +1,78 @@
+package latency
+
+import (
+	"testing"
+	"time"
+)
+
+func ms(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+func TestSummarize(t *testing.T) {
+	base := time.Now()
+	var samples []Sample
+	for i, l := range []int{10, 30, 20, 40, 100, 10, 20, 30, 20, 20} {
+		samples = append(samples, Sample{Time: base.Add(time.Duration(i) * time.Second), Latency: ms(l)})
+	}
+	samples = append(samples,
+		Sample{Time: base.Add(11 * time.Second), Failed: true},
+		Sample{Time: base.Add(12 * time.Second), TimedOut: true},
+		Sample{Time: base.Add(13 * time.Second), TimedOut: true},
+	)
+
+	got := Summarize(samples)
+	want := Stats{
+		Count:    13,
+		Failures: 1,
+		Timeouts: 2,
+		Min:      ms(10),
+		Avg:      ms(30),
+		P95:      ms(100),
+		// |30-10|+|20-30|+|40-20|+|100-40|+|10-100|+|20-10|+|30-20|+|20-30|+|20-20| = 230 over 9 steps
+		Jitter: ms(230) / 9,
+	}
+	if got != want {
+		t.Fatalf("Summarize = %+v, want %+v", got, want)
+	}
+
+	if empty := Summarize([]Sample{{Failed: true}}); empty != (Stats{Count: 1, Failures: 1}) {
+		t.Fatalf("Summarize(failed only) = %+v", empty)
+	}
+}
+
+func TestHistoryIsBoundedAndWindowed(t *testing.T) {
+	h := NewHistory(3)
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		h.Add(Sample{Time: base.Add(time.Duration(i) * time.Minute), Latency: ms(i)})
+	}
+	all := h.Since(time.Time{})
+	if len(all) != 3 || all[0].Latency != ms(2) || all[2].Latency != ms(4) {
+		t.Fatalf("Since(zero) = %+v", all)
+	}
+	recent := h.Since(base.Add(3 * time.Minute))
+	if len(recent) != 2 || recent[0].Latency != ms(3) {
+		t.Fatalf("Since(3m) = %+v", recent)
+	}
+}
+
+func TestRegistryAggregatesPerJumper(t *testing.T) {
+	r := NewRegistry(10)
+	now := time.Now()
+	r.Record(1, 7, Sample{Time: now, Latency: ms(10)})
+	r.Record(2, 7, Sample{Time: now, Latency: ms(20)})
+	r.Record(3, 8, Sample{Time: now, Failed: true})
+
+	if got := len(r.Tunnel(1, time.Time{})); got != 1 {
+		t.Fatalf("tunnel 1 samples = %d", got)
+	}
+	if got := Summarize(r.Jumper(7, time.Time{})); got.Count != 2 || got.Avg != ms(15) {
+		t.Fatalf("jumper 7 stats = %+v", got)
+	}
+	r.ForgetTunnel(1)
+	if got := r.Tunnel(1, time.Time{}); got != nil {
+		t.Fatalf("forgotten tunnel samples = %+v", got)
+	}
+	if got := len(r.Jumper(7, time.Time{})); got != 2 {
+		t.Fatalf("jumper aggregate should outlive the tunnel, got %d samples", got)
+	}
+}
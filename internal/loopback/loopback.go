@@ -0,0 +1,24 @@
+// Package loopback tells local-only HTTP servers, such as the REST API and
+// the metrics endpoint, whether a request was addressed to this machine, so
+// web pages cannot reach them through DNS rebinding.
+package loopback
+
+import (
+	"net"
+	"strings"
+)
+
+// Host reports whether hostport, a Host header with or without a port,
+// names localhost or a loopback address.
+func Host(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
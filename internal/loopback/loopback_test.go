@@ -0,0 +1,22 @@
+package loopback
+
+import "testing"
+
+func TestHost(t *testing.T) {
+	for hostport, want := range map[string]bool{
+		"localhost":            true,
+		"LOCALHOST:8080":       true,
+		"127.0.0.1:9090":       true,
+		"127.1.2.3":            true,
+		"[::1]:9090":           true,
+		"::1":                  true,
+		"evil.example.com":     false,
+		"localhost.example:80": false,
+		"192.168.1.10:9090":    false,
+		"":                     false,
+	} {
+		if got := Host(hostport); got != want {
+			t.Errorf("Host(%q) = %v, want %v", hostport, got, want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Package metrics exports tunnel counters in the Prometheus text format, or
+// OpenMetrics when the scraper asks for it, on an opt-in localhost listener.
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"loris-tunnel/internal/loopback"
+	"loris-tunnel/internal/model"
+)
+
+const (
+	DefaultPort = 47121
+
+	textContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// Source reads the current metrics. The functions are called per scrape
+// because the app replaces its biz objects when a config is imported.
+type Source struct {
+	Tunnels func() ([]model.TunnelMetrics, error)
+	Jumpers func() ([]model.JumperMetrics, error)
+}
+
+// Server serves GET /metrics. Create it with New and bind it with Start.
+type Server struct {
+	source Source
+
+	mu   sync.Mutex
+	srv  *http.Server
+	addr string
+}
+
+func New(source Source) *Server {
+	return &Server{source: source}
+}
+
+// Start listens on 127.0.0.1:port; port 0 picks a free one.
+func (s *Server) Start(port int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv != nil {
+		return fmt.Errorf("metrics server already running on %s", s.addr)
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("metrics listen: %w", err)
+	}
+	s.srv = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.addr = ln.Addr().String()
+	srv := s.srv
+	slog.Info("metrics server listening", "addr", s.addr)
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server stopped", "err", err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the bound address, empty when not running.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	srv := s.srv
+	s.srv, s.addr = nil, ""
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	slog.Info("metrics server stopped")
+	return srv.Close()
+}
+
+// Handler returns the /metrics route. Like the REST API it refuses Host
+// headers other than loopback so web pages cannot read it through DNS
+// rebinding.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !loopback.Host(r.Host) {
+			http.Error(w, "host not allowed", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	tunnels, err := s.source.Tunnels()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jumpers, err := s.source.Jumpers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", textContentType)
+	}
+	if err := Write(w, tunnels, jumpers, openMetrics); err != nil {
+		slog.Warn("metrics write failed", "err", err)
+	}
+}
+
+type family struct {
+	name    string
+	kind    string
+	help    string
+	samples []sample
+}
+
+type sample struct {
+	labels []label
+	value  float64
+}
+
+type label struct {
+	name, value string
+}
+
+// Write renders the metrics in the Prometheus text format, or OpenMetrics
+// when openMetrics is set. Tunnels are labelled by name and mode, with the
+// ID added because names need not be unique.
+func Write(w io.Writer, tunnels []model.TunnelMetrics, jumpers []model.JumperMetrics, openMetrics bool) error {
+	families := []family{
+		{name: "loris_tunnel_up", kind: "gauge", help: "Whether the tunnel is running (1) or not (0)."},
+		{name: "loris_tunnel_upload_bytes_total", kind: "counter", help: "Bytes sent through the tunnel."},
+		{name: "loris_tunnel_download_bytes_total", kind: "counter", help: "Bytes received through the tunnel."},
+		{name: "loris_tunnel_active_connections", kind: "gauge", help: "Forwarded connections currently open."},
+		{name: "loris_tunnel_ssh_latency_seconds", kind: "gauge", help: "Last SSH round-trip time to the final jumper."},
+		{name: "loris_tunnel_reconnect_attempts_total", kind: "counter", help: "Dials made while recovering a lost SSH connection."},
+		{name: "loris_tunnel_disconnects_total", kind: "counter", help: "SSH connections lost while the tunnel was running."},
+		{name: "loris_tunnel_dial_failures_total", kind: "counter", help: "Forwarded connections that could not be opened."},
+	}
+	for _, t := range tunnels {
+		labels := []label{{"tunnel", t.Name}, {"mode", t.Mode}, {"tunnel_id", strconv.Itoa(t.ID)}}
+		values := []float64{
+			boolValue(t.Running),
+			float64(t.BytesUp),
+			float64(t.BytesDown),
+			float64(t.ActiveConns),
+			t.LatencyMs / 1000,
+			float64(t.ReconnectAttempts),
+			float64(t.Disconnects),
+			float64(t.DialFailures),
+		}
+		for i, v := range values {
+			// A latency of zero means no probe has answered; leave it out
+			// rather than report an impossibly fast link.
+			if families[i].name == "loris_tunnel_ssh_latency_seconds" && v <= 0 {
+				continue
+			}
+			families[i].samples = append(families[i].samples, sample{labels: labels, value: v})
+		}
+	}
+
+	handshakes := family{name: "loris_jumper_handshake_failures_total", kind: "counter", help: "Failed attempts to connect to and authenticate with the jumper."}
+	for _, j := range jumpers {
+		handshakes.samples = append(handshakes.samples, sample{
+			labels: []label{{"jumper", j.Name}, {"jumper_id", strconv.Itoa(j.ID)}},
+			value:  float64(j.HandshakeFailures),
+		})
+	}
+	families = append(families, handshakes)
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		writeFamily(bw, f, openMetrics)
+	}
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+func writeFamily(w *bufio.Writer, f family, openMetrics bool) {
+	// OpenMetrics names a counter family without the _total suffix its
+	// samples carry.
+	name := f.name
+	if openMetrics && f.kind == "counter" {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, f.kind)
+	for _, s := range f.samples {
+		w.WriteString(f.name)
+		w.WriteByte('{')
+		for i, l := range s.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l.name)
+			w.WriteString(`="`)
+			w.WriteString(escapeLabel(l.value))
+			w.WriteByte('"')
+		}
+		w.WriteString("} ")
+		w.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+		w.WriteByte('\n')
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func boolValue(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
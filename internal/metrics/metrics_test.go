@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"loris-tunnel/internal/model"
+)
+
+// exposition is a parsed scrape: family types by name and sample values
+// keyed by series, e.g. `loris_tunnel_up{tunnel="db",mode="local",tunnel_id="1"}`.
+type exposition struct {
+	types   map[string]string
+	samples map[string]float64
+	eof     bool
+}
+
+// parseExposition reads the subset of the text format that Write emits and
+// fails on anything malformed: samples before their TYPE line, bad label
+// quoting or unparsable values.
+func parseExposition(t *testing.T, r io.Reader, openMetrics bool) exposition {
+	t.Helper()
+	out := exposition{types: map[string]string{}, samples: map[string]float64{}}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if out.eof {
+			t.Fatalf("content after # EOF: %q", line)
+		}
+		switch {
+		case line == "# EOF":
+			out.eof = true
+			continue
+		case strings.HasPrefix(line, "# HELP "):
+			continue
+		case strings.HasPrefix(line, "# TYPE "):
+			fields := strings.Fields(strings.TrimPrefix(line, "# TYPE "))
+			if len(fields) != 2 {
+				t.Fatalf("bad TYPE line %q", line)
+			}
+			out.types[fields[0]] = fields[1]
+			continue
+		case strings.HasPrefix(line, "#"):
+			t.Fatalf("unexpected comment %q", line)
+		}
+
+		name, rest, ok := strings.Cut(line, "{")
+		if !ok {
+			t.Fatalf("sample without labels %q", line)
+		}
+		family := name
+		if openMetrics {
+			family = strings.TrimSuffix(name, "_total")
+		}
+		if _, ok := out.types[family]; !ok {
+			t.Fatalf("sample %q before TYPE of %q", line, family)
+		}
+		labels, value, err := parseLabels(rest)
+		if err != nil {
+			t.Fatalf("sample %q: %v", line, err)
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("sample %q value: %v", line, err)
+		}
+		out.samples[name+"{"+labels+"}"] = v
+	}
+	return out
+}
+
+// parseLabels consumes `name="value",...} value`, unescaping label values,
+// and returns the labels re-joined unescaped plus the value text.
+func parseLabels(s string) (string, string, error) {
+	var parts []string
+	for {
+		eq := strings.Index(s, `="`)
+		if eq < 0 {
+			return "", "", fmt.Errorf("missing label value in %q", s)
+		}
+		name := s[:eq]
+		s = s[eq+2:]
+		var value strings.Builder
+		for {
+			if s == "" {
+				return "", "", fmt.Errorf("unterminated label %s", name)
+			}
+			c := s[0]
+			s = s[1:]
+			if c == '"' {
+				break
+			}
+			if c == '\\' {
+				if s == "" {
+					return "", "", fmt.Errorf("dangling escape in %s", name)
+				}
+				switch s[0] {
+				case '\\', '"':
+					value.WriteByte(s[0])
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					return "", "", fmt.Errorf("bad escape \\%c in %s", s[0], name)
+				}
+				s = s[1:]
+				continue
+			}
+			value.WriteByte(c)
+		}
+		parts = append(parts, name+`="`+value.String()+`"`)
+		switch {
+		case strings.HasPrefix(s, ","):
+			s = s[1:]
+		case strings.HasPrefix(s, "} "):
+			return strings.Join(parts, ","), s[2:], nil
+		default:
+			return "", "", fmt.Errorf("unexpected %q after label %s", s, name)
+		}
+	}
+}
+
+var (
+	testTunnels = []model.TunnelMetrics{
+		{
+			ID: 1, Name: `db "prod"\eu`, Mode: "local", Running: true,
+			BytesUp: 1024, BytesDown: 4096, ActiveConns: 2, LatencyMs: 42.5,
+			ReconnectAttempts: 3, Disconnects: 1, DialFailures: 5,
+		},
+		{ID: 2, Name: "socks", Mode: "dynamic"},
+	}
+	testJumpers = []model.JumperMetrics{{ID: 7, Name: "bastion", HandshakeFailures: 4}}
+)
+
+func TestWriteTextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testTunnels, testJumpers, false); err != nil {
+		t.Fatal(err)
+	}
+	got := parseExposition(t, &buf, false)
+	if got.eof {
+		t.Fatal("text format must not end with # EOF")
+	}
+
+	db := `{tunnel="db "prod"\eu",mode="local",tunnel_id="1"}`
+	socks := `{tunnel="socks",mode="dynamic",tunnel_id="2"}`
+	want := map[string]float64{
+		"loris_tunnel_up" + db:                                                  1,
+		"loris_tunnel_up" + socks:                                               0,
+		"loris_tunnel_upload_bytes_total" + db:                                  1024,
+		"loris_tunnel_download_bytes_total" + db:                                4096,
+		"loris_tunnel_active_connections" + db:                                  2,
+		"loris_tunnel_ssh_latency_seconds" + db:                                 0.0425,
+		"loris_tunnel_reconnect_attempts_total" + db:                            3,
+		"loris_tunnel_disconnects_total" + db:                                   1,
+		"loris_tunnel_dial_failures_total" + db:                                 5,
+		"loris_tunnel_dial_failures_total" + socks:                              0,
+		`loris_jumper_handshake_failures_total{jumper="bastion",jumper_id="7"}`: 4,
+	}
+	for series, v := range want {
+		if got.samples[series] != v {
+			t.Errorf("%s = %v (present %v), want %v", series, got.samples[series], hasKey(got.samples, series), v)
+		}
+	}
+	if _, ok := got.samples["loris_tunnel_ssh_latency_seconds"+socks]; ok {
+		t.Error("latency reported for a tunnel without probes")
+	}
+	if got.types["loris_tunnel_upload_bytes_total"] != "counter" || got.types["loris_tunnel_up"] != "gauge" {
+		t.Errorf("types = %v", got.types)
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testTunnels, testJumpers, true); err != nil {
+		t.Fatal(err)
+	}
+	got := parseExposition(t, &buf, true)
+	if !got.eof {
+		t.Fatal("OpenMetrics output must end with # EOF")
+	}
+	if got.types["loris_tunnel_disconnects"] != "counter" {
+		t.Fatalf("counter family should drop _total: %v", got.types)
+	}
+	if got.samples[`loris_tunnel_disconnects_total{tunnel="db "prod"\eu",mode="local",tunnel_id="1"}`] != 1 {
+		t.Fatalf("samples = %v", got.samples)
+	}
+}
+
+func TestServerNegotiatesFormatAndChecksHost(t *testing.T) {
+	server := New(Source{
+		Tunnels: func() ([]model.TunnelMetrics, error) { return testTunnels, nil },
+		Jumpers: func() ([]model.JumperMetrics, error) { return testJumpers, nil },
+	})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("content type = %q", ct)
+	}
+	parseExposition(t, resp.Body, false)
+	resp.Body.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;q=0.5")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Fatalf("content type = %q", ct)
+	}
+	if !parseExposition(t, resp.Body, true).eof {
+		t.Fatal("missing # EOF")
+	}
+	resp.Body.Close()
+
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/metrics", nil)
+	req.Host = "metrics.example.com"
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("foreign host status = %d", resp.StatusCode)
+	}
+}
+
+func hasKey(m map[string]float64, k string) bool {
+	_, ok := m[k]
+	return ok
+}
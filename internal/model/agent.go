@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// AgentForwardEvent is one request a remote host made to the forwarded SSH agent.
+type AgentForwardEvent struct {
+	Time           time.Time `json:"time"`
+	Jumper         string    `json:"jumper"`
+	Operation      string    `json:"operation"`
+	KeyFingerprint string    `json:"keyFingerprint,omitempty"`
+	KeyComment     string    `json:"keyComment,omitempty"`
+	Allowed        bool      `json:"allowed"`
+	Error          string    `json:"error,omitempty"`
+}
@@ -0,0 +1,13 @@
+package model
+
+// APISettings describes the local REST API. Address is where it is
+// listening, empty when disabled or when binding failed, in which case
+// Error says why.
+type APISettings struct {
+	Enabled   bool   `json:"enabled"`
+	Port      int    `json:"port"`
+	Address   string `json:"address"`
+	Token     string `json:"token"`
+	TokenPath string `json:"tokenPath"`
+	Error     string `json:"error,omitempty"`
+}
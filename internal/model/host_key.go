@@ -0,0 +1,30 @@
+package model
+
+// HostKeyCheckResult describes the host key a jumper presents and whether it
+// is trusted by the jumper's pin or known_hosts file.
+type HostKeyCheckResult struct {
+	Host                string `json:"host"`
+	Trusted             bool   `json:"trusted"`
+	Reason              string `json:"reason"`
+	KeyType             string `json:"keyType"`
+	Fingerprint         string `json:"fingerprint"`
+	KnownHostsPath      string `json:"knownHostsPath"`
+	PinnedFingerprint   string `json:"pinnedFingerprint"`
+	ConflictLine        int    `json:"conflictLine"`
+	ConflictEntry       string `json:"conflictEntry"`
+	ConflictKeyType     string `json:"conflictKeyType"`
+	ConflictFingerprint string `json:"conflictFingerprint"`
+}
+
+// KnownHostEntry is a known_hosts line that applies to one or more jumpers.
+type KnownHostEntry struct {
+	Path        string   `json:"path"`
+	Line        int      `json:"line"`
+	Marker      string   `json:"marker"`
+	Hosts       []string `json:"hosts"`
+	Hashed      bool     `json:"hashed"`
+	KeyType     string   `json:"keyType"`
+	Fingerprint string   `json:"fingerprint"`
+	Comment     string   `json:"comment"`
+	JumperIDs   []int    `json:"jumperIds"`
+}
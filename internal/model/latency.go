@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// LatencySample is one SSH round-trip probe. LatencyMs is zero for probes
+// that failed or timed out.
+type LatencySample struct {
+	Time      time.Time `json:"time"`
+	LatencyMs float64   `json:"latencyMs"`
+	Failed    bool      `json:"failed,omitempty"`
+	TimedOut  bool      `json:"timedOut,omitempty"`
+}
+
+// LatencyStats summarises a latency history. Min, avg, p95 and jitter only
+// count answered probes.
+type LatencyStats struct {
+	Count    int     `json:"count"`
+	Failures int     `json:"failures"`
+	Timeouts int     `json:"timeouts"`
+	MinMs    float64 `json:"minMs"`
+	AvgMs    float64 `json:"avgMs"`
+	P95Ms    float64 `json:"p95Ms"`
+	JitterMs float64 `json:"jitterMs"`
+}
+
+// LatencyHistory is the latency of a tunnel or jumper over a time window,
+// oldest sample first.
+type LatencyHistory struct {
+	Samples []LatencySample `json:"samples"`
+	Stats   LatencyStats    `json:"stats"`
+}
@@ -0,0 +1,35 @@
+package model
+
+// TunnelMetrics is a point-in-time reading of one tunnel's counters. Byte
+// and event counts cover every run since the app started; LatencyMs is
+// zero when no probe has answered yet.
+type TunnelMetrics struct {
+	ID                int     `json:"id"`
+	Name              string  `json:"name"`
+	Mode              string  `json:"mode"`
+	Running           bool    `json:"running"`
+	BytesUp           uint64  `json:"bytesUp"`
+	BytesDown         uint64  `json:"bytesDown"`
+	ActiveConns       int     `json:"activeConns"`
+	LatencyMs         float64 `json:"latencyMs"`
+	ReconnectAttempts uint64  `json:"reconnectAttempts"`
+	Disconnects       uint64  `json:"disconnects"`
+	DialFailures      uint64  `json:"dialFailures"`
+}
+
+// JumperMetrics counts failed connections to one jumper.
+type JumperMetrics struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	HandshakeFailures uint64 `json:"handshakeFailures"`
+}
+
+// MetricsSettings describes the metrics endpoint. Address is where it is
+// listening, empty when disabled or when binding failed, in which case
+// Error says why.
+type MetricsSettings struct {
+	Enabled bool   `json:"enabled"`
+	Port    int    `json:"port"`
+	Address string `json:"address"`
+	Error   string `json:"error,omitempty"`
+}
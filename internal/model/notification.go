@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// NotificationSink is where tunnel state changes are reported: an HTTP
+// webhook whose JSON body is rendered from BodyTemplate, or a local command.
+// Empty TunnelIDs and Events match every tunnel and event. DebounceMs,
+// Retries and FlapThreshold disable their feature when zero.
+type NotificationSink struct {
+	ID            int               `json:"id" toml:"id"`
+	Name          string            `json:"name" toml:"name"`
+	Type          string            `json:"type" toml:"type"`
+	Enabled       bool              `json:"enabled" toml:"enabled"`
+	URL           string            `json:"url,omitempty" toml:"url,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty" toml:"headers,omitempty"`
+	BodyTemplate  string            `json:"bodyTemplate,omitempty" toml:"body_template,omitempty"`
+	Command       string            `json:"command,omitempty" toml:"command,omitempty"`
+	TunnelIDs     []int             `json:"tunnelIds" toml:"tunnel_ids"`
+	Events        []string          `json:"events" toml:"events"`
+	DebounceMs    int               `json:"debounceMs" toml:"debounce_ms"`
+	FlapThreshold int               `json:"flapThreshold" toml:"flap_threshold"`
+	FlapWindowMs  int               `json:"flapWindowMs" toml:"flap_window_ms"`
+	Retries       int               `json:"retries" toml:"retries"`
+}
+
+// NotificationSinkPayload is used by create/update notification sink APIs.
+type NotificationSinkPayload struct {
+	Name          string            `json:"name"`
+	Type          string            `json:"type"`
+	Enabled       bool              `json:"enabled"`
+	URL           string            `json:"url"`
+	Headers       map[string]string `json:"headers"`
+	BodyTemplate  string            `json:"bodyTemplate"`
+	Command       string            `json:"command"`
+	TunnelIDs     []int             `json:"tunnelIds"`
+	Events        []string          `json:"events"`
+	DebounceMs    int               `json:"debounceMs"`
+	FlapThreshold int               `json:"flapThreshold"`
+	FlapWindowMs  int               `json:"flapWindowMs"`
+	Retries       int               `json:"retries"`
+}
+
+// Notification is one delivered state change, the data a webhook body
+// template is rendered from. Text is a ready-made one-line summary.
+type Notification struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	TunnelID int       `json:"tunnelId"`
+	Tunnel   string    `json:"tunnel"`
+	Message  string    `json:"message"`
+	Error    string    `json:"error,omitempty"`
+	Sink     string    `json:"sink"`
+	Text     string    `json:"text"`
+}
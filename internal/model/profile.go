@@ -0,0 +1,32 @@
+package model
+
+// TunnelProfile is a named set of tunnels that is switched on as a whole,
+// e.g. "staging" and "prod" sets that reuse the same local ports.
+type TunnelProfile struct {
+	ID        int    `json:"id" toml:"id"`
+	Name      string `json:"name" toml:"name"`
+	TunnelIDs []int  `json:"tunnelIds" toml:"tunnel_ids"`
+}
+
+// TunnelProfilePayload is used by create/update profile APIs.
+type TunnelProfilePayload struct {
+	Name      string `json:"name"`
+	TunnelIDs []int  `json:"tunnelIds"`
+}
+
+// ProfileTunnelResult is what activating a profile did to one tunnel.
+// Action is "started", "stopped" or "kept"; Status is the tunnel's status
+// afterwards and Error is set when the action failed.
+type ProfileTunnelResult struct {
+	TunnelID int    `json:"tunnelId"`
+	Name     string `json:"name"`
+	Action   string `json:"action"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ProfileActivation reports the outcome of activating a profile.
+type ProfileActivation struct {
+	ProfileID int                   `json:"profileId"`
+	Results   []ProfileTunnelResult `json:"results"`
+}
@@ -9,12 +9,21 @@ type SSHConfigImportCandidate struct {
 	User                   string   `json:"user"`
 	AuthType               string   `json:"authType"`
 	KeyPath                string   `json:"keyPath"`
+	CertificatePath        string   `json:"certificatePath"`
 	AgentSocketPath        string   `json:"agentSocketPath"`
+	ForwardAgent           bool     `json:"forwardAgent"`
 	BypassHostVerification bool     `json:"bypassHostVerification"`
+	HostKeyPolicy          string   `json:"hostKeyPolicy"`
+	KnownHostsPath         string   `json:"knownHostsPath"`
+	HashKnownHosts         bool     `json:"hashKnownHosts"`
 	KeepAliveIntervalMs    int      `json:"keepAliveIntervalMs"`
 	TimeoutMs              int      `json:"timeoutMs"`
 	HostKeyAlgorithms      string   `json:"hostKeyAlgorithms"`
+	Ciphers                string   `json:"ciphers"`
+	KeyExchanges           string   `json:"keyExchanges"`
+	MACs                   string   `json:"macs"`
 	ProxyJump              string   `json:"proxyJump"`
+	ProxyCommand           string   `json:"proxyCommand"`
 	SourcePath             string   `json:"sourcePath"`
 	Warnings               []string `json:"warnings"`
 }
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// SSHKey is a key pair in the app's managed key directory.
+type SSHKey struct {
+	Name           string    `json:"name"`
+	Type           string    `json:"type"`
+	Bits           int       `json:"bits"`
+	Fingerprint    string    `json:"fingerprint"`
+	Comment        string    `json:"comment"`
+	PrivateKeyPath string    `json:"privateKeyPath"`
+	PublicKeyPath  string    `json:"publicKeyPath"`
+	PublicKey      string    `json:"publicKey"`
+	Encrypted      bool      `json:"encrypted"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type SSHKeyGeneratePayload struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Bits       int    `json:"bits"`
+	Passphrase string `json:"passphrase"`
+	Comment    string `json:"comment"`
+}
+
+// SSHKeyInstallResult reports a public key installed on a jumper and the
+// jumper as saved afterwards.
+type SSHKeyInstallResult struct {
+	Jumper         Jumper `json:"jumper"`
+	AlreadyPresent bool   `json:"alreadyPresent"`
+}
@@ -1,21 +1,41 @@
 package model
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // Jumper is the SSH jumper configuration used by the frontend.
 type Jumper struct {
-	ID                     int    `json:"id" toml:"id"`
-	Name                   string `json:"name" toml:"name"`
-	Host                   string `json:"host" toml:"host"`
-	Port                   int    `json:"port" toml:"port"`
-	User                   string `json:"user" toml:"user"`
-	AuthType               string `json:"authType" toml:"auth_type"`
-	KeyPath                string `json:"keyPath" toml:"key_path"`
-	AgentSocketPath        string `json:"agentSocketPath" toml:"agent_socket_path"`
-	Password               string `json:"password" toml:"password"`
-	BypassHostVerification bool   `json:"bypassHostVerification" toml:"bypass_host_verification"`
-	KeepAliveIntervalMs    int    `json:"keepAliveIntervalMs" toml:"keep_alive_interval_ms"`
-	TimeoutMs              int    `json:"timeoutMs" toml:"timeout_ms"`
-	HostKeyAlgorithms      string `json:"hostKeyAlgorithms" toml:"host_key_algorithms"`
-	Notes                  string `json:"notes" toml:"notes"`
+	ID                     int      `json:"id" toml:"id"`
+	Name                   string   `json:"name" toml:"name"`
+	Host                   string   `json:"host" toml:"host"`
+	Port                   int      `json:"port" toml:"port"`
+	User                   string   `json:"user" toml:"user"`
+	AuthType               string   `json:"authType" toml:"auth_type"`
+	AuthMethods            []string `json:"authMethods,omitempty" toml:"auth_methods,omitempty"`
+	KeyPath                string   `json:"keyPath" toml:"key_path"`
+	CertificatePath        string   `json:"certificatePath" toml:"certificate_path"`
+	AgentSocketPath        string   `json:"agentSocketPath" toml:"agent_socket_path"`
+	ForwardAgent           bool     `json:"forwardAgent" toml:"forward_agent"`
+	IdentitiesOnly         bool     `json:"identitiesOnly" toml:"identities_only"`
+	IdentityFingerprint    string   `json:"identityFingerprint" toml:"identity_fingerprint"`
+	Password               string   `json:"password" toml:"password"`
+	TOTPSecret             string   `json:"totpSecret" toml:"totp_secret"`
+	BypassHostVerification bool     `json:"bypassHostVerification" toml:"bypass_host_verification"`
+	HostKeyPolicy          string   `json:"hostKeyPolicy" toml:"host_key_policy"`
+	HostKeyFingerprint     string   `json:"hostKeyFingerprint" toml:"host_key_fingerprint"`
+	KnownHostsPath         string   `json:"knownHostsPath" toml:"known_hosts_path"`
+	HashKnownHosts         bool     `json:"hashKnownHosts" toml:"hash_known_hosts"`
+	KeepAliveIntervalMs    int      `json:"keepAliveIntervalMs" toml:"keep_alive_interval_ms"`
+	TimeoutMs              int      `json:"timeoutMs" toml:"timeout_ms"`
+	HostKeyAlgorithms      string   `json:"hostKeyAlgorithms" toml:"host_key_algorithms"`
+	Ciphers                string   `json:"ciphers" toml:"ciphers"`
+	KeyExchanges           string   `json:"keyExchanges" toml:"key_exchanges"`
+	MACs                   string   `json:"macs" toml:"macs"`
+	ProxyCommand           string   `json:"proxyCommand" toml:"proxy_command"`
+	UpstreamProxy          string   `json:"upstreamProxy" toml:"upstream_proxy"`
+	Notes                  string   `json:"notes" toml:"notes"`
 }
 
 // TunnelGroup is a user-defined collection for organizing tunnels.
@@ -26,27 +46,42 @@ type TunnelGroup struct {
 
 // Tunnel is the SSH tunnel configuration used by the frontend.
 type Tunnel struct {
-	ID          int    `json:"id" toml:"id"`
-	Name        string `json:"name" toml:"name"`
-	GroupID     int    `json:"groupId" toml:"group_id"`
-	Mode        string `json:"mode" toml:"mode"`
-	JumperIDs   []int  `json:"jumperIds" toml:"jumper_ids"`
-	LocalHost   string `json:"localHost" toml:"local_host"`
-	LocalPort   int    `json:"localPort" toml:"local_port"`
-	RemoteHost  string `json:"remoteHost" toml:"remote_host"`
-	RemotePort  int    `json:"remotePort" toml:"remote_port"`
-	AutoStart   bool   `json:"autoStart" toml:"auto_start"`
-	Status      string `json:"status" toml:"status"`
-	LastError   string `json:"lastError" toml:"last_error"`
-	Description string `json:"description" toml:"description"`
-	LatencyMs   int64  `json:"latencyMs,omitempty" toml:"-"`
+	ID             int               `json:"id" toml:"id"`
+	Name           string            `json:"name" toml:"name"`
+	GroupID        int               `json:"groupId" toml:"group_id"`
+	Mode           string            `json:"mode" toml:"mode"`
+	JumperIDs      []int             `json:"jumperIds" toml:"jumper_ids"`
+	LocalHost      string            `json:"localHost" toml:"local_host"`
+	LocalPort      int               `json:"localPort" toml:"local_port"`
+	AutoLocalPort  bool              `json:"autoLocalPort" toml:"auto_local_port,omitempty"`
+	RemoteHost     string            `json:"remoteHost" toml:"remote_host"`
+	RemotePort     int               `json:"remotePort" toml:"remote_port"`
+	AutoStart      bool              `json:"autoStart" toml:"auto_start"`
+	Status         string            `json:"status" toml:"status"`
+	LastError      string            `json:"lastError" toml:"last_error"`
+	Description    string            `json:"description" toml:"description"`
+	Hooks          TunnelHooks       `json:"hooks" toml:"hooks,omitempty"`
+	HealthCheck    TunnelHealthCheck `json:"healthCheck" toml:"health_check,omitempty"`
+	DependsOn      []int             `json:"dependsOn" toml:"depends_on,omitempty"`
+	Lazy           bool              `json:"lazy" toml:"lazy,omitempty"`
+	IdleTimeoutMs  int               `json:"idleTimeoutMs" toml:"idle_timeout_ms,omitempty"`
+	Schedule       TunnelSchedule    `json:"schedule" toml:"schedule,omitempty"`
+	TTLMs          int               `json:"ttlMs" toml:"ttl_ms,omitempty"`
+	LatencyMs      int64             `json:"latencyMs,omitempty" toml:"-"`
+	Warnings       []string          `json:"warnings,omitempty" toml:"-"`
+	Health         *TunnelHealth     `json:"health,omitempty" toml:"-"`
+	BoundLocalPort int               `json:"boundLocalPort,omitempty" toml:"-"`
+	LazyState      string            `json:"lazyState,omitempty" toml:"-"`
+	TTLRemainingMs int64             `json:"ttlRemainingMs,omitempty" toml:"-"`
 }
 
 // State is the full frontend state stored in config.
 type State struct {
-	Jumpers []Jumper      `json:"jumpers"`
-	Groups  []TunnelGroup `json:"groups"`
-	Tunnels []Tunnel      `json:"tunnels"`
+	Jumpers         []Jumper        `json:"jumpers"`
+	Groups          []TunnelGroup   `json:"groups"`
+	Tunnels         []Tunnel        `json:"tunnels"`
+	Profiles        []TunnelProfile `json:"profiles"`
+	ActiveProfileID int             `json:"activeProfileId"`
 }
 
 // TunnelGroupPayload is used by create/update group APIs.
@@ -56,37 +91,210 @@ type TunnelGroupPayload struct {
 
 // JumperPayload is used by create/update APIs.
 type JumperPayload struct {
-	Name                   string `json:"name"`
-	Host                   string `json:"host"`
-	Port                   int    `json:"port"`
-	User                   string `json:"user"`
-	AuthType               string `json:"authType"`
-	KeyPath                string `json:"keyPath"`
-	AgentSocketPath        string `json:"agentSocketPath"`
-	Password               string `json:"password"`
-	BypassHostVerification bool   `json:"bypassHostVerification"`
-	KeepAliveIntervalMs    int    `json:"keepAliveIntervalMs"`
-	TimeoutMs              int    `json:"timeoutMs"`
-	HostKeyAlgorithms      string `json:"hostKeyAlgorithms"`
-	Notes                  string `json:"notes"`
+	Name                   string   `json:"name"`
+	Host                   string   `json:"host"`
+	Port                   int      `json:"port"`
+	User                   string   `json:"user"`
+	AuthType               string   `json:"authType"`
+	AuthMethods            []string `json:"authMethods"`
+	KeyPath                string   `json:"keyPath"`
+	CertificatePath        string   `json:"certificatePath"`
+	AgentSocketPath        string   `json:"agentSocketPath"`
+	ForwardAgent           bool     `json:"forwardAgent"`
+	IdentitiesOnly         bool     `json:"identitiesOnly"`
+	IdentityFingerprint    string   `json:"identityFingerprint"`
+	Password               string   `json:"password"`
+	TOTPSecret             string   `json:"totpSecret"`
+	BypassHostVerification bool     `json:"bypassHostVerification"`
+	HostKeyPolicy          string   `json:"hostKeyPolicy"`
+	HostKeyFingerprint     string   `json:"hostKeyFingerprint"`
+	KnownHostsPath         string   `json:"knownHostsPath"`
+	HashKnownHosts         bool     `json:"hashKnownHosts"`
+	KeepAliveIntervalMs    int      `json:"keepAliveIntervalMs"`
+	TimeoutMs              int      `json:"timeoutMs"`
+	HostKeyAlgorithms      string   `json:"hostKeyAlgorithms"`
+	Ciphers                string   `json:"ciphers"`
+	KeyExchanges           string   `json:"keyExchanges"`
+	MACs                   string   `json:"macs"`
+	ProxyCommand           string   `json:"proxyCommand"`
+	UpstreamProxy          string   `json:"upstreamProxy"`
+	Notes                  string   `json:"notes"`
+
+	// sent holds the JSON keys the payload was decoded from, so an update
+	// can keep stored values for keys a client leaves out. It is nil for
+	// payloads built in Go, which set every field.
+	sent map[string]bool
+}
+
+// UnmarshalJSON decodes the payload and records which keys were sent.
+func (p *JumperPayload) UnmarshalJSON(data []byte) error {
+	type plain JumperPayload
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+	p.sent = make(map[string]bool, len(keys))
+	for key := range keys {
+		p.sent[key] = true
+	}
+	return nil
+}
+
+// Sets reports whether the payload carries a value for the JSON key, which
+// is always the case for payloads built in Go.
+func (p JumperPayload) Sets(key string) bool {
+	return p.sent == nil || p.sent[key]
 }
 
 // TunnelPayload is used by create/update APIs.
 type TunnelPayload struct {
-	Name        string `json:"name"`
-	GroupID     int    `json:"groupId"`
-	Mode        string `json:"mode"`
-	JumperIDs   []int  `json:"jumperIds"`
-	LocalHost   string `json:"localHost"`
-	LocalPort   int    `json:"localPort"`
-	RemoteHost  string `json:"remoteHost"`
-	RemotePort  int    `json:"remotePort"`
-	AutoStart   bool   `json:"autoStart"`
-	Status      string `json:"status"`
-	Description string `json:"description"`
+	Name          string            `json:"name"`
+	GroupID       int               `json:"groupId"`
+	Mode          string            `json:"mode"`
+	JumperIDs     []int             `json:"jumperIds"`
+	LocalHost     string            `json:"localHost"`
+	LocalPort     int               `json:"localPort"`
+	AutoLocalPort bool              `json:"autoLocalPort"`
+	RemoteHost    string            `json:"remoteHost"`
+	RemotePort    int               `json:"remotePort"`
+	AutoStart     bool              `json:"autoStart"`
+	Status        string            `json:"status"`
+	Description   string            `json:"description"`
+	Hooks         TunnelHooks       `json:"hooks"`
+	HealthCheck   TunnelHealthCheck `json:"healthCheck"`
+	DependsOn     []int             `json:"dependsOn"`
+	Lazy          bool              `json:"lazy"`
+	IdleTimeoutMs int               `json:"idleTimeoutMs"`
+	Schedule      TunnelSchedule    `json:"schedule"`
+	TTLMs         int               `json:"ttlMs"`
+}
+
+// TunnelSchedule starts and stops a tunnel at fixed local times. StartAt
+// and StopAt are "HH:MM" and either may be empty; a StopAt before StartAt
+// stops the next day. Weekdays (0 is Sunday) limit the days the schedule
+// fires on, an overnight stop counting towards the day it started; empty
+// means every day.
+type TunnelSchedule struct {
+	StartAt  string `json:"startAt" toml:"start_at,omitempty"`
+	StopAt   string `json:"stopAt" toml:"stop_at,omitempty"`
+	Weekdays []int  `json:"weekdays" toml:"weekdays,omitempty"`
+}
+
+// TunnelHooks are optional commands run around a tunnel's lifecycle.
+// PreStart runs on the last hop once it is connected and before the tunnel
+// forwards anything; a failure aborts the start. The others run locally.
+// Each hook is limited to TimeoutMs (30s when zero).
+type TunnelHooks struct {
+	PreStart       string `json:"preStart" toml:"pre_start,omitempty"`
+	OnStarted      string `json:"onStarted" toml:"on_started,omitempty"`
+	OnStopped      string `json:"onStopped" toml:"on_stopped,omitempty"`
+	OnDisconnected string `json:"onDisconnected" toml:"on_disconnected,omitempty"`
+	OnReconnected  string `json:"onReconnected" toml:"on_reconnected,omitempty"`
+	TimeoutMs      int    `json:"timeoutMs" toml:"timeout_ms,omitempty"`
+}
+
+// TunnelHealthCheck probes the forwarded target through the tunnel's SSH
+// connection. Type is "tcp", "http", "https" or "tls"; empty disables the
+// check. Target defaults to the remote host and port of a local forward.
+// After FailureThreshold consecutive failures (1 when zero) the tunnel is
+// degraded; after ReconnectAfter (never when zero) it is reconnected.
+type TunnelHealthCheck struct {
+	Type               string `json:"type" toml:"type,omitempty"`
+	Target             string `json:"target" toml:"target,omitempty"`
+	Path               string `json:"path" toml:"path,omitempty"`
+	ExpectStatus       int    `json:"expectStatus" toml:"expect_status,omitempty"`
+	ServerName         string `json:"serverName" toml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify" toml:"insecure_skip_verify,omitempty"`
+	IntervalMs         int    `json:"intervalMs" toml:"interval_ms,omitempty"`
+	TimeoutMs          int    `json:"timeoutMs" toml:"timeout_ms,omitempty"`
+	FailureThreshold   int    `json:"failureThreshold" toml:"failure_threshold,omitempty"`
+	ReconnectAfter     int    `json:"reconnectAfter" toml:"reconnect_after,omitempty"`
+}
+
+// TunnelHealth is the runtime state of a tunnel's health check. State is
+// "unknown" until the first check, then "healthy" or "degraded".
+type TunnelHealth struct {
+	State               string     `json:"state"`
+	LastCheck           *time.Time `json:"lastCheck,omitempty"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	LastFailure         *time.Time `json:"lastFailure,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+}
+
+// TunnelLogEntry is one line of a tunnel's runtime log: a status change or
+// the outcome and output of a hook.
+type TunnelLogEntry struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Event   string    `json:"event"`
+	Message string    `json:"message"`
+	Output  string    `json:"output,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// TunnelEvent carries a tunnel log entry to live subscribers. Status
+// changes arrive as entries with source "status" and the new status as
+// their event.
+type TunnelEvent struct {
+	TunnelID int            `json:"tunnelId"`
+	Entry    TunnelLogEntry `json:"entry"`
 }
 
 // TunnelConnectionTestResult is returned by TestTunnelConnection API.
 type TunnelConnectionTestResult struct {
+	LatencyMs  int64                  `json:"latencyMs"`
+	Algorithms []NegotiatedAlgorithms `json:"algorithms"`
+}
+
+// NegotiatedAlgorithms lists the algorithms one hop's handshake settled on.
+// MAC is empty for AEAD ciphers, which need no separate MAC.
+type NegotiatedAlgorithms struct {
+	Jumper      string `json:"jumper"`
+	KeyExchange string `json:"keyExchange"`
+	HostKey     string `json:"hostKey"`
+	Cipher      string `json:"cipher"`
+	MAC         string `json:"mac"`
+}
+
+// JournalEntry is one record of the persistent event journal. TunnelID and
+// Tunnel are empty for events that are not about a single tunnel, such as a
+// config import.
+type JournalEntry struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	TunnelID int       `json:"tunnelId,omitempty"`
+	Tunnel   string    `json:"tunnel,omitempty"`
+	Message  string    `json:"message"`
+	Error    string    `json:"error,omitempty"`
+	Attempt  int       `json:"attempt,omitempty"`
+}
+
+// JournalQuery filters the event journal. Zero values match everything;
+// Until is exclusive and Limit keeps the newest entries.
+type JournalQuery struct {
+	TunnelID int       `json:"tunnelId"`
+	Types    []string  `json:"types"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+	Limit    int       `json:"limit"`
+}
+
+// TunnelLatencyUpdate is one latency probe result pushed to the UI.
+// LatencyMs is zero when the probe failed or timed out.
+type TunnelLatencyUpdate struct {
+	TunnelID  int   `json:"tunnelId"`
 	LatencyMs int64 `json:"latencyMs"`
+	Failed    bool  `json:"failed"`
+}
+
+// ConfigChange says which part of the config was edited, e.g. kind "jumper"
+// and action "updated". Kind "import" means the whole config was replaced.
+type ConfigChange struct {
+	Kind   string `json:"kind"`
+	ID     int    `json:"id,omitempty"`
+	Action string `json:"action"`
 }
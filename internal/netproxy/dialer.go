@@ -0,0 +1,374 @@
+// Package netproxy opens TCP connections through an optional upstream proxy
+// (HTTP CONNECT or SOCKS5), the way the first SSH hop is reached on networks
+// where outbound port 22 is blocked.
+package netproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ModeDirect dials the target without a proxy.
+	ModeDirect = "direct"
+	// ModeSystem picks the proxy from HTTPS_PROXY/ALL_PROXY and NO_PROXY.
+	ModeSystem = "system"
+)
+
+var ErrUnsupportedScheme = errors.New("unsupported proxy scheme")
+
+// getenv is swapped in tests.
+var getenv = os.Getenv
+
+// Dialer dials TCP targets according to a proxy spec.
+type Dialer struct {
+	spec  string
+	proxy *url.URL // nil for direct and system
+}
+
+// New parses spec: "" or "direct", "system", "http://[user:pass@]host:port"
+// or "socks5://[user:pass@]host:port".
+func New(spec string) (*Dialer, error) {
+	spec = strings.TrimSpace(spec)
+	switch strings.ToLower(spec) {
+	case "", ModeDirect:
+		return &Dialer{spec: ModeDirect}, nil
+	case ModeSystem:
+		return &Dialer{spec: ModeSystem}, nil
+	}
+	u, err := parseProxyURL(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &Dialer{spec: spec, proxy: u}, nil
+}
+
+// Validate reports whether spec is a usable proxy setting.
+func Validate(spec string) error {
+	_, err := New(spec)
+	return err
+}
+
+// Describe returns the spec with any password masked, for logs and diagnostics.
+func Describe(spec string) string {
+	spec = strings.TrimSpace(spec)
+	u, err := url.Parse(spec)
+	if err != nil || u.User == nil {
+		return spec
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+func parseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", Describe(raw), err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedScheme, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy %q: host is required", Describe(raw))
+	}
+	if u.Port() == "" {
+		port := "1080"
+		if strings.EqualFold(u.Scheme, "http") {
+			port = "8080"
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+// ProxyFor returns the proxy used for addr, or nil when addr is dialed directly.
+func (d *Dialer) ProxyFor(addr string) (*url.URL, error) {
+	if d.spec != ModeSystem {
+		return d.proxy, nil
+	}
+	raw := firstEnv("HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy")
+	if raw == "" || matchNoProxy(firstEnv("NO_PROXY", "no_proxy"), addr) {
+		return nil, nil
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	return parseProxyURL(raw)
+}
+
+// DialTimeout dials addr through the configured proxy. The timeout covers
+// both the proxy connection and the proxy handshake.
+func (d *Dialer) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+// DialContext dials addr through the configured proxy.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	proxy, err := d.ProxyFor(addr)
+	if err != nil {
+		return nil, err
+	}
+	var nd net.Dialer
+	if proxy == nil {
+		return nd.DialContext(ctx, network, addr)
+	}
+
+	conn, err := nd.DialContext(ctx, "tcp", proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("connect to proxy %s failed: %w", proxy.Host, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	tunneled := conn
+	switch strings.ToLower(proxy.Scheme) {
+	case "http":
+		tunneled, err = httpConnect(conn, proxy, addr)
+	default:
+		err = socks5Connect(conn, proxy, addr)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", Describe(proxy.String()), err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return tunneled, nil
+}
+
+func httpConnect(conn net.Conn, proxy *url.URL, addr string) (net.Conn, error) {
+	var req strings.Builder
+	fmt.Fprintf(&req, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n", addr, addr)
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		token := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		fmt.Fprintf(&req, "Proxy-Authorization: Basic %s\r\n", token)
+	}
+	req.WriteString("\r\n")
+	if _, err := conn.Write([]byte(req.String())); err != nil {
+		return nil, fmt.Errorf("write CONNECT failed: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, fmt.Errorf("read CONNECT response failed: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT %s rejected: %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// The SSH server speaks first, so its banner may already be buffered.
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+var socks5Replies = map[byte]string{
+	0x01: "general failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+func socks5Connect(conn net.Conn, proxy *url.URL, addr string) error {
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid target port %q", portText)
+	}
+
+	methods := []byte{0x00}
+	if proxy.User != nil {
+		methods = append(methods, 0x02)
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return fmt.Errorf("socks5 greeting failed: %w", err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("socks5 greeting failed: %w", err)
+	}
+	if reply[0] != 0x05 {
+		return fmt.Errorf("socks5 greeting failed: unexpected version %d", reply[0])
+	}
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if proxy.User == nil {
+			return fmt.Errorf("socks5 proxy requires username/password")
+		}
+		if err := socks5Auth(conn, proxy.User); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("socks5 proxy accepted no offered auth method")
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(req, 0x01)
+			req = append(req, ip4...)
+		} else {
+			req = append(req, 0x04)
+			req = append(req, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("socks5 target host too long")
+		}
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5 connect failed: %w", err)
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return fmt.Errorf("socks5 connect failed: %w", err)
+	}
+	if head[1] != 0x00 {
+		reason := socks5Replies[head[1]]
+		if reason == "" {
+			reason = fmt.Sprintf("reply code %d", head[1])
+		}
+		return fmt.Errorf("socks5 connect %s failed: %s", addr, reason)
+	}
+	var skip int
+	switch head[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return fmt.Errorf("socks5 connect failed: %w", err)
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("socks5 connect failed: unknown address type %d", head[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip+2)); err != nil {
+		return fmt.Errorf("socks5 connect failed: %w", err)
+	}
+	return nil
+}
+
+func socks5Auth(conn net.Conn, user *url.Userinfo) error {
+	name := user.Username()
+	password, _ := user.Password()
+	if len(name) > 255 || len(password) > 255 {
+		return fmt.Errorf("socks5 credentials too long")
+	}
+	req := []byte{0x01, byte(len(name))}
+	req = append(req, name...)
+	req = append(req, byte(len(password)))
+	req = append(req, password...)
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5 auth failed: %w", err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("socks5 auth failed: %w", err)
+	}
+	if reply[1] != 0x00 {
+		return fmt.Errorf("socks5 auth rejected")
+	}
+	return nil
+}
+
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if v := strings.TrimSpace(getenv(key)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// matchNoProxy applies NO_PROXY rules: "*", domain suffixes (with or without
+// a leading dot), literal IPs, CIDR ranges and optional ":port" qualifiers.
+func matchNoProxy(noProxy, addr string) bool {
+	if strings.TrimSpace(noProxy) == "" {
+		return false
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	hostIP := net.ParseIP(host)
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if hostIP != nil && cidr.Contains(hostIP) {
+				return true
+			}
+			continue
+		}
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		if ip := net.ParseIP(entryHost); ip != nil {
+			if hostIP != nil && ip.Equal(hostIP) {
+				return true
+			}
+			continue
+		}
+		entryHost = strings.TrimPrefix(strings.TrimPrefix(entryHost, "*"), ".")
+		if host == entryHost || strings.HasSuffix(host, "."+entryHost) {
+			return true
+		}
+	}
+	return false
+}
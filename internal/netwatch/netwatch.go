@@ -0,0 +1,189 @@
+// Package netwatch notices when the network under the app changes: an
+// interface or address comes or goes, or the machine wakes from sleep. SSH
+// connections usually die silently in both cases, so the caller can probe
+// them right away instead of waiting for keepalives to time out.
+package netwatch
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ReasonNetwork = "network"
+	ReasonResume  = "resume"
+
+	DefaultInterval = 3 * time.Second
+
+	// resumeThreshold is how far the clocks may drift within one poll
+	// before it counts as a wake from sleep.
+	resumeThreshold = 10 * time.Second
+	maxDetailItems  = 6
+)
+
+// Change describes why the watcher fired.
+type Change struct {
+	Reason string
+	Detail string
+}
+
+// Watcher polls the host's interfaces and clock and calls onChange when
+// either moves.
+type Watcher struct {
+	interval time.Duration
+	onChange func(Change)
+	snapshot func() ([]string, error)
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+
+	addrs    []string
+	lastWall time.Time
+	lastMono time.Time
+	primed   bool
+}
+
+// New returns a stopped watcher. interval <= 0 uses DefaultInterval.
+func New(interval time.Duration, onChange func(Change)) *Watcher {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Watcher{
+		interval: interval,
+		onChange: onChange,
+		snapshot: interfaceAddrs,
+	}
+}
+
+// Start begins polling in the background. It is a no-op when running.
+func (w *Watcher) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stop != nil {
+		return
+	}
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.run(w.stop, w.done)
+}
+
+// Stop ends polling and waits for an in-flight callback to return.
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	stop, done := w.stop, w.done
+	w.stop, w.done = nil, nil
+	w.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (w *Watcher) run(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	w.poll()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+func (w *Watcher) poll() {
+	now := time.Now()
+	var elapsed time.Duration
+	if !w.lastMono.IsZero() {
+		elapsed = now.Sub(w.lastMono)
+	}
+	w.lastMono = now
+	// Round(0) drops the monotonic reading so the wall clocks are compared.
+	change, ok := w.check(now.Round(0), elapsed)
+	if !ok || w.onChange == nil {
+		return
+	}
+	slog.Info("network change detected", "reason", change.Reason, "detail", change.Detail)
+	w.onChange(change)
+}
+
+// check compares the interface addresses and the wall clock with the
+// previous poll. elapsed is the monotonic time since then, which does not
+// advance while the machine sleeps on Linux, macOS and Windows; a wall clock
+// that moved much further means the machine was suspended. A sleep long
+// enough to delay the ticker itself is caught the same way.
+func (w *Watcher) check(wall time.Time, elapsed time.Duration) (Change, bool) {
+	addrs, err := w.snapshot()
+	if err != nil {
+		slog.Debug("network snapshot failed", "err", err)
+		addrs = w.addrs
+	}
+	prevAddrs, prevWall, primed := w.addrs, w.lastWall, w.primed
+	w.addrs, w.lastWall, w.primed = addrs, wall, true
+	if !primed {
+		return Change{}, false
+	}
+
+	if jump := max(wall.Sub(prevWall)-elapsed, elapsed-w.interval); jump > resumeThreshold {
+		return Change{
+			Reason: ReasonResume,
+			Detail: fmt.Sprintf("clock jumped %s", jump.Round(time.Second)),
+		}, true
+	}
+	if !slices.Equal(prevAddrs, addrs) {
+		return Change{Reason: ReasonNetwork, Detail: diffDetail(prevAddrs, addrs)}, true
+	}
+	return Change{}, false
+}
+
+// interfaceAddrs lists "name addr" for every address on an up, non-loopback
+// interface, sorted.
+func interfaceAddrs() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("list interfaces: %w", err)
+	}
+	var out []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			out = append(out, iface.Name+" "+addr.String())
+		}
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+func diffDetail(before, after []string) string {
+	var parts []string
+	for _, addr := range after {
+		if !slices.Contains(before, addr) {
+			parts = append(parts, "+"+addr)
+		}
+	}
+	for _, addr := range before {
+		if !slices.Contains(after, addr) {
+			parts = append(parts, "-"+addr)
+		}
+	}
+	if len(parts) > maxDetailItems {
+		parts = append(parts[:maxDetailItems], fmt.Sprintf("and %d more", len(parts)-maxDetailItems))
+	}
+	return strings.Join(parts, ", ")
+}
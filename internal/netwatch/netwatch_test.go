@@ -0,0 +1,62 @@
+package netwatch
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWatcherCheck(t *testing.T) {
+	addrs := []string{"eth0 192.168.1.5/24"}
+	var snapErr error
+	w := New(time.Second, nil)
+	w.snapshot = func() ([]string, error) { return addrs, snapErr }
+
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	if _, ok := w.check(start, 0); ok {
+		t.Fatal("first check should only record the baseline")
+	}
+	if change, ok := w.check(start.Add(time.Second), time.Second); ok {
+		t.Fatalf("steady state fired %+v", change)
+	}
+
+	addrs = []string{"wlan0 10.0.0.7/24"}
+	change, ok := w.check(start.Add(2*time.Second), time.Second)
+	if !ok || change.Reason != ReasonNetwork {
+		t.Fatalf("address change = %+v, %v", change, ok)
+	}
+	if change.Detail != "+wlan0 10.0.0.7/24, -eth0 192.168.1.5/24" {
+		t.Fatalf("detail = %q", change.Detail)
+	}
+
+	// A failed snapshot keeps the previous addresses instead of reporting
+	// every interface as gone.
+	snapErr = errors.New("boom")
+	if change, ok := w.check(start.Add(3*time.Second), time.Second); ok {
+		t.Fatalf("snapshot error fired %+v", change)
+	}
+	snapErr = nil
+
+	// Monotonic time stands still while suspended, the wall clock does not.
+	change, ok = w.check(start.Add(time.Hour), time.Second)
+	if !ok || change.Reason != ReasonResume {
+		t.Fatalf("wall clock jump = %+v, %v", change, ok)
+	}
+	// So does a ticker that fired far too late.
+	change, ok = w.check(start.Add(time.Hour+time.Minute), time.Minute)
+	if !ok || change.Reason != ReasonResume {
+		t.Fatalf("late tick = %+v, %v", change, ok)
+	}
+	if change, ok := w.check(start.Add(time.Hour+time.Minute+2*time.Second), 2*time.Second); ok {
+		t.Fatalf("small scheduling delay fired %+v", change)
+	}
+}
+
+func TestWatcherStartStop(t *testing.T) {
+	w := New(10*time.Millisecond, func(Change) {})
+	w.Start()
+	w.Start()
+	time.Sleep(30 * time.Millisecond)
+	w.Stop()
+	w.Stop()
+}
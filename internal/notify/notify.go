@@ -0,0 +1,589 @@
+// Package notify reports tunnel state changes to user-configured sinks: HTTP
+// webhooks with a templated JSON body, or local commands. Changes are
+// debounced per sink and tunnel, a tunnel that keeps flapping is reported
+// once until it settles, and failed deliveries are retried with backoff.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"loris-tunnel/internal/forward"
+	"loris-tunnel/internal/model"
+)
+
+// Sink types.
+const (
+	TypeWebhook = "webhook"
+	TypeCommand = "command"
+)
+
+// Events a sink can subscribe to. Flapping is sent in place of the changes
+// of a tunnel that changes state too often.
+const (
+	EventRunning   = "running"
+	EventError     = "error"
+	EventStopped   = "stopped"
+	EventPaused    = "paused"
+	EventDegraded  = "degraded"
+	EventRecovered = "recovered"
+	EventFlapping  = "flapping"
+)
+
+// Events lists every event a sink may filter on.
+var Events = []string{EventRunning, EventError, EventStopped, EventPaused, EventDegraded, EventRecovered, EventFlapping}
+
+const (
+	// DefaultBodyTemplate posts {"text": "..."}, which Slack, Mattermost
+	// and Teams incoming webhooks accept as is.
+	DefaultBodyTemplate = `{"text": {{json .Text}}}`
+
+	DefaultFlapWindow = 10 * time.Minute
+	MaxRetries        = 10
+	MaxDebounceMs     = 10 * 60 * 1000
+
+	requestTimeout    = 10 * time.Second
+	commandTimeout    = 30 * time.Second
+	defaultRetryDelay = 2 * time.Second
+	maxRetryDelay     = time.Minute
+	responseLimit     = 64 << 10
+)
+
+var (
+	ErrUnknownType     = errors.New("notification type must be webhook or command")
+	ErrInvalidURL      = errors.New("webhook url must be an http or https url")
+	ErrCommandRequired = errors.New("command is required")
+	ErrInvalidBody     = errors.New("body template must render valid JSON")
+)
+
+// Source reads the configured sinks and tunnel names. The functions are
+// called by Refresh rather than per event, so call Refresh after config
+// edits to apply them without restarting the notifier.
+type Source struct {
+	Sinks       func() ([]model.NotificationSink, error)
+	TunnelNames func() (map[int]string, error)
+}
+
+type stateKey struct {
+	sinkID   int
+	tunnelID int
+}
+
+type delivery struct {
+	sink model.NotificationSink
+	note model.Notification
+}
+
+// tunnelState tracks one tunnel as seen by one sink.
+type tunnelState struct {
+	sink      model.NotificationSink
+	pending   *model.Notification
+	delivered string
+	debounce  *time.Timer
+
+	changes  []time.Time
+	flapping bool
+	calm     *time.Timer
+
+	queue   []delivery
+	sending bool
+}
+
+// Notifier turns tunnel events into notifications. Create it with New, feed
+// it with Run and stop it with Close.
+type Notifier struct {
+	source     Source
+	retryDelay time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	states  map[stateKey]*tunnelState
+	sinks   []model.NotificationSink
+	tunnels map[int]string
+	loaded  bool
+	closed  bool
+}
+
+func New(source Source) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{
+		source:     source,
+		retryDelay: defaultRetryDelay,
+		ctx:        ctx,
+		cancel:     cancel,
+		states:     make(map[stateKey]*tunnelState),
+	}
+}
+
+// Run handles events until the channel is closed.
+func (n *Notifier) Run(events <-chan model.TunnelEvent) {
+	n.Refresh()
+	for evt := range events {
+		n.Handle(evt)
+	}
+}
+
+// Refresh reloads the sinks and tunnel names from the source and forgets
+// the state kept for sinks and tunnels that are gone, disabled or no longer
+// watched. On error the previous sinks stay in use.
+func (n *Notifier) Refresh() {
+	sinks, err := n.source.Sinks()
+	if err != nil {
+		slog.Warn("notification sinks unavailable", "err", err)
+		return
+	}
+	var tunnels map[int]string
+	if n.source.TunnelNames != nil {
+		if tunnels, err = n.source.TunnelNames(); err != nil {
+			slog.Warn("notification tunnel names unavailable", "err", err)
+			return
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sinks, n.tunnels, n.loaded = sinks, tunnels, true
+	for key, st := range n.states {
+		idx := slices.IndexFunc(sinks, func(s model.NotificationSink) bool { return s.ID == key.sinkID })
+		_, known := tunnels[key.tunnelID]
+		if idx >= 0 && sinks[idx].Enabled && watchesTunnel(sinks[idx], key.tunnelID) && (tunnels == nil || known) {
+			st.sink = sinks[idx]
+			continue
+		}
+		stopTimer(st.debounce)
+		stopTimer(st.calm)
+		st.pending, st.queue = nil, nil
+		delete(n.states, key)
+	}
+}
+
+// Close drops pending notifications and abandons retries. Deliveries
+// already in flight finish on their own.
+func (n *Notifier) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	n.closed = true
+	n.cancel()
+	for _, st := range n.states {
+		stopTimer(st.debounce)
+		stopTimer(st.calm)
+		st.pending, st.queue = nil, nil
+	}
+}
+
+// Handle feeds one tunnel event to every enabled sink that watches the
+// tunnel, as of the last Refresh. Entries other than state changes are
+// ignored.
+func (n *Notifier) Handle(evt model.TunnelEvent) {
+	event := eventName(evt.Entry)
+	if event == "" {
+		return
+	}
+	n.mu.Lock()
+	loaded := n.loaded
+	n.mu.Unlock()
+	if !loaded {
+		n.Refresh()
+	}
+	n.mu.Lock()
+	sinks, name := n.sinks, n.tunnels[evt.TunnelID]
+	n.mu.Unlock()
+	at := evt.Entry.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	for _, sink := range sinks {
+		if !sink.Enabled || !watchesTunnel(sink, evt.TunnelID) {
+			continue
+		}
+		note := model.Notification{
+			Time:     at,
+			Event:    event,
+			TunnelID: evt.TunnelID,
+			Tunnel:   name,
+			Message:  evt.Entry.Message,
+			Error:    evt.Entry.Error,
+			Sink:     sink.Name,
+		}
+		note.Text = summary(note)
+		n.observe(sink, note)
+	}
+}
+
+// eventName maps a tunnel log entry to a notification event, or "" for
+// entries that are not state changes, such as hook output or the transient
+// busy status.
+func eventName(entry model.TunnelLogEntry) string {
+	switch entry.Source {
+	case "status":
+		switch entry.Event {
+		case EventRunning, EventError, EventStopped, EventPaused:
+			return entry.Event
+		}
+	case "health":
+		switch entry.Event {
+		case EventDegraded, EventRecovered:
+			return entry.Event
+		}
+	}
+	return ""
+}
+
+func watchesTunnel(sink model.NotificationSink, id int) bool {
+	return len(sink.TunnelIDs) == 0 || slices.Contains(sink.TunnelIDs, id)
+}
+
+func wantsEvent(sink model.NotificationSink, event string) bool {
+	return len(sink.Events) == 0 || slices.Contains(sink.Events, event)
+}
+
+func (n *Notifier) observe(sink model.NotificationSink, note model.Notification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	key := stateKey{sinkID: sink.ID, tunnelID: note.TunnelID}
+	st := n.states[key]
+	if st == nil {
+		st = &tunnelState{}
+		n.states[key] = st
+	}
+	st.sink = sink
+	st.pending = &note
+
+	if sink.FlapThreshold > 0 {
+		window := flapWindow(sink)
+		now := time.Now()
+		st.changes = append(slices.DeleteFunc(st.changes, func(t time.Time) bool {
+			return now.Sub(t) > window
+		}), now)
+		if st.flapping {
+			st.calm.Reset(window)
+			return
+		}
+		if len(st.changes) >= sink.FlapThreshold {
+			// Report the flap once and hold everything else until the
+			// tunnel has been quiet for a whole window.
+			st.flapping = true
+			stopTimer(st.debounce)
+			flap := note
+			flap.Event = EventFlapping
+			flap.Message = fmt.Sprintf("changed state %d times within %s, notifications paused until it settles", len(st.changes), window)
+			flap.Error = ""
+			flap.Text = summary(flap)
+			st.delivered = EventFlapping
+			if wantsEvent(sink, EventFlapping) {
+				n.enqueueLocked(st, delivery{sink: sink, note: flap})
+			}
+			st.calm = time.AfterFunc(window, func() { n.settle(key) })
+			return
+		}
+	}
+
+	if sink.DebounceMs <= 0 {
+		n.flushLocked(st)
+		return
+	}
+	delay := time.Duration(sink.DebounceMs) * time.Millisecond
+	if st.debounce == nil {
+		st.debounce = time.AfterFunc(delay, func() { n.fire(key) })
+	} else {
+		st.debounce.Reset(delay)
+	}
+}
+
+func (n *Notifier) fire(key stateKey) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if st := n.states[key]; st != nil && !n.closed && !st.flapping {
+		n.flushLocked(st)
+	}
+}
+
+// settle ends a flap and reports the state the tunnel came to rest in.
+func (n *Notifier) settle(key stateKey) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	st := n.states[key]
+	if st == nil || n.closed || !st.flapping {
+		return
+	}
+	st.flapping = false
+	st.changes = nil
+	n.flushLocked(st)
+}
+
+// flushLocked delivers the pending change unless it leaves the tunnel in
+// the state last reported, as when it dropped and came back within the
+// debounce. The event filter applies here rather than on arrival so the
+// last reported state stays accurate.
+func (n *Notifier) flushLocked(st *tunnelState) {
+	note := st.pending
+	st.pending = nil
+	if note == nil || note.Event == st.delivered {
+		return
+	}
+	st.delivered = note.Event
+	if wantsEvent(st.sink, note.Event) {
+		n.enqueueLocked(st, delivery{sink: st.sink, note: *note})
+	}
+}
+
+// enqueueLocked queues d behind earlier deliveries for the same tunnel so a
+// retried notification never arrives after the change that followed it.
+func (n *Notifier) enqueueLocked(st *tunnelState, d delivery) {
+	st.queue = append(st.queue, d)
+	if st.sending {
+		return
+	}
+	st.sending = true
+	go n.drain(st)
+}
+
+func (n *Notifier) drain(st *tunnelState) {
+	for {
+		n.mu.Lock()
+		if len(st.queue) == 0 || n.closed {
+			st.sending = false
+			n.mu.Unlock()
+			return
+		}
+		d := st.queue[0]
+		st.queue = st.queue[1:]
+		n.mu.Unlock()
+		n.sendWithRetry(d)
+	}
+}
+
+func (n *Notifier) sendWithRetry(d delivery) {
+	attempts := 1 + min(max(d.sink.Retries, 0), MaxRetries)
+	delay := n.retryDelay
+	for attempt := 1; ; attempt++ {
+		err := Send(n.ctx, d.sink, d.note)
+		if err == nil {
+			slog.Info("notification sent", "sink", d.sink.Name, "tunnel_id", d.note.TunnelID, "event", d.note.Event)
+			return
+		}
+		var perm permanentError
+		if attempt >= attempts || errors.As(err, &perm) || n.ctx.Err() != nil {
+			slog.Warn("notification failed", "sink", d.sink.Name, "tunnel_id", d.note.TunnelID, "event", d.note.Event, "attempts", attempt, "err", err)
+			return
+		}
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// permanentError marks a failure that retrying cannot fix, such as a
+// webhook answering 404.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Send delivers note to sink once, without debounce or retries.
+func Send(ctx context.Context, sink model.NotificationSink, note model.Notification) error {
+	switch sink.Type {
+	case TypeWebhook:
+		return sendWebhook(ctx, sink, note)
+	case TypeCommand:
+		return runCommand(sink, note)
+	default:
+		return permanentError{ErrUnknownType}
+	}
+}
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+func sendWebhook(ctx context.Context, sink model.NotificationSink, note model.Notification) error {
+	body, err := RenderBody(sink.BodyTemplate, note)
+	if err != nil {
+		return permanentError{err}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.URL, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{fmt.Errorf("build webhook request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "loris-tunnel")
+	for k, v := range sink.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, responseLimit))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("webhook returned %s", resp.Status)
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout {
+		return err
+	}
+	return permanentError{err}
+}
+
+func runCommand(sink model.NotificationSink, note model.Notification) error {
+	env := []string{
+		"LORIS_TUNNEL_EVENT=" + note.Event,
+		"LORIS_TUNNEL_ID=" + strconv.Itoa(note.TunnelID),
+		"LORIS_TUNNEL_NAME=" + note.Tunnel,
+		"LORIS_TUNNEL_MESSAGE=" + note.Message,
+		"LORIS_NOTIFICATION_TEXT=" + note.Text,
+		"LORIS_NOTIFICATION_TIME=" + note.Time.Format(time.RFC3339),
+	}
+	if note.Error != "" {
+		env = append(env, "LORIS_TUNNEL_ERROR="+note.Error)
+	}
+	output, err := forward.RunLocalCommand(sink.Command, env, commandTimeout)
+	if err != nil {
+		if output = strings.TrimSpace(output); output != "" {
+			return fmt.Errorf("notification command: %w: %s", err, output)
+		}
+		return fmt.Errorf("notification command: %w", err)
+	}
+	return nil
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// RenderBody renders a webhook body template against note. An empty
+// template uses DefaultBodyTemplate. The template sees the fields of
+// model.Notification and a json function that quotes any value.
+func RenderBody(text string, note model.Notification) ([]byte, error) {
+	if strings.TrimSpace(text) == "" {
+		text = DefaultBodyTemplate
+	}
+	tmpl, err := template.New("body").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse body template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, note); err != nil {
+		return nil, fmt.Errorf("render body template: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, ErrInvalidBody
+	}
+	return buf.Bytes(), nil
+}
+
+// Validate checks a sink before it is saved, rendering the body template
+// against a sample notification.
+func Validate(sink model.NotificationSink) error {
+	switch sink.Type {
+	case TypeWebhook:
+		u, err := url.Parse(sink.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidURL
+		}
+		if _, err := RenderBody(sink.BodyTemplate, Sample(sink.Name)); err != nil {
+			return err
+		}
+	case TypeCommand:
+		if strings.TrimSpace(sink.Command) == "" {
+			return ErrCommandRequired
+		}
+	default:
+		return ErrUnknownType
+	}
+	for _, event := range sink.Events {
+		if !slices.Contains(Events, event) {
+			return fmt.Errorf("unknown notification event %q", event)
+		}
+	}
+	return nil
+}
+
+// Sample returns the notification sent when testing a sink.
+func Sample(sinkName string) model.Notification {
+	note := model.Notification{
+		Time:    time.Now(),
+		Event:   EventError,
+		Tunnel:  "example",
+		Message: "test notification",
+		Error:   "this is a test, no tunnel has changed",
+		Sink:    sinkName,
+	}
+	note.Text = summary(note)
+	return note
+}
+
+// summary is the one-line text of a notification, e.g.
+// `Tunnel "db" failed: ssh: handshake failed`.
+func summary(note model.Notification) string {
+	var what string
+	switch note.Event {
+	case EventRunning:
+		what = "is running"
+	case EventError:
+		what = "failed"
+	case EventStopped:
+		what = "stopped"
+	case EventPaused:
+		what = "is paused"
+	case EventDegraded:
+		what = "is degraded"
+	case EventRecovered:
+		what = "recovered"
+	case EventFlapping:
+		what = "is flapping"
+	default:
+		what = note.Event
+	}
+	name := note.Tunnel
+	if name == "" {
+		name = "#" + strconv.Itoa(note.TunnelID)
+	}
+	text := fmt.Sprintf("Tunnel %q %s", name, what)
+	switch {
+	case note.Error != "":
+		text += ": " + note.Error
+	case note.Event == EventFlapping:
+		text += ": " + note.Message
+	}
+	return text
+}
+
+func flapWindow(sink model.NotificationSink) time.Duration {
+	if sink.FlapWindowMs > 0 {
+		return time.Duration(sink.FlapWindowMs) * time.Millisecond
+	}
+	return DefaultFlapWindow
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
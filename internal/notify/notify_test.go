@@ -0,0 +1,305 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/model"
+)
+
+type received struct {
+	Event    string `json:"event"`
+	Tunnel   string `json:"tunnel"`
+	TunnelID int    `json:"tunnelId"`
+	Text     string `json:"text"`
+	token    string
+}
+
+// hookServer collects webhook bodies rendered from a template that echoes
+// the event, tunnel and text.
+func hookServer(t *testing.T) (*httptest.Server, <-chan received) {
+	t.Helper()
+	got := make(chan received, 32)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var rec received
+		if err := json.Unmarshal(body, &rec); err != nil {
+			t.Errorf("webhook body %q: %v", body, err)
+		}
+		rec.token = r.Header.Get("X-Token")
+		got <- rec
+	}))
+	t.Cleanup(ts.Close)
+	return ts, got
+}
+
+const testTemplate = `{"event": {{json .Event}}, "tunnel": {{json .Tunnel}}, "tunnelId": {{.TunnelID}}, "text": {{json .Text}}}`
+
+func newTestNotifier(t *testing.T, sinks ...model.NotificationSink) *Notifier {
+	t.Helper()
+	n := New(Source{
+		Sinks:       func() ([]model.NotificationSink, error) { return sinks, nil },
+		TunnelNames: func() (map[int]string, error) { return map[int]string{1: "db", 2: "web"}, nil },
+	})
+	n.retryDelay = time.Millisecond
+	t.Cleanup(n.Close)
+	return n
+}
+
+func webhookSink(url string) model.NotificationSink {
+	return model.NotificationSink{ID: 1, Name: "ops", Type: TypeWebhook, Enabled: true, URL: url, BodyTemplate: testTemplate}
+}
+
+func status(id int, event string) model.TunnelEvent {
+	return model.TunnelEvent{TunnelID: id, Entry: model.TunnelLogEntry{Source: "status", Event: event, Message: "tunnel " + event}}
+}
+
+// expect waits for the given events in order and then checks nothing else
+// arrives shortly after.
+func expect(t *testing.T, got <-chan received, events ...string) []received {
+	t.Helper()
+	var out []received
+	for _, want := range events {
+		select {
+		case rec := <-got:
+			if rec.Event != want {
+				t.Fatalf("notification %d = %q, want %q (so far %+v)", len(out), rec.Event, want, out)
+			}
+			out = append(out, rec)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q after %+v", want, out)
+		}
+	}
+	select {
+	case rec := <-got:
+		t.Fatalf("unexpected notification %+v", rec)
+	case <-time.After(100 * time.Millisecond):
+	}
+	return out
+}
+
+func TestWebhookTemplateAndHeaders(t *testing.T) {
+	ts, got := hookServer(t)
+	sink := webhookSink(ts.URL)
+	sink.Headers = map[string]string{"X-Token": "secret"}
+	n := newTestNotifier(t, sink)
+
+	n.Handle(model.TunnelEvent{TunnelID: 1, Entry: model.TunnelLogEntry{Source: "status", Event: "error", Error: "ssh: handshake failed"}})
+	rec := expect(t, got, EventError)[0]
+	if rec.Tunnel != "db" || rec.TunnelID != 1 || rec.token != "secret" {
+		t.Fatalf("received %+v", rec)
+	}
+	if rec.Text != `Tunnel "db" failed: ssh: handshake failed` {
+		t.Fatalf("text = %q", rec.Text)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	ts, got := hookServer(t)
+	sink := webhookSink(ts.URL)
+	sink.TunnelIDs = []int{2}
+	sink.Events = []string{EventError}
+	disabled := webhookSink(ts.URL)
+	disabled.ID = 2
+	disabled.Enabled = false
+	n := newTestNotifier(t, sink, disabled)
+
+	n.Handle(status(1, "error"))
+	n.Handle(status(2, "busy"))
+	n.Handle(model.TunnelEvent{TunnelID: 2, Entry: model.TunnelLogEntry{Source: "hook", Event: "started"}})
+	n.Handle(status(2, "running"))
+	n.Handle(status(2, "error"))
+	rec := expect(t, got, EventError)[0]
+	if rec.TunnelID != 2 {
+		t.Fatalf("received %+v", rec)
+	}
+
+	// A filtered-out change still counts as the state last seen, so the
+	// next failure is reported rather than taken for a repeat.
+	n.Handle(status(2, "running"))
+	n.Handle(status(2, "error"))
+	expect(t, got, EventError)
+}
+
+func TestDebounceDropsBlips(t *testing.T) {
+	ts, got := hookServer(t)
+	sink := webhookSink(ts.URL)
+	sink.DebounceMs = 50
+	n := newTestNotifier(t, sink)
+
+	n.Handle(status(1, "error"))
+	n.Handle(status(1, "running"))
+	expect(t, got, EventRunning)
+
+	// Down and back up within the debounce: nothing to report.
+	n.Handle(status(1, "error"))
+	n.Handle(status(1, "running"))
+	expect(t, got)
+
+	n.Handle(status(1, "error"))
+	expect(t, got, EventError)
+}
+
+func TestRefreshAppliesSinkEdits(t *testing.T) {
+	ts, got := hookServer(t)
+	sink := webhookSink(ts.URL)
+	sink.DebounceMs = 100
+	sinks := []model.NotificationSink{sink}
+	var loads atomic.Int32
+	n := New(Source{
+		Sinks: func() ([]model.NotificationSink, error) {
+			loads.Add(1)
+			return sinks, nil
+		},
+		TunnelNames: func() (map[int]string, error) { return map[int]string{1: "db"}, nil },
+	})
+	t.Cleanup(n.Close)
+
+	n.Handle(status(1, "error"))
+	n.Handle(status(1, "running"))
+	expect(t, got, EventRunning)
+	if loads.Load() != 1 {
+		t.Fatalf("sinks loaded %d times, want once", loads.Load())
+	}
+
+	// Deleting the sink drops its pending change and its state.
+	n.Handle(status(1, "error"))
+	sinks = nil
+	n.Refresh()
+	expect(t, got)
+	n.mu.Lock()
+	left := len(n.states)
+	n.mu.Unlock()
+	if left != 0 {
+		t.Fatalf("%d states left after the sink was deleted", left)
+	}
+	n.Handle(status(1, "running"))
+	expect(t, got)
+}
+
+func TestFlapSuppression(t *testing.T) {
+	ts, got := hookServer(t)
+	sink := webhookSink(ts.URL)
+	sink.FlapThreshold = 3
+	sink.FlapWindowMs = 300
+	n := newTestNotifier(t, sink)
+
+	n.Handle(status(1, "running"))
+	n.Handle(status(1, "error"))
+	n.Handle(status(1, "running"))
+	n.Handle(status(1, "error"))
+	n.Handle(status(1, "running"))
+	// Once the tunnel has been quiet for a window, the state it settled
+	// in is reported even if it matches the one before the flap.
+	recs := expect(t, got, EventRunning, EventError, EventFlapping, EventRunning)
+	if !strings.Contains(recs[2].Text, "is flapping") {
+		t.Fatalf("flap text = %q", recs[2].Text)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	sink := webhookSink(ts.URL)
+	sink.Retries = 3
+	n := newTestNotifier(t, sink)
+
+	n.sendWithRetry(delivery{sink: sink, note: Sample(sink.Name)})
+	if calls.Load() != 3 {
+		t.Fatalf("calls = %d, want 3", calls.Load())
+	}
+
+	calls.Store(0)
+	sink.Retries = 1
+	n.sendWithRetry(delivery{sink: sink, note: Sample(sink.Name)})
+	if calls.Load() != 2 {
+		t.Fatalf("calls with one retry = %d, want 2", calls.Load())
+	}
+}
+
+func TestClientErrorsAreNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	sink := webhookSink(ts.URL)
+	sink.Retries = 3
+	n := newTestNotifier(t, sink)
+
+	err := Send(n.ctx, sink, Sample(sink.Name))
+	var perm permanentError
+	if !errors.As(err, &perm) {
+		t.Fatalf("err = %v, want a permanent error", err)
+	}
+	n.sendWithRetry(delivery{sink: sink, note: Sample(sink.Name)})
+	if calls.Load() != 2 {
+		t.Fatalf("calls = %d, want one per send", calls.Load())
+	}
+}
+
+func TestCommandSink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	sink := model.NotificationSink{
+		ID: 1, Name: "log", Type: TypeCommand, Enabled: true,
+		Command: `printf '%s %s' "$LORIS_TUNNEL_EVENT" "$LORIS_TUNNEL_NAME" > ` + out,
+	}
+	note := Sample(sink.Name)
+	if err := Send(context.Background(), sink, note); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil || string(data) != "error example" {
+		t.Fatalf("command wrote %q, %v", data, err)
+	}
+
+	sink.Command = "echo broken >&2; exit 3"
+	if err := Send(context.Background(), sink, note); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("failing command err = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		sink model.NotificationSink
+		want error
+	}{
+		{"default body", model.NotificationSink{Type: TypeWebhook, URL: "https://hooks.example.com/x"}, nil},
+		{"bad scheme", model.NotificationSink{Type: TypeWebhook, URL: "ftp://example.com"}, ErrInvalidURL},
+		{"not json", model.NotificationSink{Type: TypeWebhook, URL: "http://localhost/x", BodyTemplate: `{{.Text}}`}, ErrInvalidBody},
+		{"no command", model.NotificationSink{Type: TypeCommand, Command: "  "}, ErrCommandRequired},
+		{"unknown type", model.NotificationSink{Type: "email"}, ErrUnknownType},
+	}
+	for _, tc := range cases {
+		if err := Validate(tc.sink); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if err := Validate(model.NotificationSink{Type: TypeCommand, Command: "true", Events: []string{"busy"}}); err == nil {
+		t.Error("accepted an unknown event")
+	}
+	if err := Validate(model.NotificationSink{Type: TypeWebhook, URL: "http://localhost", BodyTemplate: `{{.Nope}}`}); err == nil {
+		t.Error("accepted a template with an unknown field")
+	}
+}
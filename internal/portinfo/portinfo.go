@@ -0,0 +1,43 @@
+// Package portinfo finds out which process holds a local TCP port so a
+// failed listen can name the culprit.
+package portinfo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnsupported = errors.New("port owner lookup is not supported on this platform")
+	ErrNotFound    = errors.New("no listening socket found for port")
+)
+
+// Process describes the owner of a listening socket. PID is zero when the
+// socket was found but its process could not be inspected, typically
+// because it belongs to another user.
+type Process struct {
+	PID     int
+	UID     int
+	Name    string
+	Command string
+}
+
+func (p Process) String() string {
+	if p.PID == 0 {
+		return fmt.Sprintf("a process of uid %d", p.UID)
+	}
+	name := p.Name
+	if name == "" {
+		name = strings.Fields(p.Command + " ?")[0]
+	}
+	return fmt.Sprintf("%s (pid %d)", name, p.PID)
+}
+
+// ListeningProcess returns the process listening on TCP port.
+func ListeningProcess(port int) (Process, error) {
+	if port < 1 || port > 65535 {
+		return Process{}, fmt.Errorf("invalid port %d", port)
+	}
+	return listeningProcess(port)
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package portinfo
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpListen is the TCP_LISTEN state in /proc/net/tcp.
+const tcpListen = "0A"
+
+func listeningProcess(port int) (Process, error) {
+	return lookup("/proc", port)
+}
+
+// lookup finds the listening socket for port in procRoot/net/tcp{,6} and
+// then the process holding that socket's inode.
+func lookup(procRoot string, port int) (Process, error) {
+	var inode string
+	uid := -1
+	for _, name := range []string{"tcp", "tcp6"} {
+		var err error
+		inode, uid, err = findListeningInode(filepath.Join(procRoot, "net", name), port)
+		if err != nil {
+			return Process{}, err
+		}
+		if inode != "" {
+			break
+		}
+	}
+	if inode == "" {
+		return Process{}, fmt.Errorf("%w %d", ErrNotFound, port)
+	}
+
+	pid, err := findSocketOwner(procRoot, inode)
+	if err != nil || pid == 0 {
+		return Process{UID: uid}, nil
+	}
+	proc := Process{PID: pid, UID: uid}
+	if raw, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "comm")); err == nil {
+		proc.Name = strings.TrimSpace(string(raw))
+	}
+	if raw, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cmdline")); err == nil {
+		proc.Command = strings.TrimSpace(strings.ReplaceAll(string(raw), "\x00", " "))
+	}
+	return proc, nil
+}
+
+// findListeningInode scans a /proc/net/tcp style table for a socket in
+// LISTEN state on port. A missing table (no IPv6) is not an error.
+func findListeningInode(table string, port int) (string, int, error) {
+	f, err := os.Open(table)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", -1, nil
+		}
+		return "", -1, fmt.Errorf("read %s failed: %w", table, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		idx := strings.LastIndexByte(fields[1], ':')
+		if idx < 0 {
+			continue
+		}
+		localPort, err := strconv.ParseUint(fields[1][idx+1:], 16, 16)
+		if err != nil || int(localPort) != port {
+			continue
+		}
+		uid, _ := strconv.Atoi(fields[7])
+		return fields[9], uid, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", -1, fmt.Errorf("read %s failed: %w", table, err)
+	}
+	return "", -1, nil
+}
+
+// findSocketOwner returns the pid with a file descriptor on the socket
+// inode, or 0 when none of the readable processes has it.
+func findSocketOwner(procRoot, inode string) (int, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return 0, err
+	}
+	target := "socket:[" + inode + "]"
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid <= 0 {
+			continue
+		}
+		fdDir := filepath.Join(procRoot, entry.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err == nil && link == target {
+				return pid, nil
+			}
+		}
+	}
+	return 0, nil
+}
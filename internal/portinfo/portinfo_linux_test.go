@@ -0,0 +1,83 @@
+//go:build linux
+
+package portinfo
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLookupFakeProc(t *testing.T) {
+	root := t.TempDir()
+	header := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+	writeFile(t, filepath.Join(root, "net", "tcp"), header+
+		"   0: 0100007F:1538 00000000:0000 01 00000000:00000000 00:00000000 00000000  1000        0 1111 1\n"+
+		"   1: 0100007F:1538 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 5555 1\n"+
+		"   2: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 7777 1\n")
+	writeFile(t, filepath.Join(root, "4321", "comm"), "postgres\n")
+	writeFile(t, filepath.Join(root, "4321", "cmdline"), "postgres\x00-D\x00/var/lib/pg\x00")
+	if err := os.MkdirAll(filepath.Join(root, "4321", "fd"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("socket:[5555]", filepath.Join(root, "4321", "fd", "7")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 0x1538 = 5432
+	proc, err := lookup(root, 5432)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if proc.PID != 4321 || proc.UID != 1000 || proc.Name != "postgres" || proc.Command != "postgres -D /var/lib/pg" {
+		t.Fatalf("proc = %+v", proc)
+	}
+	if proc.String() != "postgres (pid 4321)" {
+		t.Fatalf("String() = %q", proc.String())
+	}
+
+	// Port 22 is listening but no readable process owns the inode.
+	proc, err = lookup(root, 22)
+	if err != nil || proc.PID != 0 || proc.UID != 0 {
+		t.Fatalf("lookup(22) = %+v, %v", proc, err)
+	}
+	if proc.String() != "a process of uid 0" {
+		t.Fatalf("String() = %q", proc.String())
+	}
+
+	if _, err := lookup(root, 8080); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("lookup(8080) err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestListeningProcessFindsSelf(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	proc, err := ListeningProcess(ln.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		t.Fatalf("ListeningProcess: %v", err)
+	}
+	if proc.PID != os.Getpid() {
+		t.Fatalf("pid = %d, want %d (%s)", proc.PID, os.Getpid(), proc)
+	}
+	if !strings.Contains(proc.String(), "pid") {
+		t.Fatalf("String() = %q", proc.String())
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package portinfo
+
+func listeningProcess(int) (Process, error) {
+	return Process{}, ErrUnsupported
+}
@@ -0,0 +1,519 @@
+// Package restapi serves an opt-in HTTP API on localhost so scripts and test
+// harnesses can drive tunnels. It is backed by the same biz layer as the
+// desktop UI, and every request needs the bearer token kept in the config
+// directory.
+package restapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"loris-tunnel/internal/biz"
+	"loris-tunnel/internal/journal"
+	"loris-tunnel/internal/loopback"
+	"loris-tunnel/internal/model"
+)
+
+const (
+	DefaultPort = 47120
+
+	eventHeartbeat = 15 * time.Second
+	eventBuffer    = 256
+)
+
+// Backend hands the server the current biz objects. They are looked up per
+// request because the app replaces them when a config is imported.
+type Backend struct {
+	Tunnels    func() *biz.TunnelBiz
+	Jumpers    func() *biz.JumperBiz
+	Groups     func() *biz.GroupBiz
+	Journal    func() *journal.Journal
+	StartLimit func() int
+}
+
+// Server is the HTTP API. Create it with New and bind it with Start.
+type Server struct {
+	backend Backend
+
+	mu     sync.Mutex
+	token  string
+	srv    *http.Server
+	addr   string
+	closed chan struct{}
+
+	trafficMu   sync.Mutex
+	lastUp      uint64
+	lastDown    uint64
+	lastTraffic time.Time
+}
+
+// RuntimeStatus is the live state of one tunnel as reported by /status.
+type RuntimeStatus struct {
+	ID             int                 `json:"id"`
+	Name           string              `json:"name"`
+	Status         string              `json:"status"`
+	LastError      string              `json:"lastError,omitempty"`
+	LatencyMs      int64               `json:"latencyMs"`
+	BoundLocalPort int                 `json:"boundLocalPort,omitempty"`
+	LazyState      string              `json:"lazyState,omitempty"`
+	TTLRemainingMs int64               `json:"ttlRemainingMs,omitempty"`
+	Health         *model.TunnelHealth `json:"health,omitempty"`
+	Warnings       []string            `json:"warnings,omitempty"`
+}
+
+// Status is the body of GET /api/v1/status.
+type Status struct {
+	Running int             `json:"running"`
+	Tunnels []RuntimeStatus `json:"tunnels"`
+}
+
+// Traffic is the body of GET /api/v1/traffic. Rates are averaged since the
+// previous call.
+type Traffic struct {
+	UpBytes   uint64 `json:"upBytes"`
+	DownBytes uint64 `json:"downBytes"`
+	UpBps     int64  `json:"upBps"`
+	DownBps   int64  `json:"downBps"`
+}
+
+func New(backend Backend, token string) *Server {
+	return &Server{backend: backend, token: token}
+}
+
+// SetToken swaps the accepted bearer token.
+func (s *Server) SetToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// Start listens on 127.0.0.1:port; port 0 picks a free one.
+func (s *Server) Start(port int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv != nil {
+		return fmt.Errorf("api server already running on %s", s.addr)
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("api listen: %w", err)
+	}
+	s.srv = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.addr = ln.Addr().String()
+	s.closed = make(chan struct{})
+	srv := s.srv
+	slog.Info("api server listening", "addr", s.addr)
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("api server stopped", "err", err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the bound address, empty when not running.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// Close stops the server and ends open event streams.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	srv, closed := s.srv, s.closed
+	s.srv, s.addr, s.closed = nil, "", nil
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	close(closed)
+	slog.Info("api server stopped")
+	return srv.Close()
+}
+
+// Handler returns the API routes behind the token check.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/state", s.handleState)
+	mux.HandleFunc("GET /api/v1/status", s.handleStatus)
+	mux.HandleFunc("GET /api/v1/traffic", s.handleTraffic)
+	mux.HandleFunc("GET /api/v1/events", s.handleEvents)
+	mux.HandleFunc("GET /api/v1/journal", s.handleJournal)
+	mux.HandleFunc("GET /api/v1/tunnels", s.handleTunnels)
+	mux.HandleFunc("GET /api/v1/tunnels/{id}", s.handleTunnel)
+	mux.HandleFunc("GET /api/v1/tunnels/{id}/log", s.handleTunnelLog)
+	mux.HandleFunc("POST /api/v1/tunnels/{id}/start", s.handleStart)
+	mux.HandleFunc("POST /api/v1/tunnels/{id}/stop", s.handleStop)
+	mux.HandleFunc("POST /api/v1/tunnels/{id}/test", s.handleTest)
+	return s.authorize(mux)
+}
+
+// authorize checks the bearer token. It also refuses Host headers other than
+// loopback so a web page cannot reach the API through DNS rebinding.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !loopback.Host(r.Host) {
+			writeError(w, http.StatusForbidden, errors.New("host not allowed"))
+			return
+		}
+		s.mu.Lock()
+		token := s.token
+		s.mu.Unlock()
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="loris-tunnel"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	jumpers, err := s.backend.Jumpers().List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	groups, err := s.backend.Groups().List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	tunnels, err := s.backend.Tunnels().List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	redacted := make([]model.Jumper, len(jumpers))
+	for i, jumper := range jumpers {
+		redacted[i] = redactJumper(jumper)
+	}
+	writeJSON(w, http.StatusOK, model.State{Jumpers: redacted, Groups: groups, Tunnels: tunnels})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	tunnels, err := s.backend.Tunnels().List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	status := Status{Tunnels: make([]RuntimeStatus, 0, len(tunnels))}
+	for _, t := range tunnels {
+		if t.Status == "running" {
+			status.Running++
+		}
+		status.Tunnels = append(status.Tunnels, RuntimeStatus{
+			ID:             t.ID,
+			Name:           t.Name,
+			Status:         t.Status,
+			LastError:      t.LastError,
+			LatencyMs:      t.LatencyMs,
+			BoundLocalPort: t.BoundLocalPort,
+			LazyState:      t.LazyState,
+			TTLRemainingMs: t.TTLRemainingMs,
+			Health:         t.Health,
+			Warnings:       t.Warnings,
+		})
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handleTraffic(w http.ResponseWriter, r *http.Request) {
+	up, down := s.backend.Tunnels().TrafficSnapshot()
+	now := time.Now()
+	traffic := Traffic{UpBytes: up, DownBytes: down}
+
+	s.trafficMu.Lock()
+	if !s.lastTraffic.IsZero() && up >= s.lastUp && down >= s.lastDown {
+		if elapsed := now.Sub(s.lastTraffic).Seconds(); elapsed > 0 {
+			traffic.UpBps = int64(float64(up-s.lastUp) / elapsed)
+			traffic.DownBps = int64(float64(down-s.lastDown) / elapsed)
+		}
+	}
+	s.lastUp, s.lastDown, s.lastTraffic = up, down, now
+	s.trafficMu.Unlock()
+
+	writeJSON(w, http.StatusOK, traffic)
+}
+
+func (s *Server) handleTunnels(w http.ResponseWriter, r *http.Request) {
+	tunnels, err := s.backend.Tunnels().List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tunnels)
+}
+
+func (s *Server) handleTunnel(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	tunnels, err := s.backend.Tunnels().List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, t := range tunnels {
+		if t.ID == id {
+			writeJSON(w, http.StatusOK, t)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, biz.ErrTunnelNotFound)
+}
+
+func (s *Server) handleTunnelLog(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	entries := s.backend.Tunnels().Log(id)
+	if entries == nil {
+		entries = []model.TunnelLogEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	limit := 0
+	if s.backend.StartLimit != nil {
+		limit = s.backend.StartLimit()
+	}
+	tunnel, err := s.backend.Tunnels().Start(id, limit)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tunnel)
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	tunnel, err := s.backend.Tunnels().Stop(id)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tunnel)
+}
+
+func (s *Server) handleTest(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	latency, algorithms, err := s.backend.Tunnels().TestSaved(id)
+	if err != nil {
+		status := statusFor(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadGateway
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.TunnelConnectionTestResult{
+		LatencyMs:  latency.Milliseconds(),
+		Algorithms: algorithms,
+	})
+}
+
+// handleEvents streams tunnel events as server-sent events. ?tunnel=<id>
+// limits the stream to one tunnel. The stream ends when the app reloads its
+// config; clients should reconnect.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+	filter := 0
+	if raw := r.URL.Query().Get("tunnel"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid tunnel id %q", raw))
+			return
+		}
+		filter = id
+	}
+
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	events, cancel := s.backend.Tunnels().Subscribe(eventBuffer)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case evt, ok := <-events:
+			if !ok {
+				return
+			}
+			if filter > 0 && evt.TunnelID != filter {
+				continue
+			}
+			data, err := json.Marshal(evt)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: tunnel\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// handleJournal returns persisted events. Filters: tunnel=<id>, type=<t>
+// (repeatable or comma separated), since and until as RFC 3339 times, and
+// limit. format=csv returns CSV instead of JSON.
+func (s *Server) handleJournal(w http.ResponseWriter, r *http.Request) {
+	q, format, err := journalQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	entries, err := s.backend.Journal().Query(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if format == journal.FormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		_ = journal.Export(w, entries, journal.FormatCSV)
+		return
+	}
+	if entries == nil {
+		entries = []model.JournalEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func journalQuery(values url.Values) (model.JournalQuery, string, error) {
+	var q model.JournalQuery
+	if raw := values.Get("tunnel"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return q, "", fmt.Errorf("invalid tunnel id %q", raw)
+		}
+		q.TunnelID = id
+	}
+	for _, raw := range values["type"] {
+		for _, typ := range strings.Split(raw, ",") {
+			if typ = strings.TrimSpace(typ); typ != "" {
+				q.Types = append(q.Types, typ)
+			}
+		}
+	}
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		raw := values.Get(name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return q, "", fmt.Errorf("invalid %s %q: want an RFC 3339 time", name, raw)
+		}
+		*dst = t
+	}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return q, "", fmt.Errorf("invalid limit %q", raw)
+		}
+		q.Limit = limit
+	}
+	format := strings.ToLower(values.Get("format"))
+	switch format {
+	case "":
+		format = journal.FormatJSON
+	case journal.FormatJSON, journal.FormatCSV:
+	default:
+		return q, "", journal.ErrUnsupportedFormat
+	}
+	return q, format, nil
+}
+
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := r.PathValue("id")
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid tunnel id %q", raw))
+		return 0, false
+	}
+	return id, true
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, biz.ErrTunnelNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, biz.ErrFreePlanRunningLimit):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// redactJumper blanks the secrets a script has no business reading.
+func redactJumper(j model.Jumper) model.Jumper {
+	if j.Password != "" {
+		j.Password = "***"
+	}
+	if j.TOTPSecret != "" {
+		j.TOTPSecret = "***"
+	}
+	if u, err := url.Parse(j.UpstreamProxy); err == nil && u.User != nil {
+		j.UpstreamProxy = u.Redacted()
+	}
+	return j
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
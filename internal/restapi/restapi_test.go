@@ -0,0 +1,246 @@
+package restapi
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"loris-tunnel/internal/biz"
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/journal"
+	"loris-tunnel/internal/model"
+)
+
+const testToken = "secret-token"
+
+func newTestServer(t *testing.T) (*httptest.Server, model.Tunnel) {
+	t.Helper()
+	storage, err := conf.NewStorage(filepath.Join(t.TempDir(), "config.toml"))
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+	jumpers := biz.NewJumperBiz(storage)
+	jumper, err := jumpers.Create(model.JumperPayload{
+		Name:      "jump",
+		Host:      "127.0.0.1",
+		Port:      1,
+		User:      "root",
+		AuthType:  "password",
+		Password:  "hunter2",
+		TimeoutMs: 500,
+	})
+	if err != nil {
+		t.Fatalf("create jumper: %v", err)
+	}
+	events, err := journal.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	tunnels := biz.NewTunnelBiz(storage)
+	tunnels.SetJournal(events)
+	tunnel, err := tunnels.Create(model.TunnelPayload{
+		Name:       "db",
+		Mode:       "local",
+		JumperIDs:  []int{jumper.ID},
+		LocalHost:  "127.0.0.1",
+		LocalPort:  15432,
+		RemoteHost: "10.0.0.1",
+		RemotePort: 5432,
+	})
+	if err != nil {
+		t.Fatalf("create tunnel: %v", err)
+	}
+	groups := biz.NewGroupBiz(storage)
+	server := New(Backend{
+		Tunnels:    func() *biz.TunnelBiz { return tunnels },
+		Jumpers:    func() *biz.JumperBiz { return jumpers },
+		Groups:     func() *biz.GroupBiz { return groups },
+		Journal:    func() *journal.Journal { return events },
+		StartLimit: func() int { return 0 },
+	}, testToken)
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		tunnels.Shutdown()
+		events.Close()
+	})
+	return ts, tunnel
+}
+
+func doRequest(t *testing.T, method, url, token string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	return resp
+}
+
+func TestAPIRequiresTokenAndLoopbackHost(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	for _, token := range []string{"", "wrong"} {
+		resp := doRequest(t, http.MethodGet, ts.URL+"/api/v1/state", token)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("token %q status = %d", token, resp.StatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/state", nil)
+	req.Host = "evil.example.com"
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("foreign host status = %d", resp.StatusCode)
+	}
+}
+
+func TestAPIStateStartStop(t *testing.T) {
+	ts, tunnel := newTestServer(t)
+	base := ts.URL + "/api/v1/tunnels/"
+
+	resp := doRequest(t, http.MethodGet, ts.URL+"/api/v1/state", testToken)
+	var state model.State
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		t.Fatalf("decode state: %v", err)
+	}
+	resp.Body.Close()
+	if len(state.Tunnels) != 1 || len(state.Jumpers) != 1 || state.Jumpers[0].Password != "***" {
+		t.Fatalf("state = %+v", state)
+	}
+
+	resp = doRequest(t, http.MethodPost, base+"999/start", testToken)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("start unknown status = %d", resp.StatusCode)
+	}
+
+	// Open the event stream before starting so the status change shows up.
+	events := doRequest(t, http.MethodGet, ts.URL+"/api/v1/events", testToken)
+	defer events.Body.Close()
+	if ct := events.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("events content type = %q", ct)
+	}
+
+	// The jumper is unreachable, so the start is recorded as an error.
+	resp = doRequest(t, http.MethodPost, base+strconv.Itoa(tunnel.ID)+"/start", testToken)
+	var started model.Tunnel
+	if err := json.NewDecoder(resp.Body).Decode(&started); err != nil {
+		t.Fatalf("decode start: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || started.ID != tunnel.ID || started.Status != "error" {
+		t.Fatalf("start = %d %+v", resp.StatusCode, started)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(events.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	deadline := time.After(5 * time.Second)
+	for found := false; !found; {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("event stream ended")
+			}
+			data, isData := strings.CutPrefix(line, "data: ")
+			if !isData {
+				continue
+			}
+			var evt model.TunnelEvent
+			if err := json.Unmarshal([]byte(data), &evt); err != nil {
+				t.Fatalf("decode event %q: %v", data, err)
+			}
+			found = evt.TunnelID == tunnel.ID && evt.Entry.Source == "status" && evt.Entry.Event == "error"
+		case <-deadline:
+			t.Fatal("no status event for the failed start")
+		}
+	}
+
+	resp = doRequest(t, http.MethodPost, base+strconv.Itoa(tunnel.ID)+"/stop", testToken)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stop status = %d", resp.StatusCode)
+	}
+}
+
+func TestAPIJournalQuery(t *testing.T) {
+	ts, tunnel := newTestServer(t)
+	resp := doRequest(t, http.MethodPost, ts.URL+"/api/v1/tunnels/"+strconv.Itoa(tunnel.ID)+"/start", testToken)
+	resp.Body.Close()
+
+	resp = doRequest(t, http.MethodGet, ts.URL+"/api/v1/journal?tunnel="+strconv.Itoa(tunnel.ID)+"&type=error,start", testToken)
+	var entries []model.JournalEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatalf("decode journal: %v", err)
+	}
+	resp.Body.Close()
+	if len(entries) != 1 || entries[0].Type != journal.TypeError || entries[0].Tunnel != "db" {
+		t.Fatalf("journal = %+v", entries)
+	}
+
+	resp = doRequest(t, http.MethodGet, ts.URL+"/api/v1/journal?format=csv", testToken)
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("csv = %v, %v", rows, err)
+	}
+	// Header, the tunnel creation and the failed start.
+	if len(rows) != 3 || rows[0][0] != "time" {
+		t.Fatalf("csv rows = %q", rows)
+	}
+
+	resp = doRequest(t, http.MethodGet, ts.URL+"/api/v1/journal?since=yesterday", testToken)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad since status = %d", resp.StatusCode)
+	}
+}
+
+func TestLoadTokenCreatesAndReuses(t *testing.T) {
+	dir := t.TempDir()
+	token, err := LoadToken(dir)
+	if err != nil || len(token) != 64 {
+		t.Fatalf("LoadToken = %q, %v", token, err)
+	}
+	again, err := LoadToken(dir)
+	if err != nil || again != token {
+		t.Fatalf("second LoadToken = %q, %v", again, err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dir, TokenFileName))
+		if err != nil || info.Mode().Perm() != 0o600 {
+			t.Fatalf("token file mode = %v, %v", info.Mode().Perm(), err)
+		}
+	}
+	fresh, err := RegenerateToken(dir)
+	if err != nil || fresh == token {
+		t.Fatalf("RegenerateToken = %q, %v", fresh, err)
+	}
+}
@@ -0,0 +1,50 @@
+package restapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TokenFileName is the bearer token file kept next to config.toml.
+const TokenFileName = "api-token"
+
+// LoadToken returns the token stored in dir, creating one on first use.
+func LoadToken(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, TokenFileName))
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("read api token: %w", err)
+	}
+	return RegenerateToken(dir)
+}
+
+// RegenerateToken replaces the token stored in dir, invalidating the old one.
+func RegenerateToken(dir string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate api token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("create config dir: %w", err)
+	}
+	path := filepath.Join(dir, TokenFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(token+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("write api token: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("write api token: %w", err)
+	}
+	return token, nil
+}
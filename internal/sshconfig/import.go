@@ -33,12 +33,21 @@ type resolvedAlias struct {
 	user                   string
 	port                   int
 	keyPath                string
+	certificatePath        string
 	agentSocketPath        string
+	forwardAgent           bool
 	bypassHostVerification bool
+	hostKeyPolicy          string
+	knownHostsPath         string
+	hashKnownHosts         bool
 	keepAliveIntervalMs    int
 	timeoutMs              int
 	hostKeyAlgorithms      string
+	ciphers                string
+	keyExchanges           string
+	macs                   string
 	proxyJump              string
+	proxyCommand           string
 	sourcePath             string
 }
 
@@ -108,12 +117,21 @@ func LoadImportCandidates(configPath string) (model.SSHConfigImportResult, error
 			User:                   resolved.user,
 			AuthType:               deriveAuthType(resolved),
 			KeyPath:                resolved.keyPath,
+			CertificatePath:        resolved.certificatePath,
 			AgentSocketPath:        resolved.agentSocketPath,
+			ForwardAgent:           resolved.forwardAgent,
 			BypassHostVerification: resolved.bypassHostVerification,
+			HostKeyPolicy:          resolved.hostKeyPolicy,
+			KnownHostsPath:         resolved.knownHostsPath,
+			HashKnownHosts:         resolved.hashKnownHosts,
 			KeepAliveIntervalMs:    resolved.keepAliveIntervalMs,
 			TimeoutMs:              resolved.timeoutMs,
 			HostKeyAlgorithms:      resolved.hostKeyAlgorithms,
+			Ciphers:                resolved.ciphers,
+			KeyExchanges:           resolved.keyExchanges,
+			MACs:                   resolved.macs,
 			ProxyJump:              resolved.proxyJump,
+			ProxyCommand:           resolved.proxyCommand,
 			SourcePath:             resolved.sourcePath,
 			Warnings:               deriveWarnings(resolved),
 		})
@@ -208,6 +226,14 @@ func (p *parser) parseFile(filePath string) error {
 	return nil
 }
 
+// forwardAgentEnabled reads a ForwardAgent value. Besides yes and no it may
+// name the agent socket to forward, as a path or an environment variable such
+// as $SSH_AUTH_SOCK, which also turns forwarding on.
+func forwardAgentEnabled(value string) bool {
+	value = strings.TrimSpace(value)
+	return value != "" && !strings.EqualFold(value, "no")
+}
+
 func collectExplicitAliases(entries []configEntry) []string {
 	aliases := make([]string, 0)
 	seen := make(map[string]struct{})
@@ -238,6 +264,16 @@ func resolveAlias(alias string, entries []configEntry) resolvedAlias {
 		keepAliveIntervalMs: 5000,
 		timeoutMs:           5000,
 	}
+	// Boolean options that may be false have no unset value to compare
+	// against, so track which ones an earlier block already set.
+	assigned := make(map[string]bool)
+	first := func(key string) bool {
+		if assigned[key] {
+			return false
+		}
+		assigned[key] = true
+		return true
+	}
 
 	for _, entry := range entries {
 		if !entryMatchesAlias(entry, alias) {
@@ -266,16 +302,38 @@ func resolveAlias(alias string, entries []configEntry) resolvedAlias {
 				if out.keyPath == "" && option.value != "" {
 					out.keyPath = option.value
 				}
+			case "certificatefile":
+				if out.certificatePath == "" && option.value != "" {
+					out.certificatePath = option.value
+				}
 			case "identityagent":
 				if out.agentSocketPath == "" && !strings.EqualFold(option.value, "none") {
 					out.agentSocketPath = option.value
 				}
+			case "forwardagent":
+				if first(option.key) {
+					out.forwardAgent = forwardAgentEnabled(option.value)
+				}
 			case "stricthostkeychecking":
 				switch strings.ToLower(option.value) {
 				case "no", "off":
 					out.bypassHostVerification = true
-				case "yes", "ask", "accept-new":
+					out.hostKeyPolicy = ""
+				case "yes", "ask":
 					out.bypassHostVerification = false
+					out.hostKeyPolicy = ""
+				case "accept-new":
+					out.bypassHostVerification = false
+					out.hostKeyPolicy = "accept_new"
+				}
+			case "userknownhostsfile":
+				// Only the first of several files is used; "none" keeps the default.
+				if fields := strings.Fields(option.value); out.knownHostsPath == "" && len(fields) > 0 && !strings.EqualFold(fields[0], "none") {
+					out.knownHostsPath = fields[0]
+				}
+			case "hashknownhosts":
+				if first(option.key) {
+					out.hashKnownHosts = strings.EqualFold(option.value, "yes")
 				}
 			case "serveraliveinterval":
 				if out.keepAliveIntervalMs == 5000 {
@@ -293,10 +351,26 @@ func resolveAlias(alias string, entries []configEntry) resolvedAlias {
 				if out.hostKeyAlgorithms == "" && option.value != "" {
 					out.hostKeyAlgorithms = option.value
 				}
+			case "ciphers":
+				if out.ciphers == "" && option.value != "" {
+					out.ciphers = option.value
+				}
+			case "kexalgorithms":
+				if out.keyExchanges == "" && option.value != "" {
+					out.keyExchanges = option.value
+				}
+			case "macs":
+				if out.macs == "" && option.value != "" {
+					out.macs = option.value
+				}
 			case "proxyjump":
 				if out.proxyJump == "" && !strings.EqualFold(option.value, "none") {
 					out.proxyJump = option.value
 				}
+			case "proxycommand":
+				if out.proxyCommand == "" && !strings.EqualFold(option.value, "none") {
+					out.proxyCommand = option.value
+				}
 			}
 		}
 	}
@@ -102,6 +102,92 @@ Host *.corp
 	}
 }
 
+func TestLoadImportCandidatesProxyCommandAndCertificate(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(configPath, []byte(`
+Host cf-bastion
+  HostName bastion.internal
+  User ops
+  ProxyCommand cloudflared access ssh --hostname %h
+  CertificateFile ~/.ssh/id_ed25519-cert.pub
+  StrictHostKeyChecking accept-new
+  UserKnownHostsFile ~/.ssh/known_hosts_cf ~/.ssh/known_hosts
+  HashKnownHosts yes
+  KexAlgorithms +diffie-hellman-group1-sha1
+  Ciphers -3des-cbc
+  MACs hmac-sha2-256
+
+Host direct
+  HostName direct.example.com
+  ProxyCommand none
+`), 0o644); err != nil {
+		t.Fatalf("write config failed: %v", err)
+	}
+
+	result, err := LoadImportCandidates(configPath)
+	if err != nil {
+		t.Fatalf("LoadImportCandidates failed: %v", err)
+	}
+	if len(result.Candidates) != 2 {
+		t.Fatalf("Candidates len = %d, want 2", len(result.Candidates))
+	}
+	if got := result.Candidates[0].ProxyCommand; got != "cloudflared access ssh --hostname %h" {
+		t.Fatalf("cf-bastion proxyCommand = %q", got)
+	}
+	if got := result.Candidates[0].CertificatePath; got != "~/.ssh/id_ed25519-cert.pub" {
+		t.Fatalf("cf-bastion certificatePath = %q", got)
+	}
+	if got := result.Candidates[0]; got.HostKeyPolicy != "accept_new" || got.KnownHostsPath != "~/.ssh/known_hosts_cf" || !got.HashKnownHosts {
+		t.Fatalf("cf-bastion host key settings = %q, %q, %v", got.HostKeyPolicy, got.KnownHostsPath, got.HashKnownHosts)
+	}
+	if got := result.Candidates[0]; got.KeyExchanges != "+diffie-hellman-group1-sha1" || got.Ciphers != "-3des-cbc" || got.MACs != "hmac-sha2-256" {
+		t.Fatalf("cf-bastion algorithms = %q, %q, %q", got.KeyExchanges, got.Ciphers, got.MACs)
+	}
+	if got := result.Candidates[1].ProxyCommand; got != "" {
+		t.Fatalf("direct proxyCommand = %q, want empty", got)
+	}
+}
+
+func TestLoadImportCandidatesFirstValueWins(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(configPath, []byte(`
+Host bastion
+  HostName bastion.internal
+  ForwardAgent no
+  HashKnownHosts no
+
+Host socket
+  HostName socket.internal
+  ForwardAgent $SSH_AUTH_SOCK
+
+Host path
+  HostName path.internal
+  ForwardAgent ~/.ssh/agent.sock
+
+Host *
+  ForwardAgent yes
+  HashKnownHosts yes
+`), 0o644); err != nil {
+		t.Fatalf("write config failed: %v", err)
+	}
+
+	result, err := LoadImportCandidates(configPath)
+	if err != nil {
+		t.Fatalf("LoadImportCandidates failed: %v", err)
+	}
+	if len(result.Candidates) != 3 {
+		t.Fatalf("Candidates len = %d, want 3", len(result.Candidates))
+	}
+	if got := result.Candidates[0]; got.ForwardAgent || got.HashKnownHosts {
+		t.Fatalf("bastion forwardAgent = %v, hashKnownHosts = %v, want the earlier no", got.ForwardAgent, got.HashKnownHosts)
+	}
+	for _, got := range result.Candidates[1:] {
+		if !got.ForwardAgent || !got.HashKnownHosts {
+			t.Fatalf("%s forwardAgent = %v, hashKnownHosts = %v, want both on", got.Name, got.ForwardAgent, got.HashKnownHosts)
+		}
+	}
+}
+
 func TestLoadImportCandidatesMissingFile(t *testing.T) {
 	_, err := LoadImportCandidates(filepath.Join(t.TempDir(), "missing-config"))
 	if err == nil {
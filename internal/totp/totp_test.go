@@ -0,0 +1,63 @@
+package totp
+
+import (
+	"encoding/base32"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 appendix B (8 digits).
+func TestRFC6238Vectors(t *testing.T) {
+	seeds := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	vectors := []struct {
+		unix int64
+		algo string
+		want string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1234567890, "SHA1", "89005924"},
+		{2000000000, "SHA256", "90698825"},
+		{20000000000, "SHA512", "47863826"},
+	}
+	for _, v := range vectors {
+		secret := base32.StdEncoding.EncodeToString([]byte(seeds[v.algo]))
+		uri := "otpauth://totp/test?digits=8&algorithm=" + v.algo + "&secret=" + url.QueryEscape(secret)
+		g, err := New(uri)
+		if err != nil {
+			t.Fatalf("New(%s): %v", v.algo, err)
+		}
+		if got := g.At(time.Unix(v.unix, 0)); got != v.want {
+			t.Fatalf("%s at %d = %s, want %s", v.algo, v.unix, got, v.want)
+		}
+	}
+}
+
+func TestNewAcceptsPlainBase32(t *testing.T) {
+	// "12345678901234567890" in lower-case, spaced, unpadded base32.
+	g, err := New("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := g.At(time.Unix(59, 0)); got != "287082" {
+		t.Fatalf("code = %s, want 287082", got)
+	}
+}
+
+func TestNewRejectsInvalidSecrets(t *testing.T) {
+	for _, secret := range []string{"", "not base32!", "otpauth://hotp/x?secret=GEZDGNBV", "otpauth://totp/x?secret=GEZDGNBV&algorithm=MD5"} {
+		if err := Validate(secret); !errors.Is(err, ErrInvalidSecret) {
+			t.Fatalf("Validate(%q) = %v, want ErrInvalidSecret", secret, err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package traymenu builds the systray tunnel menu from the config, apart from
+// the systray calls, so the layout and labels can be tested without a tray.
+package traymenu
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/traytext"
+)
+
+// Status marks prefixed to tunnel titles.
+const (
+	MarkRunning = "●"
+	MarkError   = "✕"
+	MarkPaused  = "◐"
+	MarkStopped = "○"
+)
+
+// Item is one tunnel entry; clicking it toggles the tunnel.
+type Item struct {
+	TunnelID int
+	Status   string
+	Title    string
+	Tooltip  string
+}
+
+// Group is a submenu holding the tunnels of one tunnel group.
+type Group struct {
+	ID    int
+	Title string
+	Items []Item
+}
+
+// Menu is the tunnel part of the tray menu and the icon state.
+type Menu struct {
+	// Items lists tunnels at the top level. That is every tunnel when none
+	// is grouped; otherwise ungrouped tunnels get a trailing Groups entry
+	// with ID 0.
+	Items []Item
+	// Groups holds the groups that have tunnels, in config order.
+	Groups []Group
+	// Empty is the disabled placeholder shown when there are no tunnels.
+	Empty string
+
+	Running int
+	Errors  int
+	Tooltip string
+}
+
+// HasError reports whether any tunnel is in error, which swaps the icon.
+func (m Menu) HasError() bool { return m.Errors > 0 }
+
+// Build lays out tunnels under their groups with a status mark each and sums
+// up the running and failed tunnels for the icon tooltip.
+func Build(groups []model.TunnelGroup, tunnels []model.Tunnel, s traytext.Strings) Menu {
+	m := Menu{}
+	known := make(map[int]bool, len(groups))
+	for _, g := range groups {
+		known[g.ID] = true
+	}
+	// Tunnels of unknown groups count as ungrouped, under key 0.
+	byGroup := make(map[int][]Item, len(groups)+1)
+	for _, t := range tunnels {
+		switch t.Status {
+		case "running":
+			m.Running++
+		case "error":
+			m.Errors++
+		}
+		groupID := t.GroupID
+		if !known[groupID] {
+			groupID = 0
+		}
+		byGroup[groupID] = append(byGroup[groupID], buildItem(t, s))
+	}
+
+	for _, g := range groups {
+		if g.ID > 0 && len(byGroup[g.ID]) > 0 {
+			m.Groups = append(m.Groups, buildGroup(g.ID, g.Name, byGroup[g.ID]))
+		}
+	}
+	if ungrouped := byGroup[0]; len(ungrouped) > 0 {
+		if len(m.Groups) == 0 {
+			m.Items = ungrouped
+		} else {
+			m.Groups = append(m.Groups, buildGroup(0, s.Ungrouped, ungrouped))
+		}
+	}
+	if len(tunnels) == 0 {
+		m.Empty = s.NoTunnels
+	}
+
+	m.Tooltip = s.IconTooltip
+	if len(tunnels) > 0 {
+		summary := fmt.Sprintf(s.Running, m.Running)
+		if m.Errors > 0 {
+			summary += " / " + fmt.Sprintf(s.Errors, m.Errors)
+		}
+		m.Tooltip += "\n" + summary
+	}
+	return m
+}
+
+// Shape identifies the menu structure. Menus with the same shape differ only
+// in titles and tooltips, so the tray can relabel its items in place instead
+// of rebuilding them.
+func (m Menu) Shape() string {
+	var b strings.Builder
+	for _, item := range m.Items {
+		b.WriteString(strconv.Itoa(item.TunnelID))
+		b.WriteByte(',')
+	}
+	for _, g := range m.Groups {
+		b.WriteString("g")
+		b.WriteString(strconv.Itoa(g.ID))
+		b.WriteByte(':')
+		for _, item := range g.Items {
+			b.WriteString(strconv.Itoa(item.TunnelID))
+			b.WriteByte(',')
+		}
+	}
+	if m.Empty != "" {
+		b.WriteString("empty")
+	}
+	return b.String()
+}
+
+func buildItem(t model.Tunnel, s traytext.Strings) Item {
+	item := Item{TunnelID: t.ID, Status: t.Status, Tooltip: s.StartTooltip}
+	mark := MarkStopped
+	switch t.Status {
+	case "running":
+		mark = MarkRunning
+		item.Tooltip = s.StopTooltip
+	case "paused":
+		// A paused tunnel waits on a dependency; toggling it stops it.
+		mark = MarkPaused
+		item.Tooltip = s.StopTooltip
+	case "error":
+		mark = MarkError
+		if msg := strings.TrimSpace(t.LastError); msg != "" {
+			item.Tooltip = msg
+		}
+	}
+	name := strings.TrimSpace(t.Name)
+	if name == "" {
+		name = "#" + strconv.Itoa(t.ID)
+	}
+	item.Title = mark + " " + name
+	return item
+}
+
+// buildGroup titles a group with how many of its tunnels are running.
+func buildGroup(id int, name string, items []Item) Group {
+	running := 0
+	for _, item := range items {
+		if item.Status == "running" {
+			running++
+		}
+	}
+	return Group{
+		ID:    id,
+		Title: fmt.Sprintf("%s (%d/%d)", strings.TrimSpace(name), running, len(items)),
+		Items: items,
+	}
+}
@@ -0,0 +1,88 @@
+package traymenu
+
+import (
+	"testing"
+
+	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/traytext"
+)
+
+func TestBuildGroupsTunnels(t *testing.T) {
+	s := traytext.ForLocale("en")
+	groups := []model.TunnelGroup{{ID: 1, Name: "prod"}, {ID: 2, Name: "empty"}, {ID: 3, Name: "dev"}}
+	tunnels := []model.Tunnel{
+		{ID: 10, Name: "db", GroupID: 1, Status: "running"},
+		{ID: 11, Name: "cache", GroupID: 1, Status: "error", LastError: "dial tcp: refused"},
+		{ID: 12, Name: "api", GroupID: 3, Status: "paused"},
+		{ID: 13, Name: "lost", GroupID: 99, Status: "stopped"},
+		{ID: 14, Name: "  ", Status: "running"},
+	}
+
+	m := Build(groups, tunnels, s)
+	if len(m.Items) != 0 || len(m.Groups) != 3 {
+		t.Fatalf("items = %+v, groups = %+v", m.Items, m.Groups)
+	}
+	prod, dev, ungrouped := m.Groups[0], m.Groups[1], m.Groups[2]
+	if prod.Title != "prod (1/2)" || dev.Title != "dev (0/1)" || ungrouped.ID != 0 || ungrouped.Title != "Ungrouped (1/2)" {
+		t.Fatalf("group titles = %q, %q, %q", prod.Title, dev.Title, ungrouped.Title)
+	}
+	if got := prod.Items[0]; got.Title != MarkRunning+" db" || got.Tooltip != s.StopTooltip {
+		t.Fatalf("running item = %+v", got)
+	}
+	if got := prod.Items[1]; got.Title != MarkError+" cache" || got.Tooltip != "dial tcp: refused" {
+		t.Fatalf("error item = %+v", got)
+	}
+	if got := dev.Items[0]; got.Title != MarkPaused+" api" || got.Tooltip != s.StopTooltip {
+		t.Fatalf("paused item = %+v", got)
+	}
+	if got := ungrouped.Items[0]; got.Title != MarkStopped+" lost" || got.Tooltip != s.StartTooltip {
+		t.Fatalf("stopped item = %+v", got)
+	}
+	if got := ungrouped.Items[1].Title; got != MarkRunning+" #14" {
+		t.Fatalf("unnamed item title = %q", got)
+	}
+
+	if m.Running != 2 || m.Errors != 1 || !m.HasError() {
+		t.Fatalf("running = %d, errors = %d", m.Running, m.Errors)
+	}
+	if want := "Loris Tunnel\n2 running / 1 error"; m.Tooltip != want {
+		t.Fatalf("tooltip = %q, want %q", m.Tooltip, want)
+	}
+}
+
+func TestBuildWithoutGroups(t *testing.T) {
+	s := traytext.ForLocale("en")
+	m := Build(nil, []model.Tunnel{{ID: 1, Name: "db", GroupID: 5, Status: "running"}}, s)
+	if len(m.Groups) != 0 || len(m.Items) != 1 || m.Items[0].Title != MarkRunning+" db" {
+		t.Fatalf("menu = %+v", m)
+	}
+	if m.HasError() || m.Tooltip != "Loris Tunnel\n1 running" {
+		t.Fatalf("tooltip = %q, has error = %v", m.Tooltip, m.HasError())
+	}
+
+	empty := Build(nil, nil, s)
+	if empty.Empty != s.NoTunnels || empty.Tooltip != s.IconTooltip {
+		t.Fatalf("empty menu = %+v", empty)
+	}
+}
+
+func TestShapeIgnoresStatus(t *testing.T) {
+	s := traytext.ForLocale("en")
+	groups := []model.TunnelGroup{{ID: 1, Name: "prod"}}
+	tunnels := []model.Tunnel{
+		{ID: 1, Name: "db", GroupID: 1, Status: "stopped"},
+		{ID: 2, Name: "api", Status: "stopped"},
+	}
+	before := Build(groups, tunnels, s).Shape()
+
+	tunnels[0].Status = "error"
+	tunnels[1].Name = "api-v2"
+	if after := Build(groups, tunnels, s).Shape(); after != before {
+		t.Fatalf("status and name changes altered the shape: %q -> %q", before, after)
+	}
+
+	tunnels[1].GroupID = 1
+	if after := Build(groups, tunnels, s).Shape(); after == before {
+		t.Fatalf("moving a tunnel kept the shape %q", after)
+	}
+}
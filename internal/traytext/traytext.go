@@ -17,6 +17,14 @@ type Strings struct {
 	QuitTooltip     string `json:"quitTooltip"`
 	IconTooltip     string `json:"iconTooltip"`
 	AppTitle        string `json:"appTitle"`
+	NoTunnels       string `json:"noTunnels"`
+	Ungrouped       string `json:"ungrouped"`
+	StartTooltip    string `json:"startTooltip"`
+	StopTooltip     string `json:"stopTooltip"`
+	// Running and Errors are fmt formats taking a count, joined into the
+	// icon tooltip as "3 running / 1 error".
+	Running string `json:"running"`
+	Errors  string `json:"errors"`
 }
 
 var (
@@ -48,6 +56,12 @@ func fallbackEnglish() Strings {
 		QuitTooltip:     "Quit the application",
 		IconTooltip:     "Loris Tunnel",
 		AppTitle:        "Loris Tunnel",
+		NoTunnels:       "No tunnels",
+		Ungrouped:       "Ungrouped",
+		StartTooltip:    "Click to start this tunnel",
+		StopTooltip:     "Click to stop this tunnel",
+		Running:         "%d running",
+		Errors:          "%d error",
 	}
 }
 
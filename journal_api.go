@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"loris-tunnel/internal/journal"
+	"loris-tunnel/internal/model"
+
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// attachJournal hands the event journal to the current biz objects; call it
+// whenever they are recreated.
+func (a *App) attachJournal() {
+	a.jumper.SetJournal(a.journal)
+	a.group.SetJournal(a.journal)
+	a.profile.SetJournal(a.journal)
+	a.tunnel.SetJournal(a.journal)
+	a.notification.SetJournal(a.journal)
+}
+
+// QueryJournal returns the journal entries matching query, oldest first.
+func (a *App) QueryJournal(query model.JournalQuery) ([]model.JournalEntry, error) {
+	if err := a.ensureReady(); err != nil {
+		return nil, err
+	}
+	return a.journal.Query(query)
+}
+
+// ExportJournalWithDialog asks where to save the entries matching query and
+// writes them as JSON or CSV. An empty path means the user cancelled.
+func (a *App) ExportJournalWithDialog(query model.JournalQuery, format string) (string, error) {
+	if err := a.ensureReady(); err != nil {
+		return "", err
+	}
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != journal.FormatJSON && format != journal.FormatCSV {
+		return "", journal.ErrUnsupportedFormat
+	}
+	entries, err := a.journal.Query(query)
+	if err != nil {
+		return "", err
+	}
+
+	filter := wailsruntime.FileFilter{DisplayName: "JSON (*.json)", Pattern: "*.json"}
+	if format == journal.FormatCSV {
+		filter = wailsruntime.FileFilter{DisplayName: "CSV (*.csv)", Pattern: "*.csv"}
+	}
+	destPath, err := wailsruntime.SaveFileDialog(a.ctx, wailsruntime.SaveDialogOptions{
+		DefaultFilename: "loris-tunnel-events-" + time.Now().Format("20060102-150405") + "." + format,
+		Filters:         []wailsruntime.FileFilter{filter},
+	})
+	if err != nil {
+		return "", fmt.Errorf("file dialog: %w", err)
+	}
+	destPath = strings.TrimSpace(destPath)
+	if destPath == "" {
+		return "", nil // user cancelled
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
+		return "", fmt.Errorf("create destination directory: %w", err)
+	}
+	dst, err := os.Create(destPath)
+	if err != nil {
+		return "", fmt.Errorf("create destination file: %w", err)
+	}
+	if err := journal.Export(dst, entries, format); err != nil {
+		_ = dst.Close()
+		return "", fmt.Errorf("write events: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("write events: %w", err)
+	}
+	return destPath, nil
+}
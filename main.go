@@ -12,7 +12,6 @@ import (
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
 	"github.com/wailsapp/wails/v2/pkg/options/windows"
 	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
-	"loris-tunnel/internal/traytext"
 	"loris-tunnel/internal/uilocale"
 )
 
@@ -32,6 +31,12 @@ var trayIconMacOS []byte
 //go:embed build/appicon.png
 var trayIconFallback []byte
 
+//go:embed build/windows/tray-error.ico
+var trayErrorIconWindows []byte
+
+//go:embed build/tray-error.png
+var trayErrorIcon []byte
+
 func main() {
 	// Create an instance of the app structure
 	app := NewApp()
@@ -40,7 +45,6 @@ func main() {
 		configDir = filepath.Dir(app.storage.Path())
 	}
 	localeTag := uilocale.Resolve(configDir)
-	trayLabels := traytext.ForLocale(localeTag)
 
 	showMainWindow := func() {
 		if app == nil || app.ctx == nil {
@@ -51,46 +55,18 @@ func main() {
 		wailsruntime.WindowUnminimise(app.ctx)
 	}
 
-	startTray, endTray := systray.RunWithExternalLoop(func() {
-		iconBytes := trayIconFallback
-		switch runtime.GOOS {
-		case "windows":
-			if len(trayIconWindows) > 0 {
-				iconBytes = trayIconWindows
-			}
-			if len(iconBytes) > 0 {
-				systray.SetIcon(iconBytes)
-			}
-		case "darwin":
-			if len(trayIconMacOS) > 0 {
-				iconBytes = trayIconMacOS
-			}
-			// macOS menu bar icon prefers template icons.
-			if len(iconBytes) > 0 {
-				systray.SetTemplateIcon(iconBytes, iconBytes)
-			}
-		default:
-			if len(iconBytes) > 0 {
-				systray.SetIcon(iconBytes)
-			}
-		}
-		if runtime.GOOS != "darwin" {
-			systray.SetTitle(trayLabels.AppTitle)
+	quitApp := func() {
+		if app != nil && app.ctx != nil {
+			app.PrepareForQuit()
+			wailsruntime.Quit(app.ctx)
+			return
 		}
-		systray.SetTooltip(trayLabels.IconTooltip)
-
-		showWinItem := systray.AddMenuItem(trayLabels.ShowMainTitle, trayLabels.ShowMainTooltip)
-		showWinItem.Click(showMainWindow)
-		quitMenu := systray.AddMenuItem(trayLabels.QuitTitle, trayLabels.QuitTooltip)
-		quitMenu.Click(func() {
-			if app != nil && app.ctx != nil {
-				app.PrepareForQuit()
-				wailsruntime.Quit(app.ctx)
-				return
-			}
-			// Fallback for edge cases where Wails context isn't ready yet.
-			os.Exit(0)
-		})
+		// Fallback for edge cases where Wails context isn't ready yet.
+		os.Exit(0)
+	}
+
+	startTray, endTray := systray.RunWithExternalLoop(func() {
+		app.setupTray(localeTag, platformTrayIcons(), showMainWindow, quitApp)
 
 		// 点击图标弹出菜单（与 energye/systray 示例一致）。
 		// macOS：CreateMenu 把菜单挂到 NSStatusItem，系统负责左键出菜单（在 Wails 下比 SetOnClick 可靠）。
@@ -107,8 +83,6 @@ func main() {
 			systray.SetOnClick(popupTrayMenu)
 			systray.SetOnRClick(popupTrayMenu)
 		}
-
-		app.SetTrayMenuItems(showWinItem, quitMenu)
 	}, func() {})
 	startTray()
 	defer endTray()
@@ -154,6 +128,29 @@ func main() {
 	systray.Quit()
 }
 
+// platformTrayIcons picks the tray images for this platform. The error icon
+// is a regular image on macOS too, so its badge keeps its colour.
+func platformTrayIcons() trayIcons {
+	switch runtime.GOOS {
+	case "windows":
+		return trayIcons{normal: firstIcon(trayIconWindows, trayIconFallback), failed: trayErrorIconWindows}
+	case "darwin":
+		// macOS menu bar icon prefers template icons.
+		return trayIcons{normal: firstIcon(trayIconMacOS, trayIconFallback), failed: trayErrorIcon, template: true}
+	default:
+		return trayIcons{normal: trayIconFallback, failed: trayErrorIcon}
+	}
+}
+
+func firstIcon(icons ...[]byte) []byte {
+	for _, icon := range icons {
+		if len(icon) > 0 {
+			return icon
+		}
+	}
+	return nil
+}
+
 func webviewUserDataPath() string {
 	if runtime.GOOS != "windows" {
 		return ""
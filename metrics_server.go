@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"loris-tunnel/internal/conf"
+	"loris-tunnel/internal/metrics"
+	"loris-tunnel/internal/model"
+)
+
+// GetMetricsSettings returns the Prometheus metrics endpoint settings.
+func (a *App) GetMetricsSettings() (model.MetricsSettings, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.MetricsSettings{}, err
+	}
+	cfg, err := a.storage.Load()
+	if err != nil {
+		return model.MetricsSettings{}, err
+	}
+
+	a.metricsMu.Lock()
+	defer a.metricsMu.Unlock()
+	settings := model.MetricsSettings{
+		Enabled: cfg.MetricsEnabled,
+		Port:    metricsPort(cfg),
+		Error:   a.metricsErr,
+	}
+	if a.metrics != nil {
+		settings.Address = a.metrics.Addr()
+	}
+	return settings, nil
+}
+
+// SetMetricsSettings turns the metrics endpoint on or off and moves it to
+// port (0 keeps the default).
+func (a *App) SetMetricsSettings(enabled bool, port int) (model.MetricsSettings, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.MetricsSettings{}, err
+	}
+	if port < 0 || port > 65535 {
+		return model.MetricsSettings{}, fmt.Errorf("port must be between 1 and 65535")
+	}
+	_, err := a.storage.Update(func(cfg *conf.Config) error {
+		cfg.MetricsEnabled = enabled
+		cfg.MetricsPort = port
+		return nil
+	})
+	if err != nil {
+		return model.MetricsSettings{}, err
+	}
+	a.syncMetricsServer()
+	return a.GetMetricsSettings()
+}
+
+// syncMetricsServer starts, restarts or stops the metrics endpoint to match
+// the config.
+func (a *App) syncMetricsServer() {
+	cfg, err := a.storage.Load()
+	if err != nil {
+		return
+	}
+	a.metricsMu.Lock()
+	defer a.metricsMu.Unlock()
+	if a.metrics != nil {
+		_ = a.metrics.Close()
+		a.metrics = nil
+	}
+	a.metricsErr = ""
+	if !cfg.MetricsEnabled {
+		return
+	}
+
+	server := metrics.New(metrics.Source{
+		Tunnels: func() ([]model.TunnelMetrics, error) { return a.tunnel.Metrics() },
+		Jumpers: func() ([]model.JumperMetrics, error) { return a.jumper.Metrics() },
+	})
+	if err := server.Start(metricsPort(cfg)); err != nil {
+		a.metricsErr = err.Error()
+		slog.Error("metrics server start failed", "err", err)
+		return
+	}
+	a.metrics = server
+}
+
+func (a *App) stopMetricsServer() {
+	a.metricsMu.Lock()
+	defer a.metricsMu.Unlock()
+	if a.metrics != nil {
+		_ = a.metrics.Close()
+		a.metrics = nil
+	}
+}
+
+func metricsPort(cfg *conf.Config) int {
+	if cfg.MetricsPort > 0 {
+		return cfg.MetricsPort
+	}
+	return metrics.DefaultPort
+}
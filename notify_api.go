@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"loris-tunnel/internal/biz"
+	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/notify"
+)
+
+const (
+	// notificationTestTimeout bounds a test send; a command sink may take
+	// up to its own timeout.
+	notificationTestTimeout = 40 * time.Second
+
+	// notifierEventBuffer is how far the notifier may fall behind the
+	// tunnels before it misses state changes, as when every tunnel drops
+	// at once on a network change.
+	notifierEventBuffer = 4096
+)
+
+func (a *App) ListNotificationSinks() ([]model.NotificationSink, error) {
+	if err := a.ensureReady(); err != nil {
+		return nil, err
+	}
+	return a.notification.List()
+}
+
+func (a *App) CreateNotificationSink(payload model.NotificationSinkPayload) (model.NotificationSink, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.NotificationSink{}, err
+	}
+	return a.notification.Create(payload)
+}
+
+func (a *App) UpdateNotificationSink(id int, payload model.NotificationSinkPayload) (model.NotificationSink, error) {
+	if err := a.ensureReady(); err != nil {
+		return model.NotificationSink{}, err
+	}
+	return a.notification.Update(id, payload)
+}
+
+func (a *App) DeleteNotificationSink(id int) error {
+	if err := a.ensureReady(); err != nil {
+		return err
+	}
+	return a.notification.Delete(id)
+}
+
+// TestNotificationSink sends a sample notification through payload as
+// entered in the form, without saving it.
+func (a *App) TestNotificationSink(payload model.NotificationSinkPayload) error {
+	if err := a.ensureReady(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTestTimeout)
+	defer cancel()
+	return a.notification.Test(ctx, payload)
+}
+
+// startNotifier subscribes a notifier to the current tunnel biz; call it
+// whenever the biz objects are recreated. The notifier rereads its sinks and
+// tunnel names when either changes on the bus.
+func (a *App) startNotifier() {
+	a.notifyMu.Lock()
+	defer a.notifyMu.Unlock()
+	if a.notifier != nil {
+		return
+	}
+	notifier := notify.New(a.notification.Source())
+	events, cancelEvents := a.tunnel.Subscribe(notifierEventBuffer)
+	changes, cancelChanges := a.bus.Subscribe(64)
+	a.notifier = notifier
+	a.notifyCancel = func() {
+		cancelChanges()
+		cancelEvents()
+	}
+	go notifier.Run(events)
+	go func() {
+		for evt := range changes {
+			if evt.Kind == biz.BusConfig && (evt.Config.Kind == "notification" || evt.Config.Kind == "tunnel") {
+				notifier.Refresh()
+			}
+		}
+	}()
+}
+
+// stopNotifier detaches the notifier before tunnels are shut down, so
+// quitting or importing a config does not report every tunnel as stopped.
+func (a *App) stopNotifier() {
+	a.notifyMu.Lock()
+	defer a.notifyMu.Unlock()
+	if a.notifier == nil {
+		return
+	}
+	a.notifyCancel()
+	a.notifier.Close()
+	a.notifier, a.notifyCancel = nil, nil
+}
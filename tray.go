@@ -0,0 +1,202 @@
+package main
+
+import (
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/energye/systray"
+
+	"loris-tunnel/internal/biz"
+	"loris-tunnel/internal/model"
+	"loris-tunnel/internal/traymenu"
+	"loris-tunnel/internal/traytext"
+)
+
+// trayRefreshDelay batches bursts of status changes, such as a profile
+// switch, into one menu update.
+const trayRefreshDelay = 200 * time.Millisecond
+
+// trayIcons are the tray images for the current platform. failed replaces
+// normal while any tunnel is in error.
+type trayIcons struct {
+	normal []byte
+	failed []byte
+	// template marks normal as a macOS template image.
+	template bool
+}
+
+// setupTray builds the tray menu. main calls it from the systray ready
+// callback with the actions of the fixed "show" and "quit" entries.
+func (a *App) setupTray(locale string, icons trayIcons, onShow, onQuit func()) {
+	a.trayMu.Lock()
+	defer a.trayMu.Unlock()
+	a.trayLocale = locale
+	a.trayIcons = icons
+	a.trayOnShow = onShow
+	a.trayOnQuit = onQuit
+	a.setTrayIconUnlocked(false)
+	a.refreshTrayUnlocked()
+}
+
+// startTrayUpdates refreshes the tray menu as tunnels change state or the
+// config changes, until shutdown.
+func (a *App) startTrayUpdates() {
+	events, cancel := a.bus.Subscribe(64)
+	a.trayCancel = cancel
+	go func() {
+		timer := time.NewTimer(trayRefreshDelay)
+		timer.Stop()
+		for {
+			select {
+			case evt, ok := <-events:
+				if !ok {
+					timer.Stop()
+					return
+				}
+				if evt.Kind == biz.BusTunnelStatus || evt.Kind == biz.BusConfig {
+					timer.Reset(trayRefreshDelay)
+				}
+			case <-timer.C:
+				a.refreshTray()
+			}
+		}
+	}()
+}
+
+func (a *App) refreshTray() {
+	a.trayMu.Lock()
+	defer a.trayMu.Unlock()
+	a.refreshTrayUnlocked()
+}
+
+// refreshTrayUnlocked brings the tray in line with the config. The menu is
+// rebuilt only when tunnels were added, removed or moved; status changes
+// relabel the existing items.
+func (a *App) refreshTrayUnlocked() {
+	if a.trayOnShow == nil {
+		// The tray is not set up yet.
+		return
+	}
+	s := traytext.ForLocale(a.trayLocale)
+	groups, tunnels := a.trayState()
+	menu := traymenu.Build(groups, tunnels, s)
+
+	if runtime.GOOS != "darwin" {
+		systray.SetTitle(s.AppTitle)
+	}
+	systray.SetTooltip(menu.Tooltip)
+	if menu.HasError() != a.trayFailed {
+		a.setTrayIconUnlocked(menu.HasError())
+	}
+
+	if shape := menu.Shape(); shape != a.trayShape || a.trayShow == nil {
+		a.rebuildTrayUnlocked(menu)
+		a.trayShape = shape
+	} else {
+		a.relabelTrayUnlocked(menu)
+	}
+	a.trayShow.SetTitle(s.ShowMainTitle)
+	a.trayShow.SetTooltip(s.ShowMainTooltip)
+	a.trayQuit.SetTitle(s.QuitTitle)
+	a.trayQuit.SetTooltip(s.QuitTooltip)
+}
+
+// trayState reads the groups and tunnels to list. Failures leave the list
+// empty rather than keeping a stale one.
+func (a *App) trayState() ([]model.TunnelGroup, []model.Tunnel) {
+	if a.ensureReady() != nil {
+		return nil, nil
+	}
+	groups, err := a.group.List()
+	if err != nil {
+		slog.Warn("tray: list groups failed", "err", err)
+		return nil, nil
+	}
+	tunnels, err := a.tunnel.List()
+	if err != nil {
+		slog.Warn("tray: list tunnels failed", "err", err)
+		return nil, nil
+	}
+	return groups, tunnels
+}
+
+func (a *App) rebuildTrayUnlocked(menu traymenu.Menu) {
+	systray.ResetMenu()
+	a.trayTunnels = make(map[int]*systray.MenuItem)
+	a.trayGroups = a.trayGroups[:0]
+	a.trayEmpty = nil
+
+	if menu.Empty != "" {
+		a.trayEmpty = systray.AddMenuItem(menu.Empty, "")
+		a.trayEmpty.Disable()
+	}
+	for _, item := range menu.Items {
+		a.addTrayTunnel(systray.AddMenuItem(item.Title, item.Tooltip), item.TunnelID)
+	}
+	for _, group := range menu.Groups {
+		parent := systray.AddMenuItem(group.Title, "")
+		a.trayGroups = append(a.trayGroups, parent)
+		for _, item := range group.Items {
+			a.addTrayTunnel(parent.AddSubMenuItem(item.Title, item.Tooltip), item.TunnelID)
+		}
+	}
+	systray.AddSeparator()
+
+	a.trayShow = systray.AddMenuItem("", "")
+	a.trayShow.Click(a.trayOnShow)
+	a.trayQuit = systray.AddMenuItem("", "")
+	a.trayQuit.Click(a.trayOnQuit)
+}
+
+func (a *App) addTrayTunnel(entry *systray.MenuItem, id int) {
+	entry.Click(func() {
+		// Starting a tunnel dials SSH; keep the tray responsive meanwhile.
+		go a.toggleTunnelFromTray(id)
+	})
+	a.trayTunnels[id] = entry
+}
+
+func (a *App) relabelTrayUnlocked(menu traymenu.Menu) {
+	relabel := func(item traymenu.Item) {
+		if entry := a.trayTunnels[item.TunnelID]; entry != nil {
+			entry.SetTitle(item.Title)
+			entry.SetTooltip(item.Tooltip)
+		}
+	}
+	for _, item := range menu.Items {
+		relabel(item)
+	}
+	for i, group := range menu.Groups {
+		if i < len(a.trayGroups) {
+			a.trayGroups[i].SetTitle(group.Title)
+		}
+		for _, item := range group.Items {
+			relabel(item)
+		}
+	}
+	if a.trayEmpty != nil {
+		a.trayEmpty.SetTitle(menu.Empty)
+	}
+}
+
+func (a *App) setTrayIconUnlocked(failed bool) {
+	a.trayFailed = failed
+	icons := a.trayIcons
+	switch {
+	case failed && len(icons.failed) > 0:
+		systray.SetIcon(icons.failed)
+	case len(icons.normal) == 0:
+		// Nothing embedded; keep whatever the platform shows.
+	case icons.template:
+		systray.SetTemplateIcon(icons.normal, icons.normal)
+	default:
+		systray.SetIcon(icons.normal)
+	}
+}
+
+func (a *App) toggleTunnelFromTray(id int) {
+	if _, err := a.ToggleTunnel(id); err != nil {
+		slog.Warn("tray: toggle tunnel failed", "tunnel_id", id, "err", err)
+	}
+}